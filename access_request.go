@@ -0,0 +1,124 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// accessRequestResource is the DNSAccessRequest custom resource, which a tenant
+// creates in one of its namespaces to ask for access to a service of another
+// tenant.
+var accessRequestResource = schema.GroupVersionResource{
+	Group:    "dns.capsule.clastix.io",
+	Version:  "v1alpha1",
+	Resource: "dnsaccessrequests",
+}
+
+const (
+	// AccessRequestTargetIndex indexes DNSAccessRequests by the service they
+	// request access to.
+	AccessRequestTargetIndex = "target"
+	// ApprovedRequestsAnnotation on a service lists the DNSAccessRequests its
+	// owner approved, as namespace/name separated by commas.
+	ApprovedRequestsAnnotation = "capsule.clastix.io/dns-approved-requests"
+	// accessRequestApproved is the condition a cluster admin sets to approve
+	// a DNSAccessRequest through its status.
+	accessRequestApproved = "Approved"
+)
+
+// dnsAccessRequest is the part of a DNSAccessRequest the controller keeps.
+type dnsAccessRequest struct {
+	metav1.ObjectMeta
+
+	service serviceRef
+	// approved reports whether the Approved condition holds for the current
+	// spec, a spec change after the approval voids it.
+	approved bool
+}
+
+// slimAccessRequest converts the unstructured DNSAccessRequests of the dynamic
+// informer.
+func slimAccessRequest(obj any) (any, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return obj, nil
+	}
+
+	r := &dnsAccessRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            u.GetName(),
+			Namespace:       u.GetNamespace(),
+			UID:             u.GetUID(),
+			ResourceVersion: u.GetResourceVersion(),
+			Generation:      u.GetGeneration(),
+		},
+	}
+
+	r.service.namespace, _, _ = unstructured.NestedString(u.Object, "spec", "service", "namespace")
+	r.service.name, _, _ = unstructured.NestedString(u.Object, "spec", "service", "name")
+
+	conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]any)
+		if !ok || condition["type"] != accessRequestApproved {
+			continue
+		}
+
+		observed, _, _ := unstructured.NestedInt64(condition, "observedGeneration")
+		r.approved = condition["status"] == string(metav1.ConditionTrue) && observed == r.Generation
+	}
+
+	return r, nil
+}
+
+// accessRequestTarget indexes a DNSAccessRequest by namespace/name of the
+// service it requests access to.
+func accessRequestTarget(obj any) ([]string, error) {
+	r, ok := obj.(*dnsAccessRequest)
+	if !ok || r.service.name == "" {
+		return []string{}, nil
+	}
+
+	return []string{r.service.namespace + "/" + r.service.name}, nil
+}
+
+// accessRequestAllows reports whether a DNSAccessRequest of namespace nsFrom
+// for obj was approved, either through its Approved condition or by the
+// service listing it in ApprovedRequestsAnnotation.
+func (c *dnsController) accessRequestAllows(nsFrom *v1.Namespace, obj any) bool {
+	svc, ok := obj.(*v1.Service)
+	if !ok {
+		return false
+	}
+
+	requests, err := c.accessInformer.GetIndexer().ByIndex(AccessRequestTargetIndex, svc.Namespace+"/"+svc.Name)
+	if err != nil {
+		return false
+	}
+
+	approved := strings.FieldsFunc(svc.Annotations[ApprovedRequestsAnnotation], func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
+	for _, obj := range requests {
+		r, ok := obj.(*dnsAccessRequest)
+		if !ok || r.Namespace != nsFrom.Name {
+			continue
+		}
+
+		if r.approved || slices.Contains(approved, r.Namespace+"/"+r.Name) {
+			return true
+		}
+	}
+
+	return false
+}
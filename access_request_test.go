@@ -0,0 +1,101 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newAccessRequest(namespace, name, targetNamespace, targetName string, generation int64, approvedGeneration int64) *unstructured.Unstructured {
+	r := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "dns.capsule.clastix.io/v1alpha1",
+		"kind":       "DNSAccessRequest",
+		"metadata": map[string]any{
+			"name":       name,
+			"namespace":  namespace,
+			"generation": generation,
+		},
+		"spec": map[string]any{
+			"service": map[string]any{"namespace": targetNamespace, "name": targetName},
+			"reason":  "migration",
+		},
+	}}
+
+	if approvedGeneration > 0 {
+		r.Object["status"] = map[string]any{
+			"conditions": []any{map[string]any{
+				"type":               accessRequestApproved,
+				"status":             "True",
+				"observedGeneration": approvedGeneration,
+			}},
+		}
+	}
+
+	return r
+}
+
+func TestEvaluateAccessRequest(t *testing.T) {
+	cl := newCluster(4, 1, 1)
+	cl.services[1].Annotations = map[string]string{ApprovedRequestsAnnotation: "tenant-0/by-owner, tenant-3/other"}
+
+	requests := []runtime.Object{
+		// Approved by the owner of the service.
+		newAccessRequest("tenant-0", "by-owner", "tenant-1", "svc-0", 1, 0),
+		// Approved by a cluster admin, then pointed elsewhere.
+		newAccessRequest("tenant-0", "by-admin", "tenant-2", "svc-0", 1, 1),
+		newAccessRequest("tenant-0", "changed", "tenant-3", "svc-0", 2, 1),
+		// Pending, and approved for another namespace.
+		newAccessRequest("tenant-2", "pending", "tenant-0", "svc-0", 1, 0),
+		newAccessRequest("tenant-0", "other", "tenant-1", "svc-0", 1, 0),
+	}
+
+	set, err := newInformerSet(fake.NewClientset(cl.objects()...), apiConfig{})
+	if err != nil {
+		t.Fatalf("failed to create informers: %v", err)
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{accessRequestResource: "DNSAccessRequestList"}, requests...)
+	set.dynamic = dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
+
+	ctrl, err := newDNSControllerForSet(set, dnsControllerOptions{accessRequests: true})
+	if err != nil {
+		t.Fatalf("failed to create DNS controller: %v", err)
+	}
+
+	go ctrl.Start()
+	t.Cleanup(ctrl.Stop)
+
+	waitForSync(t, ctrl)
+
+	tests := []struct {
+		name    string
+		src     int
+		dst     int
+		allowed bool
+		reason  string
+	}{
+		{name: "approved by the service owner", src: 0, dst: 1, allowed: true, reason: reasonAccessRequest},
+		{name: "approved by an admin", src: 0, dst: 2, allowed: true, reason: reasonAccessRequest},
+		{name: "changed after approval", src: 0, dst: 3, reason: reasonCrossTenant},
+		{name: "pending", src: 2, dst: 0, reason: reasonCrossTenant},
+		{name: "approved for another namespace", src: 3, dst: 1, reason: reasonCrossTenant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := ctrl.Evaluate(t.Context(), cl.pods[tt.src].Status.PodIPs[0].IP, cl.services[tt.dst].Spec.ClusterIP, Capsule{})
+			if d.allowed != tt.allowed || d.reason != tt.reason {
+				t.Errorf("got allowed=%t reason=%s, want allowed=%t reason=%s", d.allowed, d.reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const adminShutdownTimeout = 5 * time.Second
+
+// adminServer exposes maintenance endpoints. Every request must carry the
+// bearer token read from the configured file.
+type adminServer struct {
+	addr      string
+	tokenFile string
+	token     []byte
+	capsule   *Capsule
+	server    *http.Server
+}
+
+func newAdminServer(h *Capsule, addr, tokenFile string) *adminServer {
+	return &adminServer{
+		addr:      addr,
+		tokenFile: tokenFile,
+		capsule:   h,
+	}
+}
+
+func (a *adminServer) Start() error {
+	token, err := os.ReadFile(a.tokenFile)
+	if err != nil {
+		return err
+	}
+
+	a.token = []byte(strings.TrimSpace(string(token)))
+	if len(a.token) == 0 {
+		return errors.New("admin token file is empty")
+	}
+
+	ln, err := net.Listen("tcp", a.addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/flush", a.authenticated(a.flush))
+	mux.HandleFunc("/snapshot", a.authenticated(a.snapshot))
+	mux.HandleFunc("/top-names", a.authenticated(a.topNames))
+	mux.HandleFunc("/recent-blocked", a.authenticated(a.recentBlocked))
+	mux.HandleFunc("/log-level", a.authenticated(a.logLevel))
+
+	a.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		if err := a.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("admin server stopped: %v", err)
+		}
+	}()
+
+	log.Infof("admin endpoint listening on %s", ln.Addr())
+
+	return nil
+}
+
+func (a *adminServer) Stop() error {
+	if a.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+	defer cancel()
+
+	server := a.server
+	a.server = nil
+
+	return server.Shutdown(ctx)
+}
+
+func (a *adminServer) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), a.token) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// flush empties the decision and search caches. With ?scope=negative only the
+// entries for unattributed IPs and names that didn't resolve are dropped.
+func (a *adminServer) flush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	scope := r.URL.Query().Get("scope")
+	if scope != "" && scope != "all" && scope != "negative" {
+		http.Error(w, "invalid scope", http.StatusBadRequest)
+
+		return
+	}
+
+	h := a.capsule.policy()
+
+	flushed := 0
+	if h.cache != nil {
+		flushed = h.cache.flush(scope == "negative")
+	}
+
+	if h.search != nil {
+		flushed += h.search.flush(scope == "negative")
+	}
+
+	if h.prefetch != nil && scope != "negative" {
+		flushed += h.prefetch.flush()
+	}
+
+	log.Infof("flushed %d cached decisions on admin request", flushed)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{"flushed": flushed})
+}
+
+// snapshot dumps the IP to namespace and tenant mapping held by the caches.
+func (a *adminServer) snapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		Synced       bool            `json:"synced"`
+		Degraded     bool            `json:"degraded"`
+		Attributions []ipAttribution `json:"attributions"`
+	}{
+		Synced:       a.capsule.dnsController.HasSynced(),
+		Degraded:     a.capsule.dnsController.Degraded(),
+		Attributions: a.capsule.dnsController.active().snapshot(a.capsule.policy()),
+	})
+}
+
+// topNames lists the names each tenant queried most, with ?tenant= those of a
+// single tenant.
+func (a *adminServer) topNames(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if a.capsule.topNames == nil {
+		http.Error(w, "top_names is not enabled", http.StatusNotFound)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(a.capsule.topNames.top(r.URL.Query().Get("tenant")))
+}
+
+// recentBlocked lists the last blocked queries of each tenant, with ?tenant=
+// those of a single tenant and with ?since= those of the last duration only.
+func (a *adminServer) recentBlocked(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if a.capsule.recentBlocked == nil {
+		http.Error(w, "recent_blocked is not enabled", http.StatusNotFound)
+
+		return
+	}
+
+	var since time.Time
+
+	if s := r.URL.Query().Get("since"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+
+			return
+		}
+
+		since = time.Now().Add(-d)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(a.capsule.recentBlocked.since(r.URL.Query().Get("tenant"), since))
+}
+
+// logLevel returns the log level in force. POST ?level= sets it over those of
+// log_level and of the CapsuleCoreDNSConfig until DELETE clears it.
+func (a *adminServer) logLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		_ = log.setOverride("")
+	case http.MethodPost:
+		level := r.URL.Query().Get("level")
+		if level == "" || log.setOverride(level) != nil {
+			http.Error(w, "invalid level", http.StatusBadRequest)
+
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"level": log.Level()})
+}
@@ -0,0 +1,220 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Alerts of alert_threshold.
+const (
+	alertBlockRate = "block_rate"
+	alertUnsynced  = "unsynced"
+	alertErrorRate = "error_rate"
+)
+
+const (
+	defaultAlertInterval = time.Minute
+	// alertMinQueries is the number of queries below which an interval is too
+	// quiet for its block or error rate to mean anything.
+	alertMinQueries = 20
+)
+
+// alertConfig gathers the alert directives of a server block. Thresholds
+// left at zero are not checked.
+type alertConfig struct {
+	url       string
+	interval  time.Duration
+	blockRate float64
+	unsynced  time.Duration
+	errorRate float64
+}
+
+// alert is a threshold crossing, or its end, as posted to the webhook.
+type alert struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Tenant string `json:"tenant,omitempty"`
+	// Value and Threshold are fractions for rates, seconds for unsynced.
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Time      time.Time `json:"time"`
+}
+
+// alertPayload is the body of a webhook call.
+type alertPayload struct {
+	Replica string  `json:"replica,omitempty"`
+	Alerts  []alert `json:"alerts"`
+}
+
+// alerter checks the thresholds of alert_threshold every interval and posts
+// the alerts that started or ended since the last check to the alert_webhook,
+// for clusters without Prometheus alerting.
+type alerter struct {
+	capsule *Capsule
+	config  alertConfig
+	client  *http.Client
+	replica string
+	done    chan struct{}
+	// firing holds the alerts currently firing, by name and tenant.
+	firing map[[2]string]alert
+	// The counts of the last check, rates are computed over the interval.
+	tenants                 map[string][2]uint64
+	allowed, denied, failed uint64
+	unsyncedSince           time.Time
+}
+
+func newAlerter(h *Capsule, config alertConfig) *alerter {
+	return &alerter{
+		capsule: h,
+		config:  config,
+		client:  &http.Client{Timeout: statusTimeout},
+		replica: podName(),
+		done:    make(chan struct{}),
+		firing:  map[[2]string]alert{},
+		tenants: map[string][2]uint64{},
+	}
+}
+
+func (a *alerter) Start() {
+	go func() {
+		ticker := time.NewTicker(a.config.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				a.notify(a.check(time.Now()))
+			case <-a.done:
+				return
+			}
+		}
+	}()
+}
+
+func (a *alerter) Stop() {
+	close(a.done)
+}
+
+// check returns the alerts that started or ended since the last check.
+func (a *alerter) check(now time.Time) []alert {
+	firing := map[[2]string]alert{}
+
+	if a.config.blockRate > 0 {
+		for tenant, counts := range a.tenantCounts() {
+			last := a.tenants[tenant]
+			a.tenants[tenant] = counts
+
+			allowed, denied := counts[0]-last[0], counts[1]-last[1]
+			if allowed+denied < alertMinQueries {
+				continue
+			}
+
+			if rate := float64(denied) / float64(allowed+denied); rate >= a.config.blockRate {
+				firing[[2]string{alertBlockRate, tenant}] = alert{
+					Name: alertBlockRate, Tenant: tenant, Value: rate, Threshold: a.config.blockRate,
+				}
+			}
+		}
+	}
+
+	if a.config.unsynced > 0 {
+		ctrl := a.capsule.dnsController.active()
+
+		switch {
+		case ctrl.HasSynced() && !ctrl.Degraded():
+			a.unsyncedSince = time.Time{}
+		case a.unsyncedSince.IsZero():
+			a.unsyncedSince = now
+		}
+
+		if d := now.Sub(a.unsyncedSince); !a.unsyncedSince.IsZero() && d >= a.config.unsynced {
+			firing[[2]string{alertUnsynced}] = alert{
+				Name: alertUnsynced, Value: d.Seconds(), Threshold: a.config.unsynced.Seconds(),
+			}
+		}
+	}
+
+	if a.config.errorRate > 0 {
+		counters := a.capsule.counters
+		allowed, denied, failed := counters.allowed.Load(), counters.denied.Load(), counters.failed.Load()
+
+		failures := failed - a.failed
+		total := allowed - a.allowed + denied - a.denied + failures
+		a.allowed, a.denied, a.failed = allowed, denied, failed
+
+		if total >= alertMinQueries {
+			if rate := float64(failures) / float64(total); rate >= a.config.errorRate {
+				firing[[2]string{alertErrorRate}] = alert{
+					Name: alertErrorRate, Value: rate, Threshold: a.config.errorRate,
+				}
+			}
+		}
+	}
+
+	var alerts []alert
+
+	for key, al := range firing {
+		if _, ok := a.firing[key]; !ok {
+			al.Status = "firing"
+			al.Time = now
+			alerts = append(alerts, al)
+		}
+	}
+
+	for key, al := range a.firing {
+		if _, ok := firing[key]; !ok {
+			al.Status = "resolved"
+			al.Time = now
+			alerts = append(alerts, al)
+		}
+	}
+
+	a.firing = firing
+
+	return alerts
+}
+
+// tenantCounts returns the allowed and denied decisions of each tenant since
+// the plugin started.
+func (a *alerter) tenantCounts() map[string][2]uint64 {
+	counts := map[string][2]uint64{}
+
+	a.capsule.counters.namespaces.Range(func(_, value any) bool {
+		//nolint:forcetypeassert
+		c := value.(*namespaceCounters)
+
+		total := counts[c.tenant]
+		total[0] += c.allowed.Load()
+		total[1] += c.denied.Load()
+		counts[c.tenant] = total
+
+		return true
+	})
+
+	return counts
+}
+
+// notify posts alerts to the webhook. Alerts that could not be delivered are
+// dropped, the next check only reports later changes.
+func (a *alerter) notify(alerts []alert) {
+	if len(alerts) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(alertPayload{Replica: a.replica, Alerts: alerts})
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	if err := post(ctx, a.client, a.config.url, "application/json", body); err != nil {
+		log.Warningf("failed to post %d alerts to the alert_webhook: %v", len(alerts), err)
+	}
+}
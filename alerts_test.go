@@ -0,0 +1,166 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestParseAlerts(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    alertConfig
+		wantErr bool
+	}{
+		{name: "disabled", input: "capsule {\nnetworkpolicies\n}"},
+		{
+			name:  "all thresholds",
+			input: "capsule {\nalert_webhook https://hooks.example.com/dns 30s\nalert_threshold block_rate 0.2\nalert_threshold unsynced 5m\nalert_threshold error_rate 0.01\n}",
+			want:  alertConfig{url: "https://hooks.example.com/dns", interval: 30 * time.Second, blockRate: 0.2, unsynced: 5 * time.Minute, errorRate: 0.01},
+		},
+		{
+			name:  "default interval",
+			input: "capsule {\nalert_webhook http://alerts:8080\nalert_threshold unsynced 1m\n}",
+			want:  alertConfig{url: "http://alerts:8080", interval: defaultAlertInterval, unsynced: time.Minute},
+		},
+		{name: "invalid url", input: "capsule {\nalert_webhook alerts:8080\nalert_threshold unsynced 1m\n}", wantErr: true},
+		{name: "invalid interval", input: "capsule {\nalert_webhook http://alerts:8080 0s\nalert_threshold unsynced 1m\n}", wantErr: true},
+		{name: "unknown threshold", input: "capsule {\nalert_webhook http://alerts:8080\nalert_threshold latency 1s\n}", wantErr: true},
+		{name: "rate above one", input: "capsule {\nalert_webhook http://alerts:8080\nalert_threshold block_rate 2\n}", wantErr: true},
+		{name: "invalid duration", input: "capsule {\nalert_webhook http://alerts:8080\nalert_threshold unsynced 0.5\n}", wantErr: true},
+		{name: "no threshold", input: "capsule {\nalert_webhook http://alerts:8080\n}", wantErr: true},
+		{name: "no webhook", input: "capsule {\nalert_threshold error_rate 0.1\n}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if h.alerts != tt.want {
+				t.Errorf("got %+v, want %+v", h.alerts, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlerterCheck(t *testing.T) {
+	h := &Capsule{
+		counters:      &decisionCounters{perNamespace: true},
+		dnsController: &dnsController{},
+	}
+	h.dnsController.hasSynced.Store(true)
+
+	a := newAlerter(h, alertConfig{interval: time.Minute, blockRate: 0.5, unsynced: 2 * time.Minute, errorRate: 0.1})
+	start := time.Now()
+
+	record := func(tenant string, allowed, denied int) {
+		for range allowed {
+			h.counters.record(decision{allowed: true, srcNamespace: tenant + "-app", srcTenant: tenant})
+		}
+
+		for range denied {
+			h.counters.record(decision{srcNamespace: tenant + "-app", srcTenant: tenant})
+		}
+	}
+
+	check := func(at time.Duration, want ...string) {
+		t.Helper()
+
+		var got []string
+		for _, al := range a.check(start.Add(at)) {
+			got = append(got, al.Status+" "+al.Name+" "+al.Tenant)
+		}
+
+		slices.Sort(got)
+		slices.Sort(want)
+
+		if !slices.Equal(got, want) {
+			t.Errorf("at %s: got alerts %q, want %q", at, got, want)
+		}
+	}
+
+	// team-b is mostly blocked, team-a too quiet to tell.
+	record("team-a", 0, 5)
+	record("team-b", 10, 30)
+	check(time.Minute, "firing block_rate team-b")
+
+	// Still firing: reported once.
+	record("team-b", 10, 30)
+	check(2 * time.Minute)
+
+	// team-b recovered, evaluations start failing.
+	record("team-b", 40, 0)
+	h.counters.failed.Add(10)
+	check(3*time.Minute, "resolved block_rate team-b", "firing error_rate ")
+
+	// The controller lost its sync for longer than the threshold.
+	h.dnsController.hasSynced.Store(false)
+	check(4*time.Minute, "resolved error_rate ")
+	check(5 * time.Minute)
+	check(6*time.Minute, "firing unsynced ")
+
+	h.dnsController.hasSynced.Store(true)
+	check(7*time.Minute, "resolved unsynced ")
+}
+
+func TestAlerterNotify(t *testing.T) {
+	payloads := make(chan alertPayload, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p alertPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+
+		payloads <- p
+	}))
+	defer srv.Close()
+
+	a := newAlerter(&Capsule{}, alertConfig{url: srv.URL})
+	a.replica = "coredns-0"
+
+	a.notify(nil)
+	a.notify([]alert{{Name: alertUnsynced, Status: "firing", Value: 300, Threshold: 120}})
+
+	select {
+	case p := <-payloads:
+		if p.Replica != "coredns-0" || len(p.Alerts) != 1 || p.Alerts[0].Name != alertUnsynced || p.Alerts[0].Value != 300 {
+			t.Errorf("got payload %+v", p)
+		}
+	default:
+		t.Fatal("no alert posted")
+	}
+
+	select {
+	case p := <-payloads:
+		t.Errorf("got unexpected payload %+v", p)
+	default:
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"time"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultAuditBatchSize     = 100
+	defaultAuditBatchInterval = 5 * time.Second
+	defaultAuditBuffer        = 10000
+)
+
+// auditEvent is the record shipped to audit sinks for a single decision.
+type auditEvent struct {
+	Time         time.Time `json:"time"`
+	Allowed      bool      `json:"allowed"`
+	Reason       string    `json:"reason"`
+	Rule         string    `json:"rule,omitempty"`
+	QName        string    `json:"qname"`
+	QType        string    `json:"qtype"`
+	Proto        string    `json:"proto"`
+	SrcIP        string    `json:"src_ip"`
+	SrcPod       string    `json:"src_pod,omitempty"`
+	SrcWorkload  string    `json:"src_workload,omitempty"`
+	SrcNamespace string    `json:"src_namespace,omitempty"`
+	SrcTenant    string    `json:"src_tenant,omitempty"`
+	DstIP        string    `json:"dst_ip,omitempty"`
+	DstNamespace string    `json:"dst_namespace,omitempty"`
+	DstTenant    string    `json:"dst_tenant,omitempty"`
+}
+
+func newAuditEvent(state request.Request, destIp string, d decision) auditEvent {
+	return auditEvent{
+		Time:         time.Now().UTC(),
+		Allowed:      d.allowed,
+		Reason:       d.reason,
+		Rule:         d.rule,
+		QName:        state.Name(),
+		QType:        dns.TypeToString[state.QType()],
+		Proto:        state.Proto(),
+		SrcIP:        state.IP(),
+		SrcPod:       d.srcPod,
+		SrcWorkload:  d.workload(),
+		SrcNamespace: d.srcNamespace,
+		SrcTenant:    d.srcTenant,
+		DstIP:        destIp,
+		DstNamespace: d.dstNamespace,
+		DstTenant:    d.dstTenant,
+	}
+}
+
+// auditSink receives decision events. Emit must never block the query path.
+type auditSink interface {
+	Name() string
+	Emit(ev auditEvent)
+	Start()
+	Stop()
+}
+
+// auditSinkConfig describes a sink declared with the audit_sink directive.
+type auditSinkConfig struct {
+	kind    string
+	url     string
+	topic   string
+	cluster string
+}
+
+// auditConfig gathers the audit directives of a server block.
+type auditConfig struct {
+	sinks         []auditSinkConfig
+	batchSize     int
+	batchInterval time.Duration
+	buffer        int
+	all           bool
+	syslog        *syslogConfig
+	grpc          string
+}
+
+func (c auditConfig) build() []auditSink {
+	batchSize := c.batchSize
+	if batchSize == 0 {
+		batchSize = defaultAuditBatchSize
+	}
+
+	batchInterval := c.batchInterval
+	if batchInterval == 0 {
+		batchInterval = defaultAuditBatchInterval
+	}
+
+	buffer := c.buffer
+	if buffer == 0 {
+		buffer = defaultAuditBuffer
+	}
+
+	sinks := make([]auditSink, 0, len(c.sinks))
+
+	for _, sc := range c.sinks {
+		var exporter auditExporter
+
+		switch sc.kind {
+		case "webhook":
+			exporter = newWebhookExporter(sc.url)
+		case "kafka":
+			exporter = newKafkaExporter(sc.url, sc.topic)
+		case "falco":
+			exporter = newFalcoExporter(sc.url)
+		case "otlp":
+			exporter = newOTLPExporter(sc.url, sc.cluster)
+		}
+
+		sinks = append(sinks, newBatchSink(sc.kind, exporter, batchSize, buffer, batchInterval))
+	}
+
+	if c.syslog != nil {
+		sinks = append(sinks, newSyslogSink(*c.syslog, buffer))
+	}
+
+	if c.grpc != "" {
+		sinks = append(sinks, newGRPCSink(c.grpc, buffer))
+	}
+
+	return sinks
+}
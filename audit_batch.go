@@ -0,0 +1,196 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const auditExportTimeout = 10 * time.Second
+
+// auditExporter ships a batch of events to a remote system.
+type auditExporter interface {
+	Export(ctx context.Context, events []auditEvent) error
+}
+
+// batchSink buffers events in a bounded queue and hands them to an exporter in
+// batches. When the exporter can't keep up the queue fills and new events are
+// dropped instead of slowing down DNS.
+type batchSink struct {
+	name     string
+	exporter auditExporter
+	size     int
+	interval time.Duration
+	events   chan auditEvent
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newBatchSink(name string, exporter auditExporter, size, buffer int, interval time.Duration) *batchSink {
+	return &batchSink{
+		name:     name,
+		exporter: exporter,
+		size:     size,
+		interval: interval,
+		events:   make(chan auditEvent, buffer),
+		done:     make(chan struct{}),
+	}
+}
+
+func (s *batchSink) Name() string { return s.name }
+
+func (s *batchSink) Emit(ev auditEvent) {
+	select {
+	case s.events <- ev:
+	default:
+		auditEventsDropped.WithLabelValues(s.name, "buffer_full").Inc()
+	}
+}
+
+func (s *batchSink) Start() {
+	s.wg.Add(1)
+
+	go s.run()
+}
+
+// Stop flushes the queued events and waits for the last export to finish.
+func (s *batchSink) Stop() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+func (s *batchSink) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	batch := make([]auditEvent, 0, s.size)
+
+	for {
+		select {
+		case ev := <-s.events:
+			batch = append(batch, ev)
+			if len(batch) >= s.size {
+				batch = s.flush(batch)
+			}
+		case <-ticker.C:
+			batch = s.flush(batch)
+		case <-s.done:
+			for {
+				select {
+				case ev := <-s.events:
+					batch = append(batch, ev)
+				default:
+					s.flush(batch)
+
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *batchSink) flush(batch []auditEvent) []auditEvent {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), auditExportTimeout)
+	defer cancel()
+
+	err := s.exporter.Export(ctx, batch)
+	if err != nil {
+		log.Warningf("failed to export %d audit events to %s sink: %v", len(batch), s.name, err)
+		auditEventsDropped.WithLabelValues(s.name, "export_failed").Add(float64(len(batch)))
+	} else {
+		auditEventsSent.WithLabelValues(s.name).Add(float64(len(batch)))
+	}
+
+	return batch[:0]
+}
+
+// webhookExporter POSTs each batch as a JSON array.
+type webhookExporter struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookExporter(url string) *webhookExporter {
+	return &webhookExporter{url: url, client: &http.Client{}}
+}
+
+func (e *webhookExporter) Export(ctx context.Context, events []auditEvent) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+
+	return post(ctx, e.client, e.url, "application/json", body)
+}
+
+// kafkaExporter produces each batch to a topic through a Kafka REST proxy, so
+// no Kafka client has to be linked into CoreDNS.
+type kafkaExporter struct {
+	url    string
+	client *http.Client
+}
+
+func newKafkaExporter(proxy, topic string) *kafkaExporter {
+	return &kafkaExporter{
+		url:    strings.TrimSuffix(proxy, "/") + "/topics/" + topic,
+		client: &http.Client{},
+	}
+}
+
+type kafkaRecord struct {
+	Value auditEvent `json:"value"`
+}
+
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+func (e *kafkaExporter) Export(ctx context.Context, events []auditEvent) error {
+	records := kafkaRecords{Records: make([]kafkaRecord, 0, len(events))}
+	for _, ev := range events {
+		records.Records = append(records.Records, kafkaRecord{Value: ev})
+	}
+
+	body, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	return post(ctx, e.client, e.url, "application/vnd.kafka.json.v2+json", body)
+}
+
+func post(ctx context.Context, client *http.Client, url, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	falcoRule     = "Cross-tenant DNS resolution blocked"
+	falcoPriority = "Warning"
+	falcoSource   = "capsule"
+)
+
+// falcoExporter POSTs blocked queries to Falcosidekick as Falco events, so DNS
+// lateral-movement attempts reach the outputs and alerting already set up for
+// runtime security. Allowed queries are skipped, even with "audit_events all".
+type falcoExporter struct {
+	url      string
+	client   *http.Client
+	hostname string
+}
+
+func newFalcoExporter(url string) *falcoExporter {
+	return &falcoExporter{url: url, client: &http.Client{}, hostname: podName()}
+}
+
+// falcoEvent is the payload Falcosidekick accepts on its root endpoint.
+type falcoEvent struct {
+	Time         time.Time         `json:"time"`
+	Rule         string            `json:"rule"`
+	Priority     string            `json:"priority"`
+	Source       string            `json:"source"`
+	Output       string            `json:"output"`
+	OutputFields map[string]string `json:"output_fields"`
+	Tags         []string          `json:"tags"`
+	Hostname     string            `json:"hostname,omitempty"`
+}
+
+func (e *falcoExporter) newEvent(ev auditEvent) falcoEvent {
+	fields := map[string]string{}
+
+	for _, field := range [][2]string{
+		{"capsule.reason", ev.Reason},
+		{"capsule.rule", ev.Rule},
+		{"dns.qname", ev.QName},
+		{"dns.qtype", ev.QType},
+		{"dns.proto", ev.Proto},
+		{"src.ip", ev.SrcIP},
+		{"src.namespace", ev.SrcNamespace},
+		{"src.tenant", ev.SrcTenant},
+		{"dst.ip", ev.DstIP},
+		{"dst.namespace", ev.DstNamespace},
+		{"dst.tenant", ev.DstTenant},
+	} {
+		if field[1] != "" {
+			fields[field[0]] = field[1]
+		}
+	}
+
+	return falcoEvent{
+		Time:     ev.Time,
+		Rule:     falcoRule,
+		Priority: falcoPriority,
+		Source:   falcoSource,
+		Output: fmt.Sprintf("%s: %s DNS query blocked (reason=%s qname=%s qtype=%s src_ip=%s src_namespace=%s src_tenant=%s dst_namespace=%s dst_tenant=%s)",
+			ev.Time.Format(time.RFC3339Nano), falcoPriority, ev.Reason, ev.QName, ev.QType,
+			ev.SrcIP, ev.SrcNamespace, ev.SrcTenant, ev.DstNamespace, ev.DstTenant),
+		OutputFields: fields,
+		Tags:         []string{"dns", "capsule", "network", "mitre_lateral_movement"},
+		Hostname:     e.hostname,
+	}
+}
+
+// Export sends the blocked events one by one, Falcosidekick takes a single
+// event per request.
+func (e *falcoExporter) Export(ctx context.Context, events []auditEvent) error {
+	for _, ev := range events {
+		if ev.Allowed {
+			continue
+		}
+
+		body, err := json.Marshal(e.newEvent(ev))
+		if err != nil {
+			return err
+		}
+
+		if err := post(ctx, e.client, e.url, "application/json", body); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFalcoExporter(t *testing.T) {
+	var got []falcoEvent
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev falcoEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("failed to decode event: %v", err)
+		}
+
+		got = append(got, ev)
+	}))
+	t.Cleanup(srv.Close)
+
+	e := newFalcoExporter(srv.URL)
+
+	err := e.Export(context.Background(), []auditEvent{
+		{Time: time.Unix(1, 0).UTC(), Allowed: true, Reason: reasonSameTenant},
+		{
+			Time: time.Unix(2, 0).UTC(), Reason: reasonCrossTenant, QName: "api.team-b.svc.cluster.local.", QType: "A",
+			SrcIP: "10.244.1.12", SrcNamespace: "team-a-app", SrcTenant: "team-a", DstNamespace: "team-b", DstTenant: "team-b",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("got %d events, want only the blocked one", len(got))
+	}
+
+	ev := got[0]
+	if ev.Rule != falcoRule || ev.Priority != falcoPriority || ev.Source != falcoSource {
+		t.Errorf("got rule=%q priority=%q source=%q", ev.Rule, ev.Priority, ev.Source)
+	}
+
+	want := "1970-01-01T00:00:02Z: Warning DNS query blocked (reason=cross_tenant qname=api.team-b.svc.cluster.local. qtype=A src_ip=10.244.1.12 src_namespace=team-a-app src_tenant=team-a dst_namespace=team-b dst_tenant=team-b)"
+	if ev.Output != want {
+		t.Errorf("got output %q, want %q", ev.Output, want)
+	}
+
+	if ev.OutputFields["src.tenant"] != "team-a" || ev.OutputFields["dst.tenant"] != "team-b" {
+		t.Errorf("got output fields %v", ev.OutputFields)
+	}
+
+	if _, ok := ev.OutputFields["dst.ip"]; ok {
+		t.Errorf("got dst.ip=%q for an event without one, want it omitted", ev.OutputFields["dst.ip"])
+	}
+}
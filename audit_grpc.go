@@ -0,0 +1,144 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// grpcStreamService is the full name of the service declared in
+// docs/decision_events.proto.
+const grpcStreamService = "capsule.v1.DecisionEvents"
+
+// grpcSink streams decision events to the subscribers of a gRPC server. Each
+// event is a google.protobuf.Struct with the fields of the webhook events, so
+// that subscribers need no generated code beyond the well-known types. A
+// subscriber too slow to keep up with its buffer loses events, not the others.
+type grpcSink struct {
+	addr   string
+	buffer int
+	ln     net.Listener
+	server *grpc.Server
+
+	mu          sync.RWMutex
+	subscribers map[chan auditEvent]struct{}
+}
+
+func newGRPCSink(addr string, buffer int) *grpcSink {
+	return &grpcSink{
+		addr:        addr,
+		buffer:      buffer,
+		subscribers: make(map[chan auditEvent]struct{}),
+	}
+}
+
+func (s *grpcSink) Name() string { return "grpc" }
+
+func (s *grpcSink) Emit(ev auditEvent) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for events := range s.subscribers {
+		select {
+		case events <- ev:
+		default:
+			auditEventsDropped.WithLabelValues(s.Name(), "buffer_full").Inc()
+		}
+	}
+}
+
+func (s *grpcSink) Start() {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		log.Errorf("Failed to listen for decision event subscribers: %v", err)
+
+		return
+	}
+
+	s.ln = ln
+	s.server = grpc.NewServer()
+	s.server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: grpcStreamService,
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Subscribe",
+			Handler:       s.subscribe,
+			ServerStreams: true,
+		}},
+		Metadata: "decision_events.proto",
+	}, nil)
+
+	go func() {
+		if err := s.server.Serve(ln); err != nil {
+			log.Errorf("decision event server stopped: %v", err)
+		}
+	}()
+
+	log.Infof("decision events streamed on %s", ln.Addr())
+}
+
+// Stop closes the streams of the subscribers, the events they have not
+// received yet are lost.
+func (s *grpcSink) Stop() {
+	if s.server != nil {
+		s.server.Stop()
+	}
+}
+
+// subscribe serves a Subscribe call until the subscriber goes away.
+func (s *grpcSink) subscribe(_ any, stream grpc.ServerStream) error {
+	if err := stream.RecvMsg(new(emptypb.Empty)); err != nil {
+		return err
+	}
+
+	events := make(chan auditEvent, s.buffer)
+
+	s.mu.Lock()
+	s.subscribers[events] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, events)
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case ev := <-events:
+			msg, err := eventStruct(ev)
+			if err != nil {
+				return err
+			}
+
+			if err := stream.SendMsg(msg); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// eventStruct converts ev to its JSON form as a google.protobuf.Struct.
+func eventStruct(ev auditEvent) (*structpb.Struct, error) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := new(structpb.Struct)
+	if err := protojson.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestGRPCSink(t *testing.T) {
+	sink := newGRPCSink("127.0.0.1:0", 10)
+	sink.Start()
+	t.Cleanup(sink.Stop)
+
+	if sink.ln == nil {
+		t.Fatal("sink not listening")
+	}
+
+	conn, err := grpc.NewClient(sink.ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/"+grpcStreamService+"/Subscribe")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	if err := stream.SendMsg(new(emptypb.Empty)); err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("failed to close request: %v", err)
+	}
+
+	waitFor(t, "subscriber", func() bool {
+		sink.mu.RLock()
+		defer sink.mu.RUnlock()
+
+		return len(sink.subscribers) == 1
+	})
+
+	sink.Emit(auditEvent{
+		Reason:       reasonExposedService,
+		Rule:         "labels",
+		QName:        "svc-0.tenant-1.svc.cluster.local.",
+		QType:        "A",
+		Allowed:      true,
+		SrcIP:        "10.0.0.1",
+		SrcTenant:    "tenant-0",
+		DstNamespace: "tenant-1",
+	})
+
+	msg := new(structpb.Struct)
+	if err := stream.RecvMsg(msg); err != nil {
+		t.Fatalf("failed to receive event: %v", err)
+	}
+
+	fields := msg.AsMap()
+
+	want := map[string]any{
+		"allowed":       true,
+		"reason":        reasonExposedService,
+		"rule":          "labels",
+		"qname":         "svc-0.tenant-1.svc.cluster.local.",
+		"src_tenant":    "tenant-0",
+		"dst_namespace": "tenant-1",
+	}
+
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("got %s=%v, want %v", k, fields[k], v)
+		}
+	}
+
+	if _, ok := fields["dst_tenant"]; ok {
+		t.Errorf("got dst_tenant=%v, want it omitted", fields["dst_tenant"])
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// OpenTelemetry severity numbers of allowed and denied events.
+const (
+	otlpSeverityInfo = 9
+	otlpSeverityWarn = 13
+)
+
+// otlpExporter sends each batch as OTLP logs over HTTP, in the JSON encoding,
+// so no OpenTelemetry SDK has to be linked into CoreDNS.
+type otlpExporter struct {
+	url      string
+	client   *http.Client
+	resource otlpResource
+}
+
+func newOTLPExporter(url, cluster string) *otlpExporter {
+	return &otlpExporter{
+		url:      url,
+		client:   &http.Client{},
+		resource: newOTLPResource(cluster),
+	}
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string          `json:"timeUnixNano"`
+	ObservedTimeUnixNano string          `json:"observedTimeUnixNano"`
+	SeverityNumber       int             `json:"severityNumber"`
+	SeverityText         string          `json:"severityText"`
+	Body                 otlpValue       `json:"body"`
+	Attributes           []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpLogs struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func otlpBool(key string, value bool) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{BoolValue: &value}}
+}
+
+// newOTLPResource describes the replica exporting the logs. The attributes of
+// OTEL_RESOURCE_ATTRIBUTES are added to, or override, those known here.
+func newOTLPResource(cluster string) otlpResource {
+	attrs := map[string]string{"service.name": "coredns"}
+
+	if cluster != "" {
+		attrs["k8s.cluster.name"] = cluster
+	}
+
+	if name := podName(); name != "" {
+		attrs["k8s.pod.name"] = name
+	}
+
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		attrs["k8s.namespace.name"] = namespace
+	}
+
+	for _, pair := range strings.Split(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"), ",") {
+		if key, value, ok := strings.Cut(pair, "="); ok && strings.TrimSpace(key) != "" {
+			attrs[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	var resource otlpResource
+
+	for _, key := range []string{"service.name", "k8s.cluster.name", "k8s.namespace.name", "k8s.pod.name"} {
+		if value, ok := attrs[key]; ok {
+			resource.Attributes = append(resource.Attributes, otlpString(key, value))
+			delete(attrs, key)
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(attrs)) {
+		resource.Attributes = append(resource.Attributes, otlpString(key, attrs[key]))
+	}
+
+	return resource
+}
+
+func newOTLPLogRecord(ev auditEvent) otlpLogRecord {
+	severity, severityText, verdict := otlpSeverityInfo, "INFO", "allowed"
+	if !ev.Allowed {
+		severity, severityText, verdict = otlpSeverityWarn, "WARN", "denied"
+	}
+
+	body := verdict + " query " + ev.QName + " " + ev.Reason
+	ts := strconv.FormatInt(ev.Time.UnixNano(), 10)
+
+	attrs := []otlpAttribute{otlpBool("capsule.allowed", ev.Allowed)}
+
+	for _, attr := range [][2]string{
+		{"capsule.reason", ev.Reason},
+		{"capsule.rule", ev.Rule},
+		{"dns.question.name", ev.QName},
+		{"dns.question.type", ev.QType},
+		{"network.transport", ev.Proto},
+		{"capsule.src_ip", ev.SrcIP},
+		{"capsule.src_namespace", ev.SrcNamespace},
+		{"capsule.src_tenant", ev.SrcTenant},
+		{"capsule.dst_ip", ev.DstIP},
+		{"capsule.dst_namespace", ev.DstNamespace},
+		{"capsule.dst_tenant", ev.DstTenant},
+	} {
+		if attr[1] != "" {
+			attrs = append(attrs, otlpString(attr[0], attr[1]))
+		}
+	}
+
+	return otlpLogRecord{
+		TimeUnixNano:         ts,
+		ObservedTimeUnixNano: ts,
+		SeverityNumber:       severity,
+		SeverityText:         severityText,
+		Body:                 otlpValue{StringValue: &body},
+		Attributes:           attrs,
+	}
+}
+
+func (e *otlpExporter) Export(ctx context.Context, events []auditEvent) error {
+	records := make([]otlpLogRecord, 0, len(events))
+	for _, ev := range events {
+		records = append(records, newOTLPLogRecord(ev))
+	}
+
+	body, err := json.Marshal(otlpLogs{ResourceLogs: []otlpResourceLogs{{
+		Resource: e.resource,
+		ScopeLogs: []otlpScopeLogs{{
+			Scope:      otlpScope{Name: pluginName},
+			LogRecords: records,
+		}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	return post(ctx, e.client, e.url, "application/json", body)
+}
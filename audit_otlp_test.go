@@ -0,0 +1,94 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	t.Setenv("POD_NAME", "coredns-0")
+	t.Setenv("POD_NAMESPACE", "kube-system")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=prod, k8s.cluster.name=override")
+
+	var got otlpLogs
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("got content type %q, want application/json", ct)
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode logs: %v", err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	e := newOTLPExporter(srv.URL+"/v1/logs", "prod-eu")
+
+	err := e.Export(context.Background(), []auditEvent{
+		{Time: time.Unix(1, 5), Reason: reasonCrossTenant, QName: "api.team-b.svc.cluster.local.", QType: "A", SrcIP: "10.0.0.1"},
+		{Time: time.Unix(2, 0), Allowed: true, Reason: reasonExposedService, Rule: "labels"},
+	})
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+
+	if len(got.ResourceLogs) != 1 || len(got.ResourceLogs[0].ScopeLogs) != 1 {
+		t.Fatalf("got %+v, want a single resource and scope", got)
+	}
+
+	resource := map[string]string{}
+	for _, attr := range got.ResourceLogs[0].Resource.Attributes {
+		resource[attr.Key] = *attr.Value.StringValue
+	}
+
+	for key, want := range map[string]string{
+		"service.name":           "coredns",
+		"k8s.cluster.name":       "override",
+		"k8s.namespace.name":     "kube-system",
+		"k8s.pod.name":           "coredns-0",
+		"deployment.environment": "prod",
+	} {
+		if resource[key] != want {
+			t.Errorf("got resource %s=%q, want %q", key, resource[key], want)
+		}
+	}
+
+	records := got.ResourceLogs[0].ScopeLogs[0].LogRecords
+	if len(records) != 2 {
+		t.Fatalf("got %d log records, want 2", len(records))
+	}
+
+	denied := records[0]
+	if denied.TimeUnixNano != "1000000005" || denied.SeverityNumber != otlpSeverityWarn {
+		t.Errorf("got time=%s severity=%d, want time=1000000005 severity=%d", denied.TimeUnixNano, denied.SeverityNumber, otlpSeverityWarn)
+	}
+
+	if body := *denied.Body.StringValue; body != "denied query api.team-b.svc.cluster.local. cross_tenant" {
+		t.Errorf("got body %q", body)
+	}
+
+	attrs := map[string]otlpValue{}
+	for _, attr := range records[1].Attributes {
+		attrs[attr.Key] = attr.Value
+	}
+
+	if v := attrs["capsule.allowed"].BoolValue; v == nil || !*v {
+		t.Errorf("got capsule.allowed=%v, want true", v)
+	}
+
+	if v := attrs["capsule.rule"].StringValue; v == nil || *v != "labels" {
+		t.Errorf("got capsule.rule=%v, want labels", v)
+	}
+
+	if _, ok := attrs["capsule.src_ip"]; ok {
+		t.Error("got capsule.src_ip for an event without source, want it omitted")
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	syslogFacilityLocal0 = 16
+	// syslogEnterpriseID is the private enterprise number used in the
+	// structured data element, the documentation one from RFC 5612.
+	syslogEnterpriseID = 32473
+	syslogDialTimeout  = 5 * time.Second
+	syslogWriteTimeout = 5 * time.Second
+)
+
+// syslogSeverities maps RFC 5424 severity keywords to their numeric value.
+var syslogSeverities = map[string]int{
+	"emerg":   0,
+	"alert":   1,
+	"crit":    2,
+	"err":     3,
+	"warning": 4,
+	"notice":  5,
+	"info":    6,
+	"debug":   7,
+}
+
+// syslogConfig describes the audit_syslog directives.
+type syslogConfig struct {
+	network         string
+	address         string
+	deniedSeverity  int
+	allowedSeverity int
+	rate            float64
+}
+
+// syslogSink writes RFC 5424 messages over UDP, TCP or TLS. TCP and TLS
+// streams use octet-counting framing (RFC 6587). Events beyond the configured
+// rate are dropped.
+type syslogSink struct {
+	config   syslogConfig
+	hostname string
+	limiter  *rate.Limiter
+	events   chan auditEvent
+	done     chan struct{}
+	wg       sync.WaitGroup
+	conn     net.Conn
+	writer   *bufio.Writer
+	// writeTimeout bounds each write, so that a collector that stops reading
+	// does not block the sink.
+	writeTimeout time.Duration
+}
+
+func newSyslogSink(config syslogConfig, buffer int) *syslogSink {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if config.rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(config.rate), int(config.rate)+1)
+	}
+
+	return &syslogSink{
+		config:   config,
+		hostname: hostname,
+		limiter:  limiter,
+		events:   make(chan auditEvent, buffer),
+		done:     make(chan struct{}),
+
+		writeTimeout: syslogWriteTimeout,
+	}
+}
+
+func (s *syslogSink) Name() string { return "syslog" }
+
+func (s *syslogSink) Emit(ev auditEvent) {
+	if !s.limiter.Allow() {
+		auditEventsDropped.WithLabelValues(s.Name(), "rate_limited").Inc()
+
+		return
+	}
+
+	select {
+	case s.events <- ev:
+	default:
+		auditEventsDropped.WithLabelValues(s.Name(), "buffer_full").Inc()
+	}
+}
+
+func (s *syslogSink) Start() {
+	s.wg.Add(1)
+
+	go s.run()
+}
+
+func (s *syslogSink) Stop() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+func (s *syslogSink) run() {
+	defer s.wg.Done()
+	defer s.close()
+
+	for {
+		select {
+		case ev := <-s.events:
+			s.write(ev)
+		case <-s.done:
+			for {
+				select {
+				case ev := <-s.events:
+					s.write(ev)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *syslogSink) write(ev auditEvent) {
+	err := s.send(s.format(ev))
+	if err != nil {
+		// Reconnect once, the collector may have closed an idle stream or
+		// stalled past the write deadline.
+		s.close()
+		err = s.send(s.format(ev))
+	}
+
+	if err != nil {
+		log.Warningf("failed to write audit event to syslog %s://%s: %v", s.config.network, s.config.address, err)
+		auditEventsDropped.WithLabelValues(s.Name(), "export_failed").Inc()
+		s.close()
+
+		return
+	}
+
+	auditEventsSent.WithLabelValues(s.Name()).Inc()
+}
+
+func (s *syslogSink) send(msg string) error {
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+
+		s.conn = conn
+		s.writer = bufio.NewWriter(conn)
+	}
+
+	if err := s.conn.SetWriteDeadline(time.Now().Add(s.writeTimeout)); err != nil {
+		return err
+	}
+
+	if s.config.network == "udp" {
+		_, err := s.conn.Write([]byte(msg))
+
+		return err
+	}
+
+	if _, err := s.writer.WriteString(strconv.Itoa(len(msg)) + " " + msg); err != nil {
+		return err
+	}
+
+	return s.writer.Flush()
+}
+
+func (s *syslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+
+	if s.config.network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", s.config.address, &tls.Config{MinVersion: tls.VersionTLS12})
+	}
+
+	return dialer.Dial(s.config.network, s.config.address)
+}
+
+func (s *syslogSink) close() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+		s.writer = nil
+	}
+}
+
+// format renders ev as an RFC 5424 message, carrying the decision as
+// structured data.
+func (s *syslogSink) format(ev auditEvent) string {
+	severity := s.config.allowedSeverity
+	verdict := "allowed"
+
+	if !ev.Allowed {
+		severity = s.config.deniedSeverity
+		verdict = "denied"
+	}
+
+	var sd strings.Builder
+
+	fmt.Fprintf(&sd, "[%s@%d", pluginName, syslogEnterpriseID)
+
+	for _, param := range [][2]string{
+		{"allowed", strconv.FormatBool(ev.Allowed)},
+		{"reason", ev.Reason},
+		{"qname", ev.QName},
+		{"qtype", ev.QType},
+		{"proto", ev.Proto},
+		{"srcIP", ev.SrcIP},
+		{"srcNamespace", ev.SrcNamespace},
+		{"srcTenant", ev.SrcTenant},
+		{"dstIP", ev.DstIP},
+		{"dstNamespace", ev.DstNamespace},
+		{"dstTenant", ev.DstTenant},
+	} {
+		if param[1] == "" {
+			continue
+		}
+
+		fmt.Fprintf(&sd, " %s=\"%s\"", param[0], escapeSDParam(param[1]))
+	}
+
+	sd.WriteString("]")
+
+	return fmt.Sprintf("<%d>1 %s %s coredns %d %s %s %s query %s %s\n",
+		syslogFacilityLocal0*8+severity,
+		ev.Time.Format(time.RFC3339Nano),
+		s.hostname,
+		os.Getpid(),
+		pluginName,
+		sd.String(),
+		verdict,
+		ev.QName,
+		ev.Reason,
+	)
+}
+
+var sdParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func escapeSDParam(v string) string {
+	return sdParamEscaper.Replace(v)
+}
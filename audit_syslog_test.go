@@ -0,0 +1,74 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogStalledCollector(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	conns := make(chan net.Conn, 2)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			conns <- conn
+		}
+	}()
+
+	s := newSyslogSink(syslogConfig{network: "tcp", address: ln.Addr().String()}, 1)
+	s.writeTimeout = 100 * time.Millisecond
+	t.Cleanup(s.close)
+
+	// The collector never reads the first stream, a message larger than the
+	// socket buffers cannot be written in full.
+	errc := make(chan error, 1)
+	go func() { errc <- s.send(strings.Repeat("x", 64<<20)) }()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("got error %v, want the write deadline exceeded", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("got the write blocked past its deadline")
+	}
+
+	stalled := <-conns
+	t.Cleanup(func() { _ = stalled.Close() })
+
+	// The next event is written on a new stream.
+	s.write(auditEvent{Time: time.Now(), Reason: reasonCrossTenant, QName: "api.team-b.svc.cluster.local.", QType: "A"})
+
+	var conn net.Conn
+	select {
+	case conn = <-conns:
+		t.Cleanup(func() { _ = conn.Close() })
+	case <-time.After(10 * time.Second):
+		t.Fatal("got no reconnection after the timeout")
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	got, _ := io.ReadAll(conn)
+	if !strings.Contains(string(got), "api.team-b.svc.cluster.local.") {
+		t.Errorf("got %q on the new stream, want the event", got)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ErrNotSynced is returned by Authorize until the caches of the controller are
+// synced, or warm-booted from a cache snapshot.
+var ErrNotSynced = errors.New("capsule controller not synced")
+
+// Controller tells whether a resolution would be allowed, for the components
+// of the Capsule ecosystem such as capsule-proxy, dashboards or admission
+// webhooks. It answers from the same live data as the plugin, and shares the
+// informers of the plugins and middlewares of the process configured alike.
+//
+// Controller, Authorize and Decision are a stable API: fields and reasons may
+// be added, existing ones are kept. A Controller is safe for concurrent use.
+type Controller struct {
+	capsule *Capsule
+}
+
+// NewController returns a Controller applying the policy configured by
+// config, the content of a capsule block in the Corefile syntax. Start must be
+// called before Authorize.
+func NewController(config string) (*Controller, error) {
+	h, err := parseConfig("controller", config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.Setup(); err != nil {
+		return nil, err
+	}
+
+	return &Controller{capsule: h}, nil
+}
+
+// Start runs the controller. Authorize returns ErrNotSynced until it synced.
+func (c *Controller) Start() error {
+	return c.capsule.startController("")
+}
+
+// Stop releases what Start acquired.
+func (c *Controller) Stop() error {
+	if c.capsule.dnsController != nil {
+		c.capsule.unwatchConfig()
+		c.capsule.dnsController.release()
+	}
+
+	return nil
+}
+
+// Authorize returns the decision for a pod or service at srcIP resolving dst,
+// an IP address or a namespace name. Nothing is logged, audited or counted,
+// and the OnAllowed and OnBlocked hooks are not called: the query is
+// hypothetical. The QName and QType of the decision are empty.
+func (c *Controller) Authorize(srcIP, dst string) (Decision, error) {
+	return c.AuthorizeContext(context.Background(), srcIP, dst)
+}
+
+// AuthorizeContext is Authorize bounded by ctx: the error of ctx is returned
+// once it is done, instead of a decision classifying ends it left unknown.
+func (c *Controller) AuthorizeContext(ctx context.Context, srcIP, dst string) (Decision, error) {
+	h := c.capsule.policy()
+	if h.dnsController == nil {
+		return Decision{}, ErrNotSynced
+	}
+
+	ctrl := h.dnsController.active()
+	if !ctrl.HasSynced() && !ctrl.Warm() {
+		return Decision{}, ErrNotSynced
+	}
+
+	var d decision
+
+	switch ip := net.ParseIP(dst); {
+	case ip != nil:
+		dst = ip.String()
+		d = h.evaluate(ctx, srcIP, dst)
+	case len(validation.IsDNS1123Label(dst)) == 0:
+		d = ctrl.EvaluateNamespace(ctx, srcIP, dst, *h)
+		dst = ""
+	default:
+		return Decision{}, fmt.Errorf("invalid destination '%s': not an IP address or a namespace name", dst)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return Decision{}, err
+	}
+
+	return publicDecision(srcIP, dst, d), nil
+}
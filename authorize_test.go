@@ -0,0 +1,113 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	cl := newCluster(2, 1, 2)
+	cl.services[3].Labels = map[string]string{"capsule.io/expose-dns": "true"}
+
+	c, err := NewController("labels capsule.io/expose-dns=true")
+	if err != nil {
+		t.Fatalf("failed to create controller: %v", err)
+	}
+
+	if _, err := c.Authorize(cl.pods[0].Status.PodIPs[0].IP, "tenant-0"); !errors.Is(err, ErrNotSynced) {
+		t.Errorf("got error %v before start, want %v", err, ErrNotSynced)
+	}
+
+	c.capsule.dnsController = newTestCapsule(t, cl, dnsControllerOptions{}).dnsController
+
+	src := cl.pods[0].Status.PodIPs[0].IP
+
+	tests := []struct {
+		name    string
+		dst     string
+		want    Decision
+		wantErr bool
+	}{
+		{
+			name: "same tenant",
+			dst:  cl.services[1].Spec.ClusterIP,
+			want: Decision{
+				Action: ActionAllow, Reason: reasonSameTenant,
+				Source:      Identity{IP: src, Namespace: "tenant-0", Tenant: "tenant-0"},
+				Destination: Identity{IP: cl.services[1].Spec.ClusterIP, Namespace: "tenant-0", Tenant: "tenant-0"},
+			},
+		},
+		{
+			name: "other tenant",
+			dst:  cl.services[2].Spec.ClusterIP,
+			want: Decision{
+				Action: ActionBlock, Reason: reasonCrossTenant,
+				Source:      Identity{IP: src, Namespace: "tenant-0", Tenant: "tenant-0"},
+				Destination: Identity{IP: cl.services[2].Spec.ClusterIP, Namespace: "tenant-1", Tenant: "tenant-1"},
+			},
+		},
+		{
+			name: "exposed service",
+			dst:  cl.services[3].Spec.ClusterIP,
+			want: Decision{
+				Action: ActionAllow, Reason: reasonExposedService, Rule: "labels",
+				Source:      Identity{IP: src, Namespace: "tenant-0", Tenant: "tenant-0"},
+				Destination: Identity{IP: cl.services[3].Spec.ClusterIP, Namespace: "tenant-1", Tenant: "tenant-1"},
+			},
+		},
+		{
+			name: "own namespace",
+			dst:  "tenant-0",
+			want: Decision{
+				Action: ActionAllow, Reason: reasonSameTenant,
+				Source:      Identity{IP: src, Namespace: "tenant-0", Tenant: "tenant-0"},
+				Destination: Identity{Namespace: "tenant-0", Tenant: "tenant-0"},
+			},
+		},
+		{
+			name: "namespace of other tenant",
+			dst:  "tenant-1",
+			want: Decision{
+				Action: ActionBlock, Reason: reasonCrossTenant,
+				Source:      Identity{IP: src, Namespace: "tenant-0", Tenant: "tenant-0"},
+				Destination: Identity{Namespace: "tenant-1", Tenant: "tenant-1"},
+			},
+		},
+		{name: "invalid destination", dst: "svc-0.tenant-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Authorize(src, tt.dst)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeContext(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+
+	c, err := NewController("")
+	if err != nil {
+		t.Fatalf("failed to create controller: %v", err)
+	}
+
+	c.capsule.dnsController = newTestCapsule(t, cl, dnsControllerOptions{}).dnsController
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	if got, err := c.AuthorizeContext(ctx, cl.pods[0].Status.PodIPs[0].IP, cl.services[1].Spec.ClusterIP); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %+v and error %v, want %v", got, err, context.Canceled)
+	}
+}
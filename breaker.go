@@ -0,0 +1,201 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/request"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// lookupTimeouts counts the kubernetes plugin lookups that outlasted the
+	// lookup_breaker timeout.
+	lookupTimeouts = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "lookup_timeouts_total",
+			Help:      "Number of kubernetes plugin lookups abandoned after the lookup_breaker timeout.",
+		},
+	)
+
+	// lookupBreakerOpen is set while the lookup breaker is open.
+	lookupBreakerOpen = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "lookup_breaker_open",
+			Help:      "Whether the lookup_breaker is open, the kubernetes plugin lookups being skipped.",
+		},
+	)
+)
+
+// errLookupUnavailable is returned for the questions whose lookup timed out or
+// was skipped by the open breaker.
+var errLookupUnavailable = errors.New("kubernetes lookup unavailable")
+
+// lookupBreaker bounds the kubernetes plugin lookups made to evaluate queries.
+// A lookup outlasting timeout is abandoned, and after failures consecutive
+// ones the breaker opens: lookups are skipped for cooldown, then a single one
+// probes the backend, closing the breaker when it completes in time.
+type lookupBreaker struct {
+	timeout   time.Duration
+	failures  int
+	cooldown  time.Duration
+	fallback  string
+	mu        sync.Mutex
+	failed    int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow reports whether a lookup may run now, and whether it is the probe of
+// an open breaker.
+func (b *lookupBreaker) allow(now time.Time) (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true, false
+	}
+
+	if now.Before(b.openUntil) || b.probing {
+		return false, false
+	}
+
+	b.probing = true
+
+	return true, true
+}
+
+// done records the outcome of a lookup allow let through.
+func (b *lookupBreaker) done(probe, ok bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+
+	if ok {
+		b.failed = 0
+
+		if !b.openUntil.IsZero() {
+			b.openUntil = time.Time{}
+
+			lookupBreakerOpen.Set(0)
+			log.Infof("kubernetes lookups recovered, closing the lookup breaker")
+		}
+
+		return
+	}
+
+	b.failed++
+
+	switch {
+	case probe:
+		b.openUntil = now.Add(b.cooldown)
+	case b.openUntil.IsZero() && b.failed >= b.failures:
+		b.openUntil = now.Add(b.cooldown)
+
+		lookupBreakerOpen.Set(1)
+		log.Warningf("%d kubernetes lookups timed out, opening the lookup breaker for %s", b.failed, b.cooldown)
+	}
+}
+
+// abandon records a lookup allow let through that ended without telling
+// whether the backend answers.
+func (b *lookupBreaker) abandon(probe bool) {
+	if !probe {
+		return
+	}
+
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// lookupResult is the outcome of a lookup left to run in the background.
+type lookupResult struct {
+	destIp string
+	hops   []serviceRef
+	err    error
+}
+
+// lookup is destination bounded by ctx and by the breaker of h, when
+// configured. The kubernetes plugin doesn't observe the context of its
+// lookups: one timing out is left to complete in the background.
+func (h *Capsule) lookup(ctx context.Context, state request.Request, zone string, destIp string) (string, []serviceRef, error) {
+	b := h.breaker
+	if b == nil {
+		return h.boundedLookup(ctx, state, zone, destIp)
+	}
+
+	ok, probe := b.allow(time.Now())
+	if !ok {
+		return "", nil, errLookupUnavailable
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	results := make(chan lookupResult, 1)
+
+	go func() {
+		destIp, hops, err := h.destination(lookupCtx, state, zone, destIp)
+		results <- lookupResult{destIp: destIp, hops: hops, err: err}
+	}()
+
+	select {
+	case r := <-results:
+		b.done(probe, true, time.Now())
+
+		return r.destIp, r.hops, r.err
+	case <-lookupCtx.Done():
+		// A client giving up says nothing of the backend.
+		if ctx.Err() != nil {
+			b.abandon(probe)
+
+			return "", nil, ctx.Err()
+		}
+
+		lookupTimeouts.Inc()
+		lookupErrors.WithLabelValues(state.Type(), lookupTimeout).Inc()
+		b.done(probe, false, time.Now())
+
+		return "", nil, errLookupUnavailable
+	}
+}
+
+// boundedLookup is destination returning the error of ctx once it is done.
+func (h *Capsule) boundedLookup(ctx context.Context, state request.Request, zone string, destIp string) (string, []serviceRef, error) {
+	if ctx.Done() == nil {
+		return h.destination(ctx, state, zone, destIp)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+
+	results := make(chan lookupResult, 1)
+
+	go func() {
+		destIp, hops, err := h.destination(ctx, state, zone, destIp)
+		results <- lookupResult{destIp: destIp, hops: hops, err: err}
+	}()
+
+	select {
+	case r := <-results:
+		return r.destIp, r.hops, r.err
+	case <-ctx.Done():
+		return "", nil, ctx.Err()
+	}
+}
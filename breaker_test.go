@@ -0,0 +1,94 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/kubernetes/object"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestLookupBreaker(t *testing.T) {
+	start := time.Now()
+	b := &lookupBreaker{timeout: time.Second, failures: 2, cooldown: time.Minute}
+
+	allow := func(at time.Duration, wantOK, wantProbe bool) bool {
+		t.Helper()
+
+		ok, probe := b.allow(start.Add(at))
+		if ok != wantOK || probe != wantProbe {
+			t.Errorf("at %s: got allowed %t probe %t, want %t and %t", at, ok, probe, wantOK, wantProbe)
+		}
+
+		return probe
+	}
+
+	allow(0, true, false)
+	b.done(false, false, start)
+	allow(0, true, false)
+	b.done(false, false, start)
+
+	// Two consecutive timeouts open it for the cooldown.
+	allow(30*time.Second, false, false)
+
+	// A single probe goes through, its timeout reopens it.
+	probe := allow(time.Minute, true, true)
+	allow(time.Minute, false, false)
+	b.done(probe, false, start.Add(time.Minute))
+	allow(90*time.Second, false, false)
+
+	// A probe answered in time closes it.
+	probe = allow(2*time.Minute, true, true)
+	b.done(probe, true, start.Add(2*time.Minute))
+	allow(2*time.Minute, true, false)
+
+	// A timeout alone doesn't open it again.
+	b.done(false, false, start.Add(2*time.Minute))
+	allow(2*time.Minute, true, false)
+}
+
+// slowAPIConn serves the services of the synthetic cluster after delay.
+type slowAPIConn struct {
+	*fixtureAPIConn
+
+	delay time.Duration
+}
+
+func (s slowAPIConn) SvcIndex(key string) []*object.Service {
+	time.Sleep(s.delay)
+
+	return s.fixtureAPIConn.SvcIndex(key)
+}
+
+func TestServeDNSLookupBreaker(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.kubernetesHandler.APIConn = slowAPIConn{fixtureAPIConn: newFakeAPIConn(cl), delay: 200 * time.Millisecond}
+	h.breaker = &lookupBreaker{timeout: 20 * time.Millisecond, failures: 1, cooldown: time.Hour, fallback: syncFallbackDeny}
+
+	for _, want := range []string{"timed out", "open breaker"} {
+		m := new(dns.Msg)
+		m.SetQuestion(cl.services[0].Name+"."+cl.services[0].Namespace+".svc."+testZone, dns.TypeA)
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: cl.pods[0].Status.PodIPs[0].IP})
+
+		begin := time.Now()
+		if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatalf("ServeDNS failed: %v", err)
+		}
+
+		if elapsed := time.Since(begin); elapsed >= 200*time.Millisecond {
+			t.Errorf("%s: answered in %s, want the lookup abandoned", want, elapsed)
+		}
+
+		if len(rec.Msg.Answer) != 0 {
+			t.Errorf("%s: got answer %v, want it denied", want, rec.Msg.Answer)
+		}
+	}
+}
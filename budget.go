@@ -0,0 +1,115 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// budgetExceeded counts the evaluations that outlasted evaluation_budget.
+var budgetExceeded = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "evaluation_budget_exceeded_total",
+		Help:      "Number of queries whose classification and policy evaluation outlasted the evaluation_budget.",
+	},
+)
+
+// defaultBudgetSlots bounds the evaluations running on goroutines of their own
+// when max_concurrent is unlimited.
+const defaultBudgetSlots = 1024
+
+// errBudgetExceeded is returned for the questions whose evaluation outlasted
+// the evaluation budget.
+var errBudgetExceeded = errors.New("evaluation budget exceeded")
+
+// budgeted returns the decision of evaluate, or errBudgetExceeded when it
+// takes longer than the evaluation budget of h, or the error of ctx once it is
+// done. An evaluation over budget completes in the background, and fills the
+// decision cache for the next queries. Once every slot of h holds such an
+// evaluation, queries get the fallback of the budget without starting another
+// one, or are evaluated in place without a budget.
+func (h *Capsule) budgeted(ctx context.Context, evaluate func() decision) (decision, error) {
+	if h.evalBudget <= 0 && ctx.Done() == nil {
+		return evaluate(), nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return decision{}, err
+	}
+
+	if h.budgetSlots != nil {
+		select {
+		case h.budgetSlots <- struct{}{}:
+		default:
+			if h.evalBudget <= 0 {
+				d := evaluate()
+				if err := ctx.Err(); err != nil {
+					return decision{}, err
+				}
+
+				return d, nil
+			}
+
+			budgetExceeded.Inc()
+
+			return decision{}, errBudgetExceeded
+		}
+	}
+
+	result := make(chan decision, 1)
+
+	go func() {
+		if h.budgetSlots != nil {
+			defer func() { <-h.budgetSlots }()
+		}
+
+		result <- evaluate()
+	}()
+
+	var budget <-chan time.Time
+
+	if h.evalBudget > 0 {
+		timer := time.NewTimer(h.evalBudget)
+		defer timer.Stop()
+
+		budget = timer.C
+	}
+
+	select {
+	case d := <-result:
+		// The ends classified after ctx was done are unknown.
+		if err := ctx.Err(); err != nil {
+			return decision{}, err
+		}
+
+		return d, nil
+	case <-budget:
+		budgetExceeded.Inc()
+
+		return decision{}, errBudgetExceeded
+	case <-ctx.Done():
+		return decision{}, ctx.Err()
+	}
+}
+
+// fallbackFor returns the fallback applying to a question whose evaluation
+// failed with err, if any.
+func (h *Capsule) fallbackFor(err error) (string, bool) {
+	switch {
+	case errors.Is(err, errLookupUnavailable):
+		return h.breaker.fallback, true
+	case errors.Is(err, errBudgetExceeded):
+		return h.evalFallback, true
+	}
+
+	return "", false
+}
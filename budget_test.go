@@ -0,0 +1,128 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestServeDNSEvaluationBudget(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	src := cl.pods[0].Status.PodIPs[0].IP
+
+	tests := []struct {
+		fallback string
+		answer   string
+	}{
+		{fallback: syncFallbackPassthrough, answer: cl.services[1].Spec.ClusterIP},
+		{fallback: syncFallbackDeny},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fallback, func(t *testing.T) {
+			// The evaluation over budget outlives the subtest, it gets a
+			// handler of its own.
+			h := newTestCapsule(t, cl, dnsControllerOptions{})
+			h.evalBudget = 20 * time.Millisecond
+			h.evalFallback = tt.fallback
+
+			// Holding the IP table shard of the source stalls its classification.
+			shard := h.dnsController.informers.ips.shard(src)
+			shard.Lock()
+			t.Cleanup(shard.Unlock)
+
+			if answer := budgetedAnswer(t, h, cl, src); answer != tt.answer {
+				t.Errorf("got answer %q, want %q", answer, tt.answer)
+			}
+		})
+	}
+}
+
+func TestServeDNSEvaluationBudgetSlots(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	src := cl.pods[0].Status.PodIPs[0].IP
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.evalBudget = time.Hour
+	h.evalFallback = syncFallbackPassthrough
+	h.budgetSlots = make(chan struct{}, 1)
+
+	shard := h.dnsController.informers.ips.shard(src)
+	shard.Lock()
+	t.Cleanup(shard.Unlock)
+
+	// An evaluation over budget holds the only slot.
+	h.budgetSlots <- struct{}{}
+
+	// Waiting for the budget would outlast the deadline of the query.
+	if answer := budgetedAnswer(t, h, cl, src); answer != cl.services[1].Spec.ClusterIP {
+		t.Errorf("got answer %q, want the fallback passing through", answer)
+	}
+
+	if n := len(h.budgetSlots); n != 1 {
+		t.Errorf("got %d slots held, want only the one over budget", n)
+	}
+}
+
+// budgetedAnswer returns the address src is answered with for the service of
+// the second tenant of cl, failing past a deadline.
+func budgetedAnswer(t *testing.T, h *Capsule, cl *cluster, src string) string {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+
+	m := new(dns.Msg)
+	m.SetQuestion(cl.services[1].Name+"."+cl.services[1].Namespace+".svc."+testZone, dns.TypeA)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: src})
+
+	if _, err := h.ServeDNS(ctx, rec, m); err != nil {
+		t.Fatalf("ServeDNS failed: %v", err)
+	}
+
+	if len(rec.Msg.Answer) > 0 {
+		if a, ok := rec.Msg.Answer[0].(*dns.A); ok {
+			return a.A.String()
+		}
+	}
+
+	return ""
+}
+
+func TestServeDNSContextDeadline(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+
+	src := cl.pods[0].Status.PodIPs[0].IP
+
+	// Holding the IP table shard of the source stalls its classification.
+	shard := h.dnsController.informers.ips.shard(src)
+	shard.Lock()
+	t.Cleanup(shard.Unlock)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+
+	m := new(dns.Msg)
+	m.SetQuestion(cl.services[1].Name+"."+cl.services[1].Namespace+".svc."+testZone, dns.TypeA)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: src})
+
+	rcode, err := h.ServeDNS(ctx, rec, m)
+	if rcode != dns.RcodeServerFailure || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got rcode %d and error %v, want SERVFAIL and %v", rcode, err, context.DeadlineExceeded)
+	}
+
+	if rec.Msg != nil {
+		t.Errorf("got answer %v past the deadline, want none", rec.Msg)
+	}
+}
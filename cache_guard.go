@@ -0,0 +1,114 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/cache"
+	"github.com/miekg/dns"
+)
+
+// How cache_guard handles a cache plugin running in front of capsule, which
+// would serve the answer allowed for one source to every other.
+const (
+	// cacheGuardEvaluate evaluates the queries before the cache.
+	cacheGuardEvaluate = "evaluate"
+	// cacheGuardRefuse fails the startup while the cache holds the zone.
+	cacheGuardRefuse = "refuse"
+	cacheGuardOff    = "off"
+)
+
+// guardedKey marks the context of the queries a cacheGuard evaluated, for the
+// handler to pass them on.
+type guardedKey struct{}
+
+// cacheGuard runs in place of the cache plugin, evaluating the queries before
+// they reach it. The cache only gets the queries of allowed sources and never
+// sees blocked answers, and the answers it serves are narrowed on the way out.
+type cacheGuard struct {
+	capsule *Capsule
+	cache   *cache.Cache
+}
+
+func (g *cacheGuard) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	t := queryTimer{start: time.Now()}
+	rcode, err := g.capsule.policy().serveDNS(context.WithValue(ctx, guardedKey{}, true), w, r, g.cache, &t)
+	t.observe()
+
+	return rcode, err
+}
+
+// Name is the one of the cache, which the guard stands for in the server block.
+func (g *cacheGuard) Name() string { return g.cache.Name() }
+
+// guardCache puts h in front of the cache plugin of config, when the cache
+// precedes it in the plugin chain: its constructor is registered before h.
+func guardCache(config *dnsserver.Config, h *Capsule) {
+	for i, p := range config.Plugin {
+		config.Plugin[i] = func(next plugin.Handler) plugin.Handler {
+			handler := p(next)
+			if c, ok := handler.(*cache.Cache); ok {
+				return &cacheGuard{capsule: h, cache: c}
+			}
+
+			return handler
+		}
+	}
+}
+
+// cachedZones returns the zones among enforced the cache c holds the answers
+// of, unless it runs after capsule. Zones whose successes and denials are both
+// disabled are not cached.
+func cachedZones(c *cache.Cache, enforced []string) []string {
+	directives := dnsserver.Directives
+	if i := slices.Index(directives, pluginName); i >= 0 && slices.Index(directives, "cache") > i {
+		return nil
+	}
+
+	success, denial := cacheExceptions(c)
+
+	var zones []string
+
+	for _, zone := range enforced {
+		if plugin.Zones(c.Zones).Matches(zone) == "" {
+			continue
+		}
+
+		if plugin.Zones(success).Matches(zone) != "" && plugin.Zones(denial).Matches(zone) != "" {
+			continue
+		}
+
+		zones = append(zones, zone)
+	}
+
+	return zones
+}
+
+// cacheExceptions returns the zones c doesn't cache the successes and denials
+// of, which its disable option sets without exporting them.
+func cacheExceptions(c *cache.Cache) (success, denial []string) {
+	v := reflect.ValueOf(c).Elem()
+
+	read := func(name string) []string {
+		f := v.FieldByName(name)
+		if f.Kind() != reflect.Slice {
+			return nil
+		}
+
+		zones := make([]string, f.Len())
+		for i := range zones {
+			zones[i] = f.Index(i).String()
+		}
+
+		return zones
+	}
+
+	return read("pexcept"), read("nexcept")
+}
@@ -0,0 +1,200 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/cache"
+	kubedns "github.com/coredns/coredns/plugin/kubernetes"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestParseCacheGuard(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", input: "capsule {\nminimal_responses\n}"},
+		{name: "refuse", input: "capsule {\ncache_guard refuse\n}", want: cacheGuardRefuse},
+		{name: "off", input: "capsule {\ncache_guard off\n}", want: cacheGuardOff},
+		{name: "missing mode", input: "capsule {\ncache_guard\n}", wantErr: true},
+		{name: "invalid mode", input: "capsule {\ncache_guard bypass\n}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if h.cacheGuard != tt.want {
+				t.Errorf("got %q, want %q", h.cacheGuard, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheGuard(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+
+	qname := cl.services[0].Name + "." + cl.services[0].Namespace + ".svc." + testZone
+	own := cl.pods[0].Status.PodIPs[0].IP
+	other := cl.pods[1].Status.PodIPs[0].IP
+
+	answered := func(t *testing.T, handler plugin.Handler, src string) bool {
+		t.Helper()
+
+		m := new(dns.Msg)
+		m.SetQuestion(qname, dns.TypeA)
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: src})
+		if _, err := handler.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatalf("ServeDNS failed: %v", err)
+		}
+
+		for _, rr := range rec.Msg.Answer {
+			if a, ok := rr.(*dns.A); ok && a.A.String() == cl.services[0].Spec.ClusterIP {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	tests := []struct {
+		name    string
+		guarded bool
+		// leak is whether the answer cached for the own tenant reaches the
+		// other one.
+		leak bool
+	}{
+		{name: "unguarded", leak: true},
+		{name: "guarded", guarded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cache.New()
+			c.Next = h
+
+			var handler plugin.Handler = c
+			if tt.guarded {
+				handler = &cacheGuard{capsule: h, cache: c}
+			}
+
+			if !answered(t, handler, own) {
+				t.Fatal("got no answer for the own tenant")
+			}
+
+			if got := answered(t, handler, other); got != tt.leak {
+				t.Errorf("got the cached answer served to the other tenant %t, want %t", got, tt.leak)
+			}
+
+			if !answered(t, handler, own) {
+				t.Error("got no answer for the own tenant once the other was blocked")
+			}
+		})
+	}
+}
+
+func TestGuardCache(t *testing.T) {
+	c := cache.New()
+	h := &Capsule{}
+	k := kubedns.New([]string{"cluster.local."})
+
+	config := &dnsserver.Config{Zone: "cluster.local.", ListenHosts: []string{""}, Port: "53"}
+	config.AddPlugin(func(next plugin.Handler) plugin.Handler {
+		c.Next = next
+
+		return c
+	})
+	guardCache(config, h)
+	config.AddPlugin(func(next plugin.Handler) plugin.Handler {
+		h.Next = next
+
+		return h
+	})
+	config.AddPlugin(func(plugin.Handler) plugin.Handler { return k })
+
+	if _, err := dnsserver.NewServer("dns://:53", []*dnsserver.Config{config}); err != nil {
+		t.Fatalf("failed to build the server block: %v", err)
+	}
+
+	g, ok := config.Handler("cache").(*cacheGuard)
+	if !ok {
+		t.Fatalf("got %T registered as cache, want the guard", config.Handler("cache"))
+	}
+
+	if g.cache != c || g.capsule != h || c.Next != h || h.Next != k {
+		t.Error("got the guard out of the chain, want it in front of the cache, itself in front of capsule")
+	}
+}
+
+func TestCachedZones(t *testing.T) {
+	zones := []string{"cluster.local.", "in-addr.arpa."}
+
+	setupCache, err := caddy.DirectiveAction("dns", "cache")
+	if err != nil {
+		t.Fatalf("cache plugin not registered: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{name: "whole server block", input: "cache 30 .", want: []string{"cluster.local.", "in-addr.arpa."}},
+		{name: "other zone", input: "cache 30 example.org"},
+		{name: "disabled", input: "cache 30 . {\ndisable success cluster.local in-addr.arpa\ndisable denial cluster.local in-addr.arpa\n}"},
+		{name: "successes only disabled", input: "cache 30 . {\ndisable success cluster.local\n}", want: []string{"cluster.local.", "in-addr.arpa."}},
+		{name: "reverse zone cached", input: "cache 30 . {\ndisable success cluster.local\ndisable denial cluster.local\n}", want: []string{"in-addr.arpa."}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctl := caddy.NewTestController("dns", tt.input)
+			if err := setupCache(ctl); err != nil {
+				t.Fatalf("failed to set up the cache: %v", err)
+			}
+
+			plugins := dnsserver.GetConfig(ctl).Plugin
+
+			c, ok := plugins[len(plugins)-1](nil).(*cache.Cache)
+			if !ok {
+				t.Fatal("cache plugin not added")
+			}
+
+			if got := cachedZones(c, zones); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
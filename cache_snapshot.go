@@ -0,0 +1,295 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	cacheSnapshotVersion         = 1
+	defaultCacheSnapshotInterval = time.Minute
+	defaultCacheSnapshotMaxAge   = time.Hour
+)
+
+// cacheSnapshot configures the file the namespaces, pods and services caches
+// are saved to and warm-booted from.
+type cacheSnapshot struct {
+	path     string
+	interval time.Duration
+	// maxAge is the age past which a snapshot is too stale to answer from.
+	maxAge time.Duration
+}
+
+// cacheSnapshotFile is the content of a snapshot file. The pods are stored as
+// slimPod leaves them.
+type cacheSnapshotFile struct {
+	Version    int             `json:"version"`
+	Taken      time.Time       `json:"taken"`
+	Namespaces []*v1.Namespace `json:"namespaces"`
+	Pods       []*v1.Pod       `json:"pods"`
+	Services   []*v1.Service   `json:"services"`
+}
+
+// useCacheSnapshot loads snapshot into the caches of s if its informers have
+// not started yet, then saves the caches to it every interval once synced.
+// Controllers sharing s with the same snapshot only do it once.
+func (s *informerSet) useCacheSnapshot(snapshot cacheSnapshot) {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	if s.snapshots[snapshot.path] {
+		return
+	}
+
+	if s.snapshots == nil {
+		s.snapshots = map[string]bool{}
+	}
+
+	s.snapshots[snapshot.path] = true
+
+	if !s.started && !s.warm.Load() {
+		if err := s.loadCacheSnapshot(snapshot.path, snapshot.maxAge); err != nil {
+			log.Warningf("ignoring cache snapshot %s: %v", snapshot.path, err)
+		}
+	}
+
+	go s.saveCacheSnapshots(snapshot.path, snapshot.interval)
+}
+
+// loadCacheSnapshot fills the caches of s from the snapshot at path. The
+// initial lists reconcile them with the cluster: the informers see the loaded
+// objects as known and deliver updates, and deletions for those that are gone.
+func (s *informerSet) loadCacheSnapshot(path string, maxAge time.Duration) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Infof("No cache snapshot at %s, waiting for the initial sync", path)
+
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var snapshot cacheSnapshotFile
+	if err := json.NewDecoder(f).Decode(&snapshot); err != nil {
+		return err
+	}
+
+	if snapshot.Version != cacheSnapshotVersion {
+		return fmt.Errorf("unsupported version %d", snapshot.Version)
+	}
+
+	age := time.Since(snapshot.Taken)
+	if age > maxAge {
+		return fmt.Errorf("taken %s ago, over the maximum age of %s", age.Round(time.Second), maxAge)
+	}
+
+	for _, ns := range snapshot.Namespaces {
+		if err := s.namespaces.GetIndexer().Add(ns); err != nil {
+			return err
+		}
+	}
+
+	if s.pods == nil {
+		snapshot.Pods = nil
+	}
+
+	if s.services == nil {
+		snapshot.Services = nil
+	}
+
+	for _, pod := range snapshot.Pods {
+		if err := s.pods.GetIndexer().Add(pod); err != nil {
+			return err
+		}
+
+		s.ips.update(nil, pod, podIPs)
+	}
+
+	for _, svc := range snapshot.Services {
+		if err := s.services.GetIndexer().Add(svc); err != nil {
+			return err
+		}
+
+		s.ips.update(nil, svc, serviceIPs)
+	}
+
+	s.warm.Store(true)
+
+	log.Infof("Loaded cache snapshot %s taken %s ago: %d namespaces, %d pods, %d services",
+		path, age.Round(time.Second), len(snapshot.Namespaces), len(snapshot.Pods), len(snapshot.Services))
+
+	return nil
+}
+
+// ReadCacheSnapshot decodes the namespaces, pods and services of a file saved
+// with cache_snapshot, as fixtures for NewSimulation or NewReplay. The age of
+// the snapshot is not checked.
+func ReadCacheSnapshot(r io.Reader) ([]runtime.Object, error) {
+	var snapshot cacheSnapshotFile
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return nil, err
+	}
+
+	if snapshot.Version != cacheSnapshotVersion {
+		return nil, fmt.Errorf("unsupported version %d", snapshot.Version)
+	}
+
+	objects := make([]runtime.Object, 0, len(snapshot.Namespaces)+len(snapshot.Pods)+len(snapshot.Services))
+
+	for _, ns := range snapshot.Namespaces {
+		objects = append(objects, ns)
+	}
+
+	for _, pod := range snapshot.Pods {
+		objects = append(objects, pod)
+	}
+
+	for _, svc := range snapshot.Services {
+		objects = append(objects, svc)
+	}
+
+	return objects, nil
+}
+
+// saveCacheSnapshots saves the caches of s to path every interval until s
+// stops. Nothing is saved before the initial sync, which would replace a
+// complete snapshot by a partial one.
+func (s *informerSet) saveCacheSnapshots(path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		if !s.synced() {
+			continue
+		}
+
+		if err := s.saveCacheSnapshot(path); err != nil {
+			log.Warningf("failed to save cache snapshot %s: %v", path, err)
+		}
+	}
+}
+
+// synced reports whether the namespaces, pods and services informers hold
+// their initial lists.
+func (s *informerSet) synced() bool {
+	for _, informer := range []cache.SharedIndexInformer{s.namespaces, s.pods, s.services} {
+		if informer != nil && !informer.HasSynced() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// saveCacheSnapshot writes the caches of s to path. The file is replaced
+// atomically, a crash while saving leaves the previous snapshot in place.
+func (s *informerSet) saveCacheSnapshot(path string) error {
+	snapshot := cacheSnapshotFile{
+		Version: cacheSnapshotVersion,
+		Taken:   time.Now().UTC(),
+	}
+
+	for _, obj := range s.namespaces.GetStore().List() {
+		if ns, ok := obj.(*v1.Namespace); ok {
+			ns = ns.DeepCopy()
+			ns.ManagedFields = nil
+			snapshot.Namespaces = append(snapshot.Namespaces, ns)
+		}
+	}
+
+	if s.pods != nil {
+		for _, obj := range s.pods.GetStore().List() {
+			if pod, ok := obj.(*v1.Pod); ok {
+				snapshot.Pods = append(snapshot.Pods, pod)
+			}
+		}
+	}
+
+	if s.services != nil {
+		for _, obj := range s.services.GetStore().List() {
+			if svc, ok := obj.(*v1.Service); ok {
+				svc = svc.DeepCopy()
+				svc.ManagedFields = nil
+				snapshot.Services = append(snapshot.Services, svc)
+			}
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(snapshot); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Warm reports whether c answers from caches loaded from a snapshot while its
+// initial sync is in progress. The snapshot only holds namespaces, pods and
+// services: the other informers c uses have to sync first, answering without
+// them could allow what they deny.
+func (c *dnsController) Warm() bool {
+	if !c.informers.warm.Load() {
+		return false
+	}
+
+	if c.netpolInformer != nil && !c.netpolInformer.HasSynced() {
+		return false
+	}
+
+	if c.ingressInformer != nil && !c.ingressInformer.HasSynced() {
+		return false
+	}
+
+	if c.accessInformer != nil && !c.accessInformer.HasSynced() {
+		return false
+	}
+
+	if c.externalInformer != nil && !c.externalInformer.HasSynced() {
+		return false
+	}
+
+	if c.tenantInformer != nil && !c.tenantInformer.HasSynced() {
+		return false
+	}
+
+	for _, informer := range c.replicaInformers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,275 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseCacheSnapshot(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    cacheSnapshot
+		wantErr bool
+	}{
+		{name: "disabled", input: "capsule {\nnetworkpolicies\n}"},
+		{
+			name:  "defaults",
+			input: "capsule {\ncache_snapshot /var/run/capsule/cache.json\n}",
+			want:  cacheSnapshot{path: "/var/run/capsule/cache.json", interval: time.Minute, maxAge: time.Hour},
+		},
+		{
+			name:  "interval and max age",
+			input: "capsule {\ncache_snapshot /var/run/capsule/cache.json 30s 10m\n}",
+			want:  cacheSnapshot{path: "/var/run/capsule/cache.json", interval: 30 * time.Second, maxAge: 10 * time.Minute},
+		},
+		{name: "missing path", input: "capsule {\ncache_snapshot\n}", wantErr: true},
+		{name: "invalid interval", input: "capsule {\ncache_snapshot /tmp/cache.json 0s\n}", wantErr: true},
+		{name: "invalid max age", input: "capsule {\ncache_snapshot /tmp/cache.json 1m soon\n}", wantErr: true},
+		{name: "too many args", input: "capsule {\ncache_snapshot /tmp/cache.json 1m 1h 1d\n}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if h.cacheSnapshot != tt.want {
+				t.Errorf("got %+v, want %+v", h.cacheSnapshot, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheSnapshotWarmBoot(t *testing.T) {
+	cl := newCluster(2, 2, 1)
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	previous, err := newDNSControllerForClient(fake.NewClientset(cl.objects()...), dnsControllerOptions{})
+	if err != nil {
+		t.Fatalf("failed to create DNS controller: %v", err)
+	}
+
+	go previous.Start()
+	t.Cleanup(previous.Stop)
+
+	waitForSync(t, previous)
+
+	if err := previous.informers.saveCacheSnapshot(path); err != nil {
+		t.Fatalf("failed to save cache snapshot: %v", err)
+	}
+
+	// tenant-1/pod-0 went away while CoreDNS restarted.
+	gone := cl.pods[2]
+
+	objs := make([]runtime.Object, 0, len(cl.objects()))
+	for _, obj := range cl.objects() {
+		if obj != gone {
+			objs = append(objs, obj)
+		}
+	}
+
+	set, err := newInformerSet(fake.NewClientset(objs...), apiConfig{})
+	if err != nil {
+		t.Fatalf("failed to create informers: %v", err)
+	}
+
+	set.refs++
+
+	snapshot := cacheSnapshot{path: path, interval: time.Hour, maxAge: time.Hour}
+
+	ctrl, err := newDNSControllerForSet(set, dnsControllerOptions{cacheSnapshot: snapshot})
+	if err != nil {
+		t.Fatalf("failed to create DNS controller: %v", err)
+	}
+
+	t.Cleanup(ctrl.Stop)
+
+	// The NetworkPolicy cache is not part of the snapshot.
+	netpolCtrl, err := newDNSControllerForSet(set, dnsControllerOptions{cacheSnapshot: snapshot, networkPolicies: true})
+	if err != nil {
+		t.Fatalf("failed to create DNS controller: %v", err)
+	}
+
+	t.Cleanup(netpolCtrl.Stop)
+
+	if ctrl.HasSynced() || !ctrl.Warm() {
+		t.Fatalf("got synced=%t warm=%t before starting, want synced=false warm=true", ctrl.HasSynced(), ctrl.Warm())
+	}
+
+	if netpolCtrl.Warm() {
+		t.Error("answering from the snapshot before the NetworkPolicies synced")
+	}
+
+	h := Capsule{}
+
+	tests := []struct {
+		name    string
+		src     int
+		dst     int
+		allowed bool
+		reason  string
+	}{
+		{name: "same tenant", src: 0, dst: 0, allowed: true, reason: reasonSameTenant},
+		{name: "cross tenant", src: 0, dst: 1, reason: reasonCrossTenant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := ctrl.Evaluate(t.Context(), cl.pods[tt.src].Status.PodIPs[0].IP, cl.services[tt.dst].Spec.ClusterIP, h)
+			if d.allowed != tt.allowed || d.reason != tt.reason {
+				t.Errorf("got allowed=%t reason=%s, want allowed=%t reason=%s", d.allowed, d.reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+
+	go ctrl.Start()
+	go netpolCtrl.Start()
+
+	waitForSync(t, ctrl)
+	waitForSync(t, netpolCtrl)
+
+	if objs := set.ips.lookup(gone.Status.PodIPs[0].IP); len(objs) != 0 {
+		t.Errorf("pod deleted during the restart still holds %s: %v", gone.Status.PodIPs[0].IP, objs)
+	}
+
+	if ns, _, _, err := ctrl.getObjectByIP(t.Context(), cl.pods[3].Status.PodIPs[0].IP); err != nil || ns.Name != "tenant-1" {
+		t.Errorf("got namespace %v err %v for tenant-1/pod-1, want tenant-1", ns, err)
+	}
+}
+
+func TestCacheSnapshotIgnored(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(path string) error
+	}{
+		{name: "missing", write: func(string) error { return nil }},
+		{name: "malformed", write: func(path string) error { return os.WriteFile(path, []byte("{"), 0o600) }},
+		{name: "stale", write: func(path string) error {
+			return writeJSON(path, cacheSnapshotFile{Version: cacheSnapshotVersion, Taken: time.Now().Add(-2 * time.Hour)})
+		}},
+		{name: "unknown version", write: func(path string) error {
+			return writeJSON(path, cacheSnapshotFile{Version: cacheSnapshotVersion + 1, Taken: time.Now()})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cache.json")
+			if err := tt.write(path); err != nil {
+				t.Fatalf("failed to write snapshot: %v", err)
+			}
+
+			set, err := newInformerSet(fake.NewClientset(), apiConfig{})
+			if err != nil {
+				t.Fatalf("failed to create informers: %v", err)
+			}
+
+			ctrl, err := newDNSControllerForSet(set, dnsControllerOptions{
+				cacheSnapshot: cacheSnapshot{path: path, interval: time.Hour, maxAge: time.Hour},
+			})
+			if err != nil {
+				t.Fatalf("failed to create DNS controller: %v", err)
+			}
+
+			t.Cleanup(ctrl.Stop)
+
+			if ctrl.Warm() {
+				t.Error("answering from an unusable snapshot")
+			}
+		})
+	}
+}
+
+func TestCacheSnapshotSaved(t *testing.T) {
+	cl := newCluster(1, 1, 1)
+
+	// The saver may still be writing when the test ends, which t.TempDir
+	// reports as a failure to clean up.
+	dir, err := os.MkdirTemp("", "capsule-snapshot")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "cache.json")
+
+	set, err := newInformerSet(fake.NewClientset(cl.objects()...), apiConfig{})
+	if err != nil {
+		t.Fatalf("failed to create informers: %v", err)
+	}
+
+	ctrl, err := newDNSControllerForSet(set, dnsControllerOptions{
+		cacheSnapshot: cacheSnapshot{path: path, interval: 10 * time.Millisecond, maxAge: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("failed to create DNS controller: %v", err)
+	}
+
+	go ctrl.Start()
+	t.Cleanup(ctrl.Stop)
+
+	waitForSync(t, ctrl)
+
+	deadline := time.Now().Add(10 * time.Second)
+
+	for {
+		raw, err := os.ReadFile(path)
+		if err == nil {
+			var snapshot cacheSnapshotFile
+			if err := json.Unmarshal(raw, &snapshot); err != nil {
+				t.Fatalf("malformed snapshot: %v", err)
+			}
+
+			if len(snapshot.Namespaces) != 1 || len(snapshot.Pods) != 1 || len(snapshot.Services) != 1 {
+				t.Fatalf("got %d namespaces, %d pods, %d services, want one of each",
+					len(snapshot.Namespaces), len(snapshot.Pods), len(snapshot.Services))
+			}
+
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("no snapshot saved: %v", err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func writeJSON(path string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, raw, 0o600)
+}
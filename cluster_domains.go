@@ -0,0 +1,61 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"fmt"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/kubernetes"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/miekg/dns"
+)
+
+// clusterZones returns the zones of k enforced with cluster_domains: the
+// domains themselves, each of which k must serve, and the reverse zones of k.
+// Without domains every zone of k is enforced.
+func clusterZones(domains []string, k *kubernetes.Kubernetes) ([]string, error) {
+	if len(domains) == 0 {
+		return k.Zones, nil
+	}
+
+	zones := make([]string, 0, len(domains)+len(k.Zones))
+
+	for _, domain := range domains {
+		if plugin.Zones(k.Zones).Matches(domain) == "" {
+			return nil, fmt.Errorf("cluster domain %s is not served by the kubernetes plugin, whose zones are %v", domain, k.Zones)
+		}
+
+		zones = append(zones, domain)
+	}
+
+	for _, zone := range k.Zones {
+		if reverseZone(zone) {
+			zones = append(zones, zone)
+		}
+	}
+
+	return zones, nil
+}
+
+// reverseZone reports whether zone lies within in-addr.arpa. or ip6.arpa.,
+// which dnsutil.IsReverse doesn't tell of their apex.
+func reverseZone(zone string) bool {
+	return dns.IsSubDomain(dnsutil.IP4arpa[1:], zone) || dns.IsSubDomain(dnsutil.IP6arpa[1:], zone)
+}
+
+// zones returns the zones whose names h enforces.
+func (h *Capsule) zones() []string {
+	if h.clusterZones != nil {
+		return h.clusterZones
+	}
+
+	return h.kubernetesHandler.Zones
+}
+
+// zoneOf returns the zone of name among those h enforces, empty when outside
+// of all of them.
+func (h *Capsule) zoneOf(name string) string {
+	return plugin.Zones(h.zones()).Matches(name)
+}
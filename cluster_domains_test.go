@@ -0,0 +1,148 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/coredns/caddy"
+	kubedns "github.com/coredns/coredns/plugin/kubernetes"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestParseClusterDomains(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "domains", input: "capsule {\ncluster_domains cluster.local Corp.Internal.\n}", want: []string{"cluster.local.", "corp.internal."}},
+		{name: "missing domain", input: "capsule {\ncluster_domains\n}", wantErr: true},
+		{name: "root", input: "capsule {\ncluster_domains .\n}", wantErr: true},
+		{name: "reverse zone", input: "capsule {\ncluster_domains in-addr.arpa\n}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(h.clusterDomains, tt.want) {
+				t.Errorf("got %v, want %v", h.clusterDomains, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterZones(t *testing.T) {
+	k := kubedns.New([]string{"cluster.local.", "corp.internal.", "in-addr.arpa."})
+
+	tests := []struct {
+		name    string
+		domains []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "kubernetes zones", want: []string{"cluster.local.", "corp.internal.", "in-addr.arpa."}},
+		{name: "single domain", domains: []string{"corp.internal."}, want: []string{"corp.internal.", "in-addr.arpa."}},
+		{name: "unserved domain", domains: []string{"cluster.local.", "other.internal."}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := clusterZones(tt.domains, k)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeDNSClusterDomains(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+
+	k := kubedns.New([]string{testZone, "corp.internal."})
+	k.APIConn = newFakeAPIConn(cl)
+	k.Upstream = emptyUpstream{}
+	h.Next = k
+	h.kubernetesHandler = k
+
+	src := cl.pods[0].Status.PodIPs[0].IP
+	other := cl.services[1]
+
+	tests := []struct {
+		name    string
+		domains []string
+		zone    string
+		denied  bool
+	}{
+		{name: "cluster.local", zone: testZone, denied: true},
+		{name: "corp.internal", zone: "corp.internal.", denied: true},
+		{name: "unenforced domain", domains: []string{testZone}, zone: "corp.internal."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zones, err := clusterZones(tt.domains, k)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			h.clusterDomains, h.clusterZones = tt.domains, zones
+
+			m := new(dns.Msg)
+			m.SetQuestion(other.Name+"."+other.Namespace+".svc."+tt.zone, dns.TypeA)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: src})
+			if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+				t.Fatalf("ServeDNS failed: %v", err)
+			}
+
+			answered := slices.ContainsFunc(rec.Msg.Answer, func(rr dns.RR) bool {
+				a, ok := rr.(*dns.A)
+
+				return ok && a.A.String() == other.Spec.ClusterIP
+			})
+
+			if answered == tt.denied {
+				t.Errorf("got answered %t, want denied %t", answered, tt.denied)
+			}
+		})
+	}
+}
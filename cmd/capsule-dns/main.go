@@ -0,0 +1,132 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+// Command capsule-dns runs the capsule policy as a gRPC service, for clusters
+// whose CoreDNS image can't be replaced. The stock grpc plugin of CoreDNS
+// forwards the cluster zone to it, along with the address of the pod asking in
+// an EDNS0 client subnet option, and capsule-dns resolves the question through
+// the upstream DNS server, a CoreDNS server block serving the kubernetes
+// plugin, before enforcing the policy on the answer:
+//
+//	capsule-dns -config capsule.conf -upstream 10.96.0.10:5353
+//
+// Behind a load balancer sending the PROXY protocol, list it with
+// trusted_frontends in the capsule block: the address of the CoreDNS instance
+// the header names is the peer the edns trusted addresses are matched against.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	capsule "github.com/CorentinPtrl/capsule_coredns"
+	"github.com/miekg/dns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func main() {
+	listen := flag.String("listen", ":9053", "address to serve gRPC on")
+	upstream := flag.String("upstream", "", "address of the DNS server resolving the questions, such as 10.96.0.10:5353")
+	config := flag.String("config", "", "file holding the content of the capsule block")
+	timeout := flag.Duration("timeout", 2*time.Second, "timeout of the queries to the upstream server")
+	certFile := flag.String("tls-cert", "", "certificate to serve gRPC over TLS with")
+	keyFile := flag.String("tls-key", "", "key of the certificate")
+	flag.Parse()
+
+	if *upstream == "" || (*certFile == "") != (*keyFile == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*listen, *upstream, *config, *timeout, *certFile, *keyFile); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(listen, upstream, configFile string, timeout time.Duration, certFile, keyFile string) error {
+	var config []byte
+
+	if configFile != "" {
+		var err error
+
+		config, err = os.ReadFile(configFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	mw, err := capsule.NewMiddleware(string(config), &forwarder{addr: upstream, timeout: timeout})
+	if err != nil {
+		return err
+	}
+
+	if err := mw.Start(); err != nil {
+		return err
+	}
+	defer mw.Stop() //nolint:errcheck
+
+	var opts []grpc.ServerOption
+
+	if certFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+
+	server := grpc.NewServer(opts...)
+	capsule.NewDNSService(mw).Register(server)
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.Serve(mw.Listener(ln)) }()
+
+	log.Printf("serving gRPC on %s, resolving through %s", ln.Addr(), upstream)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err = <-errs:
+	case <-signals:
+		server.GracefulStop()
+	}
+
+	return err
+}
+
+// forwarder resolves the questions through the DNS server at addr, over UDP
+// then TCP when the answer is truncated.
+type forwarder struct {
+	addr    string
+	timeout time.Duration
+}
+
+func (f *forwarder) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	udp := &dns.Client{Net: "udp", Timeout: f.timeout}
+
+	m, _, err := udp.Exchange(r, f.addr)
+	if err == nil && m.Truncated {
+		tcp := &dns.Client{Net: "tcp", Timeout: f.timeout}
+		m, _, err = tcp.Exchange(r, f.addr)
+	}
+
+	if err != nil {
+		m = new(dns.Msg)
+		m.SetRcode(r, dns.RcodeServerFailure)
+	}
+
+	_ = w.WriteMsg(m)
+}
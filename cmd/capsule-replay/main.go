@@ -0,0 +1,188 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+// Command capsule-replay replays captured queries through a proposed capsule
+// configuration, against a cluster snapshot, and reports those it would block,
+// before the configuration is enabled:
+//
+//	capsule-replay -config proposed.conf -snapshot cache.json -log coredns.log
+//	capsule-replay -config proposed.conf -dnstap capture.fstrm cluster.yaml
+//
+// The snapshot is a file saved with cache_snapshot, the fixtures are those of
+// capsule-sim, such as the output of kubectl get namespaces,pods,services -A
+// -o yaml.
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	capsule "github.com/CorentinPtrl/capsule_coredns"
+	"github.com/miekg/dns"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func main() {
+	config := flag.String("config", "", "file holding the content of the proposed capsule block")
+	zone := flag.String("zone", "cluster.local.", "cluster zone, served with the cluster_domains of the configuration")
+	snapshot := flag.String("snapshot", "", "cache snapshot to replay against")
+	dnstap := flag.String("dnstap", "", "dnstap capture to replay")
+	queryLog := flag.String("log", "", "query log of the CoreDNS log plugin to replay")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [FIXTURE...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if (*dnstap == "") == (*queryLog == "") || (*snapshot == "" && flag.NArg() == 0) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(os.Stdout, *config, *zone, *snapshot, *dnstap, *queryLog, flag.Args()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// blocked is the queries blocked for the same reason, from a namespace to
+// the same name.
+type blocked struct {
+	namespace    string
+	qtype        uint16
+	name         string
+	reason       string
+	dstNamespace string
+}
+
+func run(out io.Writer, configFile, zone, snapshot, dnstap, queryLog string, fixtures []string) error {
+	var config []byte
+
+	if configFile != "" {
+		var err error
+
+		config, err = os.ReadFile(configFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	var objects []runtime.Object
+
+	if snapshot != "" {
+		objs, err := readFile(snapshot, capsule.ReadCacheSnapshot)
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, objs...)
+	}
+
+	for _, path := range fixtures {
+		objs, err := readFile(path, capsule.ReadFixtures)
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, objs...)
+	}
+
+	var (
+		queries []capsule.ReplayQuery
+		err     error
+	)
+
+	if dnstap != "" {
+		queries, err = readFile(dnstap, capsule.ReadDnstap)
+	} else {
+		queries, err = readFile(queryLog, capsule.ReadQueryLog)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	replay, err := capsule.NewReplay(string(config), zone, objects)
+	if err != nil {
+		return err
+	}
+
+	if err := replay.Start(); err != nil {
+		return err
+	}
+	defer replay.Stop() //nolint:errcheck
+
+	var evaluated, denied int
+
+	counts := map[blocked]int{}
+
+	for _, q := range queries {
+		decisions := replay.Evaluate(q)
+		if len(decisions) > 0 {
+			evaluated++
+		}
+
+		i := slices.IndexFunc(decisions, func(d capsule.Decision) bool { return d.Action == capsule.ActionBlock })
+		if i < 0 {
+			continue
+		}
+
+		denied++
+
+		d := decisions[i]
+		counts[blocked{
+			namespace:    d.Source.Namespace,
+			qtype:        q.Type,
+			name:         d.QName,
+			reason:       d.Reason,
+			dstNamespace: d.Destination.Namespace,
+		}]++
+	}
+
+	rows := make([]blocked, 0, len(counts))
+	for b := range counts {
+		rows = append(rows, b)
+	}
+
+	slices.SortFunc(rows, func(a, b blocked) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a.namespace, b.namespace), cmp.Compare(a.name, b.name))
+	})
+
+	if len(rows) > 0 {
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "COUNT\tNAMESPACE\tTYPE\tNAME\tREASON\tDESTINATION")
+
+		for _, b := range rows {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", counts[b], b.namespace, dns.TypeToString[b.qtype], b.name, b.reason, b.dstNamespace)
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(out, "%d of %d queries would be blocked, %d were evaluated\n", denied, len(queries), evaluated)
+
+	return err
+}
+
+// readFile decodes the file at path with read.
+func readFile[T any](path string, read func(io.Reader) ([]T, error)) ([]T, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values, err := read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return values, nil
+}
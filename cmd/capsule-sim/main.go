@@ -0,0 +1,112 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+// Command capsule-sim serves DNS for a cluster described by YAML fixtures, with
+// the capsule policy in front of the kubernetes plugin, so that selectors and
+// custom resources can be tried on a laptop without a cluster:
+//
+//	capsule-sim -config capsule.conf fixtures/*.yaml
+//	dig @127.0.0.1 -p 1053 +subnet=10.0.0.7/32 api.team-b.svc.cluster.local
+//
+// The subnet option picks the pod or service the query comes from.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	capsule "github.com/CorentinPtrl/capsule_coredns"
+	"github.com/miekg/dns"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:1053", "address to serve DNS on, over UDP and TCP")
+	zone := flag.String("zone", "cluster.local.", "cluster zone, served with the cluster_domains of the configuration")
+	config := flag.String("config", "", "file holding the content of the capsule block")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] FIXTURE...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*listen, *zone, *config, flag.Args()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(listen, zone, configFile string, fixtures []string) error {
+	var config []byte
+
+	if configFile != "" {
+		var err error
+
+		config, err = os.ReadFile(configFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	var objects []runtime.Object
+
+	for _, path := range fixtures {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		objs, err := capsule.ReadFixtures(f)
+		_ = f.Close()
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		objects = append(objects, objs...)
+	}
+
+	sim, err := capsule.NewSimulation(string(config), zone, objects)
+	if err != nil {
+		return err
+	}
+
+	if err := sim.Start(); err != nil {
+		return err
+	}
+	defer sim.Stop() //nolint:errcheck
+
+	errs := make(chan error, 2)
+
+	servers := []*dns.Server{
+		{Addr: listen, Net: "udp", Handler: sim},
+		{Addr: listen, Net: "tcp", Handler: sim},
+	}
+	for _, srv := range servers {
+		go func() { errs <- srv.ListenAndServe() }()
+	}
+
+	log.Printf("serving %s from %d objects on %s", zone, len(objects), listen)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err = <-errs:
+	case <-signals:
+	}
+
+	for _, srv := range servers {
+		_ = srv.Shutdown()
+	}
+
+	return err
+}
@@ -0,0 +1,309 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/cache"
+)
+
+// configResource is the cluster-scoped CapsuleCoreDNSConfig custom resource,
+// which overrides the policy options of the Corefile.
+var configResource = schema.GroupVersionResource{
+	Group:    "dns.capsule.clastix.io",
+	Version:  "v1alpha1",
+	Resource: "capsulecorednsconfigs",
+}
+
+// configSpec is the spec of a CapsuleCoreDNSConfig. Each field set replaces
+// the option of the Corefile it is named after, the others keep it.
+type configSpec struct {
+	Labels               *metav1.LabelSelector `json:"labels,omitempty"`
+	NamespaceLabels      *metav1.LabelSelector `json:"namespaceLabels,omitempty"`
+	NamespaceAnnotations *metav1.LabelSelector `json:"namespaceAnnotations,omitempty"`
+	ExposureLabel        string                `json:"exposureLabel,omitempty"`
+	PodExposureLabel     string                `json:"podExposureLabel,omitempty"`
+	SelectorMode         string                `json:"selectorMode,omitempty"`
+	NamespaceScope       string                `json:"namespaceScope,omitempty"`
+	Visibility           *bool                 `json:"visibility,omitempty"`
+	StrictTenants        []string              `json:"strictTenants,omitempty"`
+	TenantAliases        map[string][]string   `json:"tenantAliases,omitempty"`
+	Apex                 string                `json:"apex,omitempty"`
+	NamespaceGrace       *metav1.Duration      `json:"namespaceGrace,omitempty"`
+	EnforceQtypes        []string              `json:"enforceQtypes,omitempty"`
+	Sinkhole             []string              `json:"sinkhole,omitempty"`
+	BlockedCNAME         string                `json:"blockedCNAME,omitempty"`
+	MinimalResponses     *bool                 `json:"minimalResponses,omitempty"`
+	LogLevel             string                `json:"logLevel,omitempty"`
+}
+
+// policy returns the handler applying the policy in force: h as configured by
+// the Corefile, or a copy of it with the overrides of its CapsuleCoreDNSConfig.
+func (h *Capsule) policy() *Capsule {
+	if h.live == nil {
+		return h
+	}
+
+	if p := h.live.Load(); p != nil {
+		return p
+	}
+
+	return h
+}
+
+// watchConfig applies the CapsuleCoreDNSConfig named by config_resource as it
+// changes. An invalid one is ignored, the policy in force is kept.
+func (h *Capsule) watchConfig() error {
+	informer := h.dnsController.configInformer
+	if informer == nil {
+		return errors.New("no CapsuleCoreDNSConfig informer")
+	}
+
+	apply := func(obj any) {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok || u.GetName() != h.configName {
+			return
+		}
+
+		p, err := h.withConfig(u)
+		if err != nil {
+			log.Warningf("ignoring CapsuleCoreDNSConfig %s: %v", h.configName, err)
+
+			return
+		}
+
+		h.live.Store(p)
+		log.Infof("applied CapsuleCoreDNSConfig %s generation %d", h.configName, u.GetGeneration())
+		log.configure(h, p.logLevel)
+	}
+
+	registration, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    apply,
+		UpdateFunc: func(_, obj any) { apply(obj) },
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			if u, ok := obj.(*unstructured.Unstructured); ok && u.GetName() == h.configName {
+				h.live.Store(nil)
+				log.Infof("CapsuleCoreDNSConfig %s deleted, back to the Corefile policy", h.configName)
+				log.configure(h, h.logLevel)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	h.configRegistration = registration
+
+	return nil
+}
+
+// unwatchConfig stops applying the CapsuleCoreDNSConfig.
+func (h *Capsule) unwatchConfig() {
+	if h.configRegistration == nil {
+		return
+	}
+
+	_ = h.dnsController.configInformer.RemoveEventHandler(h.configRegistration)
+	h.configRegistration = nil
+}
+
+// withConfig returns a copy of h with the overrides of the CapsuleCoreDNSConfig
+// u. The copy shares the controller, counters, sinks and prefetcher of h, which
+// resolves with the policy in force, and gets caches of its own since the
+// decisions they hold may no longer hold.
+func (h *Capsule) withConfig(u *unstructured.Unstructured) (*Capsule, error) {
+	var spec configSpec
+
+	raw, _, _ := unstructured.NestedMap(u.Object, "spec")
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &spec); err != nil {
+		return nil, err
+	}
+
+	p := *h
+
+	if err := p.applyConfig(spec); err != nil {
+		return nil, err
+	}
+
+	if p.cache != nil {
+		p.cache = newDecisionCache(p.cacheTTL, p.cacheSize)
+	}
+
+	if p.search != nil {
+		p.search = newSearchCache(p.searchTTL, p.searchSize)
+	}
+
+	return &p, nil
+}
+
+// applyConfig sets the options of spec, validated as their directives.
+func (h *Capsule) applyConfig(spec configSpec) error {
+	for _, s := range []struct {
+		name     string
+		selector *metav1.LabelSelector
+		target   **selector
+	}{
+		{"labels", spec.Labels, &h.labelSelector},
+		{"namespaceLabels", spec.NamespaceLabels, &h.namespaceLabelSelector},
+		{"namespaceAnnotations", spec.NamespaceAnnotations, &h.namespaceAnnotations},
+	} {
+		if s.selector == nil {
+			continue
+		}
+
+		compiled, err := newSelector(s.selector)
+		if err != nil {
+			return fmt.Errorf("invalid %s selector: %w", s.name, err)
+		}
+
+		*s.target = compiled
+	}
+
+	if spec.ExposureLabel != "" {
+		if errs := validation.IsQualifiedName(spec.ExposureLabel); len(errs) > 0 {
+			return fmt.Errorf("invalid exposureLabel key '%s': %s", spec.ExposureLabel, strings.Join(errs, ", "))
+		}
+
+		h.exposureLabel = spec.ExposureLabel
+	}
+
+	if spec.PodExposureLabel != "" {
+		if errs := validation.IsQualifiedName(spec.PodExposureLabel); len(errs) > 0 {
+			return fmt.Errorf("invalid podExposureLabel key '%s': %s", spec.PodExposureLabel, strings.Join(errs, ", "))
+		}
+
+		h.podExposureLabel = spec.PodExposureLabel
+	}
+
+	switch spec.SelectorMode {
+	case "":
+	case selectorModeAny, selectorModeAll:
+		h.selectorMode = spec.SelectorMode
+	default:
+		return fmt.Errorf("invalid selectorMode '%s'", spec.SelectorMode)
+	}
+
+	switch spec.NamespaceScope {
+	case "":
+	case namespaceScopeCrossTenant, namespaceScopeNonTenant, namespaceScopeAll:
+		h.namespaceScope = spec.NamespaceScope
+	default:
+		return fmt.Errorf("invalid namespaceScope '%s'", spec.NamespaceScope)
+	}
+
+	if spec.Visibility != nil {
+		h.visibility = *spec.Visibility
+	}
+
+	if spec.StrictTenants != nil {
+		h.strictTenants = make(map[string]bool, len(spec.StrictTenants))
+		for _, tenant := range spec.StrictTenants {
+			h.strictTenants[tenant] = true
+		}
+	}
+
+	if spec.TenantAliases != nil {
+		h.tenantAliases = make(map[string]string)
+		for _, tenant := range slices.Sorted(maps.Keys(spec.TenantAliases)) {
+			if err := addTenantAliases(h.tenantAliases, tenant, spec.TenantAliases[tenant]); err != nil {
+				return fmt.Errorf("invalid tenantAliases: %w", err)
+			}
+		}
+	}
+
+	switch spec.Apex {
+	case "":
+	case apexAllow, apexNamespace:
+		h.apex = spec.Apex
+	default:
+		return fmt.Errorf("invalid apex behavior '%s'", spec.Apex)
+	}
+
+	if spec.NamespaceGrace != nil {
+		if spec.NamespaceGrace.Duration <= 0 {
+			return fmt.Errorf("invalid namespaceGrace duration '%s'", spec.NamespaceGrace.Duration)
+		}
+
+		h.namespaceGrace = spec.NamespaceGrace.Duration
+	}
+
+	if spec.EnforceQtypes != nil {
+		h.enforcedQtypes = make(map[uint16]bool, len(spec.EnforceQtypes))
+
+		for _, arg := range spec.EnforceQtypes {
+			qtype, ok := dns.StringToType[strings.ToUpper(arg)]
+			if !ok || !enforceableQtypes[qtype] {
+				return fmt.Errorf("unsupported enforceQtypes type '%s'", arg)
+			}
+
+			h.enforcedQtypes[qtype] = true
+		}
+	}
+
+	if spec.Sinkhole != nil && spec.BlockedCNAME != "" {
+		return errors.New("sinkhole and blockedCNAME are mutually exclusive")
+	}
+
+	// Both shape the answers to blocked address queries, setting one drops
+	// the other.
+	if spec.Sinkhole != nil {
+		if len(spec.Sinkhole) > 2 {
+			return errors.New("sinkhole takes an IPv4 and an IPv6 address at most")
+		}
+
+		h.sinkholeV4, h.sinkholeV6, h.blockedCNAME = nil, nil, ""
+
+		for _, arg := range spec.Sinkhole {
+			ip := net.ParseIP(arg)
+			if ip == nil {
+				return fmt.Errorf("invalid sinkhole address '%s'", arg)
+			}
+
+			if ip4 := ip.To4(); ip4 != nil {
+				h.sinkholeV4 = ip4
+			} else {
+				h.sinkholeV6 = ip
+			}
+		}
+	}
+
+	if spec.BlockedCNAME != "" {
+		if _, ok := dns.IsDomainName(spec.BlockedCNAME); !ok {
+			return fmt.Errorf("invalid blockedCNAME target '%s'", spec.BlockedCNAME)
+		}
+
+		h.blockedCNAME = dns.Fqdn(strings.ToLower(spec.BlockedCNAME))
+		h.sinkholeV4, h.sinkholeV6 = nil, nil
+	}
+
+	if spec.MinimalResponses != nil {
+		h.minimalResponses = *spec.MinimalResponses
+	}
+
+	switch {
+	case spec.LogLevel == "":
+	case slices.Contains(logLevels, spec.LogLevel):
+		h.logLevel = spec.LogLevel
+	default:
+		return fmt.Errorf("invalid logLevel '%s'", spec.LogLevel)
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newConfigResource(name string, spec map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "dns.capsule.clastix.io/v1alpha1",
+		"kind":       "CapsuleCoreDNSConfig",
+		"metadata":   map[string]any{"name": name},
+		"spec":       spec,
+	}}
+}
+
+func TestApplyConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    map[string]any
+		wantErr bool
+		check   func(*Capsule) bool
+	}{
+		{
+			name:  "selector",
+			spec:  map[string]any{"labels": map[string]any{"matchLabels": map[string]any{"expose": "true"}}},
+			check: func(h *Capsule) bool { return h.labelSelector != nil },
+		},
+		{
+			name:  "modes",
+			spec:  map[string]any{"selectorMode": "all", "namespaceScope": "all", "apex": "namespace", "strictTenants": []any{"a"}},
+			check: func(h *Capsule) bool { return h.selectorMode == "all" && h.apex == "namespace" && h.strictTenants["a"] },
+		},
+		{
+			name:  "enforced types",
+			spec:  map[string]any{"enforceQtypes": []any{"srv"}},
+			check: func(h *Capsule) bool { return h.enforced(dns.TypeSRV) && !h.enforced(dns.TypeA) },
+		},
+		{
+			name:  "sinkhole replaces blocked cname",
+			spec:  map[string]any{"sinkhole": []any{"0.0.0.0", "::"}},
+			check: func(h *Capsule) bool { return h.sinkholeV4 != nil && h.sinkholeV6 != nil && h.blockedCNAME == "" },
+		},
+		{
+			name:  "minimal responses off",
+			spec:  map[string]any{"minimalResponses": false},
+			check: func(h *Capsule) bool { return !h.minimalResponses },
+		},
+		{
+			name: "tenant aliases",
+			spec: map[string]any{"tenantAliases": map[string]any{"team-a": []any{"team-a-prod", "team-a-dev"}}},
+			check: func(h *Capsule) bool {
+				return h.sameTenant("team-a-prod", "team-a-dev") && !h.sameTenant("team-a", "team-b")
+			},
+		},
+		{
+			name:  "log level",
+			spec:  map[string]any{"logLevel": "debug"},
+			check: func(h *Capsule) bool { return h.logLevel == logLevelDebug },
+		},
+		{name: "chained tenant aliases", spec: map[string]any{"tenantAliases": map[string]any{"a": []any{"b"}, "b": []any{"c"}}}, wantErr: true},
+		{name: "invalid selector mode", spec: map[string]any{"selectorMode": "some"}, wantErr: true},
+		{name: "invalid selector", spec: map[string]any{"labels": map[string]any{"matchExpressions": []any{map[string]any{"key": "a", "operator": "Near"}}}}, wantErr: true},
+		{name: "unsupported type", spec: map[string]any{"enforceQtypes": []any{"TXT"}}, wantErr: true},
+		{name: "invalid grace", spec: map[string]any{"namespaceGrace": "-1s"}, wantErr: true},
+		{name: "invalid log level", spec: map[string]any{"logLevel": "verbose"}, wantErr: true},
+		{name: "sinkhole and blocked cname", spec: map[string]any{"sinkhole": []any{"0.0.0.0"}, "blockedCNAME": "blocked.example."}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Capsule{blockedCNAME: "blocked.example.", minimalResponses: true}
+
+			p, err := h.withConfig(newConfigResource("default", tt.spec))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			if err == nil && !tt.check(p) {
+				t.Errorf("spec %v not applied", tt.spec)
+			}
+
+			if h.blockedCNAME != "blocked.example." || !h.minimalResponses {
+				t.Error("the Corefile options were modified")
+			}
+		})
+	}
+}
+
+func TestConfigResource(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	cl.services[1].Labels = map[string]string{"expose": "true"}
+
+	set, err := newInformerSet(fake.NewClientset(cl.objects()...), apiConfig{})
+	if err != nil {
+		t.Fatalf("failed to create informers: %v", err)
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{configResource: "CapsuleCoreDNSConfigList"})
+	set.dynamic = dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
+
+	ctrl, err := newDNSControllerForSet(set, dnsControllerOptions{configResource: true})
+	if err != nil {
+		t.Fatalf("failed to create DNS controller: %v", err)
+	}
+
+	go ctrl.Start()
+	t.Cleanup(ctrl.Stop)
+
+	waitForSync(t, ctrl)
+
+	h := &Capsule{dnsController: ctrl, configName: "default", live: &atomic.Pointer[Capsule]{}}
+	if err := h.watchConfig(); err != nil {
+		t.Fatalf("failed to watch config: %v", err)
+	}
+	t.Cleanup(h.unwatchConfig)
+
+	src, dst := cl.pods[0].Status.PodIPs[0].IP, cl.services[1].Spec.ClusterIP
+	allowed := func() bool { return h.policy().evaluate(t.Context(), src, dst).allowed }
+
+	if allowed() {
+		t.Fatal("cross-tenant query allowed without config")
+	}
+
+	client := dynamicClient.Resource(configResource)
+	ctx := context.Background()
+
+	exposing := map[string]any{"labels": map[string]any{"matchLabels": map[string]any{"expose": "true"}}}
+
+	// Another config is ignored.
+	if _, err := client.Create(ctx, newConfigResource("other", exposing), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+
+	if _, err := client.Create(ctx, newConfigResource("default", exposing), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+
+	waitFor(t, "config applied", allowed)
+
+	if _, err := client.Update(ctx, newConfigResource("default", map[string]any{"selectorMode": "some"}), metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update config: %v", err)
+	}
+
+	if _, err := client.Update(ctx, newConfigResource("default", map[string]any{"selectorMode": "all"}), metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update config: %v", err)
+	}
+
+	waitFor(t, "config updated", func() bool { return h.policy().selectorMode == selectorModeAll })
+
+	if h.policy().labelSelector != nil {
+		t.Error("got the selector of the previous config, want the Corefile one")
+	}
+
+	if err := client.Delete(ctx, "default", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to delete config: %v", err)
+	}
+
+	waitFor(t, "Corefile policy restored", func() bool { return h.policy() == h })
+}
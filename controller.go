@@ -4,12 +4,20 @@
 package capsule_coredns
 
 import (
+	"context"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
 	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -18,197 +26,1026 @@ const (
 	SvcClusterIPIndex  = "clusterIPs"
 	NsIndex            = "name"
 	CapsuleTenantLabel = "capsule.clastix.io/tenant"
+	// HideLabel set to "true" on a service or namespace keeps the exposure
+	// selectors from opening it to other tenants.
+	HideLabel = "capsule.clastix.io/dns-hide"
+	// TraceAnnotation set to "true" on a pod logs every decision on its
+	// queries, whatever log_sample_rate.
+	TraceAnnotation = "capsule.clastix.io/dns-trace"
 )
 
+// dnsController evaluates queries for one configuration on top of an informer
+// set it may share with controllers of other configurations.
 type dnsController struct {
+	informers          *informerSet
+	client             kubernetes.Interface
 	reverseIpInformers []cache.SharedIndexInformer
+	podInformer        cache.SharedIndexInformer
 	nsInformer         cache.SharedIndexInformer
+	netpolInformer     cache.SharedIndexInformer
+	ingressInformer    cache.SharedIndexInformer
+	accessInformer     cache.SharedIndexInformer
+	externalInformer   cache.SharedIndexInformer
+	externals          *externalTable
+	// replicaInformers watch GlobalTenantResources and TenantResources.
+	replicaInformers   []cache.SharedIndexInformer
+	tenantInformer     cache.SharedIndexInformer
+	configInformer     cache.SharedIndexInformer
+	tenantSelector     labels.Selector
+	syncTimeout        time.Duration
+	staleTimeout       time.Duration
+	claims             *ipClaims
+	claimsRegistration cache.ResourceEventHandlerRegistration
+	denyReassigned     bool
+	withholdNamespaces bool
+	tenantOwners       bool
 	stopCh             chan struct{}
-	hasSynced          bool
+	started            atomic.Bool
+	stopOnce           sync.Once
+	hasSynced          atomic.Bool
+	syncExpired        atomic.Bool
+	degraded           atomic.Bool
+	// predecessor is the synced controller this one replaces on reload, it
+	// answers in its place until the initial sync completes.
+	predecessor atomic.Pointer[dnsController]
+	// key and refs are owned by the controllers registry.
+	key  string
+	refs int
+}
+
+type dnsControllerOptions struct {
+	// tenantSelector restricts enforcement to the namespaces it matches.
+	tenantSelector *metav1.LabelSelector
+	// networkPolicies enables the NetworkPolicy informer.
+	networkPolicies bool
+	// ingresses enables the Ingress informer.
+	ingresses bool
+	// accessRequests enables the DNSAccessRequest informer.
+	accessRequests bool
+	// externalWorkloads enables the ExternalWorkload informer.
+	externalWorkloads bool
+	// tenantResources enables the (Global)TenantResource informers.
+	tenantResources bool
+	// withholdNamespaces enables the Tenant informer.
+	withholdNamespaces bool
+	// tenantOwners enables the Tenant informer, to attribute unlabelled
+	// namespaces to the Tenant owning them.
+	tenantOwners bool
+	// configResource enables the CapsuleCoreDNSConfig informer.
+	configResource bool
+	// syncTimeout bounds the initial sync wait, zero waits forever.
+	syncTimeout time.Duration
+	// staleTimeout is how long a watch may fail before the controller is
+	// degraded, zero never degrades it.
+	staleTimeout time.Duration
+	// reuseGrace is how long a reassigned IP is considered contested.
+	reuseGrace time.Duration
+	// denyReassigned denies queries involving a contested IP.
+	denyReassigned bool
+	// api is how the API server is reached.
+	api apiConfig
+	// cacheSnapshot is the file the caches are warm-booted from, none when
+	// its path is empty.
+	cacheSnapshot cacheSnapshot
 }
 
-func newDNSController() (*dnsController, error) {
-	config, err := rest.InClusterConfig()
+func newDNSController(opts dnsControllerOptions) (*dnsController, error) {
+	set, err := acquireInformerSet(opts.api)
 	if err != nil {
 		return nil, err
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	c, err := newDNSControllerForSet(set, opts)
 	if err != nil {
+		set.release()
+
 		return nil, err
 	}
 
-	reverseIpInformers := []cache.SharedIndexInformer{}
-	factory := informers.NewSharedInformerFactory(clientset, 0)
-	podInformer := factory.Core().V1().Pods().Informer()
-
-	err = podInformer.AddIndexers(cache.Indexers{
-		PodIPIndex: func(obj any) ([]string, error) {
-			//nolint:forcetypeassert
-			pod := obj.(*v1.Pod)
-
-			ips := make([]string, 0, len(pod.Status.PodIPs))
-			for _, podIP := range pod.Status.PodIPs {
-				ips = append(ips, podIP.IP)
-			}
+	return c, nil
+}
 
-			return ips, nil
-		},
-	})
+// newDNSControllerForClient builds the controller on top of informers of its
+// own for clientset.
+func newDNSControllerForClient(clientset kubernetes.Interface, opts dnsControllerOptions) (*dnsController, error) {
+	set, err := newInformerSet(clientset, opts.api)
 	if err != nil {
 		return nil, err
 	}
 
-	reverseIpInformers = append(reverseIpInformers, podInformer)
-	svcInformer := factory.Core().V1().Services().Informer()
+	return newDNSControllerForSet(set, opts)
+}
 
-	err = svcInformer.AddIndexers(cache.Indexers{
-		SvcClusterIPIndex: func(obj any) ([]string, error) {
-			//nolint:forcetypeassert
-			svc := obj.(*v1.Service)
+// newDNSControllerForSet builds the controller on top of set, taking over the
+// reference the caller holds on it.
+func newDNSControllerForSet(set *informerSet, opts dnsControllerOptions) (*dnsController, error) {
+	var err error
 
-			return svc.Spec.ClusterIPs, nil
-		},
-	})
-	if err != nil {
-		return nil, err
+	shard := labels.Everything()
+
+	if opts.tenantSelector != nil {
+		shard, err = metav1.LabelSelectorAsSelector(opts.tenantSelector)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	reverseIpInformers = append(reverseIpInformers, svcInformer)
-	nsInformer := factory.Core().V1().Namespaces().Informer()
+	var (
+		claims             *ipClaims
+		claimsRegistration cache.ResourceEventHandlerRegistration
+	)
 
-	err = nsInformer.AddIndexers(cache.Indexers{
-		NsIndex: func(obj any) ([]string, error) {
-			//nolint:forcetypeassert
-			ns := obj.(*v1.Namespace)
-			if ns.Name == "" {
-				return []string{}, nil
-			}
+	if opts.reuseGrace > 0 && set.pods != nil {
+		claims = newIPClaims(opts.reuseGrace)
 
-			return []string{ns.Name}, nil
-		},
-	})
-	if err != nil {
-		return nil, err
+		claimsRegistration, err = set.pods.AddEventHandler(claims.handler())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.cacheSnapshot.path != "" {
+		set.useCacheSnapshot(opts.cacheSnapshot)
+	}
+
+	var netpolInformer cache.SharedIndexInformer
+	if opts.networkPolicies {
+		netpolInformer, err = set.networkPolicies()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ingressInformer cache.SharedIndexInformer
+	if opts.ingresses {
+		ingressInformer, err = set.ingresses()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var accessInformer cache.SharedIndexInformer
+	if opts.accessRequests {
+		accessInformer, err = set.accessRequests()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		externalInformer cache.SharedIndexInformer
+		externals        *externalTable
+	)
+	if opts.externalWorkloads {
+		externalInformer, externals, err = set.externalWorkloads()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var replicaInformers []cache.SharedIndexInformer
+	if opts.tenantResources {
+		replicaInformers, err = set.tenantResources()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var tenantInformer cache.SharedIndexInformer
+	if opts.withholdNamespaces || opts.tenantOwners {
+		tenantInformer, err = set.tenants()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var configInformer cache.SharedIndexInformer
+	if opts.configResource {
+		configInformer, err = set.configs()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reverseIpInformers := make([]cache.SharedIndexInformer, 0, 2)
+	for _, informer := range []cache.SharedIndexInformer{set.pods, set.services} {
+		if informer != nil {
+			reverseIpInformers = append(reverseIpInformers, informer)
+		}
 	}
 
 	return &dnsController{
+		informers:          set,
+		client:             set.client,
 		reverseIpInformers: reverseIpInformers,
-		nsInformer:         nsInformer,
+		podInformer:        set.pods,
+		nsInformer:         set.namespaces,
+		netpolInformer:     netpolInformer,
+		ingressInformer:    ingressInformer,
+		accessInformer:     accessInformer,
+		externalInformer:   externalInformer,
+		externals:          externals,
+		replicaInformers:   replicaInformers,
+		tenantInformer:     tenantInformer,
+		configInformer:     configInformer,
+		tenantSelector:     shard,
+		syncTimeout:        opts.syncTimeout,
+		staleTimeout:       opts.staleTimeout,
+		claims:             claims,
+		claimsRegistration: claimsRegistration,
+		denyReassigned:     opts.denyReassigned,
+		withholdNamespaces: opts.withholdNamespaces,
+		tenantOwners:       opts.tenantOwners,
 		stopCh:             make(chan struct{}),
 	}, nil
 }
 
-func (d *dnsController) Start() {
-	if d.stopCh == nil {
-		d.stopCh = make(chan struct{})
+// slimPod drops everything but the pod identity, lifecycle, addresses and
+// TraceAnnotation, which is all the controller needs to classify an IP.
+func slimPod(obj any) (any, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return obj, nil
 	}
 
-	synced := make([]cache.InformerSynced, 0, len(d.reverseIpInformers)+1)
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              pod.Name,
+			Namespace:         pod.Namespace,
+			UID:               pod.UID,
+			ResourceVersion:   pod.ResourceVersion,
+			CreationTimestamp: pod.CreationTimestamp,
+			DeletionTimestamp: pod.DeletionTimestamp,
+			Labels:            pod.Labels,
+			Annotations:       traceAnnotation(pod.Annotations),
+			OwnerReferences:   controllerRef(pod.OwnerReferences),
+		},
+		Spec: v1.PodSpec{
+			HostNetwork: pod.Spec.HostNetwork,
+		},
+		Status: v1.PodStatus{
+			Phase:     pod.Status.Phase,
+			StartTime: pod.Status.StartTime,
+			PodIPs:    pod.Status.PodIPs,
+		},
+	}, nil
+}
+
+// traceAnnotation returns the TraceAnnotation of annotations alone, nil when
+// it isn't set.
+func traceAnnotation(annotations map[string]string) map[string]string {
+	v, ok := annotations[TraceAnnotation]
+	if !ok {
+		return nil
+	}
+
+	return map[string]string{TraceAnnotation: v}
+}
+
+// Start runs the informers until Stop is called. Handlers sharing the
+// controller all call Start, only the first call has an effect.
+func (d *dnsController) Start() {
+	if !d.started.CompareAndSwap(false, true) {
+		return
+	}
 
 	log.Infof("Starting capsule controller")
 
-	for _, ctrl := range d.reverseIpInformers {
-		go ctrl.Run(d.stopCh)
+	d.informers.start()
+
+	synced := make([]cache.InformerSynced, 0, len(d.reverseIpInformers)+len(d.replicaInformers)+8)
+	for _, informer := range d.reverseIpInformers {
+		synced = append(synced, informer.HasSynced)
+	}
+
+	synced = append(synced, d.nsInformer.HasSynced, d.informers.ips.HasSynced)
+
+	if d.netpolInformer != nil {
+		synced = append(synced, d.netpolInformer.HasSynced)
+	}
+
+	if d.ingressInformer != nil {
+		synced = append(synced, d.ingressInformer.HasSynced)
+	}
+
+	if d.accessInformer != nil {
+		synced = append(synced, d.accessInformer.HasSynced)
+	}
 
-		synced = append(synced, ctrl.HasSynced)
+	if d.externalInformer != nil {
+		synced = append(synced, d.externalInformer.HasSynced)
 	}
 
-	go d.nsInformer.Run(d.stopCh)
+	for _, informer := range d.replicaInformers {
+		synced = append(synced, informer.HasSynced)
+	}
 
-	synced = append(synced, d.nsInformer.HasSynced)
+	if d.tenantInformer != nil {
+		synced = append(synced, d.tenantInformer.HasSynced)
+	}
+
+	if d.configInformer != nil {
+		synced = append(synced, d.configInformer.HasSynced)
+	}
+
+	if d.claimsRegistration != nil {
+		synced = append(synced, d.claimsRegistration.HasSynced)
+	}
 
 	log.Infof("Waiting for controllers to sync")
 
+	if d.informers.warm.Load() {
+		log.Infof("Answering from the cache snapshot until synced")
+	}
+
+	if d.syncTimeout > 0 {
+		timer := time.AfterFunc(d.syncTimeout, func() {
+			if !d.hasSynced.Load() {
+				log.Warningf("informers not synced after %s, applying the sync fallback while retrying", d.syncTimeout)
+
+				d.syncExpired.Store(true)
+			}
+		})
+		defer timer.Stop()
+	}
+
 	if !cache.WaitForCacheSync(d.stopCh, synced...) {
 		log.Errorf("failed to sync informers")
 
-		d.hasSynced = false
+		d.hasSynced.Store(false)
 
 		return
 	}
 
-	d.hasSynced = true
+	d.hasSynced.Store(true)
+	d.syncExpired.Store(false)
+	d.predecessor.Store(nil)
 
 	log.Infof("Synced all required resources")
 
+	if d.staleTimeout > 0 {
+		go d.watchStaleness()
+	}
+
 	<-d.stopCh
 	log.Infof("Stopping capsule controller")
 }
 
+// Stop detaches the controller from its informers, which are stopped once no
+// other controller uses them. The caches stay readable but may no longer be
+// updated.
+func (d *dnsController) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stopCh)
+
+		if d.claimsRegistration != nil {
+			if err := d.podInformer.RemoveEventHandler(d.claimsRegistration); err != nil {
+				log.Warningf("failed to remove the IP claims handler: %v", err)
+			}
+		}
+
+		d.informers.release()
+	})
+}
+
+// active returns the controller queries are evaluated against: c itself, or
+// its predecessor while c has not synced yet.
+func (c *dnsController) active() *dnsController {
+	if !c.hasSynced.Load() {
+		if prev := c.predecessor.Load(); prev != nil {
+			return prev
+		}
+	}
+
+	return c
+}
+
 func (c *dnsController) TenantAuthorized(from string, to string, h Capsule) bool {
-	nsFrom, _, err := c.getObjectByIP(from)
+	return c.Evaluate(context.Background(), from, to, h).allowed
+}
+
+// Evaluate classifies both ends of a query and returns the resulting decision.
+func (c *dnsController) Evaluate(ctx context.Context, from string, to string, h Capsule) decision {
+	return c.evaluate(ctx, from, h, func() (*v1.Namespace, any, bool, error) {
+		return c.getObjectByIP(ctx, to)
+	})
+}
+
+// EvaluateNamespace is Evaluate for queries naming a namespace rather than an
+// object, such as team-a.svc.cluster.local.
+func (c *dnsController) EvaluateNamespace(ctx context.Context, from string, namespace string, h Capsule) decision {
+	return c.evaluate(ctx, from, h, func() (*v1.Namespace, any, bool, error) {
+		ns, err := c.getNSByName(namespace)
+
+		return ns, nil, false, err
+	})
+}
+
+// EvaluateService is Evaluate for a service named by a CNAME chain, such as
+// the target of an ExternalName service.
+func (c *dnsController) EvaluateService(ctx context.Context, from string, namespace string, name string, h Capsule) decision {
+	return c.evaluate(ctx, from, h, func() (*v1.Namespace, any, bool, error) {
+		if c.informers.services == nil {
+			return nil, nil, false, nil
+		}
+
+		obj, exists, err := c.informers.services.GetIndexer().GetByKey(namespace + "/" + name)
+		if err != nil || !exists {
+			return nil, nil, false, err
+		}
+
+		ns, err := c.getNSByName(namespace)
+
+		return ns, obj, false, err
+	})
+}
+
+// evaluate classifies the source from and, when the policy applies to it, the
+// destination returned by resolve. Once ctx is done, ends left to classify are
+// unknown: the caller must discard the decision.
+func (c *dnsController) evaluate(ctx context.Context, from string, h Capsule, resolve func() (*v1.Namespace, any, bool, error)) decision {
+	nsFrom, objFrom, contestedFrom, err := c.getObjectByIP(ctx, from)
+	// Addresses of no pod nor service may belong to an external workload.
+	if err == nil && nsFrom == nil && c.externals != nil {
+		nsFrom, objFrom, err = c.externalSource(from)
+	}
+
 	if err != nil || nsFrom == nil {
-		return true
+		return decision{allowed: true, reason: reasonUnknownSource}
 	}
 
-	var (
-		tenantFrom string
-		tenantTo   string
-		ok         bool
-	)
+	d := decision{srcNamespace: nsFrom.Name}
+	if pod, ok := objFrom.(*v1.Pod); ok {
+		d.srcPod = pod.Name
+		d.srcWorkloadKind, d.srcWorkloadName = podWorkload(pod)
+		d.traced = pod.Annotations[TraceAnnotation] == "true"
+	} else if w, ok := objFrom.(*externalWorkload); ok {
+		d.srcWorkloadKind, d.srcWorkloadName = externalWorkloadKind, w.Name
+	}
 
-	if tenantFrom, ok = nsFrom.Labels[CapsuleTenantLabel]; !ok {
-		return true
+	if contestedFrom && c.denyReassigned {
+		return d.deny(reasonContestedIP).by("ip_reuse_grace")
+	}
+
+	var ok bool
+
+	if d.srcTenant, ok = c.namespaceTenant(&h, nsFrom); !ok {
+		return d.allow(reasonNonTenantSource)
+	}
+
+	// Tenants outside of this shard are enforced by another deployment. The
+	// tenant label reads the tenant the source resolved to, whether from
+	// tenant_labels or tenant_owners.
+	if !c.tenantSelector.Empty() && !c.tenantSelector.Matches(shardLabels{labels: nsFrom.Labels, tenant: d.srcTenant}) {
+		return d.allow(reasonOutOfShard).by("tenants")
 	}
 
-	nsTo, obj, err := c.getObjectByIP(to)
+	nsTo, obj, contestedTo, err := resolve()
 	if err != nil || nsTo == nil {
-		return true
+		return d.allow(reasonUnknownDestination)
+	}
+
+	d.dstNamespace = nsTo.Name
+	d.dstTenant, _ = c.namespaceTenant(&h, nsTo)
+
+	if contestedTo && c.denyReassigned {
+		return d.deny(reasonContestedIP).by("ip_reuse_grace")
+	}
+
+	// The Tenant of the source may withhold namespaces of others, whatever
+	// the selectors expose to everyone.
+	if c.withholdNamespaces && !h.sameTenant(d.srcTenant, d.dstTenant) && c.withheld(d.srcTenant, nsTo.Name) {
+		return d.deny(reasonWithheldNamespace).by(WithholdNamespacesAnnotation)
+	}
+
+	if h.visibility {
+		if d, ok := h.visibilityDecision(d, nsTo, obj); ok {
+			return d
+		}
 	}
 
+	if reason, rule, ok := h.exposure(nsTo, obj, d.srcTenant, d.dstTenant); ok {
+		return d.allow(reason).by(rule)
+	}
+
+	if grantedTo(nsTo, d.srcTenant, time.Now()) {
+		return d.allow(reasonTenantGrant).by(AllowTenantsAnnotation)
+	}
+
+	if c.replicaInformers != nil && c.replicatedTo(nsFrom, obj) {
+		return d.allow(reasonReplicatedService).by("tenant_resources")
+	}
+
+	if c.accessInformer != nil && c.accessRequestAllows(nsFrom, obj) {
+		return d.allow(reasonAccessRequest).by("access_requests")
+	}
+
+	if c.netpolInformer != nil && c.networkPolicyAllows(nsFrom, nsTo, obj) {
+		return d.allow(reasonNetworkPolicy).by("networkpolicies")
+	}
+
+	if d.dstTenant == "" {
+		// Capsule labels the namespaces of a tenant right after their
+		// creation, give it time to do so.
+		if h.namespaceGrace > 0 && time.Since(nsTo.CreationTimestamp.Time) < h.namespaceGrace {
+			return d.allow(reasonPendingNamespace).by("namespace_grace")
+		}
+
+		return d.deny(reasonNonTenantDestination)
+	}
+
+	if !h.sameTenant(d.srcTenant, d.dstTenant) {
+		return d.deny(reasonCrossTenant)
+	}
+
+	// Strict tenants only resolve unexposed names within the same namespace.
+	if h.strictTenants[d.srcTenant] && d.srcNamespace != d.dstNamespace {
+		return d.deny(reasonStrictTenant).by("strict_tenants")
+	}
+
+	return d.allow(reasonSameTenant)
+}
+
+// exposure reports whether the exposure selectors match obj in namespace ns of
+// dstTenant for a query from tenant, with which reason and through which
+// directive. In
+// selector_mode all, every configured selector must match: the service one and
+// either namespace one. The namespace selectors are ignored for destinations
+// outside of namespace_scope. Nothing is exposed to other tenants from a
+// namespace or service carrying the HideLabel.
+func (h *Capsule) exposure(ns *v1.Namespace, obj any, tenant, dstTenant string) (string, string, bool) {
+	namespaceScoped := h.namespaceScoped(tenant, dstTenant)
+
 	svc, isSvc := obj.(*v1.Service)
-	if isSvc && h.labelSelector != nil {
-		selector, err := metav1.LabelSelectorAsSelector(h.labelSelector)
-		if err == nil && selector.Matches(labels.Set(svc.Labels)) {
+	if !h.sameTenant(dstTenant, tenant) && (hidden(ns.Labels) || isSvc && hidden(svc.Labels)) {
+		return "", "", false
+	}
+
+	serviceLabelled := isSvc && h.labelSelector.matches(svc.Labels)
+	serviceExposed := serviceLabelled || isSvc && h.exposedTo(svc, tenant)
+	namespaceLabelled := namespaceScoped && h.namespaceLabelSelector.matches(ns.Labels)
+	namespaceExposed := namespaceLabelled || namespaceScoped && h.namespaceAnnotations.matches(ns.Annotations)
+
+	if h.selectorMode == selectorModeAll {
+		serviceRequired := h.labelSelector != nil || h.exposureLabel != ""
+		namespaceRequired := namespaceScoped && (h.namespaceLabelSelector != nil || h.namespaceAnnotations != nil)
+
+		if !serviceRequired && !namespaceRequired ||
+			serviceRequired && !serviceExposed ||
+			namespaceRequired && !namespaceExposed {
+			return "", "", false
+		}
+	}
+
+	switch {
+	case serviceLabelled:
+		return reasonExposedService, "labels", true
+	case serviceExposed:
+		return reasonExposedService, "exposure_label", true
+	case namespaceLabelled:
+		return reasonExposedNamespace, "namespace_labels", true
+	case namespaceExposed:
+		return reasonExposedNamespace, "namespace_annotations", true
+	default:
+		return "", "", false
+	}
+}
+
+// namespaceScoped reports whether the namespace selectors apply to a query
+// from srcTenant to a namespace of dstTenant, empty for non-tenant namespaces.
+func (h *Capsule) namespaceScoped(srcTenant, dstTenant string) bool {
+	switch h.namespaceScope {
+	case namespaceScopeCrossTenant:
+		return dstTenant != "" && !h.sameTenant(dstTenant, srcTenant)
+	case namespaceScopeNonTenant:
+		return !h.sameTenant(dstTenant, srcTenant)
+	default:
+		return true
+	}
+}
+
+// exposedTo reports whether the exposure_label of svc, read from its labels
+// then its annotations, lists tenant.
+func (h *Capsule) exposedTo(svc *v1.Service, tenant string) bool {
+	if h.exposureLabel == "" {
+		return false
+	}
+
+	for _, values := range []map[string]string{svc.Labels, svc.Annotations} {
+		if value, ok := values[h.exposureLabel]; ok && listsTenant(value, tenant) {
 			return true
 		}
 	}
 
-	if h.namespaceLabelSelector != nil {
-		selector, err := metav1.LabelSelectorAsSelector(h.namespaceLabelSelector)
-		if err == nil && selector.Matches(labels.Set(nsTo.Labels)) {
+	return false
+}
+
+// listsTenant reports whether the value of an exposure label lists tenant.
+// "true" and "*" list every tenant. Label values can't hold commas, tenants
+// are separated by "_" there.
+func listsTenant(value, tenant string) bool {
+	listed := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '_' || unicode.IsSpace(r)
+	})
+
+	for _, t := range listed {
+		if t == "true" || t == "*" || t == tenant {
 			return true
 		}
 	}
 
-	if tenantTo, ok = nsTo.Labels[CapsuleTenantLabel]; !ok {
+	return false
+}
+
+// hidden reports whether set carries the HideLabel.
+func hidden(set map[string]string) bool {
+	return set[HideLabel] == "true"
+}
+
+// networkPolicyAllows reports whether a NetworkPolicy in the destination
+// namespace selects obj and explicitly admits ingress from the source
+// namespace. Peers without a namespaceSelector, peers restricted to a subset of
+// pods and ipBlock peers are ignored, so only namespace-wide grants open DNS.
+func (c *dnsController) networkPolicyAllows(nsFrom, nsTo *v1.Namespace, obj any) bool {
+	var target labels.Labels
+
+	switch o := obj.(type) {
+	case *v1.Pod:
+		target = labels.Set(o.Labels)
+	case *v1.Service:
+		if len(o.Spec.Selector) == 0 {
+			return false
+		}
+
+		target = labels.Set(o.Spec.Selector)
+	default:
+		return false
+	}
+
+	objs, err := c.netpolInformer.GetIndexer().ByIndex(cache.NamespaceIndex, nsTo.Name)
+	if err != nil {
 		return false
 	}
 
-	return tenantFrom == tenantTo
+	for _, o := range objs {
+		//nolint:forcetypeassert
+		policy := o.(*networkPolicy)
+
+		if !policy.podSelector.Matches(target) {
+			continue
+		}
+
+		for _, nsSelector := range policy.namespaces {
+			if nsSelector.Matches(labels.Set(nsFrom.Labels)) {
+				return true
+			}
+		}
+	}
+
+	return false
 }
 
-func (c *dnsController) HasSynced() bool {
-	return c.hasSynced
+// shardLabels are the labels of a namespace as the tenants selector sees them,
+// the tenant label standing for the tenant the namespace resolved to.
+type shardLabels struct {
+	labels labels.Set
+	tenant string
 }
 
-func (c *dnsController) getObjectByIP(ip string) (*v1.Namespace, any, error) {
+func (l shardLabels) Has(key string) bool {
+	return key == CapsuleTenantLabel || l.labels.Has(key)
+}
+
+func (l shardLabels) Get(key string) string {
+	value, _ := l.Lookup(key)
+
+	return value
+}
+
+func (l shardLabels) Lookup(key string) (string, bool) {
+	if key == CapsuleTenantLabel {
+		return l.tenant, true
+	}
+
+	return l.labels.Lookup(key)
+}
+
+// networkPolicy is a NetworkPolicy as evaluated on the query path: the
+// selector of the pods it applies to and those of the namespaces it admits
+// every pod of, compiled once when cached.
+type networkPolicy struct {
+	metav1.ObjectMeta
+
+	podSelector labels.Selector
+	namespaces  []labels.Selector
+}
+
+// compileNetworkPolicy turns a NetworkPolicy into a networkPolicy. A policy
+// with an invalid pod selector applies to no pod, and invalid namespace
+// selectors admit no namespace.
+func compileNetworkPolicy(obj any) (any, error) {
+	policy, ok := obj.(*networkingv1.NetworkPolicy)
+	if !ok {
+		return obj, nil
+	}
+
+	compiled := &networkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            policy.Name,
+			Namespace:       policy.Namespace,
+			UID:             policy.UID,
+			ResourceVersion: policy.ResourceVersion,
+		},
+		podSelector: labels.Nothing(),
+	}
+
+	if selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.PodSelector); err == nil {
+		compiled.podSelector = selector
+	}
+
+	for _, rule := range policy.Spec.Ingress {
+		for _, peer := range rule.From {
+			if peer.NamespaceSelector == nil {
+				continue
+			}
+
+			// Peers selecting some pods of the namespaces don't admit the
+			// whole tenant.
+			if peer.PodSelector != nil && (len(peer.PodSelector.MatchLabels) > 0 || len(peer.PodSelector.MatchExpressions) > 0) {
+				continue
+			}
+
+			if selector, err := metav1.LabelSelectorAsSelector(peer.NamespaceSelector); err == nil {
+				compiled.namespaces = append(compiled.namespaces, selector)
+			}
+		}
+	}
+
+	return compiled, nil
+}
+
+// ipAttribution is one entry of the IP to tenant mapping.
+type ipAttribution struct {
+	IP        string `json:"ip"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Tenant    string `json:"tenant,omitempty"`
+}
+
+// snapshot lists the attribution of every IP currently known to the caches,
+// with the tenants h reads from the namespace labels.
+func (c *dnsController) snapshot(h *Capsule) []ipAttribution {
+	tenants := map[string]string{}
+
+	for _, obj := range c.nsInformer.GetStore().List() {
+		//nolint:forcetypeassert
+		ns := obj.(*v1.Namespace)
+		tenants[ns.Name], _ = c.namespaceTenant(h, ns)
+	}
+
+	attributions := []ipAttribution{}
+
 	for _, informer := range c.reverseIpInformers {
-		for key := range informer.GetIndexer().GetIndexers() {
-			objs, err := informer.GetIndexer().ByIndex(key, ip)
-			if err != nil || len(objs) == 0 {
+		for _, obj := range informer.GetStore().List() {
+			var (
+				kind string
+				ips  []string
+			)
+
+			switch o := obj.(type) {
+			case *v1.Pod:
+				for _, podIP := range o.Status.PodIPs {
+					ips = append(ips, podIP.IP)
+				}
+			case *v1.Service:
+				ips = o.Spec.ClusterIPs
+			default:
 				continue
 			}
 
+			kind = kindOf(obj)
+
 			//nolint:forcetypeassert
-			meta := objs[0].(metav1.ObjectMetaAccessor).GetObjectMeta()
+			meta := obj.(metav1.ObjectMetaAccessor).GetObjectMeta()
 
-			ns, err := c.getNSByName(meta.GetNamespace())
+			for _, ip := range ips {
+				if ip == "" || ip == v1.ClusterIPNone {
+					continue
+				}
 
-			return ns, objs[0], err
+				attributions = append(attributions, ipAttribution{
+					IP:        normalizeIP(ip),
+					Kind:      kind,
+					Namespace: meta.GetNamespace(),
+					Name:      meta.GetName(),
+					Tenant:    tenants[meta.GetNamespace()],
+				})
+			}
 		}
 	}
 
-	return nil, nil, nil
+	sort.Slice(attributions, func(i, j int) bool {
+		if attributions[i].IP != attributions[j].IP {
+			return attributions[i].IP < attributions[j].IP
+		}
+
+		return attributions[i].Kind < attributions[j].Kind
+	})
+
+	return attributions
+}
+
+// getPod returns the cached pod namespace/name, if any.
+func (c *dnsController) getPod(namespace, name string) *v1.Pod {
+	if c.podInformer == nil {
+		return nil
+	}
+
+	obj, exists, err := c.podInformer.GetIndexer().GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return nil
+	}
+
+	//nolint:forcetypeassert
+	return obj.(*v1.Pod)
+}
+
+func (c *dnsController) HasSynced() bool {
+	return c.hasSynced.Load()
+}
+
+// SyncExpired reports whether the initial sync outlasted the sync timeout.
+func (c *dnsController) SyncExpired() bool {
+	return c.syncExpired.Load()
+}
+
+// getObjectByIP returns the object owning ip and its namespace. When several
+// objects share the IP, services take precedence over pods, running pods over
+// terminating ones and the most recently started object wins, so the outcome
+// doesn't depend on informer iteration order. contested reports whether the IP
+// is claimed from several namespaces or was reassigned within the grace period.
+// The error of ctx is returned once it is done.
+func (c *dnsController) getObjectByIP(ctx context.Context, ip string) (ns *v1.Namespace, obj any, contested bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, false, err
+	}
+
+	ip = normalizeIP(ip)
+
+	candidates := c.informers.ips.lookup(ip)
+
+	if len(candidates) == 0 {
+		return nil, nil, false, nil
+	}
+
+	obj = candidates[0]
+	for _, candidate := range candidates[1:] {
+		if precedes(candidate, obj) {
+			obj = candidate
+		}
+	}
+
+	//nolint:forcetypeassert
+	meta := obj.(metav1.ObjectMetaAccessor).GetObjectMeta()
+
+	if len(candidates) > 1 {
+		log.Debugf("IP %s matches %d objects, attributing it to %s %s/%s", ip, len(candidates), kindOf(obj), meta.GetNamespace(), meta.GetName())
+
+		if spansNamespaces(candidates) {
+			contested = true
+		}
+	}
+
+	if c.claims != nil && c.claims.reassigned(ip) {
+		contested = true
+	}
+
+	if contested {
+		ambiguousAttributions.Inc()
+	}
+
+	ns, err = c.getNSByName(meta.GetNamespace())
+
+	return ns, obj, contested, err
+}
+
+// spansNamespaces reports whether candidates, host network pods aside, belong
+// to more than one namespace.
+func spansNamespaces(candidates []any) bool {
+	namespace := ""
+
+	for _, candidate := range candidates {
+		if pod, ok := candidate.(*v1.Pod); ok && pod.Spec.HostNetwork {
+			continue
+		}
+
+		//nolint:forcetypeassert
+		ns := candidate.(metav1.ObjectMetaAccessor).GetObjectMeta().GetNamespace()
+
+		if namespace == "" {
+			namespace = ns
+		} else if namespace != ns {
+			return true
+		}
+	}
+
+	return false
+}
+
+// precedes reports whether a takes precedence over b when both own an IP.
+func precedes(a, b any) bool {
+	if ra, rb := kindRank(a), kindRank(b); ra != rb {
+		return ra < rb
+	}
+
+	podA, isPodA := a.(*v1.Pod)
+	podB, isPodB := b.(*v1.Pod)
+
+	if isPodA && isPodB && running(podA) != running(podB) {
+		return running(podA)
+	}
+
+	tsA, tsB := startTime(a), startTime(b)
+	if !tsA.Equal(&tsB) {
+		return tsB.Before(&tsA)
+	}
+
+	//nolint:forcetypeassert
+	metaA := a.(metav1.ObjectMetaAccessor).GetObjectMeta()
+	//nolint:forcetypeassert
+	metaB := b.(metav1.ObjectMetaAccessor).GetObjectMeta()
+
+	if metaA.GetNamespace() != metaB.GetNamespace() {
+		return metaA.GetNamespace() < metaB.GetNamespace()
+	}
+
+	return metaA.GetName() < metaB.GetName()
+}
+
+// startTime returns when obj started owning its IPs: the start time of a pod,
+// the creation time otherwise.
+func startTime(obj any) metav1.Time {
+	if pod, ok := obj.(*v1.Pod); ok && pod.Status.StartTime != nil {
+		return *pod.Status.StartTime
+	}
+
+	//nolint:forcetypeassert
+	return obj.(metav1.ObjectMetaAccessor).GetObjectMeta().GetCreationTimestamp()
+}
+
+func kindRank(obj any) int {
+	switch obj.(type) {
+	case *v1.Service:
+		return 0
+	case *v1.Pod:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func kindOf(obj any) string {
+	switch obj.(type) {
+	case *v1.Service:
+		return "Service"
+	case *v1.Pod:
+		return "Pod"
+	default:
+		return "Object"
+	}
+}
+
+// normalizeIP returns the canonical form of ip, so that an IPv4-mapped IPv6
+// address such as ::ffff:10.0.0.1 and 10.0.0.1 share the same index key.
+func normalizeIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Zone() != "" {
+		return ip
+	}
+
+	// ParseAddr rejects IPv4 addresses that are not in canonical form.
+	if addr.Is4() {
+		return ip
+	}
+
+	var buf [len("ffff:ffff:ffff:ffff:ffff:ffff:255.255.255.255")]byte
+
+	canonical := addr.Unmap().AppendTo(buf[:0])
+	if string(canonical) == ip {
+		return ip
+	}
+
+	return string(canonical)
 }
 
 func (c *dnsController) getNSByName(name string) (*v1.Namespace, error) {
-	objs, err := c.nsInformer.GetIndexer().ByIndex(NsIndex, name)
-	if err != nil || len(objs) == 0 {
+	// Namespaces are keyed by name, unlike ByIndex the lookup doesn't copy.
+	obj, exists, err := c.nsInformer.GetStore().GetByKey(name)
+	if err != nil || !exists {
 		return nil, err
 	}
 
 	//nolint:forcetypeassert
-	return objs[0].(*v1.Namespace), nil
+	return obj.(*v1.Namespace), nil
 }
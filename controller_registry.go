@@ -0,0 +1,136 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+)
+
+// controllers holds the running controllers of the process by configuration,
+// and the controller the handler of each server block holds. A Corefile reload
+// starts the new instance before shutting down the old one, so a reloaded
+// handler with an unchanged configuration picks up the synced controller of
+// its predecessor instead of building and syncing another one.
+var controllers = struct {
+	sync.Mutex
+	byKey   map[string]*dnsController
+	byBlock map[string]*dnsController
+}{byKey: map[string]*dnsController{}, byBlock: map[string]*dnsController{}}
+
+// acquireDNSController returns the running controller configured with opts, or
+// one created with build, for the handler of the server block identified by
+// block, empty for handlers outside of a Corefile. Every call must be balanced
+// by a release.
+func acquireDNSController(opts dnsControllerOptions, block string, build func(dnsControllerOptions) (*dnsController, error)) (*dnsController, error) {
+	key, err := opts.key()
+	if err != nil {
+		return nil, err
+	}
+
+	controllers.Lock()
+	defer controllers.Unlock()
+
+	if c, ok := controllers.byKey[key]; ok {
+		c.refs++
+
+		if block != "" {
+			controllers.byBlock[block] = c
+		}
+
+		return c, nil
+	}
+
+	c, err := build(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c.key = key
+	c.refs = 1
+
+	// A reload that changes the configuration cannot reuse the caches, so the
+	// controller the server block held answers until the new one has synced.
+	// That of another block may enforce another tenant set.
+	if prev := controllers.byBlock[block]; prev != nil && prev.HasSynced() {
+		c.predecessor.Store(prev)
+	}
+
+	controllers.byKey[key] = c
+
+	if block != "" {
+		controllers.byBlock[block] = c
+	}
+
+	return c, nil
+}
+
+// release drops a reference to c and stops it once no handler uses it anymore.
+func (c *dnsController) release() {
+	controllers.Lock()
+	defer controllers.Unlock()
+
+	c.refs--
+	if c.refs > 0 {
+		return
+	}
+
+	if controllers.byKey[c.key] == c {
+		delete(controllers.byKey, c.key)
+	}
+
+	for block, held := range controllers.byBlock {
+		if held == c {
+			delete(controllers.byBlock, block)
+		}
+	}
+
+	c.Stop()
+}
+
+// key identifies the controllers that can be shared for opts.
+func (opts dnsControllerOptions) key() (string, error) {
+	raw, err := json.Marshal(struct {
+		TenantSelector     any      `json:"tenantSelector"`
+		NetworkPolicies    bool     `json:"networkPolicies"`
+		Ingresses          bool     `json:"ingresses"`
+		AccessRequests     bool     `json:"accessRequests"`
+		ExternalWorkloads  bool     `json:"externalWorkloads"`
+		TenantResources    bool     `json:"tenantResources"`
+		WithholdNamespaces bool     `json:"withholdNamespaces"`
+		TenantOwners       bool     `json:"tenantOwners"`
+		ConfigResource     bool     `json:"configResource"`
+		SyncTimeout        string   `json:"syncTimeout"`
+		StaleTimeout       string   `json:"staleTimeout"`
+		ReuseGrace         string   `json:"reuseGrace"`
+		DenyReassigned     bool     `json:"denyReassigned"`
+		API                []string `json:"api"`
+		CacheSnapshot      []string `json:"cacheSnapshot"`
+	}{
+		TenantSelector:     opts.tenantSelector,
+		NetworkPolicies:    opts.networkPolicies,
+		Ingresses:          opts.ingresses,
+		AccessRequests:     opts.accessRequests,
+		ExternalWorkloads:  opts.externalWorkloads,
+		TenantResources:    opts.tenantResources,
+		WithholdNamespaces: opts.withholdNamespaces,
+		TenantOwners:       opts.tenantOwners,
+		ConfigResource:     opts.configResource,
+		SyncTimeout:        opts.syncTimeout.String(),
+		StaleTimeout:       opts.staleTimeout.String(),
+		ReuseGrace:         opts.reuseGrace.String(),
+		DenyReassigned:     opts.denyReassigned,
+		API: []string{opts.api.endpoint, opts.api.certFile, opts.api.keyFile, opts.api.caFile, opts.api.tokenFile,
+			strconv.FormatInt(opts.api.pageSize, 10), strconv.FormatBool(opts.api.withoutPods),
+			strconv.FormatBool(opts.api.withoutServices), opts.api.resyncPeriod.String()},
+		CacheSnapshot: []string{opts.cacheSnapshot.path, opts.cacheSnapshot.interval.String(),
+			opts.cacheSnapshot.maxAge.String()},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(raw), nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestControllerReload(t *testing.T) {
+	cl := newCluster(2, 2, 1)
+	build := func(opts dnsControllerOptions) (*dnsController, error) {
+		return newDNSControllerForClient(fake.NewClientset(cl.objects()...), opts)
+	}
+
+	const block = "dns://cluster.local.:53//"
+
+	old, err := acquireDNSController(dnsControllerOptions{}, block, build)
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	go old.Start()
+	waitForSync(t, old)
+
+	// A reload with the same configuration reuses the synced controller.
+	same, err := acquireDNSController(dnsControllerOptions{}, block, build)
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	if same != old {
+		t.Fatal("expected the controller to be reused")
+	}
+
+	go same.Start()
+	same.release()
+
+	if isStopped(old) {
+		t.Fatal("controller stopped while still referenced")
+	}
+
+	// Another server block doesn't answer from the controller of this one,
+	// which may enforce another tenant set.
+	other, err := acquireDNSController(dnsControllerOptions{ingresses: true}, "dns://example.org.:53//", build)
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	if other.active() != other {
+		t.Fatal("expected the controller of another server block not to be a predecessor")
+	}
+
+	other.release()
+
+	// A reload with another configuration answers from the old caches
+	// until its own controller has synced.
+	changed, err := acquireDNSController(dnsControllerOptions{networkPolicies: true}, block, build)
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	if changed == old {
+		t.Fatal("expected a new controller")
+	}
+
+	if changed.active() != old {
+		t.Fatal("expected the unsynced controller to defer to its predecessor")
+	}
+
+	go changed.Start()
+	waitForSync(t, changed)
+
+	if changed.active() != changed {
+		t.Fatal("expected the synced controller to answer itself")
+	}
+
+	old.release()
+
+	if !isStopped(old) {
+		t.Fatal("expected the released controller to be stopped")
+	}
+
+	changed.release()
+
+	if len(controllers.byKey) != 0 || len(controllers.byBlock) != 0 {
+		t.Fatalf("expected no registered controllers, got %d and %d held", len(controllers.byKey), len(controllers.byBlock))
+	}
+}
+
+func isStopped(c *dnsController) bool {
+	select {
+	case <-c.stopCh:
+		return true
+	default:
+		return false
+	}
+}
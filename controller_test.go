@@ -0,0 +1,341 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEvaluateStrictTenants(t *testing.T) {
+	cl := newCluster(2, 1, 2)
+
+	// Move tenant-1 under tenant-0 so it owns two namespaces.
+	cl.namespaces[1].Labels[CapsuleTenantLabel] = "tenant-0"
+	cl.services[1].Labels = map[string]string{"capsule.io/expose-dns": "true"}
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.labelSelector = matchLabels(map[string]string{"capsule.io/expose-dns": "true"})
+
+	src := cl.pods[0].Status.PodIPs[0].IP
+	clusterIP := func(svc *v1.Service) string { return svc.Spec.ClusterIP }
+
+	tests := []struct {
+		name    string
+		strict  bool
+		dst     string
+		allowed bool
+		reason  string
+	}{
+		{name: "sibling namespace", dst: clusterIP(cl.services[2]), allowed: true, reason: reasonSameTenant},
+		{name: "strict sibling namespace", strict: true, dst: clusterIP(cl.services[2]), reason: reasonStrictTenant},
+		{name: "strict same namespace", strict: true, dst: clusterIP(cl.services[0]), allowed: true, reason: reasonSameTenant},
+		{name: "strict exposed service", strict: true, dst: clusterIP(cl.services[1]), allowed: true, reason: reasonExposedService},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.strictTenants = nil
+			if tt.strict {
+				h.strictTenants = map[string]bool{"tenant-0": true}
+			}
+
+			d := h.dnsController.Evaluate(t.Context(), src, tt.dst, *h)
+			if d.allowed != tt.allowed || d.reason != tt.reason {
+				t.Errorf("got allowed=%t reason=%s, want allowed=%t reason=%s", d.allowed, d.reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateNamespaceGrace(t *testing.T) {
+	cl := newCluster(3, 1, 1)
+
+	// tenant-1 was just created and not labelled yet, tenant-2 never was.
+	delete(cl.namespaces[1].Labels, CapsuleTenantLabel)
+	cl.namespaces[1].CreationTimestamp = meta.Now()
+	delete(cl.namespaces[2].Labels, CapsuleTenantLabel)
+	cl.namespaces[2].CreationTimestamp = meta.NewTime(time.Now().Add(-time.Hour))
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	src := cl.pods[0].Status.PodIPs[0].IP
+
+	tests := []struct {
+		name    string
+		grace   time.Duration
+		dst     string
+		allowed bool
+		reason  string
+	}{
+		{name: "no grace", dst: cl.services[1].Spec.ClusterIP, reason: reasonNonTenantDestination},
+		{name: "new namespace", grace: time.Minute, dst: cl.services[1].Spec.ClusterIP, allowed: true, reason: reasonPendingNamespace},
+		{name: "old namespace", grace: time.Minute, dst: cl.services[2].Spec.ClusterIP, reason: reasonNonTenantDestination},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.namespaceGrace = tt.grace
+
+			d := h.dnsController.Evaluate(t.Context(), src, tt.dst, *h)
+			if d.allowed != tt.allowed || d.reason != tt.reason {
+				t.Errorf("got allowed=%t reason=%s, want allowed=%t reason=%s", d.allowed, d.reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateNamespaceScope(t *testing.T) {
+	cl := newCluster(4, 1, 1)
+
+	// Every namespace is shared: tenant-1 belongs to another tenant, tenant-2
+	// to no tenant and tenant-3 is a sibling namespace of strict tenant-0.
+	delete(cl.namespaces[2].Labels, CapsuleTenantLabel)
+	cl.namespaces[3].Labels[CapsuleTenantLabel] = "tenant-0"
+
+	for _, ns := range cl.namespaces {
+		ns.Labels["capsule.io/dns"] = "enabled"
+	}
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.namespaceLabelSelector = matchLabels(map[string]string{"capsule.io/dns": "enabled"})
+	h.strictTenants = map[string]bool{"tenant-0": true}
+
+	src := cl.pods[0].Status.PodIPs[0].IP
+	otherTenant := cl.services[1].Spec.ClusterIP
+	nonTenant := cl.services[2].Spec.ClusterIP
+	sibling := cl.services[3].Spec.ClusterIP
+
+	tests := []struct {
+		scope   string
+		dst     string
+		allowed bool
+		reason  string
+	}{
+		{scope: "", dst: otherTenant, allowed: true, reason: reasonExposedNamespace},
+		{scope: "", dst: nonTenant, allowed: true, reason: reasonExposedNamespace},
+		{scope: "", dst: sibling, allowed: true, reason: reasonExposedNamespace},
+		{scope: namespaceScopeAll, dst: sibling, allowed: true, reason: reasonExposedNamespace},
+		{scope: namespaceScopeNonTenant, dst: otherTenant, allowed: true, reason: reasonExposedNamespace},
+		{scope: namespaceScopeNonTenant, dst: nonTenant, allowed: true, reason: reasonExposedNamespace},
+		{scope: namespaceScopeNonTenant, dst: sibling, reason: reasonStrictTenant},
+		{scope: namespaceScopeCrossTenant, dst: otherTenant, allowed: true, reason: reasonExposedNamespace},
+		{scope: namespaceScopeCrossTenant, dst: nonTenant, reason: reasonNonTenantDestination},
+		{scope: namespaceScopeCrossTenant, dst: sibling, reason: reasonStrictTenant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scope+" "+tt.dst, func(t *testing.T) {
+			h.namespaceScope = tt.scope
+
+			d := h.dnsController.Evaluate(t.Context(), src, tt.dst, *h)
+			if d.allowed != tt.allowed || d.reason != tt.reason {
+				t.Errorf("got allowed=%t reason=%s, want allowed=%t reason=%s", d.allowed, d.reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
+
+func TestExposure(t *testing.T) {
+	exposedLabels := map[string]string{"capsule.io/expose-dns": "true"}
+	selector := matchLabels(exposedLabels)
+
+	exposedNs := &v1.Namespace{ObjectMeta: meta.ObjectMeta{Labels: exposedLabels}}
+	plainNs := &v1.Namespace{}
+	exposedSvc := &v1.Service{ObjectMeta: meta.ObjectMeta{Labels: exposedLabels}}
+	plainSvc := &v1.Service{}
+	pod := &v1.Pod{ObjectMeta: meta.ObjectMeta{Labels: exposedLabels}}
+	hiddenLabels := map[string]string{"capsule.io/expose-dns": "true", HideLabel: "true"}
+	hiddenNs := &v1.Namespace{ObjectMeta: meta.ObjectMeta{Labels: hiddenLabels}}
+	hiddenSvc := &v1.Service{ObjectMeta: meta.ObjectMeta{Labels: hiddenLabels}}
+	ownHiddenNs := &v1.Namespace{ObjectMeta: meta.ObjectMeta{
+		Labels: map[string]string{"capsule.io/expose-dns": "true", HideLabel: "true", CapsuleTenantLabel: "tenant-a"},
+	}}
+
+	tests := []struct {
+		name      string
+		mode      string
+		services  bool
+		ns        *v1.Namespace
+		obj       any
+		reason    string
+		isExposed bool
+	}{
+		{name: "any service", services: true, ns: plainNs, obj: exposedSvc, reason: reasonExposedService, isExposed: true},
+		{name: "any namespace", services: true, ns: exposedNs, obj: plainSvc, reason: reasonExposedNamespace, isExposed: true},
+		{name: "any none", services: true, ns: plainNs, obj: plainSvc},
+		{name: "all both", mode: selectorModeAll, services: true, ns: exposedNs, obj: exposedSvc, reason: reasonExposedService, isExposed: true},
+		{name: "all service only", mode: selectorModeAll, services: true, ns: plainNs, obj: exposedSvc},
+		{name: "all namespace only", mode: selectorModeAll, services: true, ns: exposedNs, obj: plainSvc},
+		{name: "all pod", mode: selectorModeAll, services: true, ns: exposedNs, obj: pod},
+		{name: "all without service selector", mode: selectorModeAll, ns: exposedNs, obj: pod, reason: reasonExposedNamespace, isExposed: true},
+		{name: "hidden namespace", services: true, ns: hiddenNs, obj: exposedSvc},
+		{name: "hidden service", services: true, ns: exposedNs, obj: hiddenSvc},
+		{name: "hidden from other tenants only", ns: ownHiddenNs, obj: hiddenSvc, reason: reasonExposedNamespace, isExposed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Capsule{namespaceLabelSelector: selector, selectorMode: tt.mode}
+			if tt.services {
+				h.labelSelector = selector
+			}
+
+			reason, _, ok := h.exposure(tt.ns, tt.obj, "tenant-a", tt.ns.Labels[CapsuleTenantLabel])
+			if reason != tt.reason || ok != tt.isExposed {
+				t.Errorf("got %q, %t, want %q, %t", reason, ok, tt.reason, tt.isExposed)
+			}
+		})
+	}
+}
+
+func TestHotPathAllocs(t *testing.T) {
+	h := &Capsule{
+		labelSelector:          matchLabels(map[string]string{"capsule.io/expose-dns": "true"}),
+		namespaceLabelSelector: matchLabels(map[string]string{"capsule.io/dns": "enabled"}),
+	}
+	ns := &v1.Namespace{ObjectMeta: meta.ObjectMeta{Labels: map[string]string{CapsuleTenantLabel: "tenant-b"}}}
+	svc := &v1.Service{ObjectMeta: meta.ObjectMeta{Labels: map[string]string{"app": "api"}}}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		h.exposure(ns, svc, "tenant-a", ns.Labels[CapsuleTenantLabel])
+		normalizeIP("10.0.0.1")
+		namespaceName("team-a.svc.cluster.local.", "cluster.local.")
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocations per query, want 0", allocs)
+	}
+}
+
+func TestNormalizeIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "10.0.0.1", want: "10.0.0.1"},
+		{ip: "::ffff:10.0.0.1", want: "10.0.0.1"},
+		{ip: "fd00:0:0:0:0:0:0:1", want: "fd00::1"},
+		{ip: "FD00::1", want: "fd00::1"},
+		{ip: "fd00::1", want: "fd00::1"},
+		{ip: "fe80::1%eth0", want: "fe80::1%eth0"},
+		{ip: "not-an-ip", want: "not-an-ip"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeIP(tt.ip); got != tt.want {
+			t.Errorf("normalizeIP(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestExposedTo(t *testing.T) {
+	const key = "capsule.io/expose-dns"
+
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		tenant      string
+		want        bool
+	}{
+		{name: "unlabelled", tenant: "tenant-a"},
+		{name: "everyone", labels: map[string]string{key: "true"}, tenant: "tenant-a", want: true},
+		{name: "label list", labels: map[string]string{key: "tenant-a_tenant-b"}, tenant: "tenant-b", want: true},
+		{name: "label list without tenant", labels: map[string]string{key: "tenant-a_tenant-b"}, tenant: "tenant-c"},
+		{name: "annotation list", annotations: map[string]string{key: "tenant-a, tenant-b"}, tenant: "tenant-b", want: true},
+		{name: "annotation wildcard", annotations: map[string]string{key: "*"}, tenant: "tenant-c", want: true},
+		{name: "disabled", labels: map[string]string{key: "false"}, tenant: "tenant-a"},
+		{name: "no prefix match", labels: map[string]string{key: "tenant-ab"}, tenant: "tenant-a"},
+	}
+
+	h := &Capsule{exposureLabel: key}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &v1.Service{ObjectMeta: meta.ObjectMeta{Labels: tt.labels, Annotations: tt.annotations}}
+			if got := h.exposedTo(svc, tt.tenant); got != tt.want {
+				t.Errorf("exposedTo(%s) = %t, want %t", tt.tenant, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetworkPolicyAllows(t *testing.T) {
+	cl := newCluster(3, 1, 0)
+	cl.pods[1].Labels = map[string]string{"app": "api"}
+	cl.pods[2].Labels = map[string]string{"app": "api"}
+
+	from := func(ns string) networkingv1.NetworkPolicyPeer {
+		return networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &meta.LabelSelector{MatchLabels: map[string]string{CapsuleTenantLabel: ns}},
+		}
+	}
+
+	policies := []*networkingv1.NetworkPolicy{
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "from-tenant-0", Namespace: "tenant-1"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: meta.LabelSelector{MatchLabels: map[string]string{"app": "api"}},
+				Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{from("tenant-0")}}},
+			},
+		},
+		{
+			// An invalid pod selector applies to no pod.
+			ObjectMeta: meta.ObjectMeta{Name: "invalid", Namespace: "tenant-2"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: meta.LabelSelector{MatchExpressions: []meta.LabelSelectorRequirement{{Key: "app", Operator: "Near"}}},
+				Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{from("tenant-0")}}},
+			},
+		},
+		{
+			// Some pods of tenant-0 don't stand for the tenant.
+			ObjectMeta: meta.ObjectMeta{Name: "some-pods", Namespace: "tenant-2"},
+			Spec: networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{{
+					NamespaceSelector: from("tenant-0").NamespaceSelector,
+					PodSelector:       &meta.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				}}}},
+			},
+		},
+	}
+
+	objs := cl.objects()
+	for _, policy := range policies {
+		objs = append(objs, policy)
+	}
+
+	h := newTestCapsuleForClient(t, cl, fake.NewClientset(objs...), dnsControllerOptions{networkPolicies: true})
+
+	// The selectors are compiled once, as the policies are cached.
+	for _, obj := range h.dnsController.netpolInformer.GetStore().List() {
+		if _, ok := obj.(*networkPolicy); !ok {
+			t.Fatalf("got %T cached, want a compiled networkPolicy", obj)
+		}
+	}
+
+	src := cl.pods[0].Status.PodIPs[0].IP
+
+	tests := []struct {
+		name    string
+		dst     string
+		allowed bool
+		reason  string
+	}{
+		{name: "admitted namespace", dst: cl.pods[1].Status.PodIPs[0].IP, allowed: true, reason: reasonNetworkPolicy},
+		{name: "invalid or narrower policies", dst: cl.pods[2].Status.PodIPs[0].IP, reason: reasonCrossTenant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := h.dnsController.Evaluate(t.Context(), src, tt.dst, *h)
+			if d.allowed != tt.allowed || d.reason != tt.reason {
+				t.Errorf("got allowed=%t reason=%s, want allowed=%t reason=%s", d.allowed, d.reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+// Reasons attached to a decision, also used as metric and audit values.
+const (
+	reasonUnknownSource        = "unknown_source"
+	reasonNonTenantSource      = "non_tenant_source"
+	reasonOutOfShard           = "out_of_shard"
+	reasonContestedIP          = "contested_ip"
+	reasonUnknownDestination   = "unknown_destination"
+	reasonWithheldNamespace    = "withheld_namespace"
+	reasonPrivateVisibility    = "private_visibility"
+	reasonTenantVisibility     = "tenant_visibility"
+	reasonClusterVisibility    = "cluster_visibility"
+	reasonExposedService       = "exposed_service"
+	reasonExposedNamespace     = "exposed_namespace"
+	reasonReplicatedService    = "replicated_service"
+	reasonTenantGrant          = "tenant_grant"
+	reasonAccessRequest        = "access_request"
+	reasonNetworkPolicy        = "network_policy"
+	reasonPublishedIngress     = "published_ingress"
+	reasonNonTenantDestination = "non_tenant_destination"
+	reasonPendingNamespace     = "pending_namespace"
+	reasonCrossTenant          = "cross_tenant"
+	reasonStrictTenant         = "strict_tenant"
+	reasonSameTenant           = "same_tenant"
+)
+
+// decision is the outcome of evaluating a single query against the policy.
+type decision struct {
+	allowed bool
+	reason  string
+	srcPod  string
+	// srcWorkloadKind and srcWorkloadName are the workload running the
+	// source pod, such as a Deployment.
+	srcWorkloadKind string
+	srcWorkloadName string
+	srcNamespace    string
+	srcTenant       string
+	dstNamespace    string
+	dstTenant       string
+	// rule is the directive, label or annotation behind the decision, empty
+	// for the tenant isolation itself.
+	rule string
+	// traced is set for the source pods annotated with TraceAnnotation.
+	traced bool
+}
+
+func (d decision) allow(reason string) decision {
+	d.allowed = true
+	d.reason = reason
+
+	return d
+}
+
+func (d decision) deny(reason string) decision {
+	d.allowed = false
+	d.reason = reason
+
+	return d
+}
+
+// by records the rule behind d.
+func (d decision) by(rule string) decision {
+	d.rule = rule
+
+	return d
+}
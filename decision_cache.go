@@ -0,0 +1,141 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultDecisionCacheSize = 10000
+
+type decisionKey struct {
+	src string
+	dst string
+}
+
+type cachedDecision struct {
+	decision
+	expires time.Time
+}
+
+// negative reports whether the decision was reached because one end of the
+// query could not be attributed.
+func (d cachedDecision) negative() bool {
+	return d.reason == reasonUnknownSource || d.reason == reasonUnknownDestination
+}
+
+// decisionCache memoizes decisions per source and destination IP for a short
+// time. Entries for which one end could not be attributed form the negative
+// cache.
+type decisionCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	size    int
+	entries map[decisionKey]cachedDecision
+}
+
+func newDecisionCache(ttl time.Duration, size int) *decisionCache {
+	return &decisionCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[decisionKey]cachedDecision, size),
+	}
+}
+
+func (c *decisionCache) get(src, dst string) (decision, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[decisionKey{src: src, dst: dst}]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		cacheStats.record(false)
+
+		return decision{}, false
+	}
+
+	cacheStats.record(true)
+
+	return entry.decision, true
+}
+
+func (c *decisionCache) set(src, dst string, d decision) {
+	key := decisionKey{src: src, dst: dst}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		c.evict(now)
+	}
+
+	c.entries[key] = cachedDecision{decision: d, expires: now.Add(c.ttl)}
+}
+
+// evictionSamples is how many entries a full cache looks at to make room for
+// another.
+const evictionSamples = 8
+
+// evict drops an entry of a full cache: the first expired one among a sample,
+// or else the sampled one expiring first, the oldest since they share the
+// TTL. Map iteration starts at a random entry, so the sample is random and
+// eviction costs the same whatever the size. The caller must hold the lock.
+func (c *decisionCache) evict(now time.Time) {
+	var (
+		victim  decisionKey
+		expires time.Time
+		sampled int
+	)
+
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+			decisionCacheEvictions.WithLabelValues("expired").Inc()
+
+			return
+		}
+
+		if sampled == 0 || entry.expires.Before(expires) {
+			victim, expires = key, entry.expires
+		}
+
+		if sampled++; sampled == evictionSamples {
+			break
+		}
+	}
+
+	if sampled > 0 {
+		delete(c.entries, victim)
+		decisionCacheEvictions.WithLabelValues("size").Inc()
+	}
+}
+
+// flush drops the negative entries, or every entry when negativeOnly is
+// false, and returns how many were removed.
+func (c *decisionCache) flush(negativeOnly bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !negativeOnly {
+		n := len(c.entries)
+		c.entries = make(map[decisionKey]cachedDecision, c.size)
+		decisionCacheEvictions.WithLabelValues("flush").Add(float64(n))
+
+		return n
+	}
+
+	n := 0
+
+	for key, entry := range c.entries {
+		if entry.negative() {
+			delete(c.entries, key)
+			n++
+		}
+	}
+
+	decisionCacheEvictions.WithLabelValues("flush").Add(float64(n))
+
+	return n
+}
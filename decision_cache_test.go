@@ -0,0 +1,124 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestDecisionCacheExpiry(t *testing.T) {
+	c := newDecisionCache(time.Minute, defaultDecisionCacheSize)
+	c.set("10.0.0.1", "172.16.0.1", decision{allowed: true, reason: reasonSameTenant})
+
+	if d, ok := c.get("10.0.0.1", "172.16.0.1"); !ok || d.reason != reasonSameTenant {
+		t.Fatalf("got %+v, %t, want the cached decision", d, ok)
+	}
+
+	key := decisionKey{src: "10.0.0.1", dst: "172.16.0.1"}
+	entry := c.entries[key]
+	entry.expires = time.Now().Add(-time.Second)
+	c.entries[key] = entry
+
+	if d, ok := c.get("10.0.0.1", "172.16.0.1"); ok {
+		t.Errorf("got %+v past the TTL, want a miss", d)
+	}
+}
+
+func TestDecisionCacheSize(t *testing.T) {
+	const size = 16
+
+	c := newDecisionCache(time.Minute, size)
+
+	for i := range 10 * size {
+		c.set("10.0.0.1", "172.16.0."+strconv.Itoa(i), decision{allowed: true})
+
+		if len(c.entries) > size {
+			t.Fatalf("got %d entries after %d inserts, want at most %d", len(c.entries), i+1, size)
+		}
+	}
+
+	if _, ok := c.get("10.0.0.1", "172.16.0."+strconv.Itoa(10*size-1)); !ok {
+		t.Error("got the last decision evicted")
+	}
+
+	// An expired entry is dropped rather than a live one, the whole of a
+	// cache no larger than the sample being looked at.
+	small := newDecisionCache(time.Minute, evictionSamples)
+
+	for i := range evictionSamples {
+		small.set("10.0.0.1", "172.16.0."+strconv.Itoa(i), decision{allowed: true})
+	}
+
+	expired := decisionKey{src: "10.0.0.1", dst: "172.16.0.3"}
+	entry := small.entries[expired]
+	entry.expires = time.Now().Add(-time.Second)
+	small.entries[expired] = entry
+
+	small.set("10.0.0.2", "172.16.0.1", decision{allowed: true})
+
+	if _, ok := small.entries[expired]; ok || len(small.entries) != evictionSamples {
+		t.Errorf("got %d entries with the expired one kept %t, want it replaced", len(small.entries), ok)
+	}
+
+	// Replacing an entry of a full cache evicts nothing.
+	n := len(c.entries)
+	c.set("10.0.0.1", "172.16.0."+strconv.Itoa(10*size-1), decision{})
+
+	if len(c.entries) != n {
+		t.Errorf("got %d entries after a replacement, want %d", len(c.entries), n)
+	}
+}
+
+func TestAdminFlushNegative(t *testing.T) {
+	h := &Capsule{cache: newDecisionCache(time.Minute, defaultDecisionCacheSize)}
+	h.cache.set("10.0.0.1", "172.16.0.1", decision{allowed: true, reason: reasonSameTenant})
+	h.cache.set("10.0.0.2", "172.16.0.1", decision{allowed: true, reason: reasonUnknownSource})
+	h.cache.set("10.0.0.1", "172.16.0.2", decision{allowed: true, reason: reasonUnknownDestination})
+
+	h.search = newSearchCache(time.Minute, defaultDecisionCacheSize)
+	h.search.setSource("10.0.0.3", decision{allowed: true, reason: reasonNonTenantSource})
+	h.search.setSource("10.0.0.4", decision{allowed: true, reason: reasonUnknownSource})
+	h.search.setNegative("10.0.0.1", dns.TypeA, "missing.team-a.svc.cluster.local.")
+
+	a := newAdminServer(h, "", "")
+
+	rec := httptest.NewRecorder()
+	a.flush(rec, httptest.NewRequest(http.MethodPost, "/flush?scope=negative", nil))
+
+	var got map[string]int
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode the response: %v", err)
+	}
+
+	if got["flushed"] != 4 {
+		t.Errorf("got %v, want the 4 negative entries flushed", got)
+	}
+
+	if _, ok := h.cache.get("10.0.0.1", "172.16.0.1"); !ok {
+		t.Error("got the positive entry flushed")
+	}
+
+	if _, ok := h.search.source("10.0.0.3"); !ok {
+		t.Error("got the positive source-level decision flushed")
+	}
+
+	if _, ok := h.search.source("10.0.0.4"); ok {
+		t.Error("got the unknown source kept")
+	}
+
+	if h.search.unnamed("10.0.0.1", dns.TypeA, "missing.team-a.svc.cluster.local.") {
+		t.Error("got the name that didn't resolve kept")
+	}
+
+	if n := h.cache.flush(false); n != 1 {
+		t.Errorf("got %d entries flushed, want the positive one", n)
+	}
+}
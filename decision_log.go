@@ -0,0 +1,180 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// Formats of the decision logs.
+const (
+	logFormatKV   = "kv"
+	logFormatJSON = "json"
+)
+
+// decisionLogFields are the fields decision logs may carry.
+var decisionLogFields = []string{
+	"allowed", "reason", "rule", "qname", "qtype", "src_ip", "src_pod",
+	"src_workload", "src_namespace", "src_tenant", "dst_ip", "dst_namespace",
+	"dst_tenant",
+}
+
+// defaultDecisionLogFields are the fields logged unless log_format lists them.
+var defaultDecisionLogFields = []string{
+	"allowed", "reason", "qname", "qtype", "src_ip", "src_pod", "src_workload",
+	"src_namespace", "src_tenant", "dst_ip", "dst_namespace", "dst_tenant",
+}
+
+// logSampling is the fraction of allowed and blocked decisions logged by
+// log_sample_rate, from 0 (none) to 1 (every one).
+type logSampling struct {
+	allowed float64
+	blocked float64
+}
+
+func (s *logSampling) sampled(d decision) bool {
+	rate := s.blocked
+	if d.allowed {
+		rate = s.allowed
+	}
+
+	return rate >= 1 || (rate > 0 && rand.Float64() < rate)
+}
+
+// logFormat is how log_format writes decision logs: the fields, in order, as
+// key=value pairs or a JSON object.
+type logFormat struct {
+	json   bool
+	fields []string
+}
+
+var defaultLogFormat = logFormat{fields: defaultDecisionLogFields}
+
+// format returns the log line of the decision d on question.
+func (f *logFormat) format(question request.Request, qname string, destIp string, d decision) string {
+	var b strings.Builder
+
+	if f.json {
+		b.WriteByte('{')
+	}
+
+	for i, field := range f.fields {
+		var value any
+
+		switch field {
+		case "allowed":
+			value = d.allowed
+		case "reason":
+			value = d.reason
+		case "rule":
+			value = d.rule
+		case "qname":
+			value = qname
+		case "qtype":
+			value = dns.TypeToString[question.QType()]
+		case "src_ip":
+			value = question.IP()
+		case "src_pod":
+			value = d.srcPod
+		case "src_workload":
+			value = d.workload()
+		case "src_namespace":
+			value = d.srcNamespace
+		case "src_tenant":
+			value = d.srcTenant
+		case "dst_ip":
+			value = destIp
+		case "dst_namespace":
+			value = d.dstNamespace
+		case "dst_tenant":
+			value = d.dstTenant
+		}
+
+		if f.json {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			key, _ := json.Marshal(field)
+			v, _ := json.Marshal(value)
+
+			b.Write(key)
+			b.WriteByte(':')
+			b.Write(v)
+
+			continue
+		}
+
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+
+		b.WriteString(field)
+		b.WriteByte('=')
+
+		switch v := value.(type) {
+		case bool:
+			b.WriteString(strconv.FormatBool(v))
+		case string:
+			b.WriteString(logfmtValue(v))
+		}
+	}
+
+	if f.json {
+		b.WriteByte('}')
+	}
+
+	return b.String()
+}
+
+// logfmtValue quotes s when it would not read back as a single value.
+func logfmtValue(s string) string {
+	if strings.ContainsFunc(s, func(r rune) bool {
+		return r == '"' || r == '=' || unicode.IsSpace(r) || !unicode.IsPrint(r)
+	}) {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+// logDecision logs a sample of the decisions when log_sample_rate is set, and
+// every decision traced by TraceAnnotation or at debug level.
+func (h *Capsule) logDecision(question request.Request, destIp string, d decision) {
+	if d.traced || log.verbose() {
+		h.traceDecision(question, destIp, d)
+
+		return
+	}
+
+	if h.logSample == nil || !h.logSample.sampled(d) {
+		return
+	}
+
+	f := h.logFormat
+	if f == nil {
+		f = &defaultLogFormat
+	}
+
+	log.Info(f.format(question, h.reportedQName(question.Name()), destIp, d))
+}
+
+// traceDecision logs d with every field, in the encoding of log_format, for
+// the pods annotated with TraceAnnotation. It is logged at the info level, the
+// debug plugin enabling the debug one for the whole server.
+func (h *Capsule) traceDecision(question request.Request, destIp string, d decision) {
+	f := logFormat{fields: decisionLogFields}
+	if h.logFormat != nil {
+		f.json = h.logFormat.json
+	}
+
+	log.Info("trace " + f.format(question, h.reportedQName(question.Name()), destIp, d))
+}
@@ -0,0 +1,207 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParseLogSampleRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *logSampling
+		wantErr bool
+	}{
+		{name: "disabled", input: "capsule {\nnetworkpolicies\n}"},
+		{name: "allowed only", input: "capsule {\nlog_sample_rate 0.01\n}", want: &logSampling{allowed: 0.01, blocked: 1}},
+		{name: "allowed and blocked", input: "capsule {\nlog_sample_rate 0 0.5\n}", want: &logSampling{allowed: 0, blocked: 0.5}},
+		{name: "missing rate", input: "capsule {\nlog_sample_rate\n}", wantErr: true},
+		{name: "too many rates", input: "capsule {\nlog_sample_rate 1 1 1\n}", wantErr: true},
+		{name: "above one", input: "capsule {\nlog_sample_rate 2\n}", wantErr: true},
+		{name: "negative", input: "capsule {\nlog_sample_rate 1 -0.1\n}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if (h.logSample == nil) != (tt.want == nil) || (tt.want != nil && *h.logSample != *tt.want) {
+				t.Errorf("got %+v, want %+v", h.logSample, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogSampled(t *testing.T) {
+	s := &logSampling{allowed: 0, blocked: 1}
+
+	for range 100 {
+		if s.sampled(decision{allowed: true}) {
+			t.Fatal("allowed decision sampled at rate 0")
+		}
+
+		if !s.sampled(decision{allowed: false}) {
+			t.Fatal("blocked decision not sampled at rate 1")
+		}
+	}
+}
+
+func TestParseLogFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *logFormat
+		wantErr bool
+	}{
+		{name: "default", input: "capsule {\nlog_sample_rate 1\n}"},
+		{name: "kv", input: "capsule {\nlog_sample_rate 1\nlog_format kv\n}", want: &logFormat{fields: defaultDecisionLogFields}},
+		{name: "json fields", input: "capsule {\nlog_sample_rate 1\nlog_format json qname src_pod allowed\n}", want: &logFormat{json: true, fields: []string{"qname", "src_pod", "allowed"}}},
+		{name: "missing format", input: "capsule {\nlog_sample_rate 1\nlog_format\n}", wantErr: true},
+		{name: "unknown format", input: "capsule {\nlog_sample_rate 1\nlog_format text\n}", wantErr: true},
+		{name: "unknown field", input: "capsule {\nlog_sample_rate 1\nlog_format kv src_node\n}", wantErr: true},
+		{name: "duplicate field", input: "capsule {\nlog_sample_rate 1\nlog_format kv qname qname\n}", wantErr: true},
+		{name: "without sampling", input: "capsule {\nlog_format json\n}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(h.logFormat, tt.want) {
+				t.Errorf("got %+v, want %+v", h.logFormat, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogFormat(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("api.team-b.svc.cluster.local.", dns.TypeA)
+
+	question := request.Request{W: &test.ResponseWriter{RemoteIP: "10.244.1.12"}, Req: m}
+	d := decision{
+		reason:          reasonCrossTenant,
+		srcPod:          "web-7d4b9c-x2x9k",
+		srcWorkloadKind: "Deployment",
+		srcWorkloadName: "web",
+		srcNamespace:    "team-a-app",
+		srcTenant:       "team-a",
+		dstNamespace:    "team-b-app",
+		dstTenant:       "team-b",
+	}
+
+	tests := []struct {
+		name   string
+		format logFormat
+		want   string
+	}{
+		{
+			name:   "default",
+			format: defaultLogFormat,
+			want:   "allowed=false reason=cross_tenant qname=api.team-b.svc.cluster.local. qtype=A src_ip=10.244.1.12 src_pod=web-7d4b9c-x2x9k src_workload=Deployment/web src_namespace=team-a-app src_tenant=team-a dst_ip=10.96.14.7 dst_namespace=team-b-app dst_tenant=team-b",
+		},
+		{
+			name:   "kv fields",
+			format: logFormat{fields: []string{"src_tenant", "rule", "allowed"}},
+			want:   "src_tenant=team-a rule= allowed=false",
+		},
+		{
+			name:   "json fields",
+			format: logFormat{json: true, fields: []string{"allowed", "qname", "src_workload", "rule"}},
+			want:   `{"allowed":false,"qname":"api.team-b.svc.cluster.local.","src_workload":"Deployment/web","rule":""}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.format.format(question, question.Name(), "10.96.14.7", d); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogfmtValue(t *testing.T) {
+	for value, want := range map[string]string{
+		"team-a":     "team-a",
+		"":           "",
+		"a b":        `"a b"`,
+		`say "hi"`:   `"say \"hi\""`,
+		"k=v":        `"k=v"`,
+		"tab\tthere": `"tab\tthere"`,
+	} {
+		if got := logfmtValue(value); got != want {
+			t.Errorf("logfmtValue(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestEvaluateTraced(t *testing.T) {
+	cl := newCluster(1, 2, 1)
+	cl.pods[0].Annotations = map[string]string{TraceAnnotation: "true", "team-a/owner": "web"}
+	cl.pods[1].Annotations = map[string]string{TraceAnnotation: "false"}
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+
+	for i, want := range []bool{true, false} {
+		d := h.dnsController.Evaluate(t.Context(), cl.pods[i].Status.PodIPs[0].IP, cl.services[0].Spec.ClusterIP, *h)
+		if d.traced != want {
+			t.Errorf("got traced %t for pod %s, want %t", d.traced, cl.pods[i].Name, want)
+		}
+	}
+
+	slim, err := slimPod(cl.pods[0])
+	if err != nil {
+		t.Fatalf("slimPod failed: %v", err)
+	}
+
+	//nolint:forcetypeassert
+	if got := slim.(*v1.Pod).Annotations; !reflect.DeepEqual(got, map[string]string{TraceAnnotation: "true"}) {
+		t.Errorf("got annotations %v, want %s alone", got, TraceAnnotation)
+	}
+}
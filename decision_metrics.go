@@ -0,0 +1,69 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Dimensions metric_labels may add to decisions_total.
+const (
+	metricLabelQtype        = "qtype"
+	metricLabelZone         = "zone"
+	metricLabelSrcNamespace = "src_namespace"
+	metricLabelTenantPair   = "tenant_pair"
+)
+
+// decisionsTotal counts the decisions. Its labels are the same for every
+// server block, the dimensions metric_labels doesn't enable are left empty.
+var decisionsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "decisions_total",
+		Help:      "Number of decisions, partitioned by decision (allowed or denied), reason and the dimensions enabled with metric_labels.",
+	},
+	[]string{"decision", "reason", "qtype", "zone", "src_namespace", "src_tenant", "dst_tenant"},
+)
+
+// metricLabels are the dimensions enabled with metric_labels.
+type metricLabels struct {
+	qtype        bool
+	zone         bool
+	srcNamespace bool
+	tenantPair   bool
+}
+
+// countDecision counts d in decisionsTotal, zone being the server block
+// zone the question was answered for.
+func (h *Capsule) countDecision(question request.Request, zone string, d decision) {
+	outcome := "denied"
+	if d.allowed {
+		outcome = "allowed"
+	}
+
+	var qtype, srcNamespace, srcTenant, dstTenant string
+
+	if h.metricLabels.qtype {
+		qtype = dns.TypeToString[question.QType()]
+	}
+
+	if !h.metricLabels.zone {
+		zone = ""
+	}
+
+	if h.metricLabels.srcNamespace {
+		srcNamespace = d.srcNamespace
+	}
+
+	if h.metricLabels.tenantPair {
+		srcTenant, dstTenant = d.srcTenant, d.dstTenant
+	}
+
+	decisionsTotal.WithLabelValues(outcome, d.reason, qtype, zone, srcNamespace, srcTenant, dstTenant).Inc()
+}
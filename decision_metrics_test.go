@@ -0,0 +1,106 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseMetricLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    metricLabels
+		wantErr bool
+	}{
+		{name: "default", input: "capsule {\nnetworkpolicies\n}"},
+		{name: "qtype and zone", input: "capsule {\nmetric_labels qtype zone\n}", want: metricLabels{qtype: true, zone: true}},
+		{name: "all", input: "capsule {\nmetric_labels qtype zone src_namespace tenant_pair\n}", want: metricLabels{qtype: true, zone: true, srcNamespace: true, tenantPair: true}},
+		{name: "missing label", input: "capsule {\nmetric_labels\n}", wantErr: true},
+		{name: "unknown label", input: "capsule {\nmetric_labels qname\n}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if h.metricLabels != tt.want {
+				t.Errorf("got %+v, want %+v", h.metricLabels, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecisionMetrics(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+
+	tests := []struct {
+		name   string
+		labels metricLabels
+		want   []string
+	}{
+		{
+			name: "default",
+			want: []string{"denied", reasonCrossTenant, "", "", "", "", ""},
+		},
+		{
+			name:   "qtype and tenant pair",
+			labels: metricLabels{qtype: true, tenantPair: true},
+			want:   []string{"denied", reasonCrossTenant, "A", "", "", "tenant-0", "tenant-1"},
+		},
+		{
+			name:   "all",
+			labels: metricLabels{qtype: true, zone: true, srcNamespace: true, tenantPair: true},
+			want:   []string{"denied", reasonCrossTenant, "A", testZone, "tenant-0", "tenant-0", "tenant-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.metricLabels = tt.labels
+
+			counter := decisionsTotal.WithLabelValues(tt.want...)
+			before := testutil.ToFloat64(counter)
+
+			m := new(dns.Msg)
+			m.SetQuestion(cl.services[1].Name+"."+cl.services[1].Namespace+".svc."+testZone, dns.TypeA)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: cl.pods[0].Status.PodIPs[0].IP})
+
+			if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+				t.Fatalf("ServeDNS failed: %v", err)
+			}
+
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("got %v decisions counted with labels %q, want 1", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The conformance mode lets the suite run against an arbitrary existing
+// cluster: the capsule block is injected in the CoreDNS Corefile before the
+// specs run and the original configuration is restored afterwards. Where
+// CoreDNS runs depends on the distribution, see detectDistribution.
+const (
+	conformanceEnv           = "E2E_INJECT_COREFILE"
+	conformanceNamespaceEnv  = "E2E_COREDNS_NAMESPACE"
+	conformanceConfigMapEnv  = "E2E_COREDNS_CONFIGMAP"
+	conformanceDeploymentEnv = "E2E_COREDNS_DEPLOYMENT"
+	conformanceImageEnv      = "E2E_COREDNS_IMAGE"
+
+	conformanceRolloutTimeout = 5 * time.Minute
+	// sharedNamespace is whitelisted through namespace_labels by the specs.
+	sharedNamespace = "default"
+)
+
+// capsuleBlock is the configuration the specs are written against.
+var capsuleBlock = []string{
+	"capsule {",
+	"   namespace_labels capsule.io/dns=enabled",
+	"   labels capsule.io/expose-dns=true",
+	"   enforce_qtypes A AAAA PTR SRV",
+	"}",
+}
+
+// conformanceState holds what has to be restored once the suite is done.
+type conformanceState struct {
+	distribution  distribution
+	corefile      string
+	image         string
+	sharedLabels  map[string]string
+	operatorState string
+}
+
+var conformance *conformanceState
+
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return def
+}
+
+// conformanceKeys returns the CoreDNS ConfigMap and workload, by default
+// where the distribution d runs them.
+func conformanceKeys(d distribution) (cm, workload types.NamespacedName) {
+	ns := envOrDefault(conformanceNamespaceEnv, d.namespace)
+
+	return types.NamespacedName{Namespace: ns, Name: envOrDefault(conformanceConfigMapEnv, d.configMap)},
+		types.NamespacedName{Namespace: ns, Name: envOrDefault(conformanceDeploymentEnv, d.workload)}
+}
+
+// injectCorefile inserts capsuleBlock right before the kubernetes plugin of
+// every server block lacking one, and keeps the answers of its zone out of the
+// cache.
+func injectCorefile(corefile string) (string, error) {
+	lines := strings.Split(corefile, "\n")
+	out := make([]string, 0, len(lines)+len(capsuleBlock))
+	injected := false
+	zone := ""
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "capsule") {
+			return corefile, nil
+		}
+
+		if strings.HasPrefix(trimmed, "kubernetes ") || trimmed == "kubernetes" || trimmed == "kubernetes {" {
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			for _, l := range capsuleBlock {
+				out = append(out, indent+l)
+			}
+
+			injected = true
+
+			if fields := strings.Fields(trimmed); zone == "" && len(fields) > 1 && fields[1] != "{" {
+				zone = fields[1]
+			}
+		}
+
+		out = append(out, line)
+	}
+
+	if !injected {
+		return "", fmt.Errorf("no kubernetes plugin found in the Corefile")
+	}
+
+	if zone == "" {
+		zone = "cluster.local"
+	}
+
+	return disableZoneCache(strings.Join(out, "\n"), zone), nil
+}
+
+func setupConformance() {
+	if os.Getenv(conformanceEnv) != "true" {
+		return
+	}
+
+	d := detectDistribution()
+	cmKey, workloadKey := conformanceKeys(d)
+	state := &conformanceState{distribution: d}
+
+	if d.operator {
+		By("switching the DNS operator to Unmanaged")
+		state.operatorState = setDNSOperatorState("Unmanaged")
+	}
+
+	By("injecting the capsule block in the CoreDNS Corefile of " + d.name)
+	cm := &corev1.ConfigMap{}
+	Expect(k8sClient.Get(context.TODO(), cmKey, cm)).To(Succeed())
+
+	state.corefile = cm.Data["Corefile"]
+	corefile, err := injectCorefile(state.corefile)
+	Expect(err).ToNot(HaveOccurred())
+
+	cm.Data["Corefile"] = corefile
+	Expect(k8sClient.Update(context.TODO(), cm)).To(Succeed())
+
+	By("labelling the shared namespace")
+	ns := &corev1.Namespace{}
+	Expect(k8sClient.Get(context.TODO(), types.NamespacedName{Name: sharedNamespace}, ns)).To(Succeed())
+
+	state.sharedLabels = ns.GetLabels()
+	labels := map[string]string{"capsule.io/dns": "enabled"}
+	for k, v := range state.sharedLabels {
+		labels[k] = v
+	}
+
+	ns.SetLabels(labels)
+	Expect(k8sClient.Update(context.TODO(), ns)).To(Succeed())
+
+	conformance = state
+
+	By("rolling out CoreDNS")
+	rolloutCoreDNS(d, workloadKey, os.Getenv(conformanceImageEnv), &state.image)
+}
+
+func teardownConformance() {
+	if conformance == nil {
+		return
+	}
+
+	d := conformance.distribution
+	cmKey, workloadKey := conformanceKeys(d)
+
+	By("restoring the original CoreDNS Corefile")
+	cm := &corev1.ConfigMap{}
+	Expect(k8sClient.Get(context.TODO(), cmKey, cm)).To(Succeed())
+
+	cm.Data["Corefile"] = conformance.corefile
+	Expect(k8sClient.Update(context.TODO(), cm)).To(Succeed())
+
+	By("restoring the shared namespace labels")
+	ns := &corev1.Namespace{}
+	Expect(k8sClient.Get(context.TODO(), types.NamespacedName{Name: sharedNamespace}, ns)).To(Succeed())
+	ns.SetLabels(conformance.sharedLabels)
+	Expect(k8sClient.Update(context.TODO(), ns)).To(Succeed())
+
+	By("rolling out CoreDNS")
+	rolloutCoreDNS(d, workloadKey, conformance.image, nil)
+
+	if d.operator {
+		By("handing CoreDNS back to the DNS operator")
+		setDNSOperatorState(conformance.operatorState)
+	}
+
+	conformance = nil
+}
+
+// rolloutCoreDNS restarts the CoreDNS workload of d, switching its first
+// container to image when set, and waits for the rollout to complete. The
+// image in place before the change is stored in previous.
+func rolloutCoreDNS(d distribution, key types.NamespacedName, image string, previous *string) {
+	if d.daemonSet {
+		ds := &appsv1.DaemonSet{}
+		Expect(k8sClient.Get(context.TODO(), key, ds)).To(Succeed())
+
+		restartTemplate(&ds.Spec.Template, image, previous)
+		Expect(k8sClient.Update(context.TODO(), ds)).To(Succeed())
+
+		Eventually(func() error {
+			ds := &appsv1.DaemonSet{}
+			if err := k8sClient.Get(context.TODO(), key, ds); err != nil {
+				return err
+			}
+
+			desired := ds.Status.DesiredNumberScheduled
+			if ds.Status.ObservedGeneration < ds.Generation ||
+				ds.Status.UpdatedNumberScheduled != desired ||
+				ds.Status.NumberAvailable != desired {
+				return fmt.Errorf("daemonset %s not rolled out yet", key)
+			}
+
+			return nil
+		}, conformanceRolloutTimeout, defaultPollInterval).Should(Succeed())
+
+		return
+	}
+
+	deploy := &appsv1.Deployment{}
+	Expect(k8sClient.Get(context.TODO(), key, deploy)).To(Succeed())
+
+	restartTemplate(&deploy.Spec.Template, image, previous)
+	Expect(k8sClient.Update(context.TODO(), deploy)).To(Succeed())
+
+	Eventually(func() error {
+		d := &appsv1.Deployment{}
+		if err := k8sClient.Get(context.TODO(), key, d); err != nil {
+			return err
+		}
+
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+
+		if d.Status.ObservedGeneration < d.Generation ||
+			d.Status.UpdatedReplicas != replicas ||
+			d.Status.AvailableReplicas != replicas ||
+			d.Status.Replicas != replicas {
+			return fmt.Errorf("deployment %s not rolled out yet", key)
+		}
+
+		return nil
+	}, conformanceRolloutTimeout, defaultPollInterval).Should(Succeed())
+}
+
+// restartTemplate switches the first container of tpl to image when set, after
+// storing the current one in previous, and marks tpl restarted.
+func restartTemplate(tpl *corev1.PodTemplateSpec, image string, previous *string) {
+	if previous != nil {
+		*previous = tpl.Spec.Containers[0].Image
+	}
+
+	if image != "" {
+		tpl.Spec.Containers[0].Image = image
+	}
+
+	if tpl.Annotations == nil {
+		tpl.Annotations = map[string]string{}
+	}
+
+	tpl.Annotations["kubectl.kubernetes.io/restartedAt"] = time.Now().Format(time.RFC3339)
+}
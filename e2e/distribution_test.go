@@ -0,0 +1,154 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package e2e
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Distributions the conformance mode knows the CoreDNS layout of.
+const (
+	distributionEnv = "E2E_DISTRIBUTION"
+
+	distributionKubeadm   = "kubeadm"
+	distributionK3s       = "k3s"
+	distributionRKE2      = "rke2"
+	distributionOpenShift = "openshift"
+)
+
+// distribution is where a Kubernetes distribution runs CoreDNS.
+type distribution struct {
+	name      string
+	namespace string
+	configMap string
+	// workload runs CoreDNS, a Deployment unless daemonSet is set.
+	workload  string
+	daemonSet bool
+	// operator is set when the OpenShift DNS operator reconciles the
+	// ConfigMap and the workload, it is switched to Unmanaged for the run.
+	operator bool
+}
+
+// distributions lists the layouts by name. KinD and kubeadm clusters share the
+// upstream one, as does k3s, whose deploy controller only applies its CoreDNS
+// manifest again when the server restarts.
+var distributions = map[string]distribution{
+	distributionKubeadm: {
+		name: distributionKubeadm, namespace: "kube-system", configMap: "coredns", workload: "coredns",
+	},
+	distributionK3s: {
+		name: distributionK3s, namespace: "kube-system", configMap: "coredns", workload: "coredns",
+	},
+	distributionRKE2: {
+		name: distributionRKE2, namespace: "kube-system",
+		configMap: "rke2-coredns-rke2-coredns", workload: "rke2-coredns-rke2-coredns",
+	},
+	distributionOpenShift: {
+		name: distributionOpenShift, namespace: "openshift-dns",
+		configMap: "dns-default", workload: "dns-default", daemonSet: true, operator: true,
+	},
+}
+
+// detectDistribution returns the distribution named by E2E_DISTRIBUTION, or the
+// one the cluster looks like: OpenShift has an openshift-dns namespace, k3s and
+// RKE2 suffix the kubelet version of their nodes.
+func detectDistribution() distribution {
+	if name := os.Getenv(distributionEnv); name != "" {
+		d, ok := distributions[name]
+		Expect(ok).To(BeTrue(), "unknown %s %q", distributionEnv, name)
+
+		return d
+	}
+
+	err := k8sClient.Get(context.TODO(), types.NamespacedName{Name: "openshift-dns"}, &corev1.Namespace{})
+	if err == nil {
+		return distributions[distributionOpenShift]
+	}
+
+	Expect(apierrors.IsNotFound(err)).To(BeTrue(), "failed to look up the openshift-dns namespace: %v", err)
+
+	nodes := &corev1.NodeList{}
+	Expect(k8sClient.List(context.TODO(), nodes)).To(Succeed())
+
+	for _, node := range nodes.Items {
+		version := node.Status.NodeInfo.KubeletVersion
+
+		switch {
+		case strings.Contains(version, "+k3s"):
+			return distributions[distributionK3s]
+		case strings.Contains(version, "+rke2"):
+			return distributions[distributionRKE2]
+		}
+	}
+
+	return distributions[distributionKubeadm]
+}
+
+// dnsOperator is the OpenShift DNS operator configuration.
+var dnsOperator = schema.GroupVersionKind{Group: "operator.openshift.io", Version: "v1", Kind: "DNS"}
+
+// setDNSOperatorState sets the managementState of the OpenShift DNS operator
+// and returns the previous one, Managed when unset.
+func setDNSOperatorState(state string) string {
+	op := &unstructured.Unstructured{}
+	op.SetGroupVersionKind(dnsOperator)
+	Expect(k8sClient.Get(context.TODO(), types.NamespacedName{Name: "default"}, op)).To(Succeed())
+
+	previous, _, _ := unstructured.NestedString(op.Object, "spec", "managementState")
+	if previous == "" {
+		previous = "Managed"
+	}
+
+	Expect(unstructured.SetNestedField(op.Object, state, "spec", "managementState")).To(Succeed())
+	Expect(k8sClient.Update(context.TODO(), op)).To(Succeed())
+
+	return previous
+}
+
+// disableZoneCache makes the cache plugins of corefile skip zone: the answers
+// of the zone depend on the client, a cached one would be served to every
+// tenant. Upstream, k3s and RKE2 cache the whole server block, OpenShift only
+// tunes the denial cache.
+func disableZoneCache(corefile, zone string) string {
+	if strings.Contains(corefile, "disable success") {
+		return corefile
+	}
+
+	lines := strings.Split(corefile, "\n")
+	out := make([]string, 0, len(lines))
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "cache" && !strings.HasPrefix(trimmed, "cache ") {
+			out = append(out, line)
+
+			continue
+		}
+
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		disable := []string{indent + "   disable success " + zone, indent + "   disable denial " + zone}
+
+		if strings.HasSuffix(trimmed, "{") {
+			out = append(out, line)
+			out = append(out, disable...)
+
+			continue
+		}
+
+		out = append(out, line+" {")
+		out = append(out, disable...)
+		out = append(out, indent+"}")
+	}
+
+	return strings.Join(out, "\n")
+}
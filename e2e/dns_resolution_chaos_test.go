@@ -0,0 +1,224 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"github.com/projectcapsule/capsule/pkg/api"
+)
+
+// coreDNSBinding grants CoreDNS access to the API server, deleting it cuts the
+// informers off while the pods keep running.
+const coreDNSBinding = "system:coredns"
+
+var _ = Describe("DNS resolution during API server disruption", Label("dns", "chaos"), Serial, func() {
+	var (
+		tenantANs = "tenant-a-chaos-ns"
+		tenantBNs = "tenant-b-chaos-ns"
+		podName   = "dns-test-pod"
+		binding   *rbacv1.ClusterRoleBinding
+	)
+
+	tenantA := &capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "tenant-a-chaos",
+		},
+		Spec: capsulev1beta2.TenantSpec{
+			Owners: api.OwnerListSpec{
+				{
+					CoreOwnerSpec: api.CoreOwnerSpec{
+						UserSpec: api.UserSpec{
+							Name: "owner-a",
+							Kind: "User",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	tenantB := &capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "tenant-b-chaos",
+		},
+		Spec: capsulev1beta2.TenantSpec{
+			Owners: api.OwnerListSpec{
+				{
+					CoreOwnerSpec: api.CoreOwnerSpec{
+						UserSpec: api.UserSpec{
+							Name: "owner-b",
+							Kind: "User",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	revokeAPIAccess := func() {
+		binding = &rbacv1.ClusterRoleBinding{}
+		Expect(k8sClient.Get(context.TODO(), types.NamespacedName{Name: coreDNSBinding}, binding)).To(Succeed())
+		Expect(k8sClient.Delete(context.TODO(), binding)).To(Succeed())
+	}
+
+	restoreAPIAccess := func() {
+		if binding == nil {
+			return
+		}
+
+		binding.ResourceVersion = ""
+		binding.UID = ""
+		err := k8sClient.Create(context.TODO(), binding)
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		binding = nil
+	}
+
+	newService := func(cs kubernetes.Interface, ns, name string) {
+		svc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+			},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"app": name},
+				Ports: []corev1.ServicePort{{
+					Port:       80,
+					TargetPort: intstr.FromInt32(80),
+				}},
+			},
+		}
+		_, err := cs.CoreV1().Services(ns).Create(context.TODO(), svc, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	lookup := func(cs kubernetes.Interface, ns, fqdn string) string {
+		stdout, stderr, _ := ExecInPod(cs, ns, podName, "busybox", []string{"nslookup", fqdn})
+		_, _ = fmt.Fprintf(GinkgoWriter, "\nnslookup stdout: %s\nnslookup stderr: %s\n", stdout, stderr)
+
+		return stdout
+	}
+
+	JustBeforeEach(func() {
+		for _, tnt := range []*capsulev1beta2.Tenant{tenantA, tenantB} {
+			EventuallyCreation(func() error {
+				tnt.ResourceVersion = ""
+				return k8sClient.Create(context.TODO(), tnt)
+			}).Should(Succeed())
+		}
+
+		By("creating namespace for tenant A", func() {
+			ns := NewNamespace(tenantANs)
+			NamespaceCreation(ns, tenantA.Spec.Owners[0].UserSpec, defaultTimeoutInterval).Should(Succeed())
+			TenantNamespaceList(tenantA, defaultTimeoutInterval).Should(ContainElement(ns.GetName()))
+		})
+
+		By("creating namespace for tenant B", func() {
+			ns := NewNamespace(tenantBNs)
+			NamespaceCreation(ns, tenantB.Spec.Owners[0].UserSpec, defaultTimeoutInterval).Should(Succeed())
+			TenantNamespaceList(tenantB, defaultTimeoutInterval).Should(ContainElement(ns.GetName()))
+		})
+	})
+
+	JustAfterEach(func() {
+		restoreAPIAccess()
+
+		Expect(k8sClient.Delete(context.TODO(), tenantA)).Should(Succeed())
+		Expect(k8sClient.Delete(context.TODO(), tenantB)).Should(Succeed())
+		By("deleting namespaces", func() {
+			for _, nsName := range []string{tenantANs, tenantBNs} {
+				ns := NewNamespace(nsName)
+				err := k8sClient.Delete(context.TODO(), ns)
+				if err != nil && !apierrors.IsNotFound(err) {
+					Expect(err).ToNot(HaveOccurred())
+				}
+			}
+		})
+	})
+
+	It("should keep enforcing from its caches while cut off and recover once access is restored", func() {
+		csA := ownerClient(tenantA.Spec.Owners[0].UserSpec)
+		csB := ownerClient(tenantB.Spec.Owners[0].UserSpec)
+
+		By("deploying services in both tenants")
+		newService(csA, tenantANs, "service-a")
+		newService(csB, tenantBNs, "service-b")
+
+		By("deploying a client pod in tenant A's namespace")
+		clientPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      podName,
+				Namespace: tenantANs,
+				Labels:    map[string]string{"app": "dns-client"},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:    "busybox",
+					Image:   "busybox",
+					Command: []string{"sleep", "3600"},
+				}},
+				RestartPolicy: corev1.RestartPolicyNever,
+			},
+		}
+		_, err := csA.CoreV1().Pods(tenantANs).Create(context.TODO(), clientPod, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() corev1.PodPhase {
+			p, _ := csA.CoreV1().Pods(tenantANs).Get(context.TODO(), podName, metav1.GetOptions{})
+			return p.Status.Phase
+		}, 60*time.Second, 2*time.Second).Should(Equal(corev1.PodRunning))
+
+		sameTenant := fmt.Sprintf("service-a.%s.svc.cluster.local", tenantANs)
+		otherTenant := fmt.Sprintf("service-b.%s.svc.cluster.local", tenantBNs)
+
+		Eventually(func() string {
+			return lookup(csA, tenantANs, sameTenant)
+		}, 60*time.Second, 2*time.Second).Should(ContainSubstring(fmt.Sprintf("Name:\t%s", sameTenant)))
+		Expect(lookup(csA, tenantANs, otherTenant)).ToNot(ContainSubstring(fmt.Sprintf("Name:\t%s", otherTenant)))
+
+		By("revoking the CoreDNS access to the API server")
+		revokeAPIAccess()
+
+		By("asserting the cached policy keeps being enforced")
+		Consistently(func() string {
+			return lookup(csA, tenantANs, otherTenant)
+		}, 30*time.Second, 5*time.Second).ShouldNot(ContainSubstring(fmt.Sprintf("Name:\t%s", otherTenant)))
+		Expect(lookup(csA, tenantANs, sameTenant)).To(ContainSubstring(fmt.Sprintf("Name:\t%s", sameTenant)))
+
+		By("creating services while CoreDNS is cut off")
+		newService(csA, tenantANs, "late-service-a")
+		newService(csB, tenantBNs, "late-service-b")
+
+		By("restoring the CoreDNS access to the API server")
+		restoreAPIAccess()
+
+		By("asserting the informers reconnect and pick up the new objects")
+		lateSameTenant := fmt.Sprintf("late-service-a.%s.svc.cluster.local", tenantANs)
+		lateOtherTenant := fmt.Sprintf("late-service-b.%s.svc.cluster.local", tenantBNs)
+
+		Eventually(func() string {
+			return lookup(csA, tenantANs, lateSameTenant)
+		}, 2*time.Minute, 5*time.Second).Should(ContainSubstring(fmt.Sprintf("Name:\t%s", lateSameTenant)))
+		Expect(lookup(csA, tenantANs, lateOtherTenant)).ToNot(ContainSubstring(fmt.Sprintf("Name:\t%s", lateOtherTenant)))
+
+		By("cleaning up")
+		Expect(csA.CoreV1().Pods(tenantANs).Delete(context.TODO(), podName, metav1.DeleteOptions{})).Should(Succeed())
+	})
+})
@@ -0,0 +1,222 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"github.com/projectcapsule/capsule/pkg/api"
+)
+
+var _ = Describe("DNS resolution on dual-stack clusters", Label("dns", "dualstack"), func() {
+	var (
+		tenantANs = "tenant-a-dualstack-ns"
+		tenantBNs = "tenant-b-dualstack-ns"
+		podName   = "dns-test-pod"
+		svcName   = "dualstack-service"
+	)
+
+	tenantA := &capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "tenant-a-dualstack",
+		},
+		Spec: capsulev1beta2.TenantSpec{
+			Owners: api.OwnerListSpec{
+				{
+					CoreOwnerSpec: api.CoreOwnerSpec{
+						UserSpec: api.UserSpec{
+							Name: "owner-a",
+							Kind: "User",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	tenantB := &capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "tenant-b-dualstack",
+		},
+		Spec: capsulev1beta2.TenantSpec{
+			Owners: api.OwnerListSpec{
+				{
+					CoreOwnerSpec: api.CoreOwnerSpec{
+						UserSpec: api.UserSpec{
+							Name: "owner-b",
+							Kind: "User",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	JustBeforeEach(func() {
+		for _, tnt := range []*capsulev1beta2.Tenant{tenantA, tenantB} {
+			EventuallyCreation(func() error {
+				tnt.ResourceVersion = ""
+				return k8sClient.Create(context.TODO(), tnt)
+			}).Should(Succeed())
+		}
+
+		By("creating namespace for tenant A", func() {
+			ns := NewNamespace(tenantANs)
+			NamespaceCreation(ns, tenantA.Spec.Owners[0].UserSpec, defaultTimeoutInterval).Should(Succeed())
+			TenantNamespaceList(tenantA, defaultTimeoutInterval).Should(ContainElement(ns.GetName()))
+		})
+
+		By("creating namespace for tenant B", func() {
+			ns := NewNamespace(tenantBNs)
+			NamespaceCreation(ns, tenantB.Spec.Owners[0].UserSpec, defaultTimeoutInterval).Should(Succeed())
+			TenantNamespaceList(tenantB, defaultTimeoutInterval).Should(ContainElement(ns.GetName()))
+		})
+	})
+
+	JustAfterEach(func() {
+		Expect(k8sClient.Delete(context.TODO(), tenantA)).Should(Succeed())
+		Expect(k8sClient.Delete(context.TODO(), tenantB)).Should(Succeed())
+		By("deleting namespaces", func() {
+			for _, nsName := range []string{tenantANs, tenantBNs} {
+				ns := NewNamespace(nsName)
+				err := k8sClient.Delete(context.TODO(), ns)
+				if err != nil && !apierrors.IsNotFound(err) {
+					Expect(err).ToNot(HaveOccurred())
+				}
+			}
+		})
+	})
+
+	It("should isolate AAAA answers and classify IPv6 sources", func() {
+		csA := ownerClient(tenantA.Spec.Owners[0].UserSpec)
+		csB := ownerClient(tenantB.Spec.Owners[0].UserSpec)
+
+		By("looking up the IPv6 address of the cluster DNS service")
+		admin, err := kubernetes.NewForConfig(cfg)
+		Expect(err).ToNot(HaveOccurred())
+
+		kubeDNS, err := admin.CoreV1().Services("kube-system").Get(context.TODO(), "kube-dns", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		var dnsV6 string
+		for _, ip := range kubeDNS.Spec.ClusterIPs {
+			if net.ParseIP(ip).To4() == nil {
+				dnsV6 = ip
+			}
+		}
+		if dnsV6 == "" || len(kubeDNS.Spec.ClusterIPs) < 2 {
+			Skip("cluster DNS is not dual-stack")
+		}
+
+		By("deploying a dual-stack service with a backing pod in tenant B's namespace")
+		backendPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "backend-pod",
+				Namespace: tenantBNs,
+				Labels:    map[string]string{"app": "dualstack-backend"},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:  "nginx",
+					Image: "nginx:alpine",
+					Ports: []corev1.ContainerPort{{ContainerPort: 80}},
+				}},
+				RestartPolicy: corev1.RestartPolicyNever,
+			},
+		}
+		_, err = csB.CoreV1().Pods(tenantBNs).Create(context.TODO(), backendPod, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		svc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      svcName,
+				Namespace: tenantBNs,
+			},
+			Spec: corev1.ServiceSpec{
+				IPFamilyPolicy: ptr.To(corev1.IPFamilyPolicyRequireDualStack),
+				IPFamilies:     []corev1.IPFamily{corev1.IPv6Protocol, corev1.IPv4Protocol},
+				Selector:       map[string]string{"app": "dualstack-backend"},
+				Ports: []corev1.ServicePort{{
+					Port:       80,
+					TargetPort: intstr.FromInt32(80),
+				}},
+			},
+		}
+		_, err = csB.CoreV1().Services(tenantBNs).Create(context.TODO(), svc, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		By("deploying client pods querying the cluster DNS over IPv6 in both tenants")
+		for _, client := range []struct {
+			ns string
+			cs kubernetes.Interface
+		}{{tenantANs, csA}, {tenantBNs, csB}} {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      podName,
+					Namespace: client.ns,
+					Labels:    map[string]string{"app": "dns-client"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:    "busybox",
+						Image:   "busybox",
+						Command: []string{"sleep", "3600"},
+					}},
+					DNSPolicy: corev1.DNSNone,
+					DNSConfig: &corev1.PodDNSConfig{
+						Nameservers: []string{dnsV6},
+						Searches:    []string{client.ns + ".svc.cluster.local", "svc.cluster.local", "cluster.local"},
+					},
+					RestartPolicy: corev1.RestartPolicyNever,
+				},
+			}
+			_, err = client.cs.CoreV1().Pods(client.ns).Create(context.TODO(), pod, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		By("waiting for the client pods to be running")
+		Eventually(func() corev1.PodPhase {
+			p, _ := csA.CoreV1().Pods(tenantANs).Get(context.TODO(), podName, metav1.GetOptions{})
+			return p.Status.Phase
+		}, 60*time.Second, 2*time.Second).Should(Equal(corev1.PodRunning))
+		Eventually(func() corev1.PodPhase {
+			p, _ := csB.CoreV1().Pods(tenantBNs).Get(context.TODO(), podName, metav1.GetOptions{})
+			return p.Status.Phase
+		}, 60*time.Second, 2*time.Second).Should(Equal(corev1.PodRunning))
+
+		serviceFQDN := fmt.Sprintf("%s.%s.svc.cluster.local", svcName, tenantBNs)
+
+		for _, qtype := range []string{"AAAA", "A"} {
+			By(fmt.Sprintf("resolving the %s record from the same tenant over IPv6", qtype))
+			stdout, stderr, err := ExecInPod(csB, tenantBNs, podName, "busybox", []string{"nslookup", "-type=" + qtype, serviceFQDN, dnsV6})
+			_, _ = fmt.Fprintf(GinkgoWriter, "\nnslookup stdout: %s\nnslookup stderr: %s\n", stdout, stderr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(ContainSubstring(fmt.Sprintf("Name:\t%s", serviceFQDN)))
+
+			By(fmt.Sprintf("resolving the %s record from another tenant over IPv6", qtype))
+			stdout, stderr, _ = ExecInPod(csA, tenantANs, podName, "busybox", []string{"nslookup", "-type=" + qtype, serviceFQDN, dnsV6})
+			_, _ = fmt.Fprintf(GinkgoWriter, "\nnslookup stdout: %s\nnslookup stderr: %s\n", stdout, stderr)
+			Expect(stdout).ToNot(ContainSubstring(fmt.Sprintf("Name:\t%s", serviceFQDN)))
+		}
+
+		By("cleaning up")
+		Expect(csA.CoreV1().Pods(tenantANs).Delete(context.TODO(), podName, metav1.DeleteOptions{})).Should(Succeed())
+		Expect(csB.CoreV1().Pods(tenantBNs).Delete(context.TODO(), podName, metav1.DeleteOptions{})).Should(Succeed())
+		Expect(csB.CoreV1().Pods(tenantBNs).Delete(context.TODO(), backendPod.Name, metav1.DeleteOptions{})).Should(Succeed())
+		Expect(csB.CoreV1().Services(tenantBNs).Delete(context.TODO(), svcName, metav1.DeleteOptions{})).Should(Succeed())
+	})
+})
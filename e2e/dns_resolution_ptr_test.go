@@ -0,0 +1,157 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"github.com/projectcapsule/capsule/pkg/api"
+)
+
+var _ = Describe("Reverse DNS resolution between tenants", Label("dns", "ptr"), func() {
+	var (
+		tenantANs = "tenant-a-ptr-ns"
+		tenantBNs = "tenant-b-ptr-ns"
+		podName   = "dns-test-pod"
+	)
+
+	tenantA := &capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "tenant-a-ptr",
+		},
+		Spec: capsulev1beta2.TenantSpec{
+			Owners: api.OwnerListSpec{
+				{
+					CoreOwnerSpec: api.CoreOwnerSpec{
+						UserSpec: api.UserSpec{
+							Name: "owner-a",
+							Kind: "User",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	tenantB := &capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "tenant-b-ptr",
+		},
+		Spec: capsulev1beta2.TenantSpec{
+			Owners: api.OwnerListSpec{
+				{
+					CoreOwnerSpec: api.CoreOwnerSpec{
+						UserSpec: api.UserSpec{
+							Name: "owner-b",
+							Kind: "User",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	JustBeforeEach(func() {
+		for _, tnt := range []*capsulev1beta2.Tenant{tenantA, tenantB} {
+			EventuallyCreation(func() error {
+				tnt.ResourceVersion = ""
+				return k8sClient.Create(context.TODO(), tnt)
+			}).Should(Succeed())
+		}
+
+		By("creating namespace for tenant A", func() {
+			ns := NewNamespace(tenantANs)
+			NamespaceCreation(ns, tenantA.Spec.Owners[0].UserSpec, defaultTimeoutInterval).Should(Succeed())
+			TenantNamespaceList(tenantA, defaultTimeoutInterval).Should(ContainElement(ns.GetName()))
+		})
+
+		By("creating namespace for tenant B", func() {
+			ns := NewNamespace(tenantBNs)
+			NamespaceCreation(ns, tenantB.Spec.Owners[0].UserSpec, defaultTimeoutInterval).Should(Succeed())
+			TenantNamespaceList(tenantB, defaultTimeoutInterval).Should(ContainElement(ns.GetName()))
+		})
+	})
+
+	JustAfterEach(func() {
+		Expect(k8sClient.Delete(context.TODO(), tenantA)).Should(Succeed())
+		Expect(k8sClient.Delete(context.TODO(), tenantB)).Should(Succeed())
+		By("deleting namespaces", func() {
+			for _, nsName := range []string{tenantANs, tenantBNs} {
+				ns := NewNamespace(nsName)
+				err := k8sClient.Delete(context.TODO(), ns)
+				if err != nil && !apierrors.IsNotFound(err) {
+					Expect(err).ToNot(HaveOccurred())
+				}
+			}
+		})
+	})
+
+	It("should only answer PTR queries for addresses of the same tenant, for every IP family", func() {
+		csA := ownerClient(tenantA.Spec.Owners[0].UserSpec)
+		csB := ownerClient(tenantB.Spec.Owners[0].UserSpec)
+
+		By("deploying client pods in both tenants")
+		for _, client := range []struct {
+			ns string
+			cs kubernetes.Interface
+		}{{tenantANs, csA}, {tenantBNs, csB}} {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      podName,
+					Namespace: client.ns,
+					Labels:    map[string]string{"app": "dns-client"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:    "busybox",
+						Image:   "busybox",
+						Command: []string{"sleep", "3600"},
+					}},
+					RestartPolicy: corev1.RestartPolicyNever,
+				},
+			}
+			_, err := client.cs.CoreV1().Pods(client.ns).Create(context.TODO(), pod, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		By("waiting for the client pods to be running")
+		var podB *corev1.Pod
+		Eventually(func() corev1.PodPhase {
+			p, _ := csA.CoreV1().Pods(tenantANs).Get(context.TODO(), podName, metav1.GetOptions{})
+			return p.Status.Phase
+		}, 60*time.Second, 2*time.Second).Should(Equal(corev1.PodRunning))
+		Eventually(func() corev1.PodPhase {
+			podB, _ = csB.CoreV1().Pods(tenantBNs).Get(context.TODO(), podName, metav1.GetOptions{})
+			return podB.Status.Phase
+		}, 60*time.Second, 2*time.Second).Should(Equal(corev1.PodRunning))
+		Expect(podB.Status.PodIPs).ToNot(BeEmpty())
+
+		for _, podIP := range podB.Status.PodIPs {
+			By(fmt.Sprintf("reverse resolving %s from the same tenant", podIP.IP))
+			stdout, stderr, err := ExecInPod(csB, tenantBNs, podName, "busybox", []string{"nslookup", podIP.IP})
+			_, _ = fmt.Fprintf(GinkgoWriter, "\nnslookup stdout: %s\nnslookup stderr: %s\n", stdout, stderr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(ContainSubstring("name = "))
+
+			By(fmt.Sprintf("reverse resolving %s from another tenant", podIP.IP))
+			stdout, stderr, _ = ExecInPod(csA, tenantANs, podName, "busybox", []string{"nslookup", podIP.IP})
+			_, _ = fmt.Fprintf(GinkgoWriter, "\nnslookup stdout: %s\nnslookup stderr: %s\n", stdout, stderr)
+			Expect(stdout).ToNot(ContainSubstring("name = "))
+		}
+
+		By("cleaning up")
+		Expect(csA.CoreV1().Pods(tenantANs).Delete(context.TODO(), podName, metav1.DeleteOptions{})).Should(Succeed())
+		Expect(csB.CoreV1().Pods(tenantBNs).Delete(context.TODO(), podName, metav1.DeleteOptions{})).Should(Succeed())
+	})
+})
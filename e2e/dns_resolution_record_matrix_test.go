@@ -0,0 +1,308 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"github.com/projectcapsule/capsule/pkg/api"
+)
+
+// matrixTopology is the workload every record case runs against: a client pod
+// in each tenant, and a backend pod exposed through a regular and a headless
+// service in tenant B.
+type matrixTopology struct {
+	csA, csB    kubernetes.Interface
+	nsA, nsB    string
+	client      string
+	backend     *corev1.Pod
+	service     *corev1.Service
+	headlessSvc string
+}
+
+// recordCase describes how to query one record type. name returns the query
+// name for the topology, or an empty string when the cluster cannot serve
+// this record type, which skips the entry.
+type recordCase struct {
+	qtype string
+	name  func(t *matrixTopology) string
+}
+
+// podIP returns the backend pod IP of the given family.
+func (t *matrixTopology) podIP(v6 bool) string {
+	for _, ip := range t.backend.Status.PodIPs {
+		if (net.ParseIP(ip.IP).To4() == nil) == v6 {
+			return ip.IP
+		}
+	}
+
+	return ""
+}
+
+func (t *matrixTopology) serviceFQDN() string {
+	return fmt.Sprintf("%s.%s.svc.cluster.local", t.service.Name, t.nsB)
+}
+
+// dig runs dig for the case from the client pod of the given namespace.
+func (t *matrixTopology) dig(cs kubernetes.Interface, ns string, rc recordCase, name string, opts ...string) (string, error) {
+	args := append([]string{"dig"}, opts...)
+	if rc.qtype == "PTR" {
+		args = append(args, "-x", name)
+	} else {
+		args = append(args, "-t", rc.qtype, name)
+	}
+
+	stdout, stderr, err := ExecInPod(cs, ns, t.client, "dnsutils", args)
+	_, _ = fmt.Fprintf(GinkgoWriter, "\ndig %s stdout: %s\ndig stderr: %s\n", rc.qtype, stdout, stderr)
+
+	return stdout, err
+}
+
+var (
+	recordA = recordCase{
+		qtype: "A",
+		name: func(t *matrixTopology) string {
+			return t.serviceFQDN()
+		},
+	}
+
+	recordAAAA = recordCase{
+		qtype: "AAAA",
+		name: func(t *matrixTopology) string {
+			for _, ip := range t.service.Spec.ClusterIPs {
+				if net.ParseIP(ip).To4() == nil {
+					return t.serviceFQDN()
+				}
+			}
+
+			return ""
+		},
+	}
+
+	recordSRV = recordCase{
+		qtype: "SRV",
+		name: func(t *matrixTopology) string {
+			return fmt.Sprintf("_http._tcp.%s", t.serviceFQDN())
+		},
+	}
+
+	recordPTR = recordCase{
+		qtype: "PTR",
+		name: func(t *matrixTopology) string {
+			return t.backend.Status.PodIP
+		},
+	}
+
+	recordHeadlessPod = recordCase{
+		qtype: "A",
+		name: func(t *matrixTopology) string {
+			ip := t.podIP(false)
+			if ip == "" {
+				return ""
+			}
+
+			return fmt.Sprintf("%s.%s.%s.svc.cluster.local", strings.ReplaceAll(ip, ".", "-"), t.headlessSvc, t.nsB)
+		},
+	}
+)
+
+var _ = Describe("DNS resolution across record types", Label("dns", "matrix"), func() {
+	var (
+		tenantANs = "tenant-a-matrix-ns"
+		tenantBNs = "tenant-b-matrix-ns"
+		podName   = "dns-test-pod"
+		svcName   = "matrix-service"
+		dnsutils  = "registry.k8s.io/e2e-test-images/jessie-dnsutils:1.7"
+		topology  *matrixTopology
+	)
+
+	tenantA := &capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "tenant-a-matrix",
+		},
+		Spec: capsulev1beta2.TenantSpec{
+			Owners: api.OwnerListSpec{
+				{
+					CoreOwnerSpec: api.CoreOwnerSpec{
+						UserSpec: api.UserSpec{
+							Name: "owner-a",
+							Kind: "User",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	tenantB := &capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "tenant-b-matrix",
+		},
+		Spec: capsulev1beta2.TenantSpec{
+			Owners: api.OwnerListSpec{
+				{
+					CoreOwnerSpec: api.CoreOwnerSpec{
+						UserSpec: api.UserSpec{
+							Name: "owner-b",
+							Kind: "User",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	JustBeforeEach(func() {
+		for _, tnt := range []*capsulev1beta2.Tenant{tenantA, tenantB} {
+			EventuallyCreation(func() error {
+				tnt.ResourceVersion = ""
+				return k8sClient.Create(context.TODO(), tnt)
+			}).Should(Succeed())
+		}
+
+		By("creating namespace for tenant A", func() {
+			ns := NewNamespace(tenantANs)
+			NamespaceCreation(ns, tenantA.Spec.Owners[0].UserSpec, defaultTimeoutInterval).Should(Succeed())
+			TenantNamespaceList(tenantA, defaultTimeoutInterval).Should(ContainElement(ns.GetName()))
+		})
+
+		By("creating namespace for tenant B", func() {
+			ns := NewNamespace(tenantBNs)
+			NamespaceCreation(ns, tenantB.Spec.Owners[0].UserSpec, defaultTimeoutInterval).Should(Succeed())
+			TenantNamespaceList(tenantB, defaultTimeoutInterval).Should(ContainElement(ns.GetName()))
+		})
+
+		topology = &matrixTopology{
+			csA:         ownerClient(tenantA.Spec.Owners[0].UserSpec),
+			csB:         ownerClient(tenantB.Spec.Owners[0].UserSpec),
+			nsA:         tenantANs,
+			nsB:         tenantBNs,
+			client:      podName,
+			headlessSvc: svcName + "-headless",
+		}
+
+		By("deploying a backend pod behind a regular and a headless service in tenant B", func() {
+			backendPod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "backend-pod",
+					Namespace: tenantBNs,
+					Labels:    map[string]string{"app": "matrix-backend"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:  "nginx",
+						Image: "nginx:alpine",
+						Ports: []corev1.ContainerPort{{ContainerPort: 80}},
+					}},
+					RestartPolicy: corev1.RestartPolicyNever,
+				},
+			}
+			_, err := topology.csB.CoreV1().Pods(tenantBNs).Create(context.TODO(), backendPod, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, svc := range []*corev1.Service{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: svcName, Namespace: tenantBNs},
+					Spec: corev1.ServiceSpec{
+						IPFamilyPolicy: ptr.To(corev1.IPFamilyPolicyPreferDualStack),
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: topology.headlessSvc, Namespace: tenantBNs},
+					Spec: corev1.ServiceSpec{
+						ClusterIP: corev1.ClusterIPNone,
+					},
+				},
+			} {
+				svc.Spec.Selector = map[string]string{"app": "matrix-backend"}
+				svc.Spec.Ports = []corev1.ServicePort{{
+					Name:       "http",
+					Port:       80,
+					TargetPort: intstr.FromInt32(80),
+				}}
+				_, err = topology.csB.CoreV1().Services(tenantBNs).Create(context.TODO(), svc, metav1.CreateOptions{})
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			topology.service, err = topology.csB.CoreV1().Services(tenantBNs).Get(context.TODO(), svcName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		By("deploying dnsutils client pods in both tenants", func() {
+			_, err := topology.csA.CoreV1().Pods(tenantANs).Create(context.TODO(), dnsutilsPod(podName, tenantANs, dnsutils), metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = topology.csB.CoreV1().Pods(tenantBNs).Create(context.TODO(), dnsutilsPod(podName, tenantBNs, dnsutils), metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		By("waiting for the pods to be running", func() {
+			Eventually(func() corev1.PodPhase {
+				p, _ := topology.csA.CoreV1().Pods(tenantANs).Get(context.TODO(), podName, metav1.GetOptions{})
+				return p.Status.Phase
+			}, 60*time.Second, 2*time.Second).Should(Equal(corev1.PodRunning))
+			Eventually(func() corev1.PodPhase {
+				p, _ := topology.csB.CoreV1().Pods(tenantBNs).Get(context.TODO(), podName, metav1.GetOptions{})
+				return p.Status.Phase
+			}, 60*time.Second, 2*time.Second).Should(Equal(corev1.PodRunning))
+			Eventually(func() corev1.PodPhase {
+				topology.backend, _ = topology.csB.CoreV1().Pods(tenantBNs).Get(context.TODO(), "backend-pod", metav1.GetOptions{})
+				return topology.backend.Status.Phase
+			}, 60*time.Second, 2*time.Second).Should(Equal(corev1.PodRunning))
+		})
+	})
+
+	JustAfterEach(func() {
+		Expect(k8sClient.Delete(context.TODO(), tenantA)).Should(Succeed())
+		Expect(k8sClient.Delete(context.TODO(), tenantB)).Should(Succeed())
+		By("deleting namespaces", func() {
+			for _, nsName := range []string{tenantANs, tenantBNs} {
+				ns := NewNamespace(nsName)
+				err := k8sClient.Delete(context.TODO(), ns)
+				if err != nil && !apierrors.IsNotFound(err) {
+					Expect(err).ToNot(HaveOccurred())
+				}
+			}
+		})
+	})
+
+	DescribeTable("should only answer queries for records of the same tenant",
+		func(rc recordCase) {
+			name := rc.name(topology)
+			if name == "" {
+				Skip(fmt.Sprintf("cluster cannot serve %s records for this topology", rc.qtype))
+			}
+
+			By(fmt.Sprintf("resolving %s %s from the same tenant", rc.qtype, name))
+			Eventually(func() string {
+				stdout, _ := topology.dig(topology.csB, topology.nsB, rc, name, "+short")
+				return strings.TrimSpace(stdout)
+			}, 60*time.Second, 2*time.Second).ShouldNot(BeEmpty())
+
+			By(fmt.Sprintf("resolving %s %s from another tenant", rc.qtype, name))
+			stdout, err := topology.dig(topology.csA, topology.nsA, rc, name)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(ContainSubstring("status: NOERROR"))
+			Expect(stdout).To(ContainSubstring("ANSWER: 0"))
+		},
+		Entry("A records of services", recordA),
+		Entry("AAAA records of services", recordAAAA),
+		Entry("SRV records of service ports", recordSRV),
+		Entry("PTR records of pods", recordPTR),
+		Entry("A records of headless service pods", recordHeadlessPod),
+	)
+})
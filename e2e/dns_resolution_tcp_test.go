@@ -0,0 +1,207 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"github.com/projectcapsule/capsule/pkg/api"
+)
+
+var _ = Describe("DNS resolution over TCP", Label("dns"), func() {
+	var (
+		tenantANs   = "tenant-a-tcp-ns"
+		tenantBNs   = "tenant-b-tcp-ns"
+		podName     = "dns-test-pod"
+		svcName     = "headless-service"
+		backendPods = 20
+		dnsutils    = "registry.k8s.io/e2e-test-images/jessie-dnsutils:1.7"
+	)
+
+	tenantA := &capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "tenant-a-tcp",
+		},
+		Spec: capsulev1beta2.TenantSpec{
+			Owners: api.OwnerListSpec{
+				{
+					CoreOwnerSpec: api.CoreOwnerSpec{
+						UserSpec: api.UserSpec{
+							Name: "owner-a",
+							Kind: "User",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	tenantB := &capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "tenant-b-tcp",
+		},
+		Spec: capsulev1beta2.TenantSpec{
+			Owners: api.OwnerListSpec{
+				{
+					CoreOwnerSpec: api.CoreOwnerSpec{
+						UserSpec: api.UserSpec{
+							Name: "owner-b",
+							Kind: "User",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	JustBeforeEach(func() {
+		for _, tnt := range []*capsulev1beta2.Tenant{tenantA, tenantB} {
+			EventuallyCreation(func() error {
+				tnt.ResourceVersion = ""
+				return k8sClient.Create(context.TODO(), tnt)
+			}).Should(Succeed())
+		}
+
+		By("creating namespace for tenant A", func() {
+			ns := NewNamespace(tenantANs)
+			NamespaceCreation(ns, tenantA.Spec.Owners[0].UserSpec, defaultTimeoutInterval).Should(Succeed())
+			TenantNamespaceList(tenantA, defaultTimeoutInterval).Should(ContainElement(ns.GetName()))
+		})
+
+		By("creating namespace for tenant B", func() {
+			ns := NewNamespace(tenantBNs)
+			NamespaceCreation(ns, tenantB.Spec.Owners[0].UserSpec, defaultTimeoutInterval).Should(Succeed())
+			TenantNamespaceList(tenantB, defaultTimeoutInterval).Should(ContainElement(ns.GetName()))
+		})
+	})
+
+	JustAfterEach(func() {
+		Expect(k8sClient.Delete(context.TODO(), tenantA)).Should(Succeed())
+		Expect(k8sClient.Delete(context.TODO(), tenantB)).Should(Succeed())
+		By("deleting namespaces", func() {
+			for _, nsName := range []string{tenantANs, tenantBNs} {
+				ns := NewNamespace(nsName)
+				err := k8sClient.Delete(context.TODO(), ns)
+				if err != nil && !apierrors.IsNotFound(err) {
+					Expect(err).ToNot(HaveOccurred())
+				}
+			}
+		})
+	})
+
+	It("should apply the same policy to truncated UDP answers and their TCP retries", func() {
+		csA := ownerClient(tenantA.Spec.Owners[0].UserSpec)
+		csB := ownerClient(tenantB.Spec.Owners[0].UserSpec)
+
+		By("deploying a headless service with enough backends to overflow a UDP answer in tenant B")
+		for i := range backendPods {
+			backendPod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("backend-pod-%d", i),
+					Namespace: tenantBNs,
+					Labels:    map[string]string{"app": "headless-backend"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:  "nginx",
+						Image: "nginx:alpine",
+						Ports: []corev1.ContainerPort{{ContainerPort: 80}},
+					}},
+					RestartPolicy: corev1.RestartPolicyNever,
+				},
+			}
+			_, err := csB.CoreV1().Pods(tenantBNs).Create(context.TODO(), backendPod, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		svc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      svcName,
+				Namespace: tenantBNs,
+			},
+			Spec: corev1.ServiceSpec{
+				ClusterIP: corev1.ClusterIPNone,
+				Selector:  map[string]string{"app": "headless-backend"},
+				Ports: []corev1.ServicePort{{
+					Port:       80,
+					TargetPort: intstr.FromInt32(80),
+				}},
+			},
+		}
+		_, err := csB.CoreV1().Services(tenantBNs).Create(context.TODO(), svc, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		By("deploying dnsutils client pods in both tenants")
+		_, err = csA.CoreV1().Pods(tenantANs).Create(context.TODO(), dnsutilsPod(podName, tenantANs, dnsutils), metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = csB.CoreV1().Pods(tenantBNs).Create(context.TODO(), dnsutilsPod(podName, tenantBNs, dnsutils), metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		By("waiting for the client pods to be running")
+		Eventually(func() corev1.PodPhase {
+			p, _ := csA.CoreV1().Pods(tenantANs).Get(context.TODO(), podName, metav1.GetOptions{})
+			return p.Status.Phase
+		}, 60*time.Second, 2*time.Second).Should(Equal(corev1.PodRunning))
+		Eventually(func() corev1.PodPhase {
+			p, _ := csB.CoreV1().Pods(tenantBNs).Get(context.TODO(), podName, metav1.GetOptions{})
+			return p.Status.Phase
+		}, 60*time.Second, 2*time.Second).Should(Equal(corev1.PodRunning))
+
+		serviceFQDN := fmt.Sprintf("%s.%s.svc.cluster.local", svcName, tenantBNs)
+
+		By("resolving the headless service from the same tenant over UDP and TCP")
+		Eventually(func() string {
+			stdout, _, _ := ExecInPod(csB, tenantBNs, podName, "dnsutils", []string{"dig", "+notcp", "+ignore", "+bufsize=512", serviceFQDN})
+			return stdout
+		}, 60*time.Second, 2*time.Second).Should(ContainSubstring("flags: qr aa tc"))
+
+		stdout, stderr, err := ExecInPod(csB, tenantBNs, podName, "dnsutils", []string{"dig", "+tcp", "+short", serviceFQDN})
+		_, _ = fmt.Fprintf(GinkgoWriter, "\ndig stdout: %s\ndig stderr: %s\n", stdout, stderr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stdout).To(MatchRegexp(`[0-9.]+`))
+
+		By("resolving the headless service from another tenant over UDP and TCP")
+		for _, transport := range []string{"+notcp", "+tcp"} {
+			stdout, stderr, err = ExecInPod(csA, tenantANs, podName, "dnsutils", []string{"dig", transport, "+bufsize=512", serviceFQDN})
+			_, _ = fmt.Fprintf(GinkgoWriter, "\ndig %s stdout: %s\ndig stderr: %s\n", transport, stdout, stderr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(ContainSubstring("status: NOERROR"))
+			Expect(stdout).To(ContainSubstring("ANSWER: 0"))
+			Expect(stdout).ToNot(MatchRegexp(`flags:[a-z ]* tc`))
+		}
+
+		By("cleaning up")
+		Expect(csA.CoreV1().Pods(tenantANs).Delete(context.TODO(), podName, metav1.DeleteOptions{})).Should(Succeed())
+		Expect(csB.CoreV1().Pods(tenantBNs).Delete(context.TODO(), podName, metav1.DeleteOptions{})).Should(Succeed())
+		Expect(csB.CoreV1().Services(tenantBNs).Delete(context.TODO(), svcName, metav1.DeleteOptions{})).Should(Succeed())
+	})
+})
+
+func dnsutilsPod(name, namespace, image string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"app": "dns-client"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:    "dnsutils",
+				Image:   image,
+				Command: []string{"sleep", "3600"},
+			}},
+			RestartPolicy: corev1.RestartPolicyNever,
+		},
+	}
+}
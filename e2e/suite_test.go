@@ -65,9 +65,13 @@ var _ = BeforeSuite(func() {
 	Expect(ctrlClient).ToNot(BeNil())
 
 	k8sClient = &e2eClient{Client: ctrlClient}
+
+	setupConformance()
 })
 
 var _ = AfterSuite(func() {
+	teardownConformance()
+
 	Eventually(func() error {
 		var nsList corev1.NamespaceList
 
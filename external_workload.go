@@ -0,0 +1,155 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"cmp"
+	"net/netip"
+	"slices"
+	"sync/atomic"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// externalWorkloadResource is the cluster-scoped ExternalWorkload custom
+// resource, which attributes the addresses of hosts outside of the cluster,
+// such as VMs joined to the cluster network, to a namespace.
+var externalWorkloadResource = schema.GroupVersionResource{
+	Group:    "dns.capsule.clastix.io",
+	Version:  "v1alpha1",
+	Resource: "externalworkloads",
+}
+
+// externalWorkloadKind is the workload kind of the decisions whose source is
+// covered by an ExternalWorkload.
+const externalWorkloadKind = "ExternalWorkload"
+
+// externalWorkload is the part of an ExternalWorkload the controller keeps.
+type externalWorkload struct {
+	metav1.ObjectMeta
+
+	cidrs []netip.Prefix
+	// namespace is the namespace the sources are attributed to, whose tenant
+	// they belong to.
+	namespace string
+}
+
+// slimExternalWorkload converts the unstructured ExternalWorkloads of the
+// dynamic informer. Invalid CIDRs are ignored.
+func slimExternalWorkload(obj any) (any, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return obj, nil
+	}
+
+	w := &externalWorkload{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            u.GetName(),
+			UID:             u.GetUID(),
+			ResourceVersion: u.GetResourceVersion(),
+		},
+	}
+
+	w.namespace, _, _ = unstructured.NestedString(u.Object, "spec", "namespace")
+
+	cidrs, _, _ := unstructured.NestedStringSlice(u.Object, "spec", "cidrs")
+	for _, cidr := range cidrs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			w.cidrs = append(w.cidrs, prefix.Masked())
+		}
+	}
+
+	return w, nil
+}
+
+// externalRange is a CIDR of an ExternalWorkload.
+type externalRange struct {
+	prefix   netip.Prefix
+	workload *externalWorkload
+}
+
+// externalTable holds the CIDRs of every ExternalWorkload, most specific
+// first, rebuilt on each change so lookups neither lock nor allocate.
+type externalTable struct {
+	ranges atomic.Pointer[[]externalRange]
+}
+
+// rebuild replaces the ranges of t with those of the ExternalWorkloads in
+// store. Among CIDRs of the same length, the ExternalWorkload first by name
+// wins.
+func (t *externalTable) rebuild(store cache.Store) {
+	var ranges []externalRange
+
+	for _, obj := range store.List() {
+		w, ok := obj.(*externalWorkload)
+		if !ok || w.namespace == "" {
+			continue
+		}
+
+		for _, prefix := range w.cidrs {
+			ranges = append(ranges, externalRange{prefix: prefix, workload: w})
+		}
+	}
+
+	slices.SortFunc(ranges, func(a, b externalRange) int {
+		return cmp.Or(
+			cmp.Compare(b.prefix.Bits(), a.prefix.Bits()),
+			cmp.Compare(a.workload.Name, b.workload.Name),
+		)
+	})
+
+	t.ranges.Store(&ranges)
+}
+
+// handler rebuilds t whenever an ExternalWorkload of informer changes.
+func (t *externalTable) handler(informer cache.SharedIndexInformer) cache.ResourceEventHandler {
+	rebuild := func() { t.rebuild(informer.GetStore()) }
+
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { rebuild() },
+		UpdateFunc: func(any, any) { rebuild() },
+		DeleteFunc: func(any) { rebuild() },
+	}
+}
+
+// lookup returns the ExternalWorkload with the most specific CIDR covering ip.
+func (t *externalTable) lookup(ip netip.Addr) (*externalWorkload, bool) {
+	ranges := t.ranges.Load()
+	if ranges == nil {
+		return nil, false
+	}
+
+	for _, r := range *ranges {
+		if r.prefix.Contains(ip) {
+			return r.workload, true
+		}
+	}
+
+	return nil, false
+}
+
+// externalSource returns the namespace of the ExternalWorkload covering from,
+// nil when none does or its namespace doesn't exist.
+func (c *dnsController) externalSource(from string) (*v1.Namespace, *externalWorkload, error) {
+	ip, err := netip.ParseAddr(from)
+	if err != nil {
+		return nil, nil, nil
+	}
+
+	w, ok := c.externals.lookup(ip.Unmap())
+	if !ok {
+		return nil, nil, nil
+	}
+
+	ns, err := c.getNSByName(w.namespace)
+	if err != nil || ns == nil {
+		return nil, nil, err
+	}
+
+	return ns, w, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newExternalWorkload(name, namespace string, cidrs ...any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "dns.capsule.clastix.io/v1alpha1",
+		"kind":       "ExternalWorkload",
+		"metadata":   map[string]any{"name": name},
+		"spec": map[string]any{
+			"namespace": namespace,
+			"cidrs":     cidrs,
+		},
+	}}
+}
+
+func TestEvaluateExternalWorkload(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+
+	workloads := []runtime.Object{
+		newExternalWorkload("vms", "tenant-0", "192.168.10.0/24", "fd00:10::/64"),
+		newExternalWorkload("db-host", "tenant-1", "192.168.10.7/32"),
+		// Pods take precedence over the CIDRs covering them.
+		newExternalWorkload("pod-network", "tenant-1", "10.0.0.0/8"),
+		newExternalWorkload("missing", "gone", "192.168.20.0/24"),
+		newExternalWorkload("invalid", "tenant-1", "192.168.30.0"),
+	}
+
+	set, err := newInformerSet(fake.NewClientset(cl.objects()...), apiConfig{})
+	if err != nil {
+		t.Fatalf("failed to create informers: %v", err)
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{externalWorkloadResource: "ExternalWorkloadList"}, workloads...)
+	set.dynamic = dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
+
+	ctrl, err := newDNSControllerForSet(set, dnsControllerOptions{externalWorkloads: true})
+	if err != nil {
+		t.Fatalf("failed to create DNS controller: %v", err)
+	}
+
+	go ctrl.Start()
+	t.Cleanup(ctrl.Stop)
+
+	waitForSync(t, ctrl)
+	waitFor(t, "external workloads", func() bool {
+		_, ok := ctrl.externals.lookup(netip.MustParseAddr("192.168.10.7"))
+
+		return ok
+	})
+
+	tests := []struct {
+		name     string
+		src      string
+		dst      int
+		allowed  bool
+		reason   string
+		workload string
+	}{
+		{name: "same tenant", src: "192.168.10.5", dst: 0, allowed: true, reason: reasonSameTenant, workload: "vms"},
+		{name: "cross tenant", src: "192.168.10.5", dst: 1, reason: reasonCrossTenant, workload: "vms"},
+		{name: "ipv6", src: "fd00:10::5", dst: 1, reason: reasonCrossTenant, workload: "vms"},
+		{name: "most specific", src: "192.168.10.7", dst: 1, allowed: true, reason: reasonSameTenant, workload: "db-host"},
+		{name: "pod", src: cl.pods[0].Status.PodIPs[0].IP, dst: 1, reason: reasonCrossTenant},
+		{name: "missing namespace", src: "192.168.20.1", dst: 1, allowed: true, reason: reasonUnknownSource},
+		{name: "invalid cidr", src: "192.168.30.1", dst: 1, allowed: true, reason: reasonUnknownSource},
+		{name: "uncovered", src: "192.168.40.1", dst: 1, allowed: true, reason: reasonUnknownSource},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := ctrl.Evaluate(t.Context(), tt.src, cl.services[tt.dst].Spec.ClusterIP, Capsule{})
+			if d.allowed != tt.allowed || d.reason != tt.reason {
+				t.Errorf("got allowed=%t reason=%s, want allowed=%t reason=%s", d.allowed, d.reason, tt.allowed, tt.reason)
+			}
+
+			if tt.workload != "" && (d.srcWorkloadKind != externalWorkloadKind || d.srcWorkloadName != tt.workload) {
+				t.Errorf("got workload %s/%s, want %s/%s", d.srcWorkloadKind, d.srcWorkloadName, externalWorkloadKind, tt.workload)
+			}
+		})
+	}
+
+	// Deleting an ExternalWorkload gives its sources back to the broader one.
+	if err := dynamicClient.Resource(externalWorkloadResource).Delete(context.Background(), "db-host", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to delete the external workload: %v", err)
+	}
+
+	waitFor(t, "external workload deleted", func() bool {
+		w, ok := ctrl.externals.lookup(netip.MustParseAddr("192.168.10.7"))
+
+		return ok && w.Name == "vms"
+	})
+}
@@ -0,0 +1,172 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kubedns "github.com/coredns/coredns/plugin/kubernetes"
+	"golang.org/x/sync/singleflight"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testZone = "cluster.local."
+
+// cluster is a synthetic set of tenants, namespaces, pods and services fed to
+// both the capsule controller and the kubernetes plugin.
+type cluster struct {
+	namespaces []*v1.Namespace
+	pods       []*v1.Pod
+	services   []*v1.Service
+}
+
+// newCluster lays out tenants namespaces, each holding pods pods and services
+// services. Pod IPs are allocated from 10.0.0.0/8, service IPs from 172.16.0.0/12.
+func newCluster(tenants, pods, services int) *cluster {
+	cl := &cluster{}
+
+	var podIdx, svcIdx int
+
+	for t := range tenants {
+		ns := &v1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   fmt.Sprintf("tenant-%d", t),
+				Labels: map[string]string{CapsuleTenantLabel: fmt.Sprintf("tenant-%d", t)},
+			},
+		}
+		cl.namespaces = append(cl.namespaces, ns)
+
+		for p := range pods {
+			podIdx++
+			cl.pods = append(cl.pods, &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("pod-%d", p),
+					Namespace: ns.Name,
+					UID:       types.UID(fmt.Sprintf("%s-%d", ns.Name, p)),
+				},
+				Status: v1.PodStatus{
+					Phase:  v1.PodRunning,
+					PodIPs: []v1.PodIP{{IP: ipv4(10, podIdx)}},
+				},
+			})
+		}
+
+		for s := range services {
+			svcIdx++
+			ip := ipv4(172, 16<<16+svcIdx)
+			cl.services = append(cl.services, &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("svc-%d", s),
+					Namespace: ns.Name,
+				},
+				Spec: v1.ServiceSpec{
+					Type:       v1.ServiceTypeClusterIP,
+					ClusterIP:  ip,
+					ClusterIPs: []string{ip},
+					Ports:      []v1.ServicePort{{Name: "http", Protocol: v1.ProtocolTCP, Port: 80}},
+				},
+			})
+		}
+	}
+
+	return cl
+}
+
+// ipv4 returns the n-th address below the /8 starting at first.
+func ipv4(first, n int) string {
+	return fmt.Sprintf("%d.%d.%d.%d", first, n>>16&0xff, n>>8&0xff, n&0xff)
+}
+
+func (cl *cluster) objects() []runtime.Object {
+	objs := make([]runtime.Object, 0, len(cl.namespaces)+len(cl.pods)+len(cl.services))
+	for _, ns := range cl.namespaces {
+		objs = append(objs, ns)
+	}
+
+	for _, pod := range cl.pods {
+		objs = append(objs, pod)
+	}
+
+	for _, svc := range cl.services {
+		objs = append(objs, svc)
+	}
+
+	return objs
+}
+
+// matchLabels returns a selector matching set, as Parse compiles them.
+func matchLabels(set map[string]string) *selector {
+	s, err := newSelector(&metav1.LabelSelector{MatchLabels: set})
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+// newTestCapsule wires a Capsule handler in front of a kubernetes plugin, both
+// backed by the synthetic cluster instead of an API server.
+func newTestCapsule(tb testing.TB, cl *cluster, opts dnsControllerOptions) *Capsule {
+	tb.Helper()
+
+	return newTestCapsuleForClient(tb, cl, fake.NewClientset(cl.objects()...), opts)
+}
+
+// newTestCapsuleForClient is newTestCapsule with the controller watching
+// clientset, which the test may modify. The kubernetes plugin keeps answering
+// from cl.
+func newTestCapsuleForClient(tb testing.TB, cl *cluster, clientset kubernetes.Interface, opts dnsControllerOptions) *Capsule {
+	tb.Helper()
+
+	ctrl, err := newDNSControllerForClient(clientset, opts)
+	if err != nil {
+		tb.Fatalf("failed to create DNS controller: %v", err)
+	}
+
+	go ctrl.Start()
+	tb.Cleanup(ctrl.Stop)
+
+	waitForSync(tb, ctrl)
+
+	k := kubedns.New([]string{testZone})
+	k.APIConn = newFakeAPIConn(cl)
+	k.Upstream = emptyUpstream{}
+
+	return &Capsule{
+		Next:              k,
+		kubernetesHandler: k,
+		dnsController:     ctrl,
+		counters:          &decisionCounters{},
+		concurrent:        &atomic.Int64{},
+		flight:            &singleflight.Group{},
+		budgetSlots:       make(chan struct{}, defaultBudgetSlots),
+	}
+}
+
+func waitForSync(tb testing.TB, ctrl *dnsController) {
+	tb.Helper()
+
+	deadline := time.Now().Add(30 * time.Second)
+	for !ctrl.HasSynced() {
+		if time.Now().After(deadline) {
+			tb.Fatal("DNS controller did not sync")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// newFakeAPIConn serves the kubernetes plugin lookups from the synthetic
+// cluster.
+func newFakeAPIConn(cl *cluster) *fixtureAPIConn {
+	return newFixtureAPIConn(fixtureCluster{namespaces: cl.namespaces, pods: cl.pods, services: cl.services})
+}
@@ -0,0 +1,92 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// httpWriter is implemented by the response writers of DNS-over-HTTPS
+// listeners.
+type httpWriter interface {
+	dns.ResponseWriter
+	Request() *http.Request
+}
+
+// forwardedFor returns the address of the client in front of the trusted
+// proxies w went through, when w serves a DNS-over-HTTPS request received from
+// peer, one of them.
+func forwardedFor(w dns.ResponseWriter, peer netip.Addr, trusted []netip.Prefix) netip.Addr {
+	hw, ok := w.(httpWriter)
+	if !ok || hw.Request() == nil || !containsAddr(trusted, peer) {
+		return netip.Addr{}
+	}
+
+	var hops []string
+	for _, v := range hw.Request().Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+
+	// Proxies append the address they received the request from, walk back
+	// until the first one that is not trusted.
+	client := netip.Addr{}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := addrOf(strings.TrimSpace(hops[i]))
+		if !ok {
+			break
+		}
+
+		client = addr
+		if !containsAddr(trusted, addr) {
+			break
+		}
+	}
+
+	return client
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parsePrefix parses a CIDR, or an address standing for itself.
+func parsePrefix(s string) (netip.Prefix, bool) {
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, false
+		}
+
+		prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+	}
+
+	return prefix.Masked(), true
+}
+
+// addrOf parses an address optionally followed by a port.
+func addrOf(s string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap(), true
+}
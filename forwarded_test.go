@@ -0,0 +1,65 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+type dohWriter struct {
+	test.ResponseWriter
+	request *http.Request
+}
+
+func (w *dohWriter) Request() *http.Request { return w.request }
+
+func TestForwarded(t *testing.T) {
+	h := &Capsule{trustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.96.0.0/16"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+	}}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		doh    bool
+		want   string
+	}{
+		{name: "plain DNS", remote: "10.96.0.10", xff: []string{"10.244.1.5"}, want: "10.96.0.10"},
+		{name: "untrusted proxy", remote: "10.97.0.10", xff: []string{"10.244.1.5"}, doh: true, want: "10.97.0.10"},
+		{name: "no header", remote: "10.96.0.10", doh: true, want: "10.96.0.10"},
+		{name: "single hop", remote: "10.96.0.10", xff: []string{"10.244.1.5"}, doh: true, want: "10.244.1.5"},
+		{name: "spoofed leftmost entry", remote: "10.96.0.10", xff: []string{"10.244.9.9, 10.244.1.5, 192.0.2.1"}, doh: true, want: "10.244.1.5"},
+		{name: "repeated headers", remote: "10.96.0.10", xff: []string{"10.244.9.9", "10.244.1.5:5353"}, doh: true, want: "10.244.1.5"},
+		{name: "only trusted hops", remote: "10.96.0.10", xff: []string{"192.0.2.1"}, doh: true, want: "192.0.2.1"},
+		{name: "garbage", remote: "10.96.0.10", xff: []string{"unknown"}, doh: true, want: "10.96.0.10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w dns.ResponseWriter = &test.ResponseWriter{RemoteIP: tt.remote}
+
+			if tt.doh {
+				req := &http.Request{Header: http.Header{}}
+				for _, v := range tt.xff {
+					req.Header.Add("X-Forwarded-For", v)
+				}
+
+				w = &dohWriter{ResponseWriter: test.ResponseWriter{RemoteIP: tt.remote}, request: req}
+			}
+
+			state := request.Request{W: h.identify(w, new(dns.Msg))}
+			if got := state.IP(); got != tt.want {
+				t.Errorf("got source %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
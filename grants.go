@@ -0,0 +1,129 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+)
+
+// AllowTenantsAnnotation on a destination namespace grants other tenants
+// access to it, until an optional expiry:
+//
+//	capsule.clastix.io/dns-allow-tenants: "team-b=2025-12-31T00:00Z, team-c"
+const AllowTenantsAnnotation = "capsule.clastix.io/dns-allow-tenants"
+
+// grantLayouts are the accepted expiry formats, RFC 3339 with or without
+// seconds, or a date standing for its midnight UTC.
+var grantLayouts = []string{time.RFC3339, "2006-01-02T15:04Z07:00", time.DateOnly}
+
+// grant is an entry of AllowTenantsAnnotation, expires is zero for grants
+// that don't lapse.
+type grant struct {
+	tenant  string
+	expires time.Time
+}
+
+// grants parses the AllowTenantsAnnotation of ns. Malformed entries are
+// skipped.
+func grants(ns *v1.Namespace) []grant {
+	value, ok := ns.Annotations[AllowTenantsAnnotation]
+	if !ok {
+		return nil
+	}
+
+	var parsed []grant
+
+	for _, entry := range strings.Split(value, ",") {
+		tenant, expiry, temporary := strings.Cut(strings.TrimSpace(entry), "=")
+		if tenant == "" {
+			continue
+		}
+
+		g := grant{tenant: tenant}
+
+		if temporary {
+			var err error
+
+			for _, layout := range grantLayouts {
+				if g.expires, err = time.Parse(layout, strings.TrimSpace(expiry)); err == nil {
+					break
+				}
+			}
+
+			if err != nil {
+				log.Debugf("ignoring %s entry %q on namespace %s", AllowTenantsAnnotation, entry, ns.Name)
+
+				continue
+			}
+		}
+
+		parsed = append(parsed, g)
+	}
+
+	return parsed
+}
+
+// grantedTo reports whether ns grants tenant access at now.
+func grantedTo(ns *v1.Namespace, tenant string, now time.Time) bool {
+	for _, g := range grants(ns) {
+		if g.tenant == tenant && (g.expires.IsZero() || now.Before(g.expires)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// grantCollector exports the expiry of the temporary grants still in effect,
+// read from the namespace caches at scrape time.
+type grantCollector struct {
+	expiry *prometheus.Desc
+}
+
+func newGrantCollector() *grantCollector {
+	return &grantCollector{
+		expiry: prometheus.NewDesc(
+			prometheus.BuildFQName(plugin.Namespace, pluginName, "grant_expiry_timestamp_seconds"),
+			"Expiry of the temporary tenant grants in effect, as a Unix timestamp, by namespace and tenant.",
+			[]string{"namespace", "tenant"}, nil,
+		),
+	}
+}
+
+func (g *grantCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.expiry
+}
+
+func (g *grantCollector) Collect(ch chan<- prometheus.Metric) {
+	informerSets.Lock()
+	defer informerSets.Unlock()
+
+	now := time.Now()
+	seen := map[[2]string]bool{}
+
+	for _, set := range informerSets.byAPI {
+		for _, obj := range set.namespaces.GetStore().List() {
+			ns, ok := obj.(*v1.Namespace)
+			if !ok {
+				continue
+			}
+
+			for _, gr := range grants(ns) {
+				key := [2]string{ns.Name, gr.tenant}
+				if gr.expires.IsZero() || !now.Before(gr.expires) || seen[key] {
+					continue
+				}
+
+				seen[key] = true
+				ch <- prometheus.MustNewConstMetric(g.expiry, prometheus.GaugeValue,
+					float64(gr.expires.Unix()), ns.Name, gr.tenant)
+			}
+		}
+	}
+}
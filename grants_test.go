@@ -0,0 +1,68 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGrantedTo(t *testing.T) {
+	now := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		value  string
+		tenant string
+		want   bool
+	}{
+		{name: "permanent", value: "team-b", tenant: "team-b", want: true},
+		{name: "other tenant", value: "team-b", tenant: "team-c"},
+		{name: "before expiry", value: "team-b=2025-12-31T00:00Z", tenant: "team-b", want: true},
+		{name: "after expiry", value: "team-b=2025-11-30T23:59:59Z", tenant: "team-b"},
+		{name: "offset", value: "team-b=2025-12-01T00:30:00+01:00", tenant: "team-b"},
+		{name: "date", value: "team-b=2025-12-02", tenant: "team-b", want: true},
+		{name: "list", value: "team-a=2025-01-01, team-b=2026-01-01T00:00Z", tenant: "team-b", want: true},
+		{name: "malformed expiry", value: "team-b=soon", tenant: "team-b"},
+		{name: "malformed entry skipped", value: "team-a=soon,team-b", tenant: "team-b", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := &v1.Namespace{ObjectMeta: meta.ObjectMeta{Annotations: map[string]string{AllowTenantsAnnotation: tt.value}}}
+			if got := grantedTo(ns, tt.tenant, now); got != tt.want {
+				t.Errorf("grantedTo(%q, %s) = %t, want %t", tt.value, tt.tenant, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateTenantGrant(t *testing.T) {
+	cl := newCluster(3, 1, 1)
+	cl.namespaces[1].Annotations = map[string]string{
+		AllowTenantsAnnotation: "tenant-0=" + time.Now().Add(time.Hour).Format(time.RFC3339),
+	}
+	cl.namespaces[2].Annotations = map[string]string{
+		AllowTenantsAnnotation: "tenant-0=" + time.Now().Add(-time.Hour).Format(time.RFC3339),
+	}
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	src := cl.pods[0].Status.PodIPs[0].IP
+
+	if d := h.dnsController.Evaluate(t.Context(), src, cl.services[1].Spec.ClusterIP, *h); !d.allowed || d.reason != reasonTenantGrant {
+		t.Errorf("got allowed=%t reason=%s, want allowed=true reason=%s", d.allowed, d.reason, reasonTenantGrant)
+	}
+
+	if d := h.dnsController.Evaluate(t.Context(), src, cl.services[2].Spec.ClusterIP, *h); d.allowed || d.reason != reasonCrossTenant {
+		t.Errorf("got allowed=%t reason=%s, want allowed=false reason=%s", d.allowed, d.reason, reasonCrossTenant)
+	}
+
+	// The grant is given by the destination, not the source.
+	if d := h.dnsController.Evaluate(t.Context(), cl.pods[1].Status.PodIPs[0].IP, cl.services[0].Spec.ClusterIP, *h); d.allowed {
+		t.Errorf("got allowed=%t reason=%s, want a denial", d.allowed, d.reason)
+	}
+}
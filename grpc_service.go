@@ -0,0 +1,109 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/coredns/coredns/pb"
+	"github.com/miekg/dns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// DNSService serves DNS over the gRPC protocol of CoreDNS, the
+// coredns.dns.DnsService the grpc plugin forwards queries to, through a
+// Middleware. It lets a stock CoreDNS enforce the policy without being
+// rebuilt: the grpc plugin forwards the cluster zone to a service running the
+// middleware, whose wrapped handler resolves through CoreDNS again.
+//
+// The gRPC peer is the CoreDNS forwarding the query, not the pod that made
+// it: CoreDNS must pass the address of the pod in an EDNS0 client subnet
+// option, believed with source_identity edns for the addresses of CoreDNS.
+type DNSService struct {
+	pb.UnimplementedDnsServiceServer
+
+	mw *Middleware
+}
+
+// NewDNSService returns the DNSService of mw.
+func NewDNSService(mw *Middleware) *DNSService {
+	return &DNSService{mw: mw}
+}
+
+// Register registers s on server.
+func (s *DNSService) Register(server *grpc.Server) {
+	pb.RegisterDnsServiceServer(server, s)
+}
+
+// Query implements pb.DnsServiceServer.
+func (s *DNSService) Query(ctx context.Context, in *pb.DnsPacket) (*pb.DnsPacket, error) {
+	r := new(dns.Msg)
+	if err := r.Unpack(in.GetMsg()); err != nil {
+		return nil, err
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, errors.New("no peer in gRPC context")
+	}
+
+	// Behind a trusted frontend of a listener wrapped by the middleware, the
+	// peer is the CoreDNS instance the PROXY protocol header names.
+	addr := p.Addr
+	if proxied, ok := addr.(*proxyAddr); ok {
+		addr = net.TCPAddrFromAddrPort(proxied.client)
+	}
+
+	remote, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("no TCP peer in gRPC context: %v", p.Addr)
+	}
+
+	w := &grpcResponse{local: p.LocalAddr, remote: remote}
+	s.mw.ServeDNSContext(ctx, w, r)
+
+	if w.msg == nil {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		w.msg = m
+	}
+
+	packed, err := w.msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.DnsPacket{Msg: packed}, nil
+}
+
+// grpcResponse is the dns.ResponseWriter of a gRPC query, keeping the answer
+// for Query to return.
+type grpcResponse struct {
+	local  net.Addr
+	remote net.Addr
+	msg    *dns.Msg
+}
+
+func (w *grpcResponse) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+
+	return nil
+}
+
+func (w *grpcResponse) Write(b []byte) (int, error) {
+	w.msg = new(dns.Msg)
+
+	return len(b), w.msg.Unpack(b)
+}
+
+func (w *grpcResponse) LocalAddr() net.Addr  { return w.local }
+func (w *grpcResponse) RemoteAddr() net.Addr { return w.remote }
+func (w *grpcResponse) Close() error         { return nil }
+func (w *grpcResponse) TsigStatus() error    { return nil }
+func (w *grpcResponse) TsigTimersOnly(bool)  {}
+func (w *grpcResponse) Hijack()              {}
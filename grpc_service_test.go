@@ -0,0 +1,117 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/pb"
+	"github.com/miekg/dns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestDNSService(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+
+	next := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+
+		for _, svc := range cl.services {
+			if r.Question[0].Name == svc.Name+"."+svc.Namespace+".svc."+testZone {
+				m.Answer = append(m.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 30},
+					A:   net.ParseIP(svc.Spec.ClusterIP),
+				})
+			}
+		}
+
+		_ = w.WriteMsg(m)
+	})
+
+	// The client subnet is believed from the forwarding CoreDNS, the test.
+	mw, err := NewMiddleware("source_identity edns 127.0.0.0/8\nsinkhole 192.0.2.1", next)
+	if err != nil {
+		t.Fatalf("failed to create middleware: %v", err)
+	}
+
+	mw.capsule.dnsController = newTestCapsule(t, cl, dnsControllerOptions{}).dnsController
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	server := grpc.NewServer()
+	NewDNSService(mw).Register(server)
+
+	go func() { _ = server.Serve(ln) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	client := pb.NewDnsServiceClient(conn)
+
+	tests := []struct {
+		name   string
+		qname  string
+		subnet string
+		answer string
+	}{
+		{name: "same tenant", qname: "svc-0.tenant-0.svc." + testZone, subnet: cl.pods[0].Status.PodIPs[0].IP, answer: cl.services[0].Spec.ClusterIP},
+		{name: "other tenant", qname: "svc-0.tenant-1.svc." + testZone, subnet: cl.pods[0].Status.PodIPs[0].IP, answer: "192.0.2.1"},
+		{name: "without client subnet", qname: "svc-0.tenant-1.svc." + testZone, answer: cl.services[1].Spec.ClusterIP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := new(dns.Msg)
+			m.SetQuestion(tt.qname, dns.TypeA)
+
+			if tt.subnet != "" {
+				m.SetEdns0(dns.DefaultMsgSize, false)
+				m.IsEdns0().Option = append(m.IsEdns0().Option, &dns.EDNS0_SUBNET{
+					Code:          dns.EDNS0SUBNET,
+					Family:        1,
+					SourceNetmask: 32,
+					Address:       net.ParseIP(tt.subnet).To4(),
+				})
+			}
+
+			packed, err := m.Pack()
+			if err != nil {
+				t.Fatalf("failed to pack the query: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			reply, err := client.Query(ctx, &pb.DnsPacket{Msg: packed})
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+
+			r := new(dns.Msg)
+			if err := r.Unpack(reply.GetMsg()); err != nil {
+				t.Fatalf("failed to unpack the answer: %v", err)
+			}
+
+			if len(r.Answer) != 1 {
+				t.Fatalf("got answer %v, want %s", r.Answer, tt.answer)
+			}
+
+			if a, ok := r.Answer[0].(*dns.A); !ok || a.A.String() != tt.answer {
+				t.Errorf("got answer %v, want %s", r.Answer[0], tt.answer)
+			}
+		})
+	}
+}
@@ -4,145 +4,2005 @@
 package capsule_coredns
 
 import (
+	"cmp"
 	"context"
 	"errors"
-	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/plugin"
 	kubedns "github.com/coredns/coredns/plugin/kubernetes"
-	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
+	"golang.org/x/sync/singleflight"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/cache"
 )
 
-var log = clog.NewWithPlugin("capsule")
+var log = newPluginLogger(pluginName)
+
+// blockedTTL keeps synthesized answers to denied queries short-lived so lifting
+// a block takes effect quickly.
+const blockedTTL = 5
+
+// Annotations of a destination namespace overriding how queries denied access
+// to it are answered.
+const (
+	BlockedRcodeAnnotation = "capsule.clastix.io/dns-blocked-rcode"
+	BlockedTTLAnnotation   = "capsule.clastix.io/dns-blocked-ttl"
+)
+
+// Handling of queries for the zone apex and namespace-level names.
+const (
+	apexAllow     = "allow"
+	apexNamespace = "namespace"
+)
+
+// How the service and namespace exposure selectors combine.
+const (
+	selectorModeAny = "any"
+	selectorModeAll = "all"
+)
+
+// Destinations the namespace exposure selectors apply to.
+const (
+	namespaceScopeCrossTenant = "cross_tenant"
+	namespaceScopeNonTenant   = "non_tenant"
+	namespaceScopeAll         = "all"
+)
+
+// Behaviors applied once the initial sync outlasts sync_timeout.
+const (
+	syncFallbackPassthrough = "passthrough"
+	syncFallbackDeny        = "deny"
+)
 
 type Capsule struct {
 	Next                   plugin.Handler
 	kubernetesHandler      *kubedns.Kubernetes
+	kubernetesBorrowed     bool
 	dnsController          *dnsController
-	labelSelector          *meta.LabelSelector
-	namespaceLabelSelector *meta.LabelSelector
+	labelSelector          *selector
+	namespaceLabelSelector *selector
+	namespaceAnnotations   *selector
+	tenantSelector         *meta.LabelSelector
+	strictTenants          map[string]bool
+	apex                   string
+	namespaceGrace         time.Duration
+	selectorMode           string
+	sinkholeV4             net.IP
+	sinkholeV6             net.IP
+	blockedCNAME           string
+	networkPolicies        bool
+	ingresses              bool
+	accessRequests         bool
+	tenantResources        bool
+	withholdNamespaces     bool
+	audit                  auditConfig
+	auditSinks             []auditSink
+	statusInterval         time.Duration
+	status                 *statusReporter
+	counters               *decisionCounters
+	cacheTTL               time.Duration
+	cacheSize              int
+	cache                  *decisionCache
+	admin                  *adminServer
+	syncTimeout            time.Duration
+	syncFallback           string
+	maxConcurrent          int64
+	concurrent             *atomic.Int64
+	reuseGrace             time.Duration
+	denyReassigned         bool
+	logSample              *logSampling
+	logFormat              *logFormat
+	qnameRedaction         string
+	api                    apiConfig
+	flight                 *singleflight.Group
+	enforcedQtypes         map[uint16]bool
+	exposureLabel          string
+	trustedProxies         []netip.Prefix
+	trustedFrontends       []netip.Prefix
+	namespaceScope         string
+	searchTTL              time.Duration
+	searchSize             int
+	search                 *searchCache
+	visibility             bool
+	cacheSnapshot          cacheSnapshot
+	tenantStatsInterval    time.Duration
+	tenantStats            *tenantStatsReporter
+	minimalResponses       bool
+	topNamesK              int
+	topNames               *topNames
+	configName             string
+	live                   *atomic.Pointer[Capsule]
+	configRegistration     cache.ResourceEventHandlerRegistration
+	staleTimeout           time.Duration
+	staleFallback          string
+	breaker                *lookupBreaker
+	evalBudget             time.Duration
+	evalFallback           string
+	budgetSlots            chan struct{}
+	sourceIdentity         []sourceMechanism
+	metricLabels           metricLabels
+	alerts                 alertConfig
+	alerter                *alerter
+	tenantAliases          map[string]string
+	tenantLabels           []string
+	tenantOwners           bool
+	podExposureLabel       string
+	cacheGuard             string
+	prefetchK              int
+	prefetchInterval       time.Duration
+	prefetch               *prefetcher
+	recentBlockedN         int
+	recentBlocked          *recentBlocked
+	clusterDomains         []string
+	clusterZones           []string
+	externalWorkloads      bool
+	logLevel               string
+}
+
+func (h *Capsule) Setup() error {
+	h.auditSinks = h.audit.build()
+	h.counters = &decisionCounters{}
+	h.concurrent = &atomic.Int64{}
+	h.flight = &singleflight.Group{}
+	h.budgetSlots = make(chan struct{}, cmp.Or(int(h.maxConcurrent), defaultBudgetSlots))
+
+	if h.statusInterval > 0 {
+		h.status = newStatusReporter(h, h.statusInterval)
+	}
+
+	if h.tenantStatsInterval > 0 {
+		h.counters.perNamespace = true
+		h.tenantStats = newTenantStatsReporter(h, h.tenantStatsInterval)
+	}
+
+	if h.alerts.url != "" {
+		if h.alerts.blockRate > 0 {
+			h.counters.perNamespace = true
+		}
+
+		h.alerter = newAlerter(h, h.alerts)
+	}
+
+	if h.topNamesK > 0 {
+		h.topNames = newTopNames(h.topNamesK)
+	}
+
+	if h.recentBlockedN > 0 {
+		h.recentBlocked = newRecentBlocked(h.recentBlockedN)
+	}
+
+	if h.prefetchK > 0 {
+		h.prefetch = newPrefetcher(h, h.prefetchK, h.prefetchInterval)
+	}
+
+	if h.cacheTTL > 0 {
+		h.cache = newDecisionCache(h.cacheTTL, h.cacheSize)
+	}
+
+	if h.searchTTL > 0 {
+		h.search = newSearchCache(h.searchTTL, h.searchSize)
+	}
+
+	if h.configName != "" {
+		h.live = &atomic.Pointer[Capsule]{}
+	}
+
+	return nil
+}
+
+// controllerOptions returns the options of the controller backing h.
+func (h *Capsule) controllerOptions() dnsControllerOptions {
+	return dnsControllerOptions{
+		tenantSelector:     h.tenantSelector,
+		networkPolicies:    h.networkPolicies,
+		ingresses:          h.ingresses,
+		accessRequests:     h.accessRequests,
+		externalWorkloads:  h.externalWorkloads,
+		tenantResources:    h.tenantResources,
+		withholdNamespaces: h.withholdNamespaces,
+		tenantOwners:       h.tenantOwners,
+		configResource:     h.configName != "",
+		syncTimeout:        h.syncTimeout,
+		staleTimeout:       h.staleTimeout,
+		reuseGrace:         h.reuseGrace,
+		denyReassigned:     h.denyReassigned,
+		api:                h.api,
+		cacheSnapshot:      h.cacheSnapshot,
+	}
+}
+
+func (h *Capsule) Parse(c *caddy.Controller) error {
+	for c.NextBlock() {
+		switch c.Val() {
+		case "labels":
+			ls, err := compileSelector(c)
+			if err != nil {
+				return err
+			}
+
+			h.labelSelector = ls
+		case "namespace_labels":
+			nls, err := compileSelector(c)
+			if err != nil {
+				return err
+			}
+
+			h.namespaceLabelSelector = nls
+		case "namespace_annotations":
+			nas, err := compileSelector(c)
+			if err != nil {
+				return err
+			}
+
+			h.namespaceAnnotations = nas
+		case "exposure_label":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			if errs := validation.IsQualifiedName(args[0]); len(errs) > 0 {
+				return c.Errf("invalid exposure_label key '%s': %s", args[0], strings.Join(errs, ", "))
+			}
+
+			h.exposureLabel = args[0]
+		case "pod_exposure_label":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			if errs := validation.IsQualifiedName(args[0]); len(errs) > 0 {
+				return c.Errf("invalid pod_exposure_label key '%s': %s", args[0], strings.Join(errs, ", "))
+			}
+
+			h.podExposureLabel = args[0]
+		case "tenant_labels":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return c.ArgErr()
+			}
+
+			for i, key := range args {
+				if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+					return c.Errf("invalid tenant_labels key '%s': %s", key, strings.Join(errs, ", "))
+				}
+
+				if slices.Contains(args[:i], key) {
+					return c.Errf("tenant_labels key '%s' listed twice", key)
+				}
+			}
+
+			h.tenantLabels = args
+		case "tenants":
+			ts, err := parseSelector(c)
+			if err != nil {
+				return err
+			}
+
+			h.tenantSelector = ts
+		case "selector_mode":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			switch args[0] {
+			case selectorModeAny, selectorModeAll:
+				h.selectorMode = args[0]
+			default:
+				return c.Errf("invalid selector_mode '%s'", args[0])
+			}
+		case "namespace_scope":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			switch args[0] {
+			case namespaceScopeCrossTenant, namespaceScopeNonTenant, namespaceScopeAll:
+				h.namespaceScope = args[0]
+			default:
+				return c.Errf("invalid namespace_scope '%s'", args[0])
+			}
+		case "visibility":
+			if len(c.RemainingArgs()) != 0 {
+				return c.ArgErr()
+			}
+
+			h.visibility = true
+		case "strict_tenants":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return c.ArgErr()
+			}
+
+			if h.strictTenants == nil {
+				h.strictTenants = map[string]bool{}
+			}
+
+			for _, tenant := range args {
+				h.strictTenants[tenant] = true
+			}
+		case "tenant_alias":
+			args := c.RemainingArgs()
+			if len(args) < 2 {
+				return c.ArgErr()
+			}
+
+			if h.tenantAliases == nil {
+				h.tenantAliases = map[string]string{}
+			}
+
+			if err := addTenantAliases(h.tenantAliases, args[0], args[1:]); err != nil {
+				return c.Errf("invalid tenant_alias: %v", err)
+			}
+		case "apex":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			switch args[0] {
+			case apexAllow, apexNamespace:
+				h.apex = args[0]
+			default:
+				return c.Errf("invalid apex behavior '%s'", args[0])
+			}
+		case "namespace_grace":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			grace, err := time.ParseDuration(args[0])
+			if err != nil || grace <= 0 {
+				return c.Errf("invalid namespace_grace duration '%s'", args[0])
+			}
+
+			h.namespaceGrace = grace
+		case "sinkhole":
+			args := c.RemainingArgs()
+			if len(args) == 0 || len(args) > 2 {
+				return c.ArgErr()
+			}
+
+			for _, arg := range args {
+				ip := net.ParseIP(arg)
+				if ip == nil {
+					return c.Errf("invalid sinkhole address '%s'", arg)
+				}
+
+				if ip4 := ip.To4(); ip4 != nil {
+					h.sinkholeV4 = ip4
+				} else {
+					h.sinkholeV6 = ip
+				}
+			}
+		case "blocked_cname":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			if _, ok := dns.IsDomainName(args[0]); !ok {
+				return c.Errf("invalid blocked_cname target '%s'", args[0])
+			}
+
+			h.blockedCNAME = dns.Fqdn(strings.ToLower(args[0]))
+		case "minimal_responses":
+			if len(c.RemainingArgs()) != 0 {
+				return c.ArgErr()
+			}
+
+			h.minimalResponses = true
+		case "cache_guard":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			switch args[0] {
+			case cacheGuardEvaluate, cacheGuardRefuse, cacheGuardOff:
+				h.cacheGuard = args[0]
+			default:
+				return c.Errf("invalid cache_guard mode '%s'", args[0])
+			}
+		case "config_resource":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			if errs := validation.IsDNS1123Subdomain(args[0]); len(errs) > 0 {
+				return c.Errf("invalid config_resource name '%s': %s", args[0], strings.Join(errs, ", "))
+			}
+
+			h.configName = args[0]
+		case "networkpolicies":
+			if len(c.RemainingArgs()) != 0 {
+				return c.ArgErr()
+			}
+
+			h.networkPolicies = true
+		case "ingresses":
+			if len(c.RemainingArgs()) != 0 {
+				return c.ArgErr()
+			}
+
+			h.ingresses = true
+		case "access_requests":
+			if len(c.RemainingArgs()) != 0 {
+				return c.ArgErr()
+			}
+
+			h.accessRequests = true
+		case "external_workloads":
+			if len(c.RemainingArgs()) != 0 {
+				return c.ArgErr()
+			}
+
+			h.externalWorkloads = true
+		case "tenant_resources":
+			if len(c.RemainingArgs()) != 0 {
+				return c.ArgErr()
+			}
+
+			h.tenantResources = true
+		case "withhold_namespaces":
+			if len(c.RemainingArgs()) != 0 {
+				return c.ArgErr()
+			}
+
+			h.withholdNamespaces = true
+		case "tenant_owners":
+			if len(c.RemainingArgs()) != 0 {
+				return c.ArgErr()
+			}
+
+			h.tenantOwners = true
+		case "audit_sink":
+			args := c.RemainingArgs()
+			if len(args) < 2 {
+				return c.ArgErr()
+			}
+
+			if _, err := url.ParseRequestURI(args[1]); err != nil {
+				return c.Errf("invalid audit_sink url '%s': %v", args[1], err)
+			}
+
+			switch {
+			case args[0] == "webhook" && len(args) == 2:
+				h.audit.sinks = append(h.audit.sinks, auditSinkConfig{kind: args[0], url: args[1]})
+			case args[0] == "kafka" && len(args) == 3:
+				h.audit.sinks = append(h.audit.sinks, auditSinkConfig{kind: args[0], url: args[1], topic: args[2]})
+			case args[0] == "falco" && len(args) == 2:
+				h.audit.sinks = append(h.audit.sinks, auditSinkConfig{kind: args[0], url: args[1]})
+			case args[0] == "otlp" && len(args) == 2:
+				h.audit.sinks = append(h.audit.sinks, auditSinkConfig{kind: args[0], url: args[1]})
+			case args[0] == "otlp" && len(args) == 3:
+				h.audit.sinks = append(h.audit.sinks, auditSinkConfig{kind: args[0], url: args[1], cluster: args[2]})
+			default:
+				return c.ArgErr()
+			}
+		case "audit_batch":
+			args := c.RemainingArgs()
+			if len(args) != 2 {
+				return c.ArgErr()
+			}
+
+			size, err := strconv.Atoi(args[0])
+			if err != nil || size <= 0 {
+				return c.Errf("invalid audit_batch size '%s'", args[0])
+			}
+
+			interval, err := time.ParseDuration(args[1])
+			if err != nil || interval <= 0 {
+				return c.Errf("invalid audit_batch interval '%s'", args[1])
+			}
+
+			h.audit.batchSize = size
+			h.audit.batchInterval = interval
+		case "audit_buffer":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			buffer, err := strconv.Atoi(args[0])
+			if err != nil || buffer <= 0 {
+				return c.Errf("invalid audit_buffer size '%s'", args[0])
+			}
+
+			h.audit.buffer = buffer
+		case "audit_events":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			switch args[0] {
+			case "denied":
+				h.audit.all = false
+			case "all":
+				h.audit.all = true
+			default:
+				return c.Errf("invalid audit_events value '%s'", args[0])
+			}
+		case "audit_syslog":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			network, address, ok := strings.Cut(args[0], "://")
+			if !ok || address == "" || (network != "udp" && network != "tcp" && network != "tls") {
+				return c.Errf("invalid audit_syslog address '%s'", args[0])
+			}
+
+			h.syslog().network = network
+			h.syslog().address = address
+		case "audit_syslog_severity":
+			args := c.RemainingArgs()
+			if len(args) != 2 {
+				return c.ArgErr()
+			}
+
+			denied, okDenied := syslogSeverities[args[0]]
+			allowed, okAllowed := syslogSeverities[args[1]]
+
+			if !okDenied || !okAllowed {
+				return c.Errf("invalid audit_syslog_severity '%s %s'", args[0], args[1])
+			}
+
+			h.syslog().deniedSeverity = denied
+			h.syslog().allowedSeverity = allowed
+		case "audit_syslog_rate":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			r, err := strconv.ParseFloat(args[0], 64)
+			if err != nil || r <= 0 {
+				return c.Errf("invalid audit_syslog_rate '%s'", args[0])
+			}
+
+			h.syslog().rate = r
+		case "audit_grpc":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			if _, _, err := net.SplitHostPort(args[0]); err != nil {
+				return c.Errf("invalid audit_grpc address '%s': %v", args[0], err)
+			}
+
+			h.audit.grpc = args[0]
+		case "log_sample_rate":
+			args := c.RemainingArgs()
+			if len(args) == 0 || len(args) > 2 {
+				return c.ArgErr()
+			}
+
+			h.logSample = &logSampling{blocked: 1}
+
+			for i, arg := range args {
+				r, err := strconv.ParseFloat(arg, 64)
+				if err != nil || r < 0 || r > 1 {
+					return c.Errf("invalid log_sample_rate '%s', expected a fraction between 0 and 1", arg)
+				}
+
+				if i == 0 {
+					h.logSample.allowed = r
+				} else {
+					h.logSample.blocked = r
+				}
+			}
+		case "log_format":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return c.ArgErr()
+			}
+
+			f := &logFormat{fields: defaultDecisionLogFields}
+
+			switch args[0] {
+			case logFormatKV:
+			case logFormatJSON:
+				f.json = true
+			default:
+				return c.Errf("invalid log_format '%s', expected kv or json", args[0])
+			}
+
+			if len(args) > 1 {
+				f.fields = args[1:]
+			}
+
+			for i, field := range f.fields {
+				if !slices.Contains(decisionLogFields, field) {
+					return c.Errf("unknown log_format field '%s'", field)
+				}
+
+				if slices.Contains(f.fields[:i], field) {
+					return c.Errf("log_format field '%s' listed twice", field)
+				}
+			}
+
+			h.logFormat = f
+		case "log_level":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			if !slices.Contains(logLevels, args[0]) {
+				return c.Errf("invalid log_level '%s', expected debug, info, warning or error", args[0])
+			}
+
+			h.logLevel = args[0]
+		case "metric_labels":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return c.ArgErr()
+			}
+
+			for _, arg := range args {
+				switch arg {
+				case metricLabelQtype:
+					h.metricLabels.qtype = true
+				case metricLabelZone:
+					h.metricLabels.zone = true
+				case metricLabelSrcNamespace:
+					h.metricLabels.srcNamespace = true
+				case metricLabelTenantPair:
+					h.metricLabels.tenantPair = true
+				default:
+					return c.Errf("unknown metric label '%s'", arg)
+				}
+			}
+		case "qname_redaction":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			switch args[0] {
+			case qnameRedactionHash, qnameRedactionTruncate:
+				h.qnameRedaction = args[0]
+			default:
+				return c.Errf("invalid qname_redaction mode '%s'", args[0])
+			}
+		case "endpoint":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			u, err := url.Parse(args[0])
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return c.Errf("invalid endpoint '%s', expected an http or https URL", args[0])
+			}
+
+			h.api.endpoint = args[0]
+		case "tls":
+			args := c.RemainingArgs()
+			if len(args) != 3 {
+				return c.ArgErr()
+			}
+
+			h.api.certFile, h.api.keyFile, h.api.caFile = args[0], args[1], args[2]
+		case "token_file":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			h.api.tokenFile = args[0]
+		case "enforce_qtypes":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return c.ArgErr()
+			}
+
+			h.enforcedQtypes = map[uint16]bool{}
+
+			for _, arg := range args {
+				qtype, ok := dns.StringToType[strings.ToUpper(arg)]
+				if !ok || !enforceableQtypes[qtype] {
+					return c.Errf("unsupported enforce_qtypes type '%s'", arg)
+				}
+
+				h.enforcedQtypes[qtype] = true
+			}
+		case "trusted_proxies":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return c.ArgErr()
+			}
+
+			for _, arg := range args {
+				prefix, ok := parsePrefix(arg)
+				if !ok {
+					return c.Errf("invalid trusted_proxies address '%s'", arg)
+				}
+
+				h.trustedProxies = append(h.trustedProxies, prefix)
+			}
+		case "trusted_frontends":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return c.ArgErr()
+			}
+
+			for _, arg := range args {
+				prefix, ok := parsePrefix(arg)
+				if !ok {
+					return c.Errf("invalid trusted_frontends address '%s'", arg)
+				}
+
+				h.trustedFrontends = append(h.trustedFrontends, prefix)
+			}
+		case "source_identity":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return c.ArgErr()
+			}
+
+			m := sourceMechanism{name: args[0]}
+
+			switch m.name {
+			case sourceEDNS, sourceProxy, sourceXFF:
+			case sourceSocket:
+				if len(args) > 1 {
+					return c.ArgErr()
+				}
+			default:
+				return c.Errf("unknown source_identity mechanism '%s'", m.name)
+			}
+
+			for _, arg := range args[1:] {
+				prefix, ok := parsePrefix(arg)
+				if !ok {
+					return c.Errf("invalid source_identity trusted address '%s'", arg)
+				}
+
+				m.trusted = append(m.trusted, prefix)
+			}
+
+			if m.name == sourceEDNS && m.trusted == nil {
+				return c.Err("source_identity edns requires the trusted addresses")
+			}
+
+			for _, previous := range h.sourceIdentity {
+				switch previous.name {
+				case m.name:
+					return c.Errf("source_identity %s listed twice", m.name)
+				case sourceSocket:
+					return c.Errf("source_identity %s follows socket, which always applies", m.name)
+				}
+			}
+
+			h.sourceIdentity = append(h.sourceIdentity, m)
+		case "status":
+			args := c.RemainingArgs()
+
+			switch len(args) {
+			case 0:
+				h.statusInterval = defaultStatusInterval
+			case 1:
+				interval, err := time.ParseDuration(args[0])
+				if err != nil || interval <= 0 {
+					return c.Errf("invalid status interval '%s'", args[0])
+				}
+
+				h.statusInterval = interval
+			default:
+				return c.ArgErr()
+			}
+		case "tenant_stats":
+			args := c.RemainingArgs()
+
+			switch len(args) {
+			case 0:
+				h.tenantStatsInterval = defaultTenantStatsInterval
+			case 1:
+				interval, err := time.ParseDuration(args[0])
+				if err != nil || interval <= 0 {
+					return c.Errf("invalid tenant_stats interval '%s'", args[0])
+				}
+
+				h.tenantStatsInterval = interval
+			default:
+				return c.ArgErr()
+			}
+		case "alert_webhook":
+			args := c.RemainingArgs()
+			if len(args) == 0 || len(args) > 2 {
+				return c.ArgErr()
+			}
+
+			u, err := url.Parse(args[0])
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return c.Errf("invalid alert_webhook url '%s', expected an http or https URL", args[0])
+			}
+
+			h.alerts.url = args[0]
+			h.alerts.interval = defaultAlertInterval
+
+			if len(args) == 2 {
+				interval, err := time.ParseDuration(args[1])
+				if err != nil || interval <= 0 {
+					return c.Errf("invalid alert_webhook interval '%s'", args[1])
+				}
+
+				h.alerts.interval = interval
+			}
+		case "alert_threshold":
+			args := c.RemainingArgs()
+			if len(args) != 2 {
+				return c.ArgErr()
+			}
+
+			switch args[0] {
+			case alertBlockRate, alertErrorRate:
+				r, err := strconv.ParseFloat(args[1], 64)
+				if err != nil || r <= 0 || r > 1 {
+					return c.Errf("invalid alert_threshold %s '%s', expected a fraction between 0 and 1", args[0], args[1])
+				}
+
+				if args[0] == alertBlockRate {
+					h.alerts.blockRate = r
+				} else {
+					h.alerts.errorRate = r
+				}
+			case alertUnsynced:
+				d, err := time.ParseDuration(args[1])
+				if err != nil || d <= 0 {
+					return c.Errf("invalid alert_threshold unsynced '%s'", args[1])
+				}
+
+				h.alerts.unsynced = d
+			default:
+				return c.Errf("unknown alert_threshold '%s'", args[0])
+			}
+		case "top_names":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			k, err := strconv.Atoi(args[0])
+			if err != nil || k <= 0 {
+				return c.Errf("invalid top_names value '%s'", args[0])
+			}
+
+			h.topNamesK = k
+		case "prefetch":
+			args := c.RemainingArgs()
+			if len(args) == 0 || len(args) > 2 {
+				return c.ArgErr()
+			}
+
+			k, err := strconv.Atoi(args[0])
+			if err != nil || k <= 0 {
+				return c.Errf("invalid prefetch value '%s'", args[0])
+			}
+
+			h.prefetchK = k
+			h.prefetchInterval = defaultPrefetchInterval
+
+			if len(args) == 2 {
+				interval, err := time.ParseDuration(args[1])
+				if err != nil || interval <= 0 {
+					return c.Errf("invalid prefetch interval '%s'", args[1])
+				}
+
+				h.prefetchInterval = interval
+			}
+		case "cluster_domains":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return c.ArgErr()
+			}
+
+			for _, arg := range args {
+				domain := dns.Fqdn(strings.ToLower(arg))
+				if _, ok := dns.IsDomainName(domain); !ok || domain == "." || reverseZone(domain) {
+					return c.Errf("invalid cluster domain '%s'", arg)
+				}
+
+				h.clusterDomains = append(h.clusterDomains, domain)
+			}
+		case "recent_blocked":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return c.Errf("invalid recent_blocked value '%s'", args[0])
+			}
+
+			h.recentBlockedN = n
+		case "decision_cache":
+			args := c.RemainingArgs()
+			if len(args) == 0 || len(args) > 2 {
+				return c.ArgErr()
+			}
+
+			ttl, err := time.ParseDuration(args[0])
+			if err != nil || ttl <= 0 {
+				return c.Errf("invalid decision_cache ttl '%s'", args[0])
+			}
+
+			h.cacheTTL = ttl
+			h.cacheSize = defaultDecisionCacheSize
+
+			if len(args) == 2 {
+				size, err := strconv.Atoi(args[1])
+				if err != nil || size <= 0 {
+					return c.Errf("invalid decision_cache size '%s'", args[1])
+				}
+
+				h.cacheSize = size
+			}
+		case "search_cache":
+			args := c.RemainingArgs()
+			if len(args) == 0 || len(args) > 2 {
+				return c.ArgErr()
+			}
+
+			ttl, err := time.ParseDuration(args[0])
+			if err != nil || ttl <= 0 {
+				return c.Errf("invalid search_cache ttl '%s'", args[0])
+			}
+
+			h.searchTTL = ttl
+			h.searchSize = defaultSearchCacheSize
+
+			if len(args) == 2 {
+				size, err := strconv.Atoi(args[1])
+				if err != nil || size <= 0 {
+					return c.Errf("invalid search_cache size '%s'", args[1])
+				}
+
+				h.searchSize = size
+			}
+		case "admin":
+			args := c.RemainingArgs()
+			if len(args) != 2 {
+				return c.ArgErr()
+			}
+
+			if _, _, err := net.SplitHostPort(args[0]); err != nil {
+				return c.Errf("invalid admin address '%s': %v", args[0], err)
+			}
+
+			h.admin = newAdminServer(h, args[0], args[1])
+		case "sync_timeout":
+			args := c.RemainingArgs()
+			if len(args) != 2 {
+				return c.ArgErr()
+			}
+
+			timeout, err := time.ParseDuration(args[0])
+			if err != nil || timeout <= 0 {
+				return c.Errf("invalid sync_timeout duration '%s'", args[0])
+			}
+
+			if args[1] != syncFallbackPassthrough && args[1] != syncFallbackDeny {
+				return c.Errf("invalid sync_timeout fallback '%s'", args[1])
+			}
+
+			h.syncTimeout = timeout
+			h.syncFallback = args[1]
+		case "stale_timeout":
+			args := c.RemainingArgs()
+			if len(args) != 2 {
+				return c.ArgErr()
+			}
+
+			timeout, err := time.ParseDuration(args[0])
+			if err != nil || timeout <= 0 {
+				return c.Errf("invalid stale_timeout duration '%s'", args[0])
+			}
+
+			if args[1] != syncFallbackPassthrough && args[1] != syncFallbackDeny {
+				return c.Errf("invalid stale_timeout fallback '%s'", args[1])
+			}
+
+			h.staleTimeout = timeout
+			h.staleFallback = args[1]
+		case "evaluation_budget":
+			args := c.RemainingArgs()
+			if len(args) != 2 {
+				return c.ArgErr()
+			}
+
+			budget, err := time.ParseDuration(args[0])
+			if err != nil || budget <= 0 {
+				return c.Errf("invalid evaluation_budget duration '%s'", args[0])
+			}
+
+			if args[1] != syncFallbackPassthrough && args[1] != syncFallbackDeny {
+				return c.Errf("invalid evaluation_budget fallback '%s'", args[1])
+			}
+
+			h.evalBudget = budget
+			h.evalFallback = args[1]
+		case "lookup_breaker":
+			args := c.RemainingArgs()
+			if len(args) != 4 {
+				return c.ArgErr()
+			}
+
+			timeout, err := time.ParseDuration(args[0])
+			if err != nil || timeout <= 0 {
+				return c.Errf("invalid lookup_breaker timeout '%s'", args[0])
+			}
+
+			failures, err := strconv.Atoi(args[1])
+			if err != nil || failures <= 0 {
+				return c.Errf("invalid lookup_breaker failures '%s'", args[1])
+			}
+
+			cooldown, err := time.ParseDuration(args[2])
+			if err != nil || cooldown <= 0 {
+				return c.Errf("invalid lookup_breaker cooldown '%s'", args[2])
+			}
+
+			if args[3] != syncFallbackPassthrough && args[3] != syncFallbackDeny {
+				return c.Errf("invalid lookup_breaker fallback '%s'", args[3])
+			}
+
+			h.breaker = &lookupBreaker{timeout: timeout, failures: failures, cooldown: cooldown, fallback: args[3]}
+		case "sync_page_size":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			n, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil || n <= 0 {
+				return c.Errf("invalid sync_page_size value '%s'", args[0])
+			}
+
+			h.api.pageSize = n
+		case "resync":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			period, err := time.ParseDuration(args[0])
+			if err != nil || period <= 0 {
+				return c.Errf("invalid resync period '%s'", args[0])
+			}
+
+			h.api.resyncPeriod = period
+		case "cache_snapshot":
+			args := c.RemainingArgs()
+			if len(args) < 1 || len(args) > 3 {
+				return c.ArgErr()
+			}
+
+			snapshot := cacheSnapshot{
+				path:     args[0],
+				interval: defaultCacheSnapshotInterval,
+				maxAge:   defaultCacheSnapshotMaxAge,
+			}
+
+			if len(args) > 1 {
+				interval, err := time.ParseDuration(args[1])
+				if err != nil || interval <= 0 {
+					return c.Errf("invalid cache_snapshot interval '%s'", args[1])
+				}
+
+				snapshot.interval = interval
+			}
+
+			if len(args) > 2 {
+				maxAge, err := time.ParseDuration(args[2])
+				if err != nil || maxAge <= 0 {
+					return c.Errf("invalid cache_snapshot max age '%s'", args[2])
+				}
+
+				snapshot.maxAge = maxAge
+			}
+
+			h.cacheSnapshot = snapshot
+		case "max_concurrent":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+
+			n, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil || n <= 0 {
+				return c.Errf("invalid max_concurrent value '%s'", args[0])
+			}
+
+			h.maxConcurrent = n
+		case "ip_reuse_grace":
+			args := c.RemainingArgs()
+			if len(args) == 0 || len(args) > 2 {
+				return c.ArgErr()
+			}
+
+			grace, err := time.ParseDuration(args[0])
+			if err != nil || grace <= 0 {
+				return c.Errf("invalid ip_reuse_grace duration '%s'", args[0])
+			}
+
+			h.reuseGrace = grace
+			h.denyReassigned = false
+
+			if len(args) == 2 {
+				switch args[1] {
+				case "newest":
+				case "deny":
+					h.denyReassigned = true
+				default:
+					return c.Errf("invalid ip_reuse_grace behavior '%s'", args[1])
+				}
+			}
+		case "informers":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return c.ArgErr()
+			}
+
+			enabled := map[string]bool{}
+
+			for _, arg := range args {
+				switch arg {
+				case "pods", "services", "namespaces":
+					enabled[arg] = true
+				default:
+					return c.Errf("unknown informer '%s'", arg)
+				}
+			}
+
+			if !enabled["namespaces"] {
+				return c.Err("the namespaces informer cannot be disabled")
+			}
+
+			h.api.withoutPods = !enabled["pods"]
+			h.api.withoutServices = !enabled["services"]
+		default:
+			return c.Errf("unknown property '%s'", c.Val())
+		}
+	}
+
+	if h.reuseGrace > 0 && h.api.withoutPods {
+		return c.Err("ip_reuse_grace requires the pods informer")
+	}
+
+	if h.blockedCNAME != "" && (h.sinkholeV4 != nil || h.sinkholeV6 != nil) {
+		return c.Err("sinkhole and blocked_cname are mutually exclusive")
+	}
+
+	if slices.ContainsFunc(h.sourceIdentity, func(m sourceMechanism) bool {
+		return m.name == sourceXFF && m.trusted == nil
+	}) && len(h.trustedProxies) == 0 {
+		return c.Err("source_identity xff requires the trusted addresses or trusted_proxies")
+	}
+
+	if slices.ContainsFunc(h.sourceIdentity, func(m sourceMechanism) bool {
+		return m.name == sourceProxy && m.trusted == nil
+	}) && len(h.trustedFrontends) == 0 {
+		return c.Err("source_identity proxy_proto requires the trusted addresses or trusted_frontends")
+	}
+
+	if h.logFormat != nil && h.logSample == nil {
+		return c.Err("log_format requires log_sample_rate")
+	}
+
+	thresholds := h.alerts.blockRate > 0 || h.alerts.unsynced > 0 || h.alerts.errorRate > 0
+	if thresholds != (h.alerts.url != "") {
+		return c.Err("alert_webhook and alert_threshold go together")
+	}
+
+	if h.topNamesK > 0 && h.admin == nil {
+		return c.Err("top_names requires admin")
+	}
+
+	if h.recentBlockedN > 0 && h.admin == nil {
+		return c.Err("recent_blocked requires admin")
+	}
+
+	if h.audit.syslog != nil && h.audit.syslog.address == "" {
+		return c.Err("audit_syslog_severity and audit_syslog_rate require audit_syslog")
+	}
+
+	return nil
 }
 
-func (h *Capsule) Setup() error {
-	var err error
+func (h *Capsule) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	// Evaluated in front of the cache already.
+	if ctx.Value(guardedKey{}) != nil {
+		return plugin.NextOrFailure(h.Name(), h.Next, ctx, w, r)
+	}
 
-	h.dnsController, err = newDNSController()
-	if err != nil {
-		log.Errorf("failed to create DNS controller: %v", err)
+	t := queryTimer{start: time.Now()}
+	rcode, err := h.policy().serveDNS(ctx, w, r, h.Next, &t)
+	t.observe()
+
+	return rcode, err
+}
 
-		return err
+// serveDNS evaluates the questions of r and hands the allowed ones to next.
+func (h *Capsule) serveDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, next plugin.Handler, t *queryTimer) (int, error) {
+	if !wellFormed(r) {
+		return dns.RcodeFormatError, nil
 	}
 
-	return nil
-}
+	state := request.Request{W: h.identify(w, r), Req: r}
+	inZone := false
+	// unenforced is set for the questions of kubernetes zones left out by
+	// cluster_domains, which the kubernetes plugin still answers.
+	unenforced := false
 
-func (h *Capsule) Parse(c *caddy.Controller) error {
-	for c.NextBlock() {
-		switch c.Val() {
-		case "labels":
-			args := c.RemainingArgs()
-			if len(args) > 0 {
-				labelSelectorString := strings.Join(args, " ")
+	// The questions whose answer is narrowed to the pods exposed to the
+	// source tenant, with pod_exposure_label.
+	var (
+		narrowed     []string
+		narrowTenant string
+	)
 
-				ls, err := meta.ParseToLabelSelector(labelSelectorString)
-				if err != nil {
-					return fmt.Errorf("unable to parse label selector value: '%v': %w", labelSelectorString, err)
-				}
+	// Deferring within the loop would allocate, release the slot from here.
+	defer func() {
+		if inZone {
+			h.release()
+		}
+	}()
+
+	// Every question is evaluated on its own, so a second question can't ride
+	// along with an allowed first one.
+	for i := range r.Question {
+		question := questionState(state, i)
+		qname := question.QName()
+
+		zone := h.zoneOf(qname)
+		if zone == "" {
+			if len(h.clusterDomains) > 0 && plugin.Zones(h.kubernetesHandler.Zones).Matches(qname) != "" {
+				unenforced = true
+			}
+
+			continue
+		}
+
+		zone = qname[len(qname)-len(zone):] // maintain case of original query
+		question.Zone = zone
+		state.Zone = zone
+
+		// A transfer would hand out every name of the zone at once.
+		if qtype := question.QType(); qtype == dns.TypeAXFR || qtype == dns.TypeIXFR {
+			return dns.RcodeRefused, nil
+		}
+
+		if !inZone {
+			if !h.acquire() {
+				maxConcurrentRejects.Inc()
+
+				return plugin.BackendError(ctx, h.kubernetesHandler, zone, dns.RcodeServerFailure, state, nil, plugin.Options{})
+			}
 
-				h.labelSelector = ls
+			inZone = true
+		}
+
+		namespace, namespaceLevel := namespaceName(qname, zone)
+		if namespaceLevel && (namespace == "" || h.apex != apexNamespace) {
+			continue
+		}
 
+		// Namespace-level names are evaluated whatever their type, as are
+		// the delegation records of the names within a namespace: all of them
+		// tell whether the namespace exists.
+		if !namespaceLevel && !h.enforced(question.QType()) {
+			if h.apex != apexNamespace || !delegationQtypes[question.QType()] {
 				continue
 			}
 
-			return c.ArgErr()
-		case "namespace_labels":
-			args := c.RemainingArgs()
-			if len(args) > 0 {
-				namespaceLabelSelectorString := strings.Join(args, " ")
+			if namespace, namespaceLevel = enclosingNamespace(qname, zone); !namespaceLevel {
+				continue
+			}
+		}
+
+		// The controller answering while a reload syncs tells whether its
+		// caches are stale.
+		ctrl := h.dnsController.active()
+
+		if !ctrl.HasSynced() && !ctrl.Warm() {
+			if !ctrl.SyncExpired() {
+				return plugin.BackendError(ctx, h.kubernetesHandler, zone, dns.RcodeServerFailure, state, nil, plugin.Options{})
+			}
+
+			if h.syncFallback == syncFallbackDeny {
+				return h.block(ctx, state, question, zone, defaultBlockedResponse)
+			}
+
+			return t.downstream(func() (int, error) { return next.ServeDNS(ctx, w, r) })
+		}
+
+		if ctrl.Degraded() {
+			if h.staleFallback == syncFallbackDeny {
+				return h.block(ctx, state, question, zone, defaultBlockedResponse)
+			}
+
+			return t.downstream(func() (int, error) { return next.ServeDNS(ctx, w, r) })
+		}
+
+		var (
+			destIp string
+			d      decision
+			err    error
+		)
+
+		if namespaceLevel {
+			d, err = h.budgeted(ctx, func() decision {
+				return h.dnsController.active().EvaluateNamespace(ctx, state.IP(), namespace, *h)
+			})
+		} else {
+			destIp, d, err = h.searchResolve(ctx, question, zone)
+		}
+
+		if fallback, ok := h.fallbackFor(err); ok {
+			h.counters.failed.Add(1)
+
+			if fallback == syncFallbackDeny {
+				return h.block(ctx, state, question, zone, defaultBlockedResponse)
+			}
+
+			return t.downstream(func() (int, error) { return next.ServeDNS(ctx, w, r) })
+		}
+
+		// A query given up on, or out of time, is not answered as if allowed.
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return dns.RcodeServerFailure, err
+		}
+
+		if err != nil {
+			continue
+		}
+
+		h.counters.record(d)
+		h.countDecision(question, zone, d)
+		h.recordName(question, d)
+		h.recordBlocked(question, d)
+		h.recordPrefetch(question, d)
+		h.emit(question, destIp, d)
+		h.logDecision(question, destIp, d)
+		h.runHooks(ctx, question, destIp, d)
+
+		if !d.allowed {
+			if namespaceLevel {
+				return h.block(ctx, state, question, zone, h.namespaceBlockedResponse(d))
+			}
+
+			return h.block(ctx, state, question, zone, h.blockedResponse(d))
+		}
+
+		if h.filtersPods(d) {
+			narrowed = append(narrowed, question.Name())
+			narrowTenant = d.srcTenant
+		}
+	}
+
+	if !inZone {
+		// A kubernetes plugin from another server block is not part of
+		// this chain, there is nothing to skip. In front of the cache, the
+		// plugins up to kubernetes are still to run.
+		if h.kubernetesBorrowed || next != h.Next || unenforced {
+			return t.downstream(func() (int, error) { return plugin.NextOrFailure(h.Name(), next, ctx, w, r) })
+		}
+
+		return t.downstream(func() (int, error) {
+			return plugin.NextOrFailure(h.kubernetesHandler.Name(), h.kubernetesHandler.Next, ctx, w, r)
+		})
+	}
+
+	return t.downstream(func() (int, error) {
+		return next.ServeDNS(ctx, h.exposedPods(ctx, h.minimal(w), narrowTenant, narrowed), r)
+	})
+}
+
+// syslog returns the syslog audit configuration, creating it with the default
+// severities on first use.
+func (h *Capsule) syslog() *syslogConfig {
+	if h.audit.syslog == nil {
+		h.audit.syslog = &syslogConfig{
+			deniedSeverity:  syslogSeverities["warning"],
+			allowedSeverity: syslogSeverities["info"],
+		}
+	}
+
+	return h.audit.syslog
+}
+
+// acquire reserves an evaluation slot, failing once max_concurrent
+// evaluations are in flight.
+func (h *Capsule) acquire() bool {
+	n := h.concurrent.Add(1)
+	if h.maxConcurrent > 0 && n > h.maxConcurrent {
+		h.concurrent.Add(-1)
+
+		return false
+	}
+
+	return true
+}
+
+func (h *Capsule) release() {
+	h.concurrent.Add(-1)
+}
+
+// enforceableQtypes are the types GetDestIp can attribute, the ones subject to
+// policy by default are listed in defaultEnforcedQtypes.
+var (
+	enforceableQtypes = map[uint16]bool{
+		dns.TypeA:    true,
+		dns.TypeAAAA: true,
+		dns.TypePTR:  true,
+		dns.TypeSRV:  true,
+	}
+	defaultEnforcedQtypes = map[uint16]bool{
+		dns.TypeA:    true,
+		dns.TypeAAAA: true,
+		dns.TypePTR:  true,
+	}
+)
+
+// delegationQtypes are evaluated against the namespace enclosing their name
+// with "apex namespace", even when not enforced.
+var delegationQtypes = map[uint16]bool{
+	dns.TypeNS:  true,
+	dns.TypeSOA: true,
+	dns.TypeDS:  true,
+}
+
+// enforced reports whether questions of qtype are subject to policy, the
+// others are passed through.
+func (h *Capsule) enforced(qtype uint16) bool {
+	if h.enforcedQtypes == nil {
+		return defaultEnforcedQtypes[qtype]
+	}
+
+	return h.enforcedQtypes[qtype]
+}
 
-				nls, err := meta.ParseToLabelSelector(namespaceLabelSelectorString)
-				if err != nil {
-					return fmt.Errorf("unable to parse namespace_label selector value: '%v': %w", namespaceLabelSelectorString, err)
+// searchResolve is resolve behind the search cache, when enabled. Decisions
+// holding for every question of the source are returned without a
+// destination.
+func (h *Capsule) searchResolve(ctx context.Context, question request.Request, zone string) (string, decision, error) {
+	if h.search == nil {
+		return h.resolve(ctx, question, zone)
+	}
+
+	src := question.IP()
+	if d, ok := h.search.source(src); ok {
+		return "", d, nil
+	}
+
+	// Name is lowercased, the case of the search path expansions of a 0x20
+	// resolver varies from one query to the next.
+	qname := question.Name()
+	if h.search.unnamed(src, question.QType(), qname) {
+		return "", decision{}, errNoRecord
+	}
+
+	destIp, d, err := h.resolve(ctx, question, zone)
+
+	switch {
+	case err != nil:
+		if errors.Is(err, errNoRecord) || h.kubernetesHandler.IsNameError(err) {
+			h.search.setNegative(src, question.QType(), qname)
+		}
+	case sourceLevel(d):
+		h.search.setSource(src, d)
+	}
+
+	return destIp, d, err
+}
+
+// resolution is the outcome of resolving and evaluating a question.
+type resolution struct {
+	destIp string
+	d      decision
+}
+
+// resolve looks up the destination of question and evaluates it. Concurrent
+// identical questions from the same source share a single lookup and
+// evaluation, which runs detached from the context of the caller that started
+// it: each caller waits for it until its own ctx is done.
+func (h *Capsule) resolve(ctx context.Context, question request.Request, zone string) (string, decision, error) {
+	// IP parses the remote address on every call, look it up once.
+	src := question.IP()
+
+	// Name is lowercased, so questions differing only in case are shared.
+	key := src + " " + question.Type() + " " + question.Name()
+
+	detached := context.WithoutCancel(ctx)
+
+	work := func() (any, error) {
+		destIp, hops, err := h.prefetchedLookup(detached, question, zone, src)
+		if err != nil {
+			return nil, err
+		}
+
+		// Every service a CNAME chain goes through must be reachable, and so
+		// must the address it ends on: an ExternalName service of the source
+		// tenant must not lead to another tenant's service.
+		d, err := h.budgeted(detached, func() decision {
+			var d decision
+			for _, hop := range hops {
+				if d = h.dnsController.active().EvaluateService(detached, src, hop.namespace, hop.name, *h); !d.allowed {
+					return d
 				}
+			}
 
-				h.namespaceLabelSelector = nls
+			// A headless service answers with its pods, evaluate the
+			// service they stand for.
+			if ref, ok := h.headlessService(question, zone); ok {
+				return h.dnsController.active().EvaluateService(detached, src, ref.namespace, ref.name, *h)
+			}
 
-				continue
+			if destIp != "" {
+				d = h.evaluate(detached, src, destIp)
 			}
 
-			return c.ArgErr()
+			return d
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return resolution{destIp: destIp, d: d}, nil
+	}
+
+	var res singleflight.Result
+
+	if ctx.Done() == nil {
+		res.Val, res.Err, res.Shared = h.flight.Do(key, work)
+	} else {
+		select {
+		case res = <-h.flight.DoChan(key, work):
+		case <-ctx.Done():
+			return "", decision{}, ctx.Err()
+		}
+	}
+
+	if res.Shared {
+		sharedEvaluations.Inc()
+	}
+
+	if res.Err != nil {
+		return "", decision{}, res.Err
+	}
+
+	//nolint:forcetypeassert
+	r := res.Val.(resolution)
+
+	return r.destIp, r.d, nil
+}
+
+// evaluate returns the decision for a query from src to dst, served from the
+// decision cache when enabled. A decision made once ctx is done is not cached.
+func (h *Capsule) evaluate(ctx context.Context, src, dst string) decision {
+	if h.cache == nil {
+		return h.dnsController.active().Evaluate(ctx, src, dst, *h)
+	}
+
+	if d, ok := h.cache.get(src, dst); ok {
+		return d
+	}
+
+	d := h.dnsController.active().Evaluate(ctx, src, dst, *h)
+
+	// Pending namespaces are labelled shortly, don't outlive the grace period.
+	if d.reason != reasonPendingNamespace && ctx.Err() == nil {
+		h.cache.set(src, dst, d)
+	}
+
+	return d
+}
+
+// emit hands the decision to the audit sinks. Allowed queries are only
+// reported with "audit_events all".
+func (h *Capsule) emit(question request.Request, destIp string, d decision) {
+	if len(h.auditSinks) == 0 || (d.allowed && !h.audit.all) {
+		return
+	}
+
+	ev := newAuditEvent(question, destIp, d)
+	ev.QName = h.reportedQName(ev.QName)
+
+	for _, sink := range h.auditSinks {
+		sink.Emit(ev)
+	}
+}
+
+// blockedResponse is how a denied query is answered.
+type blockedResponse struct {
+	rcode int
+	ttl   uint32
+	// customTTL also applies ttl to the SOA of negative answers.
+	customTTL bool
+}
+
+var defaultBlockedResponse = blockedResponse{rcode: dns.RcodeSuccess, ttl: blockedTTL}
+
+// blockedResponse returns the response to a query denied by d, as overridden by
+// the annotations of the destination namespace. Invalid values are ignored.
+func (h *Capsule) blockedResponse(d decision) blockedResponse {
+	return h.annotatedResponse(defaultBlockedResponse, d)
+}
+
+// namespaceBlockedResponse is blockedResponse for the namespace-level names,
+// NXDOMAIN by default like the names of namespaces that don't exist.
+func (h *Capsule) namespaceBlockedResponse(d decision) blockedResponse {
+	return h.annotatedResponse(blockedResponse{rcode: dns.RcodeNameError, ttl: blockedTTL}, d)
+}
+
+// annotatedResponse returns resp as overridden by the annotations of the
+// destination namespace of d.
+func (h *Capsule) annotatedResponse(resp blockedResponse, d decision) blockedResponse {
+	if d.dstNamespace == "" {
+		return resp
+	}
+
+	ns, err := h.dnsController.active().getNSByName(d.dstNamespace)
+	if err != nil || ns == nil {
+		return resp
+	}
+
+	if v, ok := ns.Annotations[BlockedRcodeAnnotation]; ok {
+		switch rcode := dns.StringToRcode[strings.ToUpper(v)]; rcode {
+		case dns.RcodeSuccess, dns.RcodeNameError, dns.RcodeRefused:
+			resp.rcode = rcode
 		default:
-			return c.Errf("unknown property '%s'", c.Val())
+			log.Debugf("ignoring %s=%q on namespace %s", BlockedRcodeAnnotation, v, ns.Name)
+		}
+	}
+
+	if v, ok := ns.Annotations[BlockedTTLAnnotation]; ok {
+		ttl, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			log.Debugf("ignoring %s=%q on namespace %s", BlockedTTLAnnotation, v, ns.Name)
+		} else {
+			resp.ttl = uint32(ttl)
+			resp.customTTL = true
+		}
+	}
+
+	return resp
+}
+
+// block answers state with an empty response carrying the rcode of resp,
+// NOERROR by default. NOERROR answers hold a CNAME to the blocked_cname target,
+// or the sinkhole address when one is configured for the type of the denied
+// question. The response is tiny, so it never carries the TC bit and never
+// makes a UDP client retry over TCP.
+func (h *Capsule) block(ctx context.Context, state, question request.Request, zone string, resp blockedResponse) (int, error) {
+	m := new(dns.Msg)
+	m.SetRcode(state.Req, resp.rcode)
+	m.Authoritative = true
+
+	sinkhole := h.sinkhole(question, resp.ttl)
+
+	switch {
+	case resp.rcode == dns.RcodeRefused:
+		// REFUSED carries no records.
+	case resp.rcode == dns.RcodeSuccess && h.blockedCNAME != "":
+		m.Answer = h.blockedAnswer(ctx, question, resp.ttl)
+	case resp.rcode == dns.RcodeSuccess && sinkhole != nil:
+		m.Answer = []dns.RR{sinkhole}
+	case h.minimalResponses:
+		// Resolvers cache the answer for their default negative TTL.
+	default:
+		m.Ns, _ = plugin.SOA(ctx, h.kubernetesHandler, zone, state, plugin.Options{})
+
+		if resp.customTTL {
+			for _, rr := range m.Ns {
+				if soa, ok := rr.(*dns.SOA); ok {
+					soa.Hdr.Ttl = resp.ttl
+					soa.Minttl = resp.ttl
+				}
+			}
 		}
 	}
 
+	state.SizeAndDo(m)
+	m.Truncated = false
+
+	err := state.W.WriteMsg(m)
+
+	return dns.RcodeSuccess, err
+}
+
+// sinkhole returns the honeypot record answering state, or nil when no
+// sinkhole address is configured for the query type.
+func (h *Capsule) sinkhole(state request.Request, ttl uint32) dns.RR {
+	hdr := dns.RR_Header{Name: state.QName(), Rrtype: state.QType(), Class: dns.ClassINET, Ttl: ttl}
+
+	switch {
+	case state.QType() == dns.TypeA && h.sinkholeV4 != nil:
+		return &dns.A{Hdr: hdr, A: h.sinkholeV4}
+	case state.QType() == dns.TypeAAAA && h.sinkholeV6 != nil:
+		return &dns.AAAA{Hdr: hdr, AAAA: h.sinkholeV6}
+	}
+
 	return nil
 }
 
-func (h *Capsule) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
-	state := request.Request{W: w, Req: r}
-	qname := state.QName()
+// blockedAnswer points the denied question at the blocked_cname target. When
+// the target lives in the cluster zone its addresses are appended, so stub
+// resolvers reach the help page without a second lookup.
+func (h *Capsule) blockedAnswer(ctx context.Context, question request.Request, ttl uint32) []dns.RR {
+	answer := []dns.RR{&dns.CNAME{
+		Hdr:    dns.RR_Header{Name: question.QName(), Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: ttl},
+		Target: h.blockedCNAME,
+	}}
 
-	zone := plugin.Zones(h.kubernetesHandler.Zones).Matches(qname)
+	zone := plugin.Zones(h.kubernetesHandler.Zones).Matches(h.blockedCNAME)
 	if zone == "" {
-		return plugin.NextOrFailure(h.kubernetesHandler.Name(), h.kubernetesHandler.Next, ctx, w, r)
+		return answer
 	}
 
-	zone = qname[len(qname)-len(zone):] // maintain case of original query
-	state.Zone = zone
+	req := question.Req.Copy()
+	req.Question[0].Name = h.blockedCNAME
+	target := request.Request{W: question.W, Req: req, Zone: zone}
 
-	destIp := state.IP()
+	var (
+		records []dns.RR
+		err     error
+	)
 
-	if !h.dnsController.HasSynced() {
-		return plugin.BackendError(ctx, h.kubernetesHandler, zone, dns.RcodeServerFailure, state, nil, plugin.Options{})
+	switch question.QType() {
+	case dns.TypeA:
+		records, _, err = plugin.A(ctx, h.kubernetesHandler, zone, target, nil, plugin.Options{})
+	case dns.TypeAAAA:
+		records, _, err = plugin.AAAA(ctx, h.kubernetesHandler, zone, target, nil, plugin.Options{})
 	}
 
-	destIp, err := h.GetDestIp(ctx, state, zone, destIp)
 	if err != nil {
-		return h.Next.ServeDNS(ctx, w, r)
+		h.countLookupError(question.QType(), err)
+
+		return answer
+	}
+
+	return append(answer, records...)
+}
+
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+
+	return ip.String()
+}
+
+// wellFormed reports whether r carries at least one question and every
+// question holds a valid domain name.
+func wellFormed(r *dns.Msg) bool {
+	if r == nil || len(r.Question) == 0 {
+		return false
+	}
+
+	for _, q := range r.Question {
+		if _, ok := dns.IsDomainName(q.Name); !ok || !dns.IsFqdn(q.Name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// namespaceName reports whether qname is the zone apex or a namespace-level
+// name, such as cluster.local., svc.cluster.local. or team-a.svc.cluster.local.,
+// and returns the namespace it names, if any.
+func namespaceName(qname, zone string) (string, bool) {
+	rest := strings.TrimSuffix(strings.ToLower(qname[:len(qname)-len(zone)]), ".")
+	if rest == "" {
+		return "", true
+	}
+
+	// Cut rather than split, this runs for every question.
+	namespace, kind := "", rest
+	if i := strings.LastIndexByte(rest, '.'); i >= 0 {
+		namespace, kind = rest[:i], rest[i+1:]
+	}
+
+	if kind != "svc" && kind != "pod" || strings.Contains(namespace, ".") {
+		return "", false
+	}
+
+	return namespace, true
+}
+
+// enclosingNamespace returns the namespace of a name within a namespace of the
+// zone, such as api.team-b.svc.cluster.local. or 10-0-0-1.team-b.pod.cluster.local.
+func enclosingNamespace(qname, zone string) (string, bool) {
+	rest := strings.TrimSuffix(strings.ToLower(qname[:len(qname)-len(zone)]), ".")
+
+	rest, kind, ok := cutLast(rest)
+	if !ok || kind != "svc" && kind != "pod" {
+		return "", false
+	}
+
+	_, namespace, ok := cutLast(rest)
+
+	return namespace, ok
+}
+
+// cutLast slices s around its last label.
+func cutLast(s string) (before, last string, ok bool) {
+	i := strings.LastIndexByte(s, '.')
+	if i < 0 {
+		return "", s, s != ""
+	}
+
+	return s[:i], s[i+1:], true
+}
+
+// serviceName returns the service named by name when it is a service name of
+// the zone, such as api.team-b.svc.cluster.local.
+func serviceName(name, zone string) (serviceRef, bool) {
+	if zone == "" || !dns.IsSubDomain(zone, name) {
+		return serviceRef{}, false
+	}
+
+	rest := strings.TrimSuffix(strings.ToLower(name[:len(name)-len(zone)]), ".")
+
+	segs := strings.Split(rest, ".")
+	if len(segs) != 3 || segs[2] != "svc" {
+		return serviceRef{}, false
+	}
+
+	return serviceRef{namespace: segs[1], name: segs[0]}, true
+}
+
+// serviceQuestion returns the service an A, AAAA or SRV question names. SRV
+// names may carry the port and protocol, as in
+// _http._tcp.web.team-b.svc.cluster.local.
+func serviceQuestion(question request.Request, zone string) (serviceRef, bool) {
+	switch question.QType() {
+	case dns.TypeA, dns.TypeAAAA, dns.TypeSRV:
+	default:
+		return serviceRef{}, false
+	}
+
+	name := question.Name()
+	for range 2 {
+		if label, rest, ok := strings.Cut(name, "."); ok && strings.HasPrefix(label, "_") {
+			name = rest
+		}
 	}
 
-	if !h.dnsController.TenantAuthorized(state.IP(), destIp, *h) {
-		return plugin.BackendError(ctx, h.kubernetesHandler, zone, dns.RcodeSuccess, state, nil, plugin.Options{})
+	return serviceName(name, zone)
+}
+
+// questionState returns a copy of state that only carries the i-th question.
+func questionState(state request.Request, i int) request.Request {
+	if len(state.Req.Question) == 1 {
+		return request.Request{W: state.W, Req: state.Req, Zone: state.Zone}
 	}
 
-	return h.Next.ServeDNS(ctx, w, r)
+	req := state.Req.Copy()
+	req.Question = []dns.Question{state.Req.Question[i]}
+
+	return request.Request{W: state.W, Req: req, Zone: state.Zone}
 }
 
 func (h *Capsule) GetDestIp(ctx context.Context, state request.Request, zone string, destIp string) (string, error) {
+	destIp, _, err := h.destination(ctx, state, zone, destIp)
+
+	return destIp, err
+}
+
+// errNoRecord is returned when the kubernetes plugin holds no record for a
+// question.
+var errNoRecord = errors.New("kubernetes record not found")
+
+// serviceRef names a service of the zone.
+type serviceRef struct {
+	namespace string
+	name      string
+}
+
+// destination returns the address state resolves to and, when the answer goes
+// through a CNAME chain, the services of the zone the chain passes through,
+// such as ExternalName services. The address is empty when the chain leaves
+// the cluster without resolving.
+func (h *Capsule) destination(ctx context.Context, state request.Request, zone string, destIp string) (string, []serviceRef, error) {
 	switch state.QType() {
-	case dns.TypeA:
-		records, _, err := plugin.A(ctx, h.kubernetesHandler, zone, state, nil, plugin.Options{})
+	case dns.TypeA, dns.TypeAAAA:
+		lookup := plugin.A
+		if state.QType() == dns.TypeAAAA {
+			lookup = plugin.AAAA
+		}
+
+		records, _, err := lookup(ctx, h.kubernetesHandler, zone, state, nil, plugin.Options{})
 		if err != nil {
-			return "", err
+			h.countLookupError(state.QType(), err)
+
+			return "", nil, err
+		}
+
+		var hops []serviceRef
+
+		destIp = ""
+
+		for _, rr := range records {
+			switch rr := rr.(type) {
+			case *dns.CNAME:
+				// The chain may go through another cluster domain.
+				if ref, ok := serviceName(rr.Hdr.Name, h.zoneOf(rr.Hdr.Name)); ok {
+					hops = append(hops, ref)
+				}
+			case *dns.A:
+				destIp = rr.A.String()
+			case *dns.AAAA:
+				destIp = rr.AAAA.String()
+			}
+
+			if destIp != "" {
+				break
+			}
 		}
 
-		if len(records) == 0 {
-			return "", errors.New("kubernetes record not found")
+		if destIp == "" && len(hops) == 0 {
+			return "", nil, errNoRecord
 		}
 
-		//nolint:forcetypeassert
-		destIp = records[0].(*dns.A).A.String()
-	case dns.TypeAAAA:
-		records, _, err := plugin.AAAA(ctx, h.kubernetesHandler, zone, state, nil, plugin.Options{})
+		return destIp, hops, nil
+	case dns.TypeSRV:
+		// The targets are attributed through the addresses the kubernetes
+		// plugin adds to the additional section.
+		_, extra, err := plugin.SRV(ctx, h.kubernetesHandler, zone, state, plugin.Options{})
 		if err != nil {
-			return "", err
+			h.countLookupError(state.QType(), err)
+
+			return "", nil, err
+		}
+
+		for _, rr := range extra {
+			switch rr := rr.(type) {
+			case *dns.A:
+				return rr.A.String(), nil, nil
+			case *dns.AAAA:
+				return rr.AAAA.String(), nil, nil
+			}
 		}
 
-		if len(records) == 0 {
-			return "", errors.New("kubernetes record not found")
+		return "", nil, errNoRecord
+	case dns.TypePTR:
+		// Both in-addr.arpa and ip6.arpa (nibble format) names carry the
+		// destination address, no backend lookup is needed.
+		addr := net.ParseIP(dnsutil.ExtractAddressFromReverse(state.Name()))
+		if addr == nil {
+			return "", nil, errors.New("not a reverse address name")
 		}
 
-		//nolint:forcetypeassert
-		destIp = records[0].(*dns.AAAA).AAAA.String()
+		destIp = addr.String()
 	}
 
-	return destIp, nil
+	return destIp, nil, nil
 }
 
 func (h *Capsule) Name() string { return pluginName }
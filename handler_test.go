@@ -0,0 +1,678 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	v1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServeDNS(t *testing.T) {
+	cl := newCluster(4, 1, 2)
+	// tenant-2 holds no tenant workloads, tenant-3 is a shared namespace
+	// exposing svc-1 to everyone.
+	delete(cl.namespaces[2].Labels, CapsuleTenantLabel)
+	cl.namespaces[3].Labels["capsule.io/dns"] = "enabled"
+	cl.services[7].Labels = map[string]string{"capsule.io/expose-dns": "true"}
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+
+	var passed int
+
+	h.kubernetesHandler.Next = plugin.HandlerFunc(func(_ context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		passed++
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+
+		return dns.RcodeSuccess, w.WriteMsg(m)
+	})
+
+	svcName := func(i int) string {
+		return cl.services[i].Name + "." + cl.services[i].Namespace + ".svc." + testZone
+	}
+
+	tests := []struct {
+		name      string
+		configure func(h *Capsule)
+		src       int
+		qnames    []string
+		qtype     uint16
+		rcode     int
+		answer    string
+		denied    uint64
+		passed    int
+	}{
+		{name: "same tenant", src: 0, qnames: []string{svcName(0)}, answer: cl.services[0].Spec.ClusterIP},
+		{name: "other tenant", src: 0, qnames: []string{svcName(2)}, denied: 1},
+		{name: "from non-tenant namespace", src: 2, qnames: []string{svcName(0)}, answer: cl.services[0].Spec.ClusterIP},
+		{name: "to non-tenant namespace", src: 0, qnames: []string{svcName(4)}, denied: 1},
+		{
+			name: "service selector",
+			configure: func(h *Capsule) {
+				h.labelSelector = matchLabels(map[string]string{"capsule.io/expose-dns": "true"})
+			},
+			src:    0,
+			qnames: []string{svcName(7)},
+			answer: cl.services[7].Spec.ClusterIP,
+		},
+		{
+			name: "service selector not matching",
+			configure: func(h *Capsule) {
+				h.labelSelector = matchLabels(map[string]string{"capsule.io/expose-dns": "true"})
+			},
+			src:    0,
+			qnames: []string{svcName(6)},
+			denied: 1,
+		},
+		{
+			name: "namespace selector",
+			configure: func(h *Capsule) {
+				h.namespaceLabelSelector = matchLabels(map[string]string{"capsule.io/dns": "enabled"})
+			},
+			src:    0,
+			qnames: []string{svcName(6)},
+			answer: cl.services[6].Spec.ClusterIP,
+		},
+		{
+			name: "sinkhole",
+			configure: func(h *Capsule) {
+				h.sinkholeV4 = net.ParseIP("192.0.2.1")
+			},
+			src:    0,
+			qnames: []string{svcName(2)},
+			answer: "192.0.2.1",
+			denied: 1,
+		},
+		{name: "SRV passed through by default", src: 0, qnames: []string{"_http._tcp." + svcName(2)}, qtype: dns.TypeSRV},
+		{
+			name: "SRV enforced",
+			configure: func(h *Capsule) {
+				h.enforcedQtypes = map[uint16]bool{dns.TypeSRV: true}
+			},
+			src:    0,
+			qnames: []string{"_http._tcp." + svcName(2)},
+			qtype:  dns.TypeSRV,
+			denied: 1,
+		},
+		{
+			name: "A passed through when not enforced",
+			configure: func(h *Capsule) {
+				h.enforcedQtypes = map[uint16]bool{dns.TypeSRV: true}
+			},
+			src:    0,
+			qnames: []string{svcName(2)},
+			answer: cl.services[2].Spec.ClusterIP,
+		},
+		{name: "second question denied", src: 0, qnames: []string{svcName(0), svcName(2)}, denied: 1},
+		{name: "zone transfer", src: 0, qnames: []string{testZone}, qtype: dns.TypeAXFR, rcode: dns.RcodeRefused},
+		{name: "incremental zone transfer", src: 2, qnames: []string{testZone}, qtype: dns.TypeIXFR, rcode: dns.RcodeRefused},
+		{name: "zone transfer out of zone", src: 0, qnames: []string{"example.org."}, qtype: dns.TypeAXFR, passed: 1},
+		{name: "out of zone", src: 0, qnames: []string{"example.org."}, passed: 1},
+		{name: "no question", src: 0, rcode: dns.RcodeFormatError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.labelSelector = nil
+			h.namespaceLabelSelector = nil
+			h.sinkholeV4 = nil
+			h.enforcedQtypes = nil
+			h.counters = &decisionCounters{}
+			passed = 0
+
+			if tt.configure != nil {
+				tt.configure(h)
+			}
+
+			qtype := tt.qtype
+			if qtype == 0 {
+				qtype = dns.TypeA
+			}
+
+			m := new(dns.Msg)
+			for _, qname := range tt.qnames {
+				m.Question = append(m.Question, dns.Question{Name: qname, Qtype: qtype, Qclass: dns.ClassINET})
+			}
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: cl.pods[tt.src].Status.PodIPs[0].IP})
+
+			rcode, err := h.ServeDNS(context.Background(), rec, m)
+			if err != nil {
+				t.Fatalf("ServeDNS failed: %v", err)
+			}
+
+			if rcode != tt.rcode {
+				t.Fatalf("got rcode %s, want %s", dns.RcodeToString[rcode], dns.RcodeToString[tt.rcode])
+			}
+
+			if denied := h.counters.denied.Load(); denied != tt.denied {
+				t.Errorf("got %d denied queries, want %d", denied, tt.denied)
+			}
+
+			if passed != tt.passed {
+				t.Errorf("got %d queries passed to the next plugin, want %d", passed, tt.passed)
+			}
+
+			if tt.rcode != dns.RcodeSuccess {
+				return
+			}
+
+			var answer string
+			if len(rec.Msg.Answer) > 0 {
+				if a, ok := rec.Msg.Answer[0].(*dns.A); ok {
+					answer = a.A.String()
+				}
+			}
+
+			if answer != tt.answer {
+				t.Errorf("got answer %q, want %q", answer, tt.answer)
+			}
+		})
+	}
+}
+
+func TestServeDNSExternalName(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+
+	alias := func(ns, name, target string) {
+		cl.services = append(cl.services, &v1.Service{
+			ObjectMeta: meta.ObjectMeta{Name: name, Namespace: ns},
+			Spec:       v1.ServiceSpec{Type: v1.ServiceTypeExternalName, ExternalName: target},
+		})
+	}
+
+	// Aliases in tenant-0 to its own service, to tenant-1's service and out of
+	// the cluster, and an alias in tenant-1 back to tenant-0's service.
+	alias("tenant-0", "own", "svc-0.tenant-0.svc.cluster.local")
+	alias("tenant-0", "other", "svc-0.tenant-1.svc.cluster.local")
+	alias("tenant-0", "chained", "own.tenant-0.svc.cluster.local")
+	alias("tenant-0", "external", "example.org")
+	alias("tenant-1", "back", "svc-0.tenant-0.svc.cluster.local")
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	src := cl.pods[0].Status.PodIPs[0].IP
+
+	tests := []struct {
+		qname  string
+		answer string
+		denied uint64
+	}{
+		{qname: "own.tenant-0.svc.cluster.local.", answer: cl.services[0].Spec.ClusterIP},
+		{qname: "chained.tenant-0.svc.cluster.local.", answer: cl.services[0].Spec.ClusterIP},
+		{qname: "other.tenant-0.svc.cluster.local.", denied: 1},
+		{qname: "back.tenant-1.svc.cluster.local.", denied: 1},
+		{qname: "external.tenant-0.svc.cluster.local."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.qname, func(t *testing.T) {
+			h.counters = &decisionCounters{}
+
+			m := new(dns.Msg)
+			m.SetQuestion(tt.qname, dns.TypeA)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: src})
+			if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+				t.Fatalf("ServeDNS failed: %v", err)
+			}
+
+			if denied := h.counters.denied.Load(); denied != tt.denied {
+				t.Errorf("got %d denied queries, want %d", denied, tt.denied)
+			}
+
+			var answer string
+			for _, rr := range rec.Msg.Answer {
+				if a, ok := rr.(*dns.A); ok {
+					answer = a.A.String()
+				}
+			}
+
+			if answer != tt.answer {
+				t.Errorf("got answer %q, want %q", answer, tt.answer)
+			}
+		})
+	}
+}
+
+func TestServeDNSSearchCache(t *testing.T) {
+	cl := newCluster(3, 1, 1)
+	delete(cl.namespaces[2].Labels, CapsuleTenantLabel)
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.search = newSearchCache(time.Minute, defaultSearchCacheSize)
+
+	query := func(src int, qname string) {
+		t.Helper()
+
+		m := new(dns.Msg)
+		m.SetQuestion(qname, dns.TypeA)
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: cl.pods[src].Status.PodIPs[0].IP})
+		if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatalf("ServeDNS failed: %v", err)
+		}
+	}
+
+	tenantSrc := cl.pods[0].Status.PodIPs[0].IP
+	nonTenantSrc := cl.pods[2].Status.PodIPs[0].IP
+
+	// The search path expansions of example.org from a tenant pod.
+	for _, qname := range []string{"example.org.tenant-0.svc.cluster.local.", "example.org.svc.cluster.local.", "example.org.cluster.local."} {
+		query(0, qname)
+
+		if !h.search.unnamed(tenantSrc, dns.TypeA, qname) {
+			t.Errorf("%s is not cached as naming nothing", qname)
+		}
+	}
+
+	query(0, "svc-0.tenant-1.svc.cluster.local.")
+
+	if _, ok := h.search.source(tenantSrc); ok {
+		t.Error("tenant source decision cached")
+	}
+
+	query(2, "svc-0.tenant-1.svc.cluster.local.")
+
+	d, ok := h.search.source(nonTenantSrc)
+	if !ok || d.reason != reasonNonTenantSource {
+		t.Errorf("got cached source decision %+v, %t, want %s", d, ok, reasonNonTenantSource)
+	}
+
+	// The cached decision is reused for other destinations.
+	h.counters = &decisionCounters{}
+	query(2, "svc-0.tenant-0.svc.cluster.local.")
+
+	if allowed := h.counters.allowed.Load(); allowed != 1 {
+		t.Errorf("got %d allowed queries, want 1", allowed)
+	}
+
+	if n := h.search.flush(false); n != 4 {
+		t.Errorf("flushed %d entries, want 4", n)
+	}
+}
+
+// randomCase flips the case of the letters of name at random, as resolvers
+// implementing DNS 0x20 do.
+func randomCase(r *rand.Rand, name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if r.IntN(2) == 0 {
+			continue
+		}
+
+		switch {
+		case c >= 'a' && c <= 'z':
+			b[i] = c - 'a' + 'A'
+		case c >= 'A' && c <= 'Z':
+			b[i] = c - 'A' + 'a'
+		}
+	}
+
+	return string(b)
+}
+
+func TestServeDNSRandomCase(t *testing.T) {
+	cl := newCluster(3, 1, 1)
+	cl.namespaces[2].Labels = map[string]string{"capsule.io/dns": "enabled"}
+	cl.services = append(cl.services, &v1.Service{
+		ObjectMeta: meta.ObjectMeta{Name: "alias", Namespace: "tenant-0"},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeExternalName, ExternalName: "SVC-0.Tenant-1.svc.Cluster.Local"},
+	})
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.kubernetesHandler.Zones = append(h.kubernetesHandler.Zones, "in-addr.arpa.")
+	h.apex = apexNamespace
+	h.enforcedQtypes = map[uint16]bool{dns.TypeA: true, dns.TypePTR: true, dns.TypeSRV: true}
+	h.namespaceLabelSelector = matchLabels(map[string]string{"capsule.io/dns": "enabled"})
+
+	reverse, _ := dns.ReverseAddr(cl.pods[1].Status.PodIPs[0].IP)
+
+	tests := []struct {
+		name   string
+		qname  string
+		qtype  uint16
+		denied uint64
+	}{
+		{name: "same tenant", qname: "svc-0.tenant-0.svc.cluster.local.", qtype: dns.TypeA},
+		{name: "other tenant", qname: "svc-0.tenant-1.svc.cluster.local.", qtype: dns.TypeA, denied: 1},
+		{name: "whitelisted namespace", qname: "svc-0.tenant-2.svc.cluster.local.", qtype: dns.TypeA},
+		{name: "own namespace", qname: "tenant-0.svc.cluster.local.", qtype: dns.TypeA},
+		{name: "other namespace", qname: "tenant-1.svc.cluster.local.", qtype: dns.TypeA, denied: 1},
+		{name: "other tenant pod", qname: reverse, qtype: dns.TypePTR, denied: 1},
+		{name: "other tenant port", qname: "_http._tcp.svc-0.tenant-1.svc.cluster.local.", qtype: dns.TypeSRV, denied: 1},
+		{name: "alias to other tenant", qname: "alias.tenant-0.svc.cluster.local.", qtype: dns.TypeA, denied: 1},
+	}
+
+	r := rand.New(rand.NewPCG(0x20, 0x20))
+	src := cl.pods[0].Status.PodIPs[0].IP
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 16 {
+				qname := randomCase(r, tt.qname)
+				h.counters = &decisionCounters{}
+
+				m := new(dns.Msg)
+				m.SetQuestion(qname, tt.qtype)
+
+				rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: src})
+				if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+					t.Fatalf("ServeDNS(%s) failed: %v", qname, err)
+				}
+
+				if denied := h.counters.denied.Load(); denied != tt.denied {
+					t.Errorf("%s: got %d denied queries, want %d", qname, denied, tt.denied)
+				}
+
+				if h.counters.allowed.Load()+h.counters.denied.Load() != 1 {
+					t.Errorf("%s: not evaluated", qname)
+				}
+			}
+		})
+	}
+}
+
+func TestNamespaceName(t *testing.T) {
+	tests := []struct {
+		qname     string
+		namespace string
+		ok        bool
+	}{
+		{qname: "cluster.local.", ok: true},
+		{qname: "svc.cluster.local.", ok: true},
+		{qname: "Pod.Cluster.Local.", ok: true},
+		{qname: "team-a.svc.cluster.local.", namespace: "team-a", ok: true},
+		{qname: "Team-A.pod.cluster.local.", namespace: "team-a", ok: true},
+		{qname: "api.team-a.svc.cluster.local.", ok: false},
+		{qname: "team-a.cluster.local.", ok: false},
+		{qname: "4.3.2.1.in-addr.arpa.", ok: false},
+	}
+
+	for _, tt := range tests {
+		zone := testZone
+		if dns.IsSubDomain("in-addr.arpa.", tt.qname) {
+			zone = "in-addr.arpa."
+		}
+
+		namespace, ok := namespaceName(tt.qname, tt.qname[len(tt.qname)-len(zone):])
+		if namespace != tt.namespace || ok != tt.ok {
+			t.Errorf("namespaceName(%q) = %q, %t, want %q, %t", tt.qname, namespace, ok, tt.namespace, tt.ok)
+		}
+	}
+}
+
+func TestEnclosingNamespace(t *testing.T) {
+	tests := []struct {
+		qname     string
+		namespace string
+		ok        bool
+	}{
+		{qname: "api.team-a.svc.cluster.local.", namespace: "team-a", ok: true},
+		{qname: "_http._tcp.API.Team-A.svc.cluster.local.", namespace: "team-a", ok: true},
+		{qname: "10-0-0-1.team-a.pod.cluster.local.", namespace: "team-a", ok: true},
+		{qname: "team-a.svc.cluster.local.", namespace: "team-a", ok: true},
+		{qname: "svc.cluster.local."},
+		{qname: "cluster.local."},
+		{qname: "api.team-a.cluster.local."},
+	}
+
+	for _, tt := range tests {
+		namespace, ok := enclosingNamespace(tt.qname, testZone)
+		if namespace != tt.namespace || ok != tt.ok {
+			t.Errorf("enclosingNamespace(%q) = %q, %t, want %q, %t", tt.qname, namespace, ok, tt.namespace, tt.ok)
+		}
+	}
+}
+
+func TestServiceName(t *testing.T) {
+	tests := []struct {
+		name string
+		ref  serviceRef
+		ok   bool
+	}{
+		{name: "api.team-a.svc.cluster.local.", ref: serviceRef{namespace: "team-a", name: "api"}, ok: true},
+		{name: "API.Team-A.SVC.Cluster.Local.", ref: serviceRef{namespace: "team-a", name: "api"}, ok: true},
+		{name: "team-a.svc.cluster.local."},
+		{name: "web-0.api.team-a.svc.cluster.local."},
+		{name: "api.team-a.pod.cluster.local."},
+		{name: "api.team-a.svc.example.org."},
+	}
+
+	for _, tt := range tests {
+		ref, ok := serviceName(tt.name, testZone)
+		if ref != tt.ref || ok != tt.ok {
+			t.Errorf("serviceName(%q) = %+v, %t, want %+v, %t", tt.name, ref, ok, tt.ref, tt.ok)
+		}
+	}
+}
+
+func TestServeDNSApex(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	src := cl.pods[0].Status.PodIPs[0].IP
+
+	tests := []struct {
+		name   string
+		apex   string
+		qname  string
+		qtype  uint16
+		rcode  int
+		denied uint64
+	}{
+		{name: "apex SOA", qname: "cluster.local.", qtype: dns.TypeSOA},
+		{name: "apex NS", apex: apexNamespace, qname: "cluster.local.", qtype: dns.TypeNS},
+		{name: "other namespace allowed", qname: "tenant-1.svc.cluster.local.", qtype: dns.TypeA},
+		{name: "own namespace", apex: apexNamespace, qname: "tenant-0.svc.cluster.local.", qtype: dns.TypeA},
+		{name: "other namespace evaluated", apex: apexNamespace, qname: "tenant-1.svc.cluster.local.", qtype: dns.TypeA, rcode: dns.RcodeNameError, denied: 1},
+		{name: "missing namespace", apex: apexNamespace, qname: "tenant-9.svc.cluster.local.", qtype: dns.TypeA, rcode: dns.RcodeNameError},
+		{name: "other namespace NS", apex: apexNamespace, qname: "tenant-1.svc.cluster.local.", qtype: dns.TypeNS, rcode: dns.RcodeNameError, denied: 1},
+		{name: "other namespace TXT", apex: apexNamespace, qname: "tenant-1.svc.cluster.local.", qtype: dns.TypeTXT, rcode: dns.RcodeNameError, denied: 1},
+		{name: "NS within own namespace", apex: apexNamespace, qname: "svc-0.tenant-0.svc.cluster.local.", qtype: dns.TypeNS},
+		{name: "NS within other namespace", apex: apexNamespace, qname: "svc-0.tenant-1.svc.cluster.local.", qtype: dns.TypeNS, rcode: dns.RcodeNameError, denied: 1},
+		{name: "SOA within other namespace", apex: apexNamespace, qname: "svc-0.tenant-1.svc.cluster.local.", qtype: dns.TypeSOA, rcode: dns.RcodeNameError, denied: 1},
+		{name: "NS within other namespace allowed", qname: "svc-0.tenant-1.svc.cluster.local.", qtype: dns.TypeNS},
+		{name: "TXT within other namespace passed through", apex: apexNamespace, qname: "svc-0.tenant-1.svc.cluster.local.", qtype: dns.TypeTXT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.apex = tt.apex
+			h.counters = &decisionCounters{}
+
+			m := new(dns.Msg)
+			m.SetQuestion(tt.qname, tt.qtype)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: src})
+			if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+				t.Fatalf("ServeDNS failed: %v", err)
+			}
+
+			if rec.Msg == nil || rec.Msg.Rcode != tt.rcode {
+				t.Fatalf("expected a %s answer, got %v", dns.RcodeToString[tt.rcode], rec.Msg)
+			}
+
+			if denied := h.counters.denied.Load(); denied != tt.denied {
+				t.Errorf("got %d denied queries, want %d", denied, tt.denied)
+			}
+		})
+	}
+}
+
+func TestServeDNSBlockedResponse(t *testing.T) {
+	cl := newCluster(5, 1, 1)
+	cl.namespaces[2].Annotations = map[string]string{BlockedRcodeAnnotation: "REFUSED"}
+	cl.namespaces[3].Annotations = map[string]string{BlockedRcodeAnnotation: "nxdomain", BlockedTTLAnnotation: "60"}
+	cl.namespaces[4].Annotations = map[string]string{BlockedRcodeAnnotation: "SERVFAIL", BlockedTTLAnnotation: "-1"}
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	src := cl.pods[0].Status.PodIPs[0].IP
+
+	tests := []struct {
+		name   string
+		ns     int
+		rcode  int
+		soaTTL uint32
+	}{
+		{name: "default", ns: 1, rcode: dns.RcodeSuccess, soaTTL: 5},
+		{name: "refused", ns: 2, rcode: dns.RcodeRefused},
+		{name: "nxdomain with ttl", ns: 3, rcode: dns.RcodeNameError, soaTTL: 60},
+		{name: "invalid values", ns: 4, rcode: dns.RcodeSuccess, soaTTL: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := cl.services[tt.ns]
+
+			m := new(dns.Msg)
+			m.SetQuestion(svc.Name+"."+svc.Namespace+".svc."+testZone, dns.TypeA)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: src})
+			if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+				t.Fatalf("ServeDNS failed: %v", err)
+			}
+
+			if rec.Msg.Rcode != tt.rcode {
+				t.Errorf("got rcode %s, want %s", dns.RcodeToString[rec.Msg.Rcode], dns.RcodeToString[tt.rcode])
+			}
+
+			if len(rec.Msg.Answer) != 0 {
+				t.Errorf("expected no answer, got %v", rec.Msg.Answer)
+			}
+
+			if tt.soaTTL == 0 {
+				if len(rec.Msg.Ns) != 0 {
+					t.Errorf("expected no authority, got %v", rec.Msg.Ns)
+				}
+
+				return
+			}
+
+			if len(rec.Msg.Ns) != 1 || rec.Msg.Ns[0].Header().Ttl != tt.soaTTL {
+				t.Errorf("expected a SOA with TTL %d, got %v", tt.soaTTL, rec.Msg.Ns)
+			}
+		})
+	}
+}
+
+func TestResolveShared(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	src := cl.pods[0].Status.PodIPs[0].IP
+	svc := cl.services[1]
+
+	m := new(dns.Msg)
+	m.SetQuestion(svc.Name+"."+svc.Namespace+".svc."+testZone, dns.TypeA)
+	question := request.Request{W: &test.ResponseWriter{RemoteIP: src}, Req: m, Zone: testZone}
+
+	// Hold an evaluation of the same question in flight, the next one must
+	// wait for it and share its outcome rather than evaluate on its own.
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+	held := resolution{destIp: "192.0.2.1", d: decision{allowed: true, reason: "held"}}
+
+	go h.flight.Do(src+" A "+question.Name(), func() (any, error) {
+		close(inFlight)
+		<-release
+
+		return held, nil
+	})
+
+	<-inFlight
+
+	done := make(chan resolution)
+
+	go func() {
+		destIp, d, err := h.resolve(context.Background(), question, testZone)
+		if err != nil {
+			t.Errorf("resolve failed: %v", err)
+		}
+
+		done <- resolution{destIp: destIp, d: d}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if got := <-done; got != held {
+		t.Errorf("got %+v, want the in-flight outcome %+v", got, held)
+	}
+
+	destIp, d, err := h.resolve(context.Background(), question, testZone)
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+
+	if destIp != svc.Spec.ClusterIP || d.allowed {
+		t.Errorf("got %s %+v, want %s denied once nothing is in flight", destIp, d, svc.Spec.ClusterIP)
+	}
+}
+
+func TestResolveSharedCancelled(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	src := cl.pods[0].Status.PodIPs[0].IP
+	svc := cl.services[1]
+
+	m := new(dns.Msg)
+	m.SetQuestion(svc.Name+"."+svc.Namespace+".svc."+testZone, dns.TypeA)
+	question := request.Request{W: &test.ResponseWriter{RemoteIP: src}, Req: m, Zone: testZone}
+
+	// Holding the IP table shard of the source stalls the shared evaluation.
+	shard := h.dnsController.informers.ips.shard(src)
+	shard.Lock()
+
+	first, cancel := context.WithCancel(t.Context())
+	firstErr := make(chan error)
+
+	go func() {
+		_, _, err := h.resolve(first, question, testZone)
+		firstErr <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	type outcome struct {
+		destIp string
+		d      decision
+		err    error
+	}
+
+	second := make(chan outcome)
+
+	go func() {
+		destIp, d, err := h.resolve(t.Context(), question, testZone)
+		second <- outcome{destIp: destIp, d: d, err: err}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v for the cancelled caller, want %v", err, context.Canceled)
+	}
+
+	shard.Unlock()
+
+	got := <-second
+	if got.err != nil {
+		t.Fatalf("got error %v for the caller sharing the evaluation of a cancelled one", got.err)
+	}
+
+	if got.destIp != svc.Spec.ClusterIP || got.d.allowed || got.d.reason != reasonCrossTenant {
+		t.Errorf("got %s %+v, want %s denied", got.destIp, got.d, svc.Spec.ClusterIP)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/coredns/coredns/request"
+)
+
+// Action is what the plugin does with an evaluated query.
+type Action string
+
+const (
+	ActionAllow Action = "allow"
+	ActionBlock Action = "block"
+)
+
+// Identity is one end of a query, as the plugin attributed it. Namespace and
+// Tenant are empty when unknown.
+type Identity struct {
+	IP        string
+	Namespace string
+	Tenant    string
+}
+
+// Decision describes how a query was decided.
+type Decision struct {
+	Action Action
+	// Reason is one of the reasons exported in metrics and audit events,
+	// such as "exposed_service" or "cross_tenant".
+	Reason string
+	// Rule is the directive, label or annotation behind the decision, such
+	// as "labels" or "capsule.clastix.io/dns-allow-tenants". It is empty
+	// when the tenant isolation itself decided.
+	Rule string
+	// QName is the question name as qname_redaction reports it.
+	QName       string
+	QType       uint16
+	Source      Identity
+	Destination Identity
+}
+
+// Hook is called with the decision of an evaluated query, on the query path:
+// it must return quickly, hand slow work off to another goroutine and not
+// modify anything it did not create.
+type Hook func(ctx context.Context, d Decision)
+
+// hooks are registered for the whole process, the handlers are built from the
+// Corefile where embedders can't reach them.
+var hooks struct {
+	mu      sync.Mutex
+	allowed atomic.Pointer[[]Hook]
+	blocked atomic.Pointer[[]Hook]
+}
+
+// OnAllowed registers hook for the queries the plugin allows, in every server
+// block. Hooks are best registered before the server starts, from an init
+// function of the program embedding the plugin.
+func OnAllowed(hook Hook) {
+	registerHook(&hooks.allowed, hook)
+}
+
+// OnBlocked registers hook for the queries the plugin blocks, in every server
+// block.
+func OnBlocked(hook Hook) {
+	registerHook(&hooks.blocked, hook)
+}
+
+// registerHook appends hook to a copy of the list, which queries read without
+// locking.
+func registerHook(list *atomic.Pointer[[]Hook], hook Hook) {
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+
+	var registered []Hook
+	if current := list.Load(); current != nil {
+		registered = append(registered, *current...)
+	}
+
+	registered = append(registered, hook)
+	list.Store(&registered)
+}
+
+// runHooks calls the hooks registered for d. The Decision is only built when
+// there are some.
+func (h *Capsule) runHooks(ctx context.Context, question request.Request, destIp string, d decision) {
+	list := hooks.blocked.Load()
+	if d.allowed {
+		list = hooks.allowed.Load()
+	}
+
+	if list == nil {
+		return
+	}
+
+	pub := newDecision(question, destIp, d)
+	pub.QName = h.reportedQName(pub.QName)
+
+	for _, hook := range *list {
+		hook(ctx, pub)
+	}
+}
+
+func newDecision(question request.Request, destIp string, d decision) Decision {
+	pub := publicDecision(question.IP(), destIp, d)
+	pub.QName = question.Name()
+	pub.QType = question.QType()
+
+	return pub
+}
+
+// publicDecision returns d between srcIp and destIp, without a question.
+func publicDecision(srcIp, destIp string, d decision) Decision {
+	action := ActionBlock
+	if d.allowed {
+		action = ActionAllow
+	}
+
+	return Decision{
+		Action: action,
+		Reason: d.reason,
+		Rule:   d.rule,
+		Source: Identity{
+			IP:        srcIp,
+			Namespace: d.srcNamespace,
+			Tenant:    d.srcTenant,
+		},
+		Destination: Identity{
+			IP:        destIp,
+			Namespace: d.dstNamespace,
+			Tenant:    d.dstTenant,
+		},
+	}
+}
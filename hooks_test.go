@@ -0,0 +1,130 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+// resetHooks drops the hooks registered by a test once it ends.
+func resetHooks(tb testing.TB) {
+	tb.Helper()
+
+	allowed, blocked := hooks.allowed.Load(), hooks.blocked.Load()
+
+	tb.Cleanup(func() {
+		hooks.allowed.Store(allowed)
+		hooks.blocked.Store(blocked)
+	})
+}
+
+func TestHooks(t *testing.T) {
+	cl := newCluster(2, 1, 2)
+	cl.services[3].Labels = map[string]string{"capsule.io/expose-dns": "true"}
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.labelSelector = matchLabels(map[string]string{"capsule.io/expose-dns": "true"})
+	h.kubernetesHandler.Next = plugin.HandlerFunc(func(_ context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+
+		return dns.RcodeSuccess, w.WriteMsg(m)
+	})
+
+	resetHooks(t)
+
+	var allowed, blocked []Decision
+
+	OnAllowed(func(_ context.Context, d Decision) { allowed = append(allowed, d) })
+	OnBlocked(func(_ context.Context, d Decision) { blocked = append(blocked, d) })
+
+	src := cl.pods[0].Status.PodIPs[0].IP
+
+	for _, svc := range []int{0, 2, 3} {
+		m := new(dns.Msg)
+		m.SetQuestion(cl.services[svc].Name+"."+cl.services[svc].Namespace+".svc."+testZone, dns.TypeA)
+
+		if _, err := h.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: src}), m); err != nil {
+			t.Fatalf("ServeDNS failed: %v", err)
+		}
+	}
+
+	wantAllowed := []Decision{
+		{
+			Action: ActionAllow, Reason: reasonSameTenant, QName: "svc-0.tenant-0.svc." + testZone, QType: dns.TypeA,
+			Source:      Identity{IP: src, Namespace: "tenant-0", Tenant: "tenant-0"},
+			Destination: Identity{IP: cl.services[0].Spec.ClusterIP, Namespace: "tenant-0", Tenant: "tenant-0"},
+		},
+		{
+			Action: ActionAllow, Reason: reasonExposedService, Rule: "labels", QName: "svc-1.tenant-1.svc." + testZone, QType: dns.TypeA,
+			Source:      Identity{IP: src, Namespace: "tenant-0", Tenant: "tenant-0"},
+			Destination: Identity{IP: cl.services[3].Spec.ClusterIP, Namespace: "tenant-1", Tenant: "tenant-1"},
+		},
+	}
+	wantBlocked := []Decision{
+		{
+			Action: ActionBlock, Reason: reasonCrossTenant, QName: "svc-0.tenant-1.svc." + testZone, QType: dns.TypeA,
+			Source:      Identity{IP: src, Namespace: "tenant-0", Tenant: "tenant-0"},
+			Destination: Identity{IP: cl.services[2].Spec.ClusterIP, Namespace: "tenant-1", Tenant: "tenant-1"},
+		},
+	}
+
+	if len(allowed) != len(wantAllowed) {
+		t.Fatalf("got %d allowed decisions, want %d: %+v", len(allowed), len(wantAllowed), allowed)
+	}
+
+	for i := range wantAllowed {
+		if allowed[i] != wantAllowed[i] {
+			t.Errorf("got allowed decision %+v, want %+v", allowed[i], wantAllowed[i])
+		}
+	}
+
+	if len(blocked) != 1 || blocked[0] != wantBlocked[0] {
+		t.Errorf("got blocked decisions %+v, want %+v", blocked, wantBlocked)
+	}
+}
+
+func TestDecisionRules(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	cl.namespaces[1].Annotations = map[string]string{AllowTenantsAnnotation: "tenant-0"}
+
+	ctrl := newTestCapsule(t, cl, dnsControllerOptions{}).dnsController
+	src, dst := cl.pods[0].Status.PodIPs[0].IP, cl.services[1].Spec.ClusterIP
+
+	tests := []struct {
+		name   string
+		h      Capsule
+		reason string
+		rule   string
+	}{
+		{name: "grant", reason: reasonTenantGrant, rule: AllowTenantsAnnotation},
+		{
+			name:   "namespace labels",
+			h:      Capsule{namespaceLabelSelector: matchLabels(map[string]string{CapsuleTenantLabel: "tenant-1"})},
+			reason: reasonExposedNamespace,
+			rule:   "namespace_labels",
+		},
+		{
+			name:   "namespace annotations",
+			h:      Capsule{namespaceAnnotations: matchLabels(map[string]string{AllowTenantsAnnotation: "tenant-0"})},
+			reason: reasonExposedNamespace,
+			rule:   "namespace_annotations",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := ctrl.Evaluate(t.Context(), src, dst, tt.h)
+			if d.reason != tt.reason || d.rule != tt.rule {
+				t.Errorf("got reason=%s rule=%s, want reason=%s rule=%s", d.reason, d.rule, tt.reason, tt.rule)
+			}
+		})
+	}
+}
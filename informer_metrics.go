@@ -0,0 +1,103 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"github.com/coredns/coredns/plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	// informerEvents counts the events informers deliver to their handlers.
+	informerEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "informer_events_total",
+			Help:      "Number of informer events handled, partitioned by informer and event (add, update or delete).",
+		},
+		[]string{"informer", "event"},
+	)
+
+	// informerQueueDepth counts the objects received from the API server
+	// that the handlers of an informer have yet to see.
+	informerQueueDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "informer_queue_depth",
+			Help:      "Number of objects received from the API server and not handled yet, by informer.",
+		},
+		[]string{"informer"},
+	)
+
+	// informerLastEvent is the time of the last event an informer handled.
+	informerLastEvent = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "informer_last_event_timestamp_seconds",
+			Help:      "Time of the last event handled by an informer, as a Unix timestamp.",
+		},
+		[]string{"informer"},
+	)
+)
+
+// instrumentInformer exports the events of informer under name, tracks its
+// watch in watches, and sets its transform, which has to happen before it
+// starts. Informers don't expose their
+// queue: objects are counted in when transformed, as they are queued, and out
+// when the metrics handler receives them. The deletions the informer makes up
+// after a relist skip the transform, and are not counted out either.
+func instrumentInformer(informer cache.SharedIndexInformer, name string, transform cache.TransformFunc, watches *watchHealth) error {
+	var (
+		added     = informerEvents.WithLabelValues(name, "add")
+		updated   = informerEvents.WithLabelValues(name, "update")
+		deleted   = informerEvents.WithLabelValues(name, "delete")
+		depth     = informerQueueDepth.WithLabelValues(name)
+		lastEvent = informerLastEvent.WithLabelValues(name)
+	)
+
+	if err := watches.track(informer, name); err != nil {
+		return err
+	}
+
+	err := informer.SetTransform(func(obj any) (any, error) {
+		depth.Inc()
+
+		if transform == nil {
+			return obj, nil
+		}
+
+		return transform(obj)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(any) {
+			added.Inc()
+			depth.Dec()
+			lastEvent.SetToCurrentTime()
+		},
+		UpdateFunc: func(_, _ any) {
+			updated.Inc()
+			depth.Dec()
+			lastEvent.SetToCurrentTime()
+		},
+		DeleteFunc: func(obj any) {
+			deleted.Inc()
+			lastEvent.SetToCurrentTime()
+
+			if _, ok := obj.(cache.DeletedFinalStateUnknown); !ok {
+				depth.Dec()
+			}
+		},
+	})
+
+	return err
+}
@@ -0,0 +1,75 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInformerMetrics(t *testing.T) {
+	cl := newCluster(1, 3, 1)
+	client := fake.NewClientset(cl.objects()...)
+
+	set, err := newInformerSet(client, apiConfig{})
+	if err != nil {
+		t.Fatalf("failed to create informers: %v", err)
+	}
+
+	// The metrics are process-wide, other tests feed them too.
+	events := func(event string) float64 {
+		return testutil.ToFloat64(informerEvents.WithLabelValues("pods", event))
+	}
+
+	added, updated, deleted := events("add"), events("update"), events("delete")
+
+	set.start()
+	t.Cleanup(set.release)
+
+	waitFor(t, "initial list", func() bool { return set.synced() && events("add") == added+3 })
+
+	ctx := context.Background()
+
+	pod := cl.pods[0].DeepCopy()
+	pod.Status.PodIPs = []v1.PodIP{{IP: "10.1.0.1"}}
+
+	if _, err := client.CoreV1().Pods(pod.Namespace).UpdateStatus(ctx, pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update pod: %v", err)
+	}
+
+	if err := client.CoreV1().Pods(pod.Namespace).Delete(ctx, cl.pods[1].Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to delete pod: %v", err)
+	}
+
+	waitFor(t, "watch events", func() bool {
+		return events("update") == updated+1 && events("delete") == deleted+1
+	})
+
+	if depth := testutil.ToFloat64(informerQueueDepth.WithLabelValues("pods")); depth != 0 {
+		t.Errorf("got queue depth %v once handled, want 0", depth)
+	}
+
+	if last := testutil.ToFloat64(informerLastEvent.WithLabelValues("pods")); time.Since(time.Unix(int64(last), 0)) > time.Minute {
+		t.Errorf("got last event at %v, want a recent time", time.Unix(int64(last), 0))
+	}
+}
+
+func waitFor(tb testing.TB, what string, cond func() bool) {
+	tb.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			tb.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,483 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	clientfeatures "k8s.io/client-go/features"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// informerSets holds the informers shared by the controllers of the process.
+// The capsule block may appear in several server blocks, each with its own
+// configuration, but all of them classify IPs from the same pods, services and
+// namespaces, so they watch the API server and keep the caches only once per
+// API connection.
+var informerSets = struct {
+	sync.Mutex
+	byAPI map[apiConfig]*informerSet
+}{byAPI: map[apiConfig]*informerSet{}}
+
+// apiConfig is how the controller reaches the API server, the in-cluster
+// configuration when empty.
+type apiConfig struct {
+	endpoint  string
+	certFile  string
+	keyFile   string
+	caFile    string
+	tokenFile string
+	// pageSize splits the initial lists in pages, zero lists at once.
+	pageSize int64
+	// withoutPods and withoutServices leave out the pod and service
+	// informers, and the attribution of their IPs.
+	withoutPods     bool
+	withoutServices bool
+	// resyncPeriod is how often the caches are checked against a fresh
+	// list, zero never checks them.
+	resyncPeriod time.Duration
+}
+
+// restConfig builds the client configuration. Without endpoint, the in-cluster
+// configuration is used and tls and token_file override its credentials.
+func (a apiConfig) restConfig() (*rest.Config, error) {
+	var config *rest.Config
+
+	if a.endpoint != "" {
+		config = &rest.Config{Host: a.endpoint}
+	} else {
+		var err error
+
+		config, err = rest.InClusterConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if a.certFile != "" {
+		config.TLSClientConfig = rest.TLSClientConfig{
+			CertFile: a.certFile,
+			KeyFile:  a.keyFile,
+			CAFile:   a.caFile,
+		}
+	}
+
+	if a.tokenFile != "" {
+		config.BearerToken = ""
+		config.BearerTokenFile = a.tokenFile
+	}
+
+	return config, nil
+}
+
+// informerSet is a reference counted set of informers built from one client.
+type informerSet struct {
+	client  kubernetes.Interface
+	factory informers.SharedInformerFactory
+	// pods and services are nil when disabled.
+	pods       cache.SharedIndexInformer
+	services   cache.SharedIndexInformer
+	namespaces cache.SharedIndexInformer
+	ips        *ipTable
+	watches    *watchHealth
+	// pageSize and resyncPeriod are those of the api the set was built for.
+	pageSize     int64
+	resyncPeriod time.Duration
+	// dynamic watches the custom resources, it is nil for informer sets
+	// built without a dynamic client.
+	dynamic dynamicinformer.DynamicSharedInformerFactory
+	// customMu guards the informers created on demand.
+	customMu sync.Mutex
+	netpols  cache.SharedIndexInformer
+	ingress  cache.SharedIndexInformer
+	custom   map[schema.GroupVersionResource]cache.SharedIndexInformer
+	// externals are the CIDRs of the ExternalWorkloads, nil until a
+	// controller enables external_workloads.
+	externals *externalTable
+	stopCh    chan struct{}
+	// snapshotMu guards started and snapshots, the cache snapshot files
+	// in use.
+	snapshotMu sync.Mutex
+	started    bool
+	snapshots  map[string]bool
+	// warm reports whether the caches were loaded from a snapshot.
+	warm atomic.Bool
+	// api and refs are guarded by informerSets.
+	api  apiConfig
+	refs int
+}
+
+// acquireInformerSet returns the process-wide informer set of api, creating it
+// on first use. Every call must be balanced by a release.
+func acquireInformerSet(api apiConfig) (*informerSet, error) {
+	informerSets.Lock()
+	defer informerSets.Unlock()
+
+	if s, ok := informerSets.byAPI[api]; ok {
+		s.refs++
+
+		return s, nil
+	}
+
+	config, err := api.restConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Protobuf decodes the built-in types with far less memory than JSON,
+	// custom resources are only served as JSON.
+	protoConfig := rest.CopyConfig(config)
+	protoConfig.ContentType = runtime.ContentTypeProtobuf
+	protoConfig.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+
+	clientset, err := kubernetes.NewForConfig(protoConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []informers.SharedInformerOption
+	if api.pageSize > 0 {
+		opts = append(opts, paginate(api.pageSize))
+	}
+
+	if clientfeatures.FeatureGates().Enabled(clientfeatures.WatchListClient) {
+		log.Infof("Streaming the initial lists of the informers")
+	}
+
+	s, err := newInformerSet(clientset, api, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.dynamic = dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
+	s.api = api
+	informerSets.byAPI[api] = s
+
+	return s, nil
+}
+
+// newInformerSet builds an informer set holding a single reference, with the
+// informers api enables.
+func newInformerSet(clientset kubernetes.Interface, api apiConfig, opts ...informers.SharedInformerOption) (*informerSet, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, opts...)
+	ips := newIPTable()
+	watches := newWatchHealth()
+
+	var podInformer, svcInformer cache.SharedIndexInformer
+
+	if !api.withoutPods {
+		podInformer = factory.Core().V1().Pods().Informer()
+
+		err := instrumentInformer(podInformer, "pods", slimPod, watches)
+		if err != nil {
+			return nil, err
+		}
+
+		err = podInformer.AddIndexers(cache.Indexers{PodIPIndex: podIPs})
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ips.watch(podInformer, podIPs); err != nil {
+			return nil, err
+		}
+	}
+
+	if !api.withoutServices {
+		svcInformer = factory.Core().V1().Services().Informer()
+
+		err := instrumentInformer(svcInformer, "services", nil, watches)
+		if err != nil {
+			return nil, err
+		}
+
+		err = svcInformer.AddIndexers(cache.Indexers{SvcClusterIPIndex: serviceIPs})
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ips.watch(svcInformer, serviceIPs); err != nil {
+			return nil, err
+		}
+	}
+
+	nsInformer := factory.Core().V1().Namespaces().Informer()
+
+	err := instrumentInformer(nsInformer, "namespaces", nil, watches)
+	if err != nil {
+		return nil, err
+	}
+
+	err = nsInformer.AddIndexers(cache.Indexers{
+		NsIndex: func(obj any) ([]string, error) {
+			//nolint:forcetypeassert
+			ns := obj.(*v1.Namespace)
+			if ns.Name == "" {
+				return []string{}, nil
+			}
+
+			return []string{ns.Name}, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &informerSet{
+		client:       clientset,
+		factory:      factory,
+		pods:         podInformer,
+		services:     svcInformer,
+		namespaces:   nsInformer,
+		ips:          ips,
+		watches:      watches,
+		pageSize:     api.pageSize,
+		resyncPeriod: api.resyncPeriod,
+		stopCh:       make(chan struct{}),
+		refs:         1,
+	}, nil
+}
+
+// paginate has the informers list size objects per request. The API server
+// serves lists at resource version "0" from its watch cache in a single
+// response whatever the limit, these are turned into consistent reads, which
+// it pages.
+func paginate(size int64) informers.SharedInformerOption {
+	return informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		// Watches, and the relists the reflector wants from the watch
+		// cache, come without a limit.
+		if options.Limit == 0 {
+			return
+		}
+
+		if options.ResourceVersion == "0" {
+			options.ResourceVersion = ""
+		}
+
+		options.Limit = size
+	})
+}
+
+// podIPs indexes a pod by its IPs.
+func podIPs(obj any) ([]string, error) {
+	//nolint:forcetypeassert
+	pod := obj.(*v1.Pod)
+
+	ips := make([]string, 0, len(pod.Status.PodIPs))
+	for _, podIP := range pod.Status.PodIPs {
+		ips = append(ips, normalizeIP(podIP.IP))
+	}
+
+	return ips, nil
+}
+
+// serviceIPs indexes a service by its cluster IPs.
+func serviceIPs(obj any) ([]string, error) {
+	//nolint:forcetypeassert
+	svc := obj.(*v1.Service)
+
+	ips := make([]string, 0, len(svc.Spec.ClusterIPs))
+	for _, clusterIP := range svc.Spec.ClusterIPs {
+		ips = append(ips, normalizeIP(clusterIP))
+	}
+
+	return ips, nil
+}
+
+// networkPolicies returns the NetworkPolicy informer, which is only created
+// once a controller enables networkpolicies.
+func (s *informerSet) networkPolicies() (cache.SharedIndexInformer, error) {
+	s.customMu.Lock()
+	defer s.customMu.Unlock()
+
+	if s.netpols != nil {
+		return s.netpols, nil
+	}
+
+	informer := s.factory.Networking().V1().NetworkPolicies().Informer()
+
+	if err := instrumentInformer(informer, "networkpolicies", compileNetworkPolicy, s.watches); err != nil {
+		return nil, err
+	}
+
+	s.netpols = informer
+
+	return informer, nil
+}
+
+// ingresses returns the Ingress informer, which is only created once a
+// controller enables ingresses.
+func (s *informerSet) ingresses() (cache.SharedIndexInformer, error) {
+	s.customMu.Lock()
+	defer s.customMu.Unlock()
+
+	if s.ingress != nil {
+		return s.ingress, nil
+	}
+
+	informer := s.factory.Networking().V1().Ingresses().Informer()
+
+	if err := instrumentInformer(informer, "ingresses", slimIngress, s.watches); err != nil {
+		return nil, err
+	}
+
+	if err := informer.AddIndexers(cache.Indexers{IngressHostIndex: ingressHosts}); err != nil {
+		return nil, err
+	}
+
+	s.ingress = informer
+
+	return informer, nil
+}
+
+// accessRequests returns the DNSAccessRequest informer, which is only created
+// once a controller enables access_requests.
+func (s *informerSet) accessRequests() (cache.SharedIndexInformer, error) {
+	return s.customInformer(accessRequestResource, slimAccessRequest, cache.Indexers{
+		AccessRequestTargetIndex: accessRequestTarget,
+	})
+}
+
+// externalWorkloads returns the ExternalWorkload informer and the table of
+// their CIDRs it keeps up to date, which are only created once a controller
+// enables external_workloads.
+func (s *informerSet) externalWorkloads() (cache.SharedIndexInformer, *externalTable, error) {
+	informer, err := s.customInformer(externalWorkloadResource, slimExternalWorkload, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.customMu.Lock()
+	defer s.customMu.Unlock()
+
+	if s.externals == nil {
+		externals := &externalTable{}
+		if _, err := informer.AddEventHandler(externals.handler(informer)); err != nil {
+			return nil, nil, err
+		}
+
+		s.externals = externals
+	}
+
+	return informer, s.externals, nil
+}
+
+// tenants returns the Tenant informer, which is only created once a controller
+// enables withhold_namespaces.
+func (s *informerSet) tenants() (cache.SharedIndexInformer, error) {
+	return s.customInformer(tenantsResource, slimTenant, cache.Indexers{
+		TenantNamespaceIndex: tenantNamespaces,
+	})
+}
+
+// configs returns the CapsuleCoreDNSConfig informer, which is only created once
+// a controller enables config_resource.
+func (s *informerSet) configs() (cache.SharedIndexInformer, error) {
+	return s.customInformer(configResource, nil, nil)
+}
+
+// tenantResources returns the GlobalTenantResource and TenantResource
+// informers, which are only created once a controller enables
+// tenant_resources.
+func (s *informerSet) tenantResources() ([]cache.SharedIndexInformer, error) {
+	informers := make([]cache.SharedIndexInformer, 0, 2)
+
+	for _, gvr := range []schema.GroupVersionResource{globalTenantResourceResource, tenantResourceResource} {
+		informer, err := s.customInformer(gvr, slimTenantResource, cache.Indexers{
+			TenantResourceSourceIndex: tenantResourceSources,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		informers = append(informers, informer)
+	}
+
+	return informers, nil
+}
+
+// customInformer returns the informer of the custom resource gvr, setting its
+// transform and indexers when first requested.
+func (s *informerSet) customInformer(gvr schema.GroupVersionResource, transform cache.TransformFunc, indexers cache.Indexers) (cache.SharedIndexInformer, error) {
+	s.customMu.Lock()
+	defer s.customMu.Unlock()
+
+	if informer, ok := s.custom[gvr]; ok {
+		return informer, nil
+	}
+
+	if s.dynamic == nil {
+		return nil, fmt.Errorf("no dynamic client to watch %s", gvr.GroupResource())
+	}
+
+	informer := s.dynamic.ForResource(gvr).Informer()
+
+	if err := instrumentInformer(informer, gvr.Resource, transform, s.watches); err != nil {
+		return nil, err
+	}
+
+	if err := informer.AddIndexers(indexers); err != nil {
+		return nil, err
+	}
+
+	if s.custom == nil {
+		s.custom = map[schema.GroupVersionResource]cache.SharedIndexInformer{}
+	}
+
+	s.custom[gvr] = informer
+
+	return informer, nil
+}
+
+// start runs the informers that are not running yet.
+func (s *informerSet) start() {
+	s.snapshotMu.Lock()
+	first := !s.started
+	s.started = true
+	s.snapshotMu.Unlock()
+
+	s.factory.Start(s.stopCh)
+
+	if s.dynamic != nil {
+		s.dynamic.Start(s.stopCh)
+	}
+
+	if first && s.resyncPeriod > 0 {
+		go s.resyncs(s.resyncPeriod)
+	}
+}
+
+// release drops a reference to s and stops the informers once unused.
+func (s *informerSet) release() {
+	informerSets.Lock()
+	defer informerSets.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return
+	}
+
+	if informerSets.byAPI[s.api] == s {
+		delete(informerSets.byAPI, s.api)
+	}
+
+	close(s.stopCh)
+}
@@ -0,0 +1,243 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestInformerSetShared(t *testing.T) {
+	set, err := newInformerSet(fake.NewClientset(newCluster(2, 2, 1).objects()...), apiConfig{})
+	if err != nil {
+		t.Fatalf("failed to create informer set: %v", err)
+	}
+
+	// One reference per server block.
+	set.refs = 2
+
+	plain, err := newDNSControllerForSet(set, dnsControllerOptions{})
+	if err != nil {
+		t.Fatalf("failed to create controller: %v", err)
+	}
+
+	policies, err := newDNSControllerForSet(set, dnsControllerOptions{networkPolicies: true, reuseGrace: time.Second})
+	if err != nil {
+		t.Fatalf("failed to create controller: %v", err)
+	}
+
+	go plain.Start()
+	go policies.Start()
+
+	waitForSync(t, plain)
+	waitForSync(t, policies)
+
+	if plain.podInformer != policies.podInformer || plain.nsInformer != policies.nsInformer {
+		t.Fatal("expected both controllers to share their informers")
+	}
+
+	if plain.netpolInformer != nil || policies.netpolInformer == nil {
+		t.Fatal("expected only the networkpolicies controller to watch NetworkPolicies")
+	}
+
+	policies.Stop()
+
+	select {
+	case <-set.stopCh:
+		t.Fatal("informers stopped while still in use")
+	default:
+	}
+
+	plain.Stop()
+
+	select {
+	case <-set.stopCh:
+	default:
+		t.Fatal("expected the informers to be stopped once unused")
+	}
+}
+
+func TestAPIConfig(t *testing.T) {
+	config, err := apiConfig{
+		endpoint:  "https://capsule-proxy.capsule-system:9001",
+		certFile:  "/etc/coredns/api/tls.crt",
+		keyFile:   "/etc/coredns/api/tls.key",
+		caFile:    "/etc/coredns/api/ca.crt",
+		tokenFile: "/etc/coredns/api/token",
+	}.restConfig()
+	if err != nil {
+		t.Fatalf("restConfig failed: %v", err)
+	}
+
+	if config.Host != "https://capsule-proxy.capsule-system:9001" {
+		t.Errorf("got host %q", config.Host)
+	}
+
+	if config.CertFile != "/etc/coredns/api/tls.crt" || config.KeyFile != "/etc/coredns/api/tls.key" || config.CAFile != "/etc/coredns/api/ca.crt" {
+		t.Errorf("got TLS configuration %+v", config.TLSClientConfig)
+	}
+
+	if config.BearerTokenFile != "/etc/coredns/api/token" {
+		t.Errorf("got token file %q, want /etc/coredns/api/token", config.BearerTokenFile)
+	}
+
+	// Outside of a cluster, credentials alone are not enough to reach it.
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+	if _, err := (apiConfig{tokenFile: "/etc/coredns/api/token"}).restConfig(); err == nil {
+		t.Error("expected an error without endpoint outside of a cluster")
+	}
+}
+
+func TestInformerSetPaginated(t *testing.T) {
+	client := fake.NewClientset(newCluster(2, 2, 1).objects()...)
+
+	var (
+		mu    sync.Mutex
+		lists []metav1.ListOptions
+	)
+
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		//nolint:forcetypeassert
+		lists = append(lists, action.(k8stesting.ListActionImpl).ListOptions)
+
+		return false, nil, nil
+	})
+
+	set, err := newInformerSet(client, apiConfig{}, paginate(100))
+	if err != nil {
+		t.Fatalf("failed to create informer set: %v", err)
+	}
+
+	ctrl, err := newDNSControllerForSet(set, dnsControllerOptions{})
+	if err != nil {
+		t.Fatalf("failed to create controller: %v", err)
+	}
+
+	go ctrl.Start()
+	t.Cleanup(ctrl.Stop)
+
+	waitForSync(t, ctrl)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(lists) == 0 {
+		t.Fatal("expected pods to be listed")
+	}
+
+	if lists[0].Limit != 100 || lists[0].ResourceVersion != "" {
+		t.Errorf("got limit=%d resourceVersion=%q, want limit=100 and a consistent read", lists[0].Limit, lists[0].ResourceVersion)
+	}
+}
+
+func TestParseInformers(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		wantPods     bool
+		wantServices bool
+		wantErr      bool
+	}{
+		{name: "default", input: "capsule {\nnetworkpolicies\n}", wantPods: true, wantServices: true},
+		{name: "services only", input: "capsule {\ninformers services namespaces\n}", wantServices: true},
+		{name: "pods only", input: "capsule {\ninformers namespaces pods\n}", wantPods: true},
+		{name: "missing list", input: "capsule {\ninformers\n}", wantErr: true},
+		{name: "without namespaces", input: "capsule {\ninformers pods services\n}", wantErr: true},
+		{name: "unknown informer", input: "capsule {\ninformers namespaces nodes\n}", wantErr: true},
+		{name: "reuse grace without pods", input: "capsule {\ninformers namespaces services\nip_reuse_grace 30s\n}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !h.api.withoutPods != tt.wantPods || !h.api.withoutServices != tt.wantServices {
+				t.Errorf("got pods=%t services=%t, want pods=%t services=%t",
+					!h.api.withoutPods, !h.api.withoutServices, tt.wantPods, tt.wantServices)
+			}
+		})
+	}
+}
+
+func TestInformersDisabled(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	h := Capsule{}
+
+	tests := []struct {
+		name    string
+		api     apiConfig
+		src     string
+		dst     string
+		allowed bool
+		reason  string
+	}{
+		{
+			name: "without pods", api: apiConfig{withoutPods: true},
+			src: cl.pods[0].Status.PodIPs[0].IP, dst: cl.services[1].Spec.ClusterIP,
+			allowed: true, reason: reasonUnknownSource,
+		},
+		{
+			name: "without services", api: apiConfig{withoutServices: true},
+			src: cl.pods[0].Status.PodIPs[0].IP, dst: cl.services[1].Spec.ClusterIP,
+			allowed: true, reason: reasonUnknownDestination,
+		},
+		{
+			name: "pods to pods without services", api: apiConfig{withoutServices: true},
+			src: cl.pods[0].Status.PodIPs[0].IP, dst: cl.pods[1].Status.PodIPs[0].IP,
+			reason: reasonCrossTenant,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl, err := newDNSControllerForClient(fake.NewClientset(cl.objects()...), dnsControllerOptions{api: tt.api})
+			if err != nil {
+				t.Fatalf("failed to create DNS controller: %v", err)
+			}
+
+			go ctrl.Start()
+			t.Cleanup(ctrl.Stop)
+
+			waitForSync(t, ctrl)
+
+			if (ctrl.informers.pods == nil) != tt.api.withoutPods || (ctrl.informers.services == nil) != tt.api.withoutServices {
+				t.Fatalf("got pods=%t services=%t informers", ctrl.informers.pods != nil, ctrl.informers.services != nil)
+			}
+
+			d := ctrl.Evaluate(t.Context(), tt.src, tt.dst, h)
+			if d.allowed != tt.allowed || d.reason != tt.reason {
+				t.Errorf("got allowed=%t reason=%s, want allowed=%t reason=%s", d.allowed, d.reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IngressHostIndex indexes Ingresses by the hosts of their rules.
+const IngressHostIndex = "host"
+
+// slimIngress drops everything but the hosts of the rules of an Ingress and
+// the addresses it is published at.
+func slimIngress(obj any) (any, error) {
+	ing, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return obj, nil
+	}
+
+	rules := make([]networkingv1.IngressRule, 0, len(ing.Spec.Rules))
+	for _, rule := range ing.Spec.Rules {
+		if rule.Host != "" {
+			rules = append(rules, networkingv1.IngressRule{Host: rule.Host})
+		}
+	}
+
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            ing.Name,
+			Namespace:       ing.Namespace,
+			UID:             ing.UID,
+			ResourceVersion: ing.ResourceVersion,
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: rules,
+		},
+		Status: ing.Status,
+	}, nil
+}
+
+// ingressHosts indexes an Ingress by the hosts of its rules, wildcards
+// included as such.
+func ingressHosts(obj any) ([]string, error) {
+	ing, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return []string{}, nil
+	}
+
+	hosts := make([]string, 0, len(ing.Spec.Rules))
+	for _, rule := range ing.Spec.Rules {
+		if rule.Host != "" {
+			hosts = append(hosts, strings.ToLower(rule.Host))
+		}
+	}
+
+	return hosts, nil
+}
+
+// ingressPublishes reports whether an Ingress with a rule for qname is
+// published at ip. A wildcard host matches a single label, as Ingresses do.
+func (c *dnsController) ingressPublishes(qname, ip string) bool {
+	if c.ingressInformer == nil {
+		return false
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(qname, "."))
+	ip = normalizeIP(ip)
+
+	hosts := []string{host}
+	if _, parent, ok := strings.Cut(host, "."); ok {
+		hosts = append(hosts, "*."+parent)
+	}
+
+	for _, host := range hosts {
+		ingresses, err := c.ingressInformer.GetIndexer().ByIndex(IngressHostIndex, host)
+		if err != nil {
+			continue
+		}
+
+		for _, obj := range ingresses {
+			ing, ok := obj.(*networkingv1.Ingress)
+			if !ok {
+				continue
+			}
+
+			for _, lb := range ing.Status.LoadBalancer.Ingress {
+				if lb.IP != "" && normalizeIP(lb.IP) == ip {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
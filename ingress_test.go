@@ -0,0 +1,95 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMiddlewareIngress(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+
+	// tenant-1 runs its own ingress controller behind svc-0.
+	controllerIP := cl.services[1].Spec.ClusterIP
+
+	ing := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: cl.namespaces[1].Name},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{Host: "App.example.com"}, {Host: "*.apps.example.com"}},
+		},
+		Status: networkingv1.IngressStatus{
+			LoadBalancer: networkingv1.IngressLoadBalancerStatus{
+				Ingress: []networkingv1.IngressLoadBalancerIngress{{IP: controllerIP}},
+			},
+		},
+	}
+
+	ctrl, err := newDNSControllerForClient(fake.NewClientset(append(cl.objects(), ing)...), dnsControllerOptions{ingresses: true})
+	if err != nil {
+		t.Fatalf("failed to create DNS controller: %v", err)
+	}
+
+	go ctrl.Start()
+	t.Cleanup(ctrl.Stop)
+
+	waitForSync(t, ctrl)
+
+	// The wrapped server answers every A question with the address of the
+	// ingress controller.
+	next := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 30},
+			A:   net.ParseIP(controllerIP),
+		})
+
+		_ = w.WriteMsg(m)
+	})
+
+	mw, err := NewMiddleware("ingresses", next)
+	if err != nil {
+		t.Fatalf("failed to create middleware: %v", err)
+	}
+
+	mw.capsule.dnsController = ctrl
+
+	tests := []struct {
+		qname   string
+		allowed bool
+	}{
+		{qname: "app.example.com.", allowed: true},
+		{qname: "shop.apps.example.com.", allowed: true},
+		{qname: "a.shop.apps.example.com."},
+		{qname: "svc-0.tenant-1.gateway.example."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.qname, func(t *testing.T) {
+			mw.capsule.counters = &decisionCounters{}
+
+			m := new(dns.Msg)
+			m.SetQuestion(tt.qname, dns.TypeA)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: cl.pods[0].Status.PodIPs[0].IP})
+			mw.ServeDNS(rec, m)
+
+			if rec.Msg == nil {
+				t.Fatal("no answer written")
+			}
+
+			if allowed := len(rec.Msg.Answer) > 0; allowed != tt.allowed {
+				t.Errorf("got allowed %t, want %t", allowed, tt.allowed)
+			}
+		})
+	}
+}
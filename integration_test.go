@@ -0,0 +1,237 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build integration
+
+package capsule_coredns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// startAPIServer runs an etcd and kube-apiserver from KUBEBUILDER_ASSETS for
+// the duration of the test.
+func startAPIServer(t *testing.T) kubernetes.Interface {
+	t.Helper()
+
+	env := &envtest.Environment{}
+
+	cfg, err := env.Start()
+	if err != nil {
+		t.Fatalf("failed to start the API server, is KUBEBUILDER_ASSETS set? %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := env.Stop(); err != nil {
+			t.Errorf("failed to stop the API server: %v", err)
+		}
+	})
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		t.Fatalf("failed to create clientset: %v", err)
+	}
+
+	return clientset
+}
+
+// integrationCluster holds a tenant namespace per entry of tenants, each with
+// one running pod and one service.
+type integrationCluster struct {
+	clientset kubernetes.Interface
+	podIPs    map[string]string
+	svcIPs    map[string]string
+}
+
+func newIntegrationCluster(t *testing.T, clientset kubernetes.Interface, tenants ...string) *integrationCluster {
+	t.Helper()
+
+	ctx := context.Background()
+	ic := &integrationCluster{
+		clientset: clientset,
+		podIPs:    map[string]string{},
+		svcIPs:    map[string]string{},
+	}
+
+	for i, tenant := range tenants {
+		ns := &v1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   tenant,
+				Labels: map[string]string{CapsuleTenantLabel: tenant},
+			},
+		}
+		if _, err := clientset.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("failed to create namespace %s: %v", tenant, err)
+		}
+
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "client", Namespace: tenant},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{{Name: "busybox", Image: "busybox"}},
+			},
+		}
+
+		pod, err := clientset.CoreV1().Pods(tenant).Create(ctx, pod, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("failed to create pod in %s: %v", tenant, err)
+		}
+
+		// There is no kubelet, report the pod as running ourselves.
+		ic.podIPs[tenant] = ipv4(10, i+1)
+		pod.Status = v1.PodStatus{
+			Phase:  v1.PodRunning,
+			PodIP:  ic.podIPs[tenant],
+			PodIPs: []v1.PodIP{{IP: ic.podIPs[tenant]}},
+		}
+
+		if _, err := clientset.CoreV1().Pods(tenant).UpdateStatus(ctx, pod, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("failed to update pod status in %s: %v", tenant, err)
+		}
+
+		svc := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "backend", Namespace: tenant},
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{{Name: "http", Protocol: v1.ProtocolTCP, Port: 80}},
+			},
+		}
+
+		svc, err = clientset.CoreV1().Services(tenant).Create(ctx, svc, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("failed to create service in %s: %v", tenant, err)
+		}
+
+		ic.svcIPs[tenant] = svc.Spec.ClusterIP
+	}
+
+	return ic
+}
+
+func startIntegrationController(t *testing.T, clientset kubernetes.Interface) *dnsController {
+	t.Helper()
+
+	ctrl, err := newDNSControllerForClient(clientset, dnsControllerOptions{})
+	if err != nil {
+		t.Fatalf("failed to create DNS controller: %v", err)
+	}
+
+	go ctrl.Start()
+	t.Cleanup(ctrl.Stop)
+
+	waitForSync(t, ctrl)
+
+	return ctrl
+}
+
+// eventually polls cond until it holds, the informers apply changes
+// asynchronously.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestIntegrationIndexes(t *testing.T) {
+	clientset := startAPIServer(t)
+	ic := newIntegrationCluster(t, clientset, "tenant-a", "tenant-b")
+	ctrl := startIntegrationController(t, clientset)
+
+	for tenant := range ic.podIPs {
+		for _, ip := range []string{ic.podIPs[tenant], ic.svcIPs[tenant]} {
+			ns, _, _, err := ctrl.getObjectByIP(t.Context(), ip)
+			if err != nil {
+				t.Fatalf("getObjectByIP(%s) failed: %v", ip, err)
+			}
+
+			if ns == nil || ns.Name != tenant {
+				t.Errorf("getObjectByIP(%s) = %v, want namespace %s", ip, ns, tenant)
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		allowed bool
+	}{
+		{name: "pod to service of the same tenant", from: ic.podIPs["tenant-a"], to: ic.svcIPs["tenant-a"], allowed: true},
+		{name: "pod to pod of the same tenant", from: ic.podIPs["tenant-b"], to: ic.podIPs["tenant-b"], allowed: true},
+		{name: "pod to service of another tenant", from: ic.podIPs["tenant-a"], to: ic.svcIPs["tenant-b"]},
+		{name: "pod to pod of another tenant", from: ic.podIPs["tenant-b"], to: ic.podIPs["tenant-a"]},
+		{name: "unknown source", from: "192.0.2.1", to: ic.svcIPs["tenant-b"], allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ctrl.TenantAuthorized(tt.from, tt.to, Capsule{}); got != tt.allowed {
+				t.Errorf("TenantAuthorized(%s, %s) = %t, want %t", tt.from, tt.to, got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestIntegrationPropagation(t *testing.T) {
+	ctx := context.Background()
+	clientset := startAPIServer(t)
+	ic := newIntegrationCluster(t, clientset, "tenant-a", "tenant-b")
+	ctrl := startIntegrationController(t, clientset)
+
+	from, to := ic.podIPs["tenant-a"], ic.svcIPs["tenant-b"]
+	if ctrl.TenantAuthorized(from, to, Capsule{}) {
+		t.Fatalf("expected %s to be denied %s before relabelling", from, to)
+	}
+
+	patch := []byte(`{"metadata":{"labels":{"` + CapsuleTenantLabel + `":"tenant-a"}}}`)
+	if _, err := clientset.CoreV1().Namespaces().Patch(ctx, "tenant-b", types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		t.Fatalf("failed to relabel tenant-b: %v", err)
+	}
+
+	eventually(t, "the tenant label change to allow the query", func() bool {
+		return ctrl.TenantAuthorized(from, to, Capsule{})
+	})
+
+	patch = []byte(`{"metadata":{"labels":{"` + CapsuleTenantLabel + `":"tenant-c"}}}`)
+	if _, err := clientset.CoreV1().Namespaces().Patch(ctx, "tenant-b", types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		t.Fatalf("failed to relabel tenant-b: %v", err)
+	}
+
+	eventually(t, "the tenant label change to deny the query", func() bool {
+		return !ctrl.TenantAuthorized(from, to, Capsule{})
+	})
+
+	patch = []byte(`{"metadata":{"labels":{"` + CapsuleTenantLabel + `":null}}}`)
+	if _, err := clientset.CoreV1().Namespaces().Patch(ctx, "tenant-a", types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		t.Fatalf("failed to unlabel tenant-a: %v", err)
+	}
+
+	eventually(t, "the non-tenant source to be allowed", func() bool {
+		d := ctrl.Evaluate(t.Context(), from, to, Capsule{})
+
+		return d.allowed && d.reason == reasonNonTenantSource
+	})
+
+	if err := clientset.CoreV1().Pods("tenant-a").Delete(ctx, "client", metav1.DeleteOptions{GracePeriodSeconds: new(int64)}); err != nil {
+		t.Fatalf("failed to delete pod: %v", err)
+	}
+
+	eventually(t, "the deleted pod IP to be released", func() bool {
+		ns, _, _, _ := ctrl.getObjectByIP(t.Context(), from)
+
+		return ns == nil
+	})
+}
@@ -0,0 +1,114 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ipClaim records which pod last claimed an IP and when the IP last changed
+// hands.
+type ipClaim struct {
+	uid       types.UID
+	changedAt time.Time
+}
+
+// ipClaims follows pod events to detect IPs reassigned from one pod to
+// another. Until the informer processes the deletion of the previous owner both
+// pods are indexed under the same IP, which is what the grace period covers.
+type ipClaims struct {
+	mu     sync.Mutex
+	grace  time.Duration
+	claims map[string]ipClaim
+}
+
+func newIPClaims(grace time.Duration) *ipClaims {
+	return &ipClaims{
+		grace:  grace,
+		claims: map[string]ipClaim{},
+	}
+}
+
+func (c *ipClaims) handler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: c.observe,
+		UpdateFunc: func(_, obj any) {
+			c.observe(obj)
+		},
+		DeleteFunc: c.forget,
+	}
+}
+
+func (c *ipClaims) observe(obj any) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || pod.Spec.HostNetwork || !running(pod) {
+		return
+	}
+
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, podIP := range pod.Status.PodIPs {
+		ip := normalizeIP(podIP.IP)
+
+		claim, found := c.claims[ip]
+		if found && claim.uid == pod.UID {
+			continue
+		}
+
+		claim = ipClaim{uid: pod.UID}
+		if found {
+			claim.changedAt = now
+		}
+
+		c.claims[ip] = claim
+	}
+}
+
+// forget drops the claims of a deleted pod, those another pod took over
+// aside.
+func (c *ipClaims) forget(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, podIP := range pod.Status.PodIPs {
+		ip := normalizeIP(podIP.IP)
+
+		if claim, found := c.claims[ip]; found && claim.uid == pod.UID {
+			delete(c.claims, ip)
+		}
+	}
+}
+
+// reassigned reports whether ip changed hands within the grace period.
+func (c *ipClaims) reassigned(ip string) bool {
+	c.mu.Lock()
+	claim, found := c.claims[ip]
+	c.mu.Unlock()
+
+	return found && !claim.changedAt.IsZero() && time.Since(claim.changedAt) <= c.grace
+}
+
+// running reports whether pod still owns its IPs.
+func running(pod *v1.Pod) bool {
+	return pod.DeletionTimestamp == nil &&
+		pod.Status.Phase != v1.PodSucceeded &&
+		pod.Status.Phase != v1.PodFailed
+}
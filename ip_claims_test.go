@@ -0,0 +1,79 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+func claimingPod(uid, ip string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: uid, Namespace: "team-a", UID: types.UID(uid)},
+		Status:     v1.PodStatus{Phase: v1.PodRunning, PodIPs: []v1.PodIP{{IP: ip}}},
+	}
+}
+
+func TestIPClaimsReassigned(t *testing.T) {
+	const ip = "10.0.0.1"
+
+	c := newIPClaims(time.Minute)
+	h := c.handler()
+
+	h.OnAdd(claimingPod("old", ip), true)
+
+	if c.reassigned(ip) {
+		t.Error("got the first claim reassigned")
+	}
+
+	h.OnUpdate(nil, claimingPod("old", ip))
+
+	if c.reassigned(ip) {
+		t.Error("got a claim reassigned by an update of its own pod")
+	}
+
+	h.OnAdd(claimingPod("new", ip), false)
+
+	if !c.reassigned(ip) {
+		t.Error("got no reassignment within the grace period")
+	}
+
+	c.mu.Lock()
+	claim := c.claims[ip]
+	claim.changedAt = time.Now().Add(-2 * time.Minute)
+	c.claims[ip] = claim
+	c.mu.Unlock()
+
+	if c.reassigned(ip) {
+		t.Error("got a reassignment past the grace period")
+	}
+}
+
+func TestIPClaimsForget(t *testing.T) {
+	c := newIPClaims(time.Minute)
+	h := c.handler()
+
+	h.OnAdd(claimingPod("old", "10.0.0.1"), true)
+	h.OnAdd(claimingPod("new", "10.0.0.1"), false)
+	h.OnAdd(claimingPod("other", "10.0.0.2"), false)
+
+	// The IP was taken over, the deletion of its previous owner keeps it.
+	h.OnDelete(claimingPod("old", "10.0.0.1"))
+
+	if !c.reassigned("10.0.0.1") {
+		t.Error("got the claim of the new owner dropped")
+	}
+
+	h.OnDelete(claimingPod("new", "10.0.0.1"))
+	h.OnDelete(cache.DeletedFinalStateUnknown{Key: "team-a/other", Obj: claimingPod("other", "10.0.0.2")})
+
+	if len(c.claims) != 0 {
+		t.Errorf("got claims %v left after the deletions", c.claims)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"hash/maphash"
+	"slices"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const ipTableShards = 64
+
+// ipTable maps IPs to the pods and services holding them for the query path,
+// kept up to date by the informer event handlers. Unlike the informer indexes,
+// which serialize every reader of a cache behind one lock and copy the matches,
+// lookups only lock one of many shards and return the stored slice: writers
+// replace the slice of an IP rather than modifying it.
+type ipTable struct {
+	seed          maphash.Seed
+	shards        [ipTableShards]ipShard
+	registrations []cache.ResourceEventHandlerRegistration
+}
+
+type ipShard struct {
+	sync.RWMutex
+	objs map[string][]any
+}
+
+func newIPTable() *ipTable {
+	t := &ipTable{seed: maphash.MakeSeed()}
+	for i := range t.shards {
+		t.shards[i].objs = map[string][]any{}
+	}
+
+	return t
+}
+
+// watch feeds the objects of informer to t, ips returning the IPs of an
+// object.
+func (t *ipTable) watch(informer cache.SharedIndexInformer, ips cache.IndexFunc) error {
+	registration, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			t.update(nil, obj, ips)
+		},
+		UpdateFunc: func(old, obj any) {
+			t.update(old, obj, ips)
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			t.update(obj, nil, ips)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	t.registrations = append(t.registrations, registration)
+
+	return nil
+}
+
+// HasSynced reports whether t holds the initial list of every informer it
+// watches.
+func (t *ipTable) HasSynced() bool {
+	for _, registration := range t.registrations {
+		if !registration.HasSynced() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lookup returns the objects holding ip. The slice must not be modified.
+func (t *ipTable) lookup(ip string) []any {
+	shard := t.shard(ip)
+
+	shard.RLock()
+	defer shard.RUnlock()
+
+	return shard.objs[ip]
+}
+
+func (t *ipTable) shard(ip string) *ipShard {
+	return &t.shards[maphash.String(t.seed, ip)%ipTableShards]
+}
+
+// update replaces old, nil for additions, by obj, nil for deletions.
+func (t *ipTable) update(old, obj any, ips cache.IndexFunc) {
+	var oldIPs, newIPs []string
+
+	if old != nil {
+		oldIPs, _ = ips(old)
+	}
+
+	if obj != nil {
+		newIPs, _ = ips(obj)
+	}
+
+	for _, ip := range oldIPs {
+		if !slices.Contains(newIPs, ip) {
+			t.set(ip, old, nil)
+		}
+	}
+
+	for _, ip := range newIPs {
+		t.set(ip, old, obj)
+	}
+}
+
+// set drops old and obj from the objects of ip, then adds obj unless nil.
+func (t *ipTable) set(ip string, old, obj any) {
+	shard := t.shard(ip)
+
+	shard.Lock()
+	defer shard.Unlock()
+
+	current := shard.objs[ip]
+
+	objs := make([]any, 0, len(current)+1)
+	for _, o := range current {
+		if !sameObject(o, old) && !sameObject(o, obj) {
+			objs = append(objs, o)
+		}
+	}
+
+	if obj != nil {
+		objs = append(objs, obj)
+	}
+
+	if len(objs) == 0 {
+		delete(shard.objs, ip)
+
+		return
+	}
+
+	shard.objs[ip] = objs
+}
+
+// sameObject reports whether a and b are versions of the same object.
+func sameObject(a, b any) bool {
+	if a == nil || b == nil || kindOf(a) != kindOf(b) {
+		return false
+	}
+
+	//nolint:forcetypeassert
+	metaA := a.(metav1.ObjectMetaAccessor).GetObjectMeta()
+	//nolint:forcetypeassert
+	metaB := b.(metav1.ObjectMetaAccessor).GetObjectMeta()
+
+	return metaA.GetNamespace() == metaB.GetNamespace() && metaA.GetName() == metaB.GetName()
+}
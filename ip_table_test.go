@@ -0,0 +1,63 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIPTable(t *testing.T) {
+	pod := func(name string, ips ...string) *v1.Pod {
+		p := &v1.Pod{ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "tenant-0"}}
+		for _, ip := range ips {
+			p.Status.PodIPs = append(p.Status.PodIPs, v1.PodIP{IP: ip})
+		}
+
+		return p
+	}
+
+	names := func(objs []any) []string {
+		var out []string
+		for _, obj := range objs {
+			out = append(out, obj.(*v1.Pod).Name)
+		}
+
+		return out
+	}
+
+	table := newIPTable()
+
+	table.update(nil, pod("a", "10.0.0.1", "fd00::1"), podIPs)
+	table.update(nil, pod("b", "10.0.0.1"), podIPs)
+
+	before := table.lookup("10.0.0.1")
+
+	// a moves from 10.0.0.1 to 10.0.0.2 and b is deleted.
+	table.update(pod("a", "10.0.0.1", "fd00::1"), pod("a", "10.0.0.2", "fd00::1"), podIPs)
+	table.update(pod("b", "10.0.0.1"), nil, podIPs)
+
+	tests := []struct {
+		ip   string
+		want []string
+	}{
+		{ip: "10.0.0.1"},
+		{ip: "10.0.0.2", want: []string{"a"}},
+		{ip: "fd00::1", want: []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		got := names(table.lookup(tt.ip))
+		if len(got) != len(tt.want) || len(got) > 0 && got[0] != tt.want[0] {
+			t.Errorf("lookup(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	// Readers keep what they looked up, writers replace the slices.
+	if got := names(before); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("earlier lookup changed to %v", got)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	v1 "k8s.io/api/core/v1"
+)
+
+// loadProfiles are the cluster sizes BenchmarkServeDNS reports on. The larger
+// profiles are skipped under -short.
+var loadProfiles = []struct {
+	name                    string
+	tenants, pods, services int
+	long                    bool
+}{
+	{name: "small", tenants: 10, pods: 100, services: 10},
+	{name: "medium", tenants: 50, pods: 200, services: 20},
+	{name: "large", tenants: 100, pods: 500, services: 50, long: true},
+}
+
+type loadQuery struct {
+	src string
+	msg *dns.Msg
+}
+
+// BenchmarkServeDNS drives A queries for random services from random pods
+// through the plugin chain, so half of the traffic is same-tenant and allowed
+// and the rest is cross-tenant and blocked. Besides ns/op it reports the p50
+// and p99 latency of a single ServeDNS call and the heap retained by the
+// informer caches. denied/op guards against the harness silently
+// measuring a passthrough path.
+func BenchmarkServeDNS(b *testing.B) {
+	for _, profile := range loadProfiles {
+		b.Run(profile.name, func(b *testing.B) {
+			if profile.long && testing.Short() {
+				b.Skip("skipping large profile in short mode")
+			}
+
+			cl := newCluster(profile.tenants, profile.pods, profile.services)
+
+			var before, after runtime.MemStats
+
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			h := newTestCapsule(b, cl, dnsControllerOptions{})
+
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+
+			queries := loadQueries(cl, 4096)
+
+			var (
+				mu        sync.Mutex
+				latencies = make([]time.Duration, 0, b.N)
+			)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				local := make([]time.Duration, 0, 1024)
+
+				for i := 0; pb.Next(); i++ {
+					q := queries[i%len(queries)]
+					rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: q.src})
+
+					start := time.Now()
+
+					if _, err := h.ServeDNS(context.Background(), rec, q.msg.Copy()); err != nil {
+						b.Errorf("ServeDNS failed: %v", err)
+
+						return
+					}
+
+					local = append(local, time.Since(start))
+				}
+
+				mu.Lock()
+				latencies = append(latencies, local...)
+				mu.Unlock()
+			})
+
+			b.StopTimer()
+
+			slices.Sort(latencies)
+			b.ReportMetric(float64(percentile(latencies, 50).Nanoseconds()), "p50-ns")
+			b.ReportMetric(float64(percentile(latencies, 99).Nanoseconds()), "p99-ns")
+			b.ReportMetric(float64(len(cl.pods)), "pods")
+			b.ReportMetric(float64(h.counters.denied.Load())/float64(b.N), "denied/op")
+			b.ReportMetric(float64(after.HeapAlloc)-float64(before.HeapAlloc), "heap-bytes")
+		})
+	}
+}
+
+// loadQueries builds n queries alternating between a service in the source
+// pod's own namespace and one in the next tenant over.
+func loadQueries(cl *cluster, n int) []loadQuery {
+	queries := make([]loadQuery, 0, n)
+	servicesPerNs := len(cl.services) / len(cl.namespaces)
+
+	for i := range n {
+		pod := cl.pods[(i*7919)%len(cl.pods)]
+
+		ns := slices.IndexFunc(cl.namespaces, func(ns *v1.Namespace) bool { return ns.Name == pod.Namespace })
+		if i%2 == 1 {
+			ns = (ns + 1) % len(cl.namespaces)
+		}
+
+		svc := cl.services[ns*servicesPerNs+i%servicesPerNs]
+
+		m := new(dns.Msg)
+		m.SetQuestion(fmt.Sprintf("%s.%s.svc.%s", svc.Name, svc.Namespace, testZone), dns.TypeA)
+
+		queries = append(queries, loadQuery{src: pod.Status.PodIPs[0].IP, msg: m})
+	}
+
+	return queries
+}
+
+// percentile returns the p-th percentile of sorted.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+// BenchmarkEvaluate measures the policy evaluation alone, with the exposure
+// selectors configured, from concurrent goroutines as CoreDNS serves queries.
+func BenchmarkEvaluate(b *testing.B) {
+	cl := newCluster(10, 10, 10)
+
+	h := newTestCapsule(b, cl, dnsControllerOptions{})
+	h.labelSelector = matchLabels(map[string]string{"capsule.io/expose-dns": "true"})
+	h.namespaceLabelSelector = matchLabels(map[string]string{"capsule.io/dns": "enabled"})
+
+	src := cl.pods[0].Status.PodIPs[0].IP
+	dst := cl.services[len(cl.services)-1].Spec.ClusterIP
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			h.dnsController.Evaluate(b.Context(), src, dst, *h)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"cmp"
+	"fmt"
+	golog "log"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+)
+
+// Levels of log_level, from the most verbose.
+const (
+	logLevelDebug   = "debug"
+	logLevelInfo    = "info"
+	logLevelWarning = "warning"
+	logLevelError   = "error"
+)
+
+var logLevels = []string{logLevelDebug, logLevelInfo, logLevelWarning, logLevelError}
+
+// pluginLogger is the logger of the plugin, dropping the messages below a
+// level that can be changed at runtime, without a reload. At debug level it
+// writes the debug messages the debug plugin would, and traces every decision.
+//
+// The level is that of the process, the logger owns it: the level set on the
+// admin endpoint wins, then the most verbose of those the capsule blocks set,
+// then info.
+type pluginLogger struct {
+	clog.P
+
+	prefix string
+	// level indexes logLevels.
+	level atomic.Int32
+
+	mu sync.Mutex
+	// configured holds the level each handler sets, with log_level or the
+	// logLevel of its CapsuleCoreDNSConfig.
+	configured map[*Capsule]string
+	// override is the level set on the admin endpoint, empty when none is.
+	override string
+}
+
+func newPluginLogger(name string) *pluginLogger {
+	l := &pluginLogger{P: clog.NewWithPlugin(name), prefix: "plugin/" + name + ": ", configured: map[*Capsule]string{}}
+	l.level.Store(int32(slices.Index(logLevels, logLevelInfo)))
+
+	return l
+}
+
+// Level returns the level in force.
+func (l *pluginLogger) Level() string {
+	return logLevels[l.level.Load()]
+}
+
+// SetLevel sets the level in force, one of logLevels.
+func (l *pluginLogger) SetLevel(level string) error {
+	i := slices.Index(logLevels, level)
+	if i < 0 {
+		return fmt.Errorf("invalid log level '%s', expected debug, info, warning or error", level)
+	}
+
+	if old := l.level.Swap(int32(i)); old != int32(i) {
+		golog.Print("[INFO] " + l.prefix + "log level set to " + level + ", was " + logLevels[old])
+	}
+
+	return nil
+}
+
+func (l *pluginLogger) enabled(level string) bool {
+	return l.level.Load() <= int32(slices.Index(logLevels, level))
+}
+
+// verbose reports whether the level in force is debug.
+func (l *pluginLogger) verbose() bool {
+	return l.level.Load() == 0
+}
+
+func (l *pluginLogger) Debugf(format string, v ...any) {
+	if !l.verbose() {
+		l.P.Debugf(format, v...)
+
+		return
+	}
+
+	golog.Print("[DEBUG] " + l.prefix + fmt.Sprintf(format, v...))
+}
+
+func (l *pluginLogger) Info(v ...any) {
+	if l.enabled(logLevelInfo) {
+		l.P.Info(v...)
+	}
+}
+
+func (l *pluginLogger) Infof(format string, v ...any) {
+	if l.enabled(logLevelInfo) {
+		l.P.Infof(format, v...)
+	}
+}
+
+func (l *pluginLogger) Warning(v ...any) {
+	if l.enabled(logLevelWarning) {
+		l.P.Warning(v...)
+	}
+}
+
+func (l *pluginLogger) Warningf(format string, v ...any) {
+	if l.enabled(logLevelWarning) {
+		l.P.Warningf(format, v...)
+	}
+}
+
+// configure records level, empty for none, as the one h sets, and resolves
+// the level in force.
+func (l *pluginLogger) configure(h *Capsule, level string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.configured[h] = level
+	l.resolve()
+}
+
+// release forgets the level of h, shut down, and resolves the level in force.
+func (l *pluginLogger) release(h *Capsule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.configured, h)
+	l.resolve()
+}
+
+// setOverride sets the level of the admin endpoint, which wins over those of
+// the handlers until it is cleared with an empty level.
+func (l *pluginLogger) setOverride(level string) error {
+	if level != "" && !slices.Contains(logLevels, level) {
+		return fmt.Errorf("invalid log level '%s', expected debug, info, warning or error", level)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.override = level
+	l.resolve()
+
+	return nil
+}
+
+// resolve sets the level in force from the override and the configured levels.
+// l.mu must be held.
+func (l *pluginLogger) resolve() {
+	level := l.override
+
+	if level == "" {
+		for _, configured := range l.configured {
+			if configured != "" && (level == "" || slices.Index(logLevels, configured) < slices.Index(logLevels, level)) {
+				level = configured
+			}
+		}
+	}
+
+	_ = l.SetLevel(cmp.Or(level, logLevelInfo))
+}
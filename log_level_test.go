@@ -0,0 +1,148 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coredns/caddy"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", input: "capsule"},
+		{name: "debug", input: "capsule {\nlog_level debug\n}", want: logLevelDebug},
+		{name: "missing level", input: "capsule {\nlog_level\n}", wantErr: true},
+		{name: "unknown level", input: "capsule {\nlog_level trace\n}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			if h.logLevel != tt.want {
+				t.Errorf("got level %q, want %q", h.logLevel, tt.want)
+			}
+		})
+	}
+}
+
+func TestPluginLoggerLevel(t *testing.T) {
+	l := newPluginLogger(pluginName)
+
+	if l.Level() != logLevelInfo || l.verbose() || !l.enabled(logLevelInfo) {
+		t.Fatalf("got level %s, want info by default", l.Level())
+	}
+
+	if err := l.SetLevel("trace"); err == nil {
+		t.Error("got no error for an unknown level")
+	}
+
+	if err := l.SetLevel(logLevelWarning); err != nil {
+		t.Fatalf("failed to set the level: %v", err)
+	}
+
+	if l.enabled(logLevelInfo) || !l.enabled(logLevelWarning) || !l.enabled(logLevelError) {
+		t.Errorf("got info enabled %t at warning level", l.enabled(logLevelInfo))
+	}
+
+	if err := l.SetLevel(logLevelDebug); err != nil {
+		t.Fatalf("failed to set the level: %v", err)
+	}
+
+	if !l.verbose() || l.Level() != logLevelDebug {
+		t.Errorf("got level %s, want debug", l.Level())
+	}
+}
+
+func TestPluginLoggerPrecedence(t *testing.T) {
+	l := newPluginLogger(pluginName)
+	a, b := &Capsule{}, &Capsule{}
+
+	steps := []struct {
+		name string
+		do   func()
+		want string
+	}{
+		{name: "no level", do: func() { l.configure(a, "") }, want: logLevelInfo},
+		{name: "most verbose block", do: func() { l.configure(b, logLevelDebug) }, want: logLevelDebug},
+		{name: "block config", do: func() { l.configure(a, logLevelWarning) }, want: logLevelDebug},
+		{name: "admin override", do: func() { _ = l.setOverride(logLevelError) }, want: logLevelError},
+		{name: "config under override", do: func() { l.configure(b, logLevelInfo) }, want: logLevelError},
+		{name: "override cleared", do: func() { _ = l.setOverride("") }, want: logLevelInfo},
+		{name: "block shut down", do: func() { l.release(b) }, want: logLevelWarning},
+		{name: "every block shut down", do: func() { l.release(a) }, want: logLevelInfo},
+	}
+
+	for _, step := range steps {
+		step.do()
+
+		if got := l.Level(); got != step.want {
+			t.Errorf("%s: got level %s, want %s", step.name, got, step.want)
+		}
+	}
+
+	if err := l.setOverride("trace"); err == nil {
+		t.Error("got no error for an unknown level")
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	h := &Capsule{}
+	a := newAdminServer(h, "", "")
+
+	t.Cleanup(func() {
+		_ = log.setOverride("")
+		log.release(h)
+	})
+
+	level := func(method, target string) (int, string) {
+		rec := httptest.NewRecorder()
+		a.logLevel(rec, httptest.NewRequest(method, target, nil))
+
+		var got map[string]string
+		_ = json.NewDecoder(rec.Body).Decode(&got)
+
+		return rec.Code, got["level"]
+	}
+
+	log.configure(h, logLevelWarning)
+
+	if _, got := level(http.MethodPost, "/log-level?level=debug"); got != logLevelDebug {
+		t.Fatalf("got level %s, want debug", got)
+	}
+
+	// A CapsuleCoreDNSConfig event doesn't revert the level set on the endpoint.
+	log.configure(h, logLevelError)
+
+	if _, got := level(http.MethodGet, "/log-level"); got != logLevelDebug {
+		t.Errorf("got level %s after a config change, want debug kept", got)
+	}
+
+	if code, _ := level(http.MethodPost, "/log-level?level="); code != http.StatusBadRequest {
+		t.Errorf("got status %d for an empty level, want %d", code, http.StatusBadRequest)
+	}
+
+	if _, got := level(http.MethodDelete, "/log-level"); got != logLevelError {
+		t.Errorf("got level %s once cleared, want that of the config", got)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"errors"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Kinds of kubernetes plugin lookup errors.
+const (
+	lookupNotFound     = "not_found"
+	lookupBackendError = "backend_error"
+	lookupTimeout      = "timeout"
+)
+
+// lookupErrors counts the failed lookups capsule makes into the kubernetes
+// plugin, telling the names it couldn't resolve from the ones capsule blocked.
+var lookupErrors = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "lookup_errors_total",
+		Help:      "Number of failed kubernetes plugin lookups, partitioned by qtype and kind (not_found, backend_error or timeout).",
+	},
+	[]string{"qtype", "kind"},
+)
+
+// countLookupError counts err, returned by a kubernetes plugin lookup for
+// qtype. Lookups canceled by their client are not counted.
+func (h *Capsule) countLookupError(qtype uint16, err error) {
+	var kind string
+
+	switch {
+	case err == nil || errors.Is(err, context.Canceled):
+		return
+	case h.kubernetesHandler.IsNameError(err):
+		kind = lookupNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		kind = lookupTimeout
+	default:
+		kind = lookupBackendError
+	}
+
+	lookupErrors.WithLabelValues(dns.TypeToString[qtype], kind).Inc()
+}
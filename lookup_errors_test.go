@@ -0,0 +1,70 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLookupErrors(t *testing.T) {
+	cl := newCluster(1, 1, 1)
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+
+	t.Run("not found", func(t *testing.T) {
+		counter := lookupErrors.WithLabelValues("A", lookupNotFound)
+		before := testutil.ToFloat64(counter)
+
+		m := new(dns.Msg)
+		m.SetQuestion("missing."+cl.namespaces[0].Name+".svc."+testZone, dns.TypeA)
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: cl.pods[0].Status.PodIPs[0].IP})
+
+		if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatalf("ServeDNS failed: %v", err)
+		}
+
+		if got := testutil.ToFloat64(counter) - before; got != 1 {
+			t.Errorf("got %v not found lookups, want 1", got)
+		}
+	})
+
+	tests := []struct {
+		err  error
+		kind string
+	}{
+		{err: fmt.Errorf("list services: %w", context.DeadlineExceeded), kind: lookupTimeout},
+		{err: errors.New("connection refused"), kind: lookupBackendError},
+		{err: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			before := map[string]float64{}
+			for _, kind := range []string{lookupNotFound, lookupTimeout, lookupBackendError} {
+				before[kind] = testutil.ToFloat64(lookupErrors.WithLabelValues("SRV", kind))
+			}
+
+			h.countLookupError(dns.TypeSRV, tt.err)
+
+			for kind, n := range before {
+				want := 0.0
+				if kind == tt.kind {
+					want = 1
+				}
+
+				if got := testutil.ToFloat64(lookupErrors.WithLabelValues("SRV", kind)) - n; got != want {
+					t.Errorf("got %v %s lookups, want %v", got, kind, want)
+				}
+			}
+		})
+	}
+}
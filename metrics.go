@@ -0,0 +1,228 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// auditEventsSent counts audit events delivered to a sink.
+	auditEventsSent = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "audit_events_sent_total",
+			Help:      "Number of audit events delivered, partitioned by sink.",
+		},
+		[]string{"sink"},
+	)
+
+	// auditEventsDropped counts audit events a sink could not deliver.
+	auditEventsDropped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "audit_events_dropped_total",
+			Help:      "Number of audit events dropped, partitioned by sink and reason.",
+		},
+		[]string{"sink", "reason"},
+	)
+
+	// maxConcurrentRejects counts queries shed because of max_concurrent.
+	maxConcurrentRejects = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "max_concurrent_rejects_total",
+			Help:      "Number of queries answered with SERVFAIL because max_concurrent evaluations were in flight.",
+		},
+	)
+
+	// ambiguousAttributions counts lookups of IPs claimed by objects of
+	// several namespaces or recently reassigned.
+	ambiguousAttributions = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "ambiguous_attributions_total",
+			Help:      "Number of IP lookups that matched objects of several namespaces or an IP reassigned within the grace period.",
+		},
+	)
+
+	// sharedEvaluations counts questions answered by the evaluation of an
+	// identical concurrent question.
+	sharedEvaluations = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "shared_evaluations_total",
+			Help:      "Number of questions that shared the lookup and evaluation of an identical concurrent question.",
+		},
+	)
+
+	// decisionCacheLookups counts decision cache lookups by result.
+	decisionCacheLookups = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "decision_cache_lookups_total",
+			Help:      "Number of decision cache lookups, partitioned by result (hit or miss).",
+		},
+		[]string{"result"},
+	)
+
+	// searchCacheHits counts questions answered from the search cache,
+	// partitioned by kind.
+	searchCacheHits = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "search_cache_hits_total",
+			Help:      "Number of questions answered from the search cache, partitioned by kind (negative or source).",
+		},
+		[]string{"kind"},
+	)
+
+	// decisionCacheEvictions counts entries removed from the decision cache.
+	decisionCacheEvictions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "decision_cache_evictions_total",
+			Help:      "Number of decision cache entries evicted, partitioned by reason (expired, size or flush).",
+		},
+		[]string{"reason"},
+	)
+
+	_ = promauto.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "decision_cache_hit_ratio",
+			Help:      "Share of decision cache lookups served from the cache since the plugin started.",
+		},
+		cacheStats.hitRatio,
+	)
+)
+
+// Grant expiries come from a collector rather than a gauge, the grants are read
+// from the namespace caches when scraped.
+func init() { prometheus.MustRegister(newGrantCollector()) }
+
+// durationBuckets go from 10µs to about 0.3s, the plugin alone usually
+// stays well below the smallest of plugin.TimeBuckets.
+var durationBuckets = prometheus.ExponentialBuckets(0.00001, 2, 16)
+
+var (
+	// requestDuration measures ServeDNS, including the plugins after capsule.
+	requestDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "request_duration_seconds",
+			Help:      "Time spent serving a query, including the plugins after capsule.",
+			Buckets:   durationBuckets,
+		},
+	)
+
+	// overheadDuration measures the share of ServeDNS spent in capsule itself:
+	// attribution, policy evaluation, the extra kubernetes lookups and blocked
+	// answers.
+	overheadDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "overhead_duration_seconds",
+			Help:      "Time spent serving a query outside of the plugins after capsule.",
+			Buckets:   durationBuckets,
+		},
+	)
+
+	_ = promauto.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "overhead_ratio",
+			Help:      "Share of the query serving time spent in capsule since the plugin started.",
+		},
+		timeStats.overheadRatio,
+	)
+)
+
+// timeStats backs overhead_ratio.
+var timeStats durationStats
+
+type durationStats struct {
+	total    atomic.Int64
+	overhead atomic.Int64
+}
+
+func (s *durationStats) overheadRatio() float64 {
+	total := s.total.Load()
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.overhead.Load()) / float64(total)
+}
+
+// queryTimer splits the time spent serving a query between capsule and the
+// plugins it hands the query to.
+type queryTimer struct {
+	start time.Time
+	down  time.Duration
+}
+
+// downstream runs next, a call into the following plugins, off the overhead
+// clock.
+func (t *queryTimer) downstream(next func() (int, error)) (int, error) {
+	start := time.Now()
+	rcode, err := next()
+	t.down += time.Since(start)
+
+	return rcode, err
+}
+
+func (t *queryTimer) observe() {
+	total := time.Since(t.start)
+	overhead := total - t.down
+
+	timeStats.total.Add(int64(total))
+	timeStats.overhead.Add(int64(overhead))
+	requestDuration.Observe(total.Seconds())
+	overheadDuration.Observe(overhead.Seconds())
+}
+
+// cacheStats backs decision_cache_hit_ratio, counters can't be read back.
+var cacheStats lookupStats
+
+type lookupStats struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func (s *lookupStats) record(hit bool) {
+	if hit {
+		s.hits.Add(1)
+		decisionCacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		s.misses.Add(1)
+		decisionCacheLookups.WithLabelValues("miss").Inc()
+	}
+}
+
+func (s *lookupStats) hitRatio() float64 {
+	hits, misses := s.hits.Load(), s.misses.Load()
+	if hits+misses == 0 {
+		return 0
+	}
+
+	return float64(hits) / float64(hits+misses)
+}
@@ -0,0 +1,328 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/caddy/caddyfile"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// Middleware enforces the tenancy policy in front of any miekg/dns handler, for
+// DNS servers other than CoreDNS such as k8s_gateway. The plugin resolves the
+// questions through the kubernetes plugin before they are answered, the
+// middleware has no such backend: it lets the wrapped handler answer, then
+// evaluates the addresses of the answer, or the address a PTR question names,
+// and blocks the whole answer when one of them is denied.
+type Middleware struct {
+	capsule *Capsule
+	next    dns.Handler
+}
+
+// NewMiddleware wraps next with the policy configured by config, the content
+// of a capsule block in the Corefile syntax. Start must be called before
+// serving queries.
+func NewMiddleware(config string, next dns.Handler) (*Middleware, error) {
+	h, err := parseConfig("middleware", config)
+	if err != nil {
+		return nil, err
+	}
+
+	// These answer from the cluster zone of the kubernetes plugin.
+	if h.blockedCNAME != "" {
+		return nil, errors.New("blocked_cname requires the kubernetes plugin")
+	}
+
+	if h.apex == apexNamespace {
+		return nil, errors.New("apex namespace requires the kubernetes plugin")
+	}
+
+	if h.breaker != nil {
+		return nil, errors.New("lookup_breaker requires the kubernetes plugin")
+	}
+
+	if h.prefetchK > 0 {
+		return nil, errors.New("prefetch requires the kubernetes plugin")
+	}
+
+	if len(h.clusterDomains) > 0 {
+		return nil, errors.New("cluster_domains requires the kubernetes plugin")
+	}
+
+	if err := h.Setup(); err != nil {
+		return nil, err
+	}
+
+	return &Middleware{capsule: h, next: next}, nil
+}
+
+// parseConfig parses config, the content of a capsule block, into a handler
+// without a next plugin. The caller sets it up.
+func parseConfig(name, config string) (*Capsule, error) {
+	h := &Capsule{}
+
+	c := &caddy.Controller{
+		Dispenser: caddyfile.NewDispenser(name, strings.NewReader(pluginName+" {\n"+config+"\n}")),
+	}
+
+	for c.Next() {
+		if err := h.Parse(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+// Controller returns the decision API backed by the controller of m, valid
+// once m started.
+func (m *Middleware) Controller() *Controller {
+	return &Controller{capsule: m.capsule}
+}
+
+// Listener wraps ln, the listener of the DNS server, so that the PROXY
+// protocol header of the connections accepted from trusted_frontends, or the
+// peers source_identity proxy_proto trusts, is parsed. The client it names is
+// the source of the queries as source_identity orders it. ln is returned as is
+// without trusted frontends.
+func (m *Middleware) Listener(ln net.Listener) net.Listener {
+	frontends := m.capsule.frontends()
+	if len(frontends) == 0 {
+		return ln
+	}
+
+	return &proxyListener{Listener: ln, trusted: frontends}
+}
+
+// PacketConn is Listener for the datagrams of the DNS server, which carry a
+// PROXY protocol v2 header when received from trusted frontends. Answers are
+// sent back to the frontend.
+func (m *Middleware) PacketConn(pc net.PacketConn) net.PacketConn {
+	frontends := m.capsule.frontends()
+	if len(frontends) == 0 {
+		return pc
+	}
+
+	return &proxyPacketConn{PacketConn: pc, trusted: frontends}
+}
+
+// Start runs the controller, shared with the other middlewares and plugins of
+// the process configured alike, and the audit sinks, status reporter and admin
+// server.
+func (m *Middleware) Start() error {
+	return m.capsule.startup("")
+}
+
+// Stop releases what Start acquired.
+func (m *Middleware) Stop() error {
+	return m.capsule.shutdown()
+}
+
+// ServeDNS implements dns.Handler.
+func (m *Middleware) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	t := queryTimer{start: time.Now()}
+	m.serveDNS(context.Background(), w, r, &t)
+	t.observe()
+}
+
+// ServeDNSContext is ServeDNS bounded by ctx: the query is answered with
+// SERVFAIL once ctx is done before it was evaluated.
+func (m *Middleware) ServeDNSContext(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) {
+	t := queryTimer{start: time.Now()}
+	m.serveDNS(ctx, w, r, &t)
+	t.observe()
+}
+
+func (m *Middleware) serveDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, t *queryTimer) {
+	h := m.capsule.policy()
+
+	if !wellFormed(r) {
+		m.reply(w, r, dns.RcodeFormatError)
+
+		return
+	}
+
+	// A transfer would hand out every name of the zone at once, and the zones
+	// of the wrapped server are not known: refuse them all.
+	if slices.ContainsFunc(r.Question, func(q dns.Question) bool { return q.Qtype == dns.TypeAXFR || q.Qtype == dns.TypeIXFR }) {
+		m.reply(w, r, dns.RcodeRefused)
+
+		return
+	}
+
+	if !slices.ContainsFunc(r.Question, func(q dns.Question) bool { return h.enforced(q.Qtype) }) {
+		_, _ = t.downstream(func() (int, error) { m.next.ServeDNS(w, r); return 0, nil })
+
+		return
+	}
+
+	if !h.acquire() {
+		maxConcurrentRejects.Inc()
+		m.reply(w, r, dns.RcodeServerFailure)
+
+		return
+	}
+	defer h.release()
+
+	state := request.Request{W: h.identify(w, r), Req: r}
+
+	// The controller answering while a reload syncs tells whether its caches
+	// are stale.
+	ctrl := h.dnsController.active()
+
+	if !ctrl.HasSynced() && !ctrl.Warm() {
+		switch {
+		case !ctrl.SyncExpired():
+			m.reply(w, r, dns.RcodeServerFailure)
+		case h.syncFallback == syncFallbackDeny:
+			m.block(state, defaultBlockedResponse)
+		default:
+			_, _ = t.downstream(func() (int, error) { m.next.ServeDNS(w, r); return 0, nil })
+		}
+
+		return
+	}
+
+	if ctrl.Degraded() {
+		if h.staleFallback == syncFallbackDeny {
+			m.block(state, defaultBlockedResponse)
+		} else {
+			_, _ = t.downstream(func() (int, error) { m.next.ServeDNS(w, r); return 0, nil })
+		}
+
+		return
+	}
+
+	nw := nonwriter.New(w)
+	_, _ = t.downstream(func() (int, error) { m.next.ServeDNS(nw, r); return 0, nil })
+
+	if nw.Msg == nil {
+		return
+	}
+
+	src := state.IP()
+
+	for i := range r.Question {
+		question := questionState(state, i)
+		if !h.enforced(question.QType()) {
+			continue
+		}
+
+		for _, destIp := range answerAddresses(question, nw.Msg) {
+			d, err := h.budgeted(ctx, func() decision { return h.evaluate(ctx, src, destIp) })
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				m.reply(w, r, dns.RcodeServerFailure)
+
+				return
+			}
+
+			if err != nil {
+				h.counters.failed.Add(1)
+
+				if h.evalFallback == syncFallbackDeny {
+					m.block(state, defaultBlockedResponse)
+				} else {
+					_ = h.minimal(w).WriteMsg(nw.Msg)
+				}
+
+				return
+			}
+
+			// The owner of a host published by an Ingress means it to be
+			// resolved, its other addresses stay isolated.
+			if d.reason == reasonCrossTenant && h.dnsController.active().ingressPublishes(question.Name(), destIp) {
+				d = d.allow(reasonPublishedIngress).by("ingresses")
+			}
+
+			h.counters.record(d)
+			h.countDecision(question, "", d)
+			h.recordName(question, d)
+			h.recordBlocked(question, d)
+			h.emit(question, destIp, d)
+			h.logDecision(question, destIp, d)
+			h.runHooks(ctx, question, destIp, d)
+
+			if !d.allowed {
+				m.block(state, h.blockedResponse(d))
+
+				return
+			}
+		}
+	}
+
+	_ = h.minimal(w).WriteMsg(nw.Msg)
+}
+
+// answerAddresses returns the addresses msg discloses for question: those of
+// the records answering it, or the address a PTR question names when
+// answered.
+func answerAddresses(question request.Request, msg *dns.Msg) []string {
+	var addrs []string
+
+	switch question.QType() {
+	case dns.TypePTR:
+		if len(msg.Answer) == 0 {
+			return nil
+		}
+
+		if addr := net.ParseIP(dnsutil.ExtractAddressFromReverse(question.Name())); addr != nil {
+			addrs = append(addrs, addr.String())
+		}
+	case dns.TypeSRV:
+		addrs = appendAddresses(addrs, msg.Extra)
+	default:
+		addrs = appendAddresses(addrs, msg.Answer)
+	}
+
+	return addrs
+}
+
+func appendAddresses(addrs []string, rrs []dns.RR) []string {
+	for _, rr := range rrs {
+		switch rr := rr.(type) {
+		case *dns.A:
+			addrs = append(addrs, rr.A.String())
+		case *dns.AAAA:
+			addrs = append(addrs, rr.AAAA.String())
+		}
+	}
+
+	return addrs
+}
+
+// block answers every question of state as blocked. Without a zone of its own
+// the answer carries no SOA, resolvers cache it for their default negative
+// TTL.
+func (m *Middleware) block(state request.Request, resp blockedResponse) {
+	msg := new(dns.Msg)
+	msg.SetRcode(state.Req, resp.rcode)
+	msg.Authoritative = true
+
+	if resp.rcode == dns.RcodeSuccess {
+		for i := range state.Req.Question {
+			if sinkhole := m.capsule.policy().sinkhole(questionState(state, i), resp.ttl); sinkhole != nil {
+				msg.Answer = append(msg.Answer, sinkhole)
+			}
+		}
+	}
+
+	state.SizeAndDo(msg)
+	_ = state.W.WriteMsg(msg)
+}
+
+func (m *Middleware) reply(w dns.ResponseWriter, r *dns.Msg, rcode int) {
+	msg := new(dns.Msg)
+	msg.SetRcode(r, rcode)
+	_ = w.WriteMsg(msg)
+}
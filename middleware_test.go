@@ -0,0 +1,172 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestNewMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "selectors", config: "labels capsule.io/expose-dns=true\nnamespace_labels capsule.io/dns=enabled"},
+		{name: "unknown directive", config: "colour blue", wantErr: true},
+		{name: "blocked cname", config: "blocked_cname blocked.example.com.", wantErr: true},
+		{name: "namespace apex", config: "apex namespace", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMiddleware(tt.config, dns.HandlerFunc(func(dns.ResponseWriter, *dns.Msg) {}))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	cl := newCluster(2, 1, 2)
+	cl.services[3].Labels = map[string]string{"capsule.io/expose-dns": "true"}
+
+	// The wrapped server answers A questions for SERVICE.NAMESPACE.gateway.example.
+	// with the service address, and every PTR question with a name.
+	next := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+
+		q := r.Question[0]
+
+		switch q.Qtype {
+		case dns.TypeA:
+			for _, svc := range cl.services {
+				if q.Name == svc.Name+"."+svc.Namespace+".gateway.example." {
+					m.Answer = append(m.Answer, &dns.A{
+						Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 30},
+						A:   net.ParseIP(svc.Spec.ClusterIP),
+					})
+				}
+			}
+		case dns.TypePTR:
+			m.Answer = append(m.Answer, &dns.PTR{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 30},
+				Ptr: "svc.gateway.example.",
+			})
+		}
+
+		_ = w.WriteMsg(m)
+	})
+
+	mw, err := NewMiddleware("labels capsule.io/expose-dns=true\nsinkhole 192.0.2.1", next)
+	if err != nil {
+		t.Fatalf("failed to create middleware: %v", err)
+	}
+
+	mw.capsule.dnsController = newTestCapsule(t, cl, dnsControllerOptions{}).dnsController
+
+	reverse := func(ip string) string {
+		name, err := dns.ReverseAddr(ip)
+		if err != nil {
+			t.Fatalf("invalid address %s: %v", ip, err)
+		}
+
+		return name
+	}
+
+	tests := []struct {
+		name   string
+		qname  string
+		qtype  uint16
+		answer string
+		denied uint64
+	}{
+		{name: "same tenant", qname: "svc-0.tenant-0.gateway.example.", qtype: dns.TypeA, answer: cl.services[0].Spec.ClusterIP},
+		{name: "other tenant", qname: "svc-0.tenant-1.gateway.example.", qtype: dns.TypeA, answer: "192.0.2.1", denied: 1},
+		{name: "exposed service", qname: "svc-1.tenant-1.gateway.example.", qtype: dns.TypeA, answer: cl.services[3].Spec.ClusterIP},
+		{name: "outside of the cluster", qname: "www.example.", qtype: dns.TypeA},
+		{name: "reverse of other tenant", qname: reverse(cl.services[2].Spec.ClusterIP), qtype: dns.TypePTR, denied: 1},
+		{name: "reverse of same tenant", qname: reverse(cl.services[1].Spec.ClusterIP), qtype: dns.TypePTR, answer: "svc.gateway.example."},
+		{name: "not enforced", qname: "svc-0.tenant-1.gateway.example.", qtype: dns.TypeTXT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw.capsule.counters = &decisionCounters{}
+
+			m := new(dns.Msg)
+			m.SetQuestion(tt.qname, tt.qtype)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: cl.pods[0].Status.PodIPs[0].IP})
+			mw.ServeDNS(rec, m)
+
+			if rec.Msg == nil {
+				t.Fatal("no answer written")
+			}
+
+			var answer string
+			if len(rec.Msg.Answer) > 0 {
+				switch rr := rec.Msg.Answer[0].(type) {
+				case *dns.A:
+					answer = rr.A.String()
+				case *dns.PTR:
+					answer = rr.Ptr
+				}
+			}
+
+			if answer != tt.answer {
+				t.Errorf("got answer %q, want %q", answer, tt.answer)
+			}
+
+			if denied := mw.capsule.counters.denied.Load(); denied != tt.denied {
+				t.Errorf("got %d denied queries, want %d", denied, tt.denied)
+			}
+		})
+	}
+}
+
+func TestMiddlewareTransfer(t *testing.T) {
+	cl := newCluster(1, 1, 1)
+
+	next := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		t.Errorf("got the %s question passed to the wrapped server", dns.TypeToString[r.Question[0].Qtype])
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		_ = w.WriteMsg(m)
+	})
+
+	mw, err := NewMiddleware("", next)
+	if err != nil {
+		t.Fatalf("failed to create middleware: %v", err)
+	}
+
+	mw.capsule.dnsController = newTestCapsule(t, cl, dnsControllerOptions{}).dnsController
+
+	for _, qtype := range []uint16{dns.TypeAXFR, dns.TypeIXFR} {
+		t.Run(dns.TypeToString[qtype], func(t *testing.T) {
+			m := new(dns.Msg)
+			m.SetQuestion("gateway.example.", qtype)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: cl.pods[0].Status.PodIPs[0].IP})
+			mw.ServeDNS(rec, m)
+
+			if rec.Msg == nil {
+				t.Fatal("no answer written")
+			}
+
+			if rec.Msg.Rcode != dns.RcodeRefused {
+				t.Errorf("got rcode %s, want REFUSED", dns.RcodeToString[rec.Msg.Rcode])
+			}
+		})
+	}
+}
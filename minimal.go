@@ -0,0 +1,44 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"github.com/miekg/dns"
+)
+
+// minimalWriter strips the authority and additional sections of positive
+// answers, keeping the OPT record. Negative answers keep the SOA resolvers
+// cache them by.
+type minimalWriter struct {
+	dns.ResponseWriter
+}
+
+func (w *minimalWriter) WriteMsg(m *dns.Msg) error {
+	if m.Rcode == dns.RcodeSuccess && len(m.Answer) > 0 {
+		m.Ns = nil
+		m.Extra = optOnly(m.Extra)
+	}
+
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// optOnly returns the OPT record of extra, if any.
+func optOnly(extra []dns.RR) []dns.RR {
+	for _, rr := range extra {
+		if opt, ok := rr.(*dns.OPT); ok {
+			return []dns.RR{opt}
+		}
+	}
+
+	return nil
+}
+
+// minimal returns w stripping the answers it writes with minimal_responses.
+func (h *Capsule) minimal(w dns.ResponseWriter) dns.ResponseWriter {
+	if !h.minimalResponses {
+		return w
+	}
+
+	return &minimalWriter{ResponseWriter: w}
+}
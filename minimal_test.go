@@ -0,0 +1,72 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestMinimalResponses(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.minimalResponses = true
+	h.Next = plugin.HandlerFunc(func(_ context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = []dns.RR{&dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 5},
+			A:   net.ParseIP(cl.services[0].Spec.ClusterIP),
+		}}
+		m.Ns = []dns.RR{&dns.NS{Hdr: dns.RR_Header{Name: testZone, Rrtype: dns.TypeNS, Class: dns.ClassINET}, Ns: "ns.dns." + testZone}}
+		m.Extra = []dns.RR{
+			&dns.A{Hdr: dns.RR_Header{Name: "ns.dns." + testZone, Rrtype: dns.TypeA, Class: dns.ClassINET}, A: net.ParseIP("10.96.0.10")},
+			&dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}},
+		}
+
+		return dns.RcodeSuccess, w.WriteMsg(m)
+	})
+
+	src := cl.pods[0].Status.PodIPs[0].IP
+
+	tests := []struct {
+		name   string
+		svc    int
+		answer int
+		extra  int
+	}{
+		{name: "allowed", svc: 0, answer: 1, extra: 1},
+		{name: "blocked", svc: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := new(dns.Msg)
+			m.SetQuestion(cl.services[tt.svc].Name+"."+cl.services[tt.svc].Namespace+".svc."+testZone, dns.TypeA)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: src})
+			if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+				t.Fatalf("ServeDNS failed: %v", err)
+			}
+
+			if len(rec.Msg.Answer) != tt.answer || len(rec.Msg.Ns) != 0 || len(rec.Msg.Extra) != tt.extra {
+				t.Errorf("got %d answer, %d authority and %d additional records, want %d, 0 and %d",
+					len(rec.Msg.Answer), len(rec.Msg.Ns), len(rec.Msg.Extra), tt.answer, tt.extra)
+			}
+
+			if tt.extra > 0 {
+				if _, ok := rec.Msg.Extra[0].(*dns.OPT); !ok {
+					t.Errorf("got additional record %v, want the OPT record", rec.Msg.Extra[0])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	v1 "k8s.io/api/core/v1"
+)
+
+// headlessService returns the headless service question names with
+// pod_exposure_label, which is evaluated in place of the pod its answer
+// starts with.
+func (h *Capsule) headlessService(question request.Request, zone string) (serviceRef, bool) {
+	if h.podExposureLabel == "" {
+		return serviceRef{}, false
+	}
+
+	ref, ok := serviceQuestion(question, zone)
+	if !ok || !h.dnsController.active().headless(ref) {
+		return serviceRef{}, false
+	}
+
+	return ref, true
+}
+
+// headless reports whether ref is a headless service.
+func (c *dnsController) headless(ref serviceRef) bool {
+	svc, ok := c.service(ref)
+
+	return ok && svc.Spec.ClusterIP == v1.ClusterIPNone
+}
+
+// service returns the service ref names.
+func (c *dnsController) service(ref serviceRef) (*v1.Service, bool) {
+	if c.informers.services == nil {
+		return nil, false
+	}
+
+	obj, exists, err := c.informers.services.GetIndexer().GetByKey(ref.namespace + "/" + ref.name)
+	if err != nil || !exists {
+		return nil, false
+	}
+
+	svc, ok := obj.(*v1.Service)
+
+	return svc, ok
+}
+
+// filtersPods reports whether the answer to a question allowed by d must be
+// narrowed to the pods exposed to the source tenant: the service exposure
+// selectors let another tenant in.
+func (h *Capsule) filtersPods(d decision) bool {
+	return h.podExposureLabel != "" && d.allowed && d.reason == reasonExposedService &&
+		!h.sameTenant(d.srcTenant, d.dstTenant)
+}
+
+// podExposedTo reports whether the pod_exposure_label of pod lists tenant.
+func (h *Capsule) podExposedTo(pod *v1.Pod, tenant string) bool {
+	value, ok := pod.Labels[h.podExposureLabel]
+
+	return ok && listsTenant(value, tenant)
+}
+
+// podExposureWriter drops the addresses of the pods not exposed to tenant from
+// the answers to qnames, and the SRV records targeting them.
+type podExposureWriter struct {
+	dns.ResponseWriter
+	ctx     context.Context
+	capsule *Capsule
+	tenant  string
+	qnames  []string
+}
+
+func (w *podExposureWriter) WriteMsg(m *dns.Msg) error {
+	answered := func(rr dns.RR) bool {
+		return slices.Contains(w.qnames, strings.ToLower(rr.Header().Name))
+	}
+
+	targets := map[string]bool{}
+
+	for _, rr := range m.Answer {
+		if srv, ok := rr.(*dns.SRV); ok && answered(rr) {
+			targets[strings.ToLower(srv.Target)] = true
+		}
+	}
+
+	dropped := map[string]bool{}
+
+	m.Extra = slices.DeleteFunc(m.Extra, func(rr dns.RR) bool {
+		name := strings.ToLower(rr.Header().Name)
+		if !targets[name] || !w.hidden(rr) {
+			return false
+		}
+
+		dropped[name] = true
+
+		return true
+	})
+
+	m.Answer = slices.DeleteFunc(m.Answer, func(rr dns.RR) bool {
+		if !answered(rr) {
+			return false
+		}
+
+		if srv, ok := rr.(*dns.SRV); ok {
+			return dropped[strings.ToLower(srv.Target)]
+		}
+
+		return w.hidden(rr)
+	})
+
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// hidden reports whether rr is the address of a pod not exposed to tenant.
+func (w *podExposureWriter) hidden(rr dns.RR) bool {
+	var ip string
+
+	switch rr := rr.(type) {
+	case *dns.A:
+		ip = rr.A.String()
+	case *dns.AAAA:
+		ip = rr.AAAA.String()
+	default:
+		return false
+	}
+
+	// Once the query is given up on, the pods left to classify are hidden.
+	_, obj, _, err := w.capsule.dnsController.active().getObjectByIP(w.ctx, ip)
+	if err != nil {
+		return w.ctx.Err() != nil
+	}
+
+	pod, ok := obj.(*v1.Pod)
+
+	return ok && !w.capsule.podExposedTo(pod, w.tenant)
+}
+
+// exposedPods returns w narrowing the answers to qnames to the pods exposed to
+// tenant, w itself when there is nothing to narrow.
+func (h *Capsule) exposedPods(ctx context.Context, w dns.ResponseWriter, tenant string, qnames []string) dns.ResponseWriter {
+	if len(qnames) == 0 {
+		return w
+	}
+
+	return &podExposureWriter{ResponseWriter: w, ctx: ctx, capsule: h, tenant: tenant, qnames: qnames}
+}
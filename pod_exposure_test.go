@@ -0,0 +1,163 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/kubernetes/object"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParsePodExposureLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "key", input: "capsule {\npod_exposure_label capsule.io/expose-pod\n}", want: "capsule.io/expose-pod"},
+		{name: "missing key", input: "capsule {\npod_exposure_label\n}", wantErr: true},
+		{name: "two keys", input: "capsule {\npod_exposure_label a b\n}", wantErr: true},
+		{name: "invalid key", input: "capsule {\npod_exposure_label capsule.io/expose/pod\n}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if h.podExposureLabel != tt.want {
+				t.Errorf("got %q, want %q", h.podExposureLabel, tt.want)
+			}
+		})
+	}
+}
+
+// endpointsAPIConn adds endpoints to the fixtures, which don't have any.
+type endpointsAPIConn struct {
+	*fixtureAPIConn
+	endpoints map[string][]*object.Endpoints
+}
+
+func (e *endpointsAPIConn) EpIndex(key string) []*object.Endpoints { return e.endpoints[key] }
+
+func TestServeDNSPodExposure(t *testing.T) {
+	cl := newCluster(2, 3, 0)
+
+	// tenant-1 shares the first two of its pods with tenant-0 through a
+	// headless service, and hides a second headless service.
+	cl.pods[3].Labels = map[string]string{"capsule.io/expose-pod": "tenant-0"}
+	cl.pods[4].Labels = map[string]string{"capsule.io/expose-pod": "true"}
+	cl.pods[5].Labels = map[string]string{"capsule.io/expose-pod": "tenant-2"}
+
+	for _, name := range []string{"frontend", "backend"} {
+		svc := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "tenant-1"},
+			Spec: v1.ServiceSpec{
+				Type:       v1.ServiceTypeClusterIP,
+				ClusterIP:  v1.ClusterIPNone,
+				ClusterIPs: []string{v1.ClusterIPNone},
+			},
+		}
+		if name == "frontend" {
+			svc.Labels = map[string]string{"capsule.io/expose-dns": "true"}
+		}
+
+		cl.services = append(cl.services, svc)
+	}
+
+	conn := &endpointsAPIConn{fixtureAPIConn: newFakeAPIConn(cl), endpoints: map[string][]*object.Endpoints{}}
+
+	for _, name := range []string{"frontend", "backend"} {
+		key := object.EndpointsKey(name, "tenant-1")
+		subset := object.EndpointSubset{Ports: []object.EndpointPort{{Name: "http", Protocol: "TCP", Port: 80}}}
+
+		for _, pod := range cl.pods[3:] {
+			subset.Addresses = append(subset.Addresses, object.EndpointAddress{IP: pod.Status.PodIPs[0].IP, Hostname: pod.Name})
+		}
+
+		conn.endpoints[key] = []*object.Endpoints{{Name: name, Namespace: "tenant-1", Index: key, Subsets: []object.EndpointSubset{subset}}}
+	}
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.kubernetesHandler.APIConn = conn
+	h.labelSelector = matchLabels(map[string]string{"capsule.io/expose-dns": "true"})
+	h.podExposureLabel = "capsule.io/expose-pod"
+	h.enforcedQtypes = map[uint16]bool{dns.TypeA: true, dns.TypeSRV: true}
+
+	ip := func(i int) string { return cl.pods[i].Status.PodIPs[0].IP }
+
+	tests := []struct {
+		name  string
+		src   int
+		qname string
+		qtype uint16
+		want  []string
+	}{
+		{name: "exposed pods", src: 0, qname: "frontend.tenant-1.svc.cluster.local.", qtype: dns.TypeA, want: []string{ip(3), ip(4)}},
+		{name: "exposed pods srv", src: 0, qname: "_http._tcp.frontend.tenant-1.svc.cluster.local.", qtype: dns.TypeSRV, want: []string{ip(3), ip(4)}},
+		{name: "same tenant", src: 4, qname: "frontend.tenant-1.svc.cluster.local.", qtype: dns.TypeA, want: []string{ip(3), ip(4), ip(5)}},
+		{name: "unexposed service", src: 0, qname: "backend.tenant-1.svc.cluster.local.", qtype: dns.TypeA},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := new(dns.Msg)
+			m.SetQuestion(tt.qname, tt.qtype)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: ip(tt.src)})
+			if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+				t.Fatalf("ServeDNS failed: %v", err)
+			}
+
+			var got []string
+
+			targets := 0
+
+			for _, rr := range append(rec.Msg.Answer, rec.Msg.Extra...) {
+				switch rr := rr.(type) {
+				case *dns.A:
+					got = append(got, rr.A.String())
+				case *dns.SRV:
+					targets++
+				}
+			}
+
+			slices.Sort(got)
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got addresses %v, want %v", got, tt.want)
+			}
+
+			if tt.qtype == dns.TypeSRV && targets != len(tt.want) {
+				t.Errorf("got %d SRV records, want %d", targets, len(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	v1 "k8s.io/api/core/v1"
+)
+
+const defaultPrefetchInterval = 30 * time.Second
+
+var (
+	// prefetchHits counts the questions whose destination was prefetched.
+	prefetchHits = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "prefetch_hits_total",
+			Help:      "Number of questions evaluated against a prefetched destination, without a kubernetes plugin lookup.",
+		},
+	)
+
+	// prefetchedNames is the number of names prefetched by the last refresh.
+	prefetchedNames = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "prefetched_names",
+			Help:      "Number of names whose destination the last prefetch refresh resolved.",
+		},
+	)
+)
+
+// prefetchTypes are the question types whose destination is prefetched.
+var prefetchTypes = map[uint16]bool{
+	dns.TypeA:    true,
+	dns.TypeAAAA: true,
+	dns.TypeSRV:  true,
+}
+
+// prefetched is the destination a service question resolved to.
+type prefetched struct {
+	destIp string
+	ref    serviceRef
+}
+
+// prefetcher resolves ahead of their queries the in-tenant services each
+// tenant queried most over the last interval, so that the kubernetes plugin
+// lookup of the hottest names runs off the query path. Only the lookup is
+// spared: the destination is still evaluated for every query, and used only
+// while the service still holds it.
+type prefetcher struct {
+	capsule  *Capsule
+	k        int
+	interval time.Duration
+	done     chan struct{}
+
+	// names counts the questions of the current interval per tenant, as
+	// "<type> <name>".
+	names atomic.Pointer[topNames]
+
+	mu           sync.RWMutex
+	destinations map[uint16]map[string]prefetched
+}
+
+func newPrefetcher(h *Capsule, k int, interval time.Duration) *prefetcher {
+	p := &prefetcher{
+		capsule:      h,
+		k:            k,
+		interval:     interval,
+		done:         make(chan struct{}),
+		destinations: map[uint16]map[string]prefetched{},
+	}
+	p.names.Store(newTopNames(k))
+
+	return p
+}
+
+func (p *prefetcher) Start() {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.refresh(context.Background())
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+func (p *prefetcher) Stop() {
+	close(p.done)
+}
+
+// record counts the question for tenant.
+func (p *prefetcher) record(tenant string, question request.Request) {
+	p.names.Load().record(tenant, question.Type()+" "+question.Name(), false)
+}
+
+// refresh resolves the names the tenants queried most since the last
+// refresh, which replace the destinations prefetched then.
+func (p *prefetcher) refresh(ctx context.Context) {
+	names := p.names.Swap(newTopNames(p.k))
+
+	destinations := map[uint16]map[string]prefetched{}
+	n := 0
+
+	for _, counts := range names.top("") {
+		for _, c := range counts {
+			qtype, name, _ := strings.Cut(c.Name, " ")
+
+			t := dns.StringToType[qtype]
+			if _, ok := destinations[t][name]; ok {
+				continue
+			}
+
+			entry, ok := p.resolve(ctx, t, name)
+			if !ok {
+				continue
+			}
+
+			if destinations[t] == nil {
+				destinations[t] = map[string]prefetched{}
+			}
+
+			destinations[t][name] = entry
+			n++
+		}
+	}
+
+	p.mu.Lock()
+	p.destinations = destinations
+	p.mu.Unlock()
+
+	prefetchedNames.Set(float64(n))
+}
+
+// resolve looks up the destination of the question for name, a ClusterIP
+// service of the cluster zone, as the policy in force would: the copy of a
+// CapsuleCoreDNSConfig shares the prefetcher of the Corefile handler.
+func (p *prefetcher) resolve(ctx context.Context, qtype uint16, name string) (prefetched, bool) {
+	h := p.capsule.policy()
+
+	zone := h.zoneOf(name)
+	if zone == "" {
+		return prefetched{}, false
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+
+	question := request.Request{Req: m, Zone: zone}
+
+	ref, ok := serviceQuestion(question, zone)
+	if !ok {
+		return prefetched{}, false
+	}
+
+	if _, ok := h.dnsController.active().clusterIPs(ref); !ok {
+		return prefetched{}, false
+	}
+
+	destIp, hops, err := h.lookup(ctx, question, zone, "")
+	if err != nil || destIp == "" || len(hops) > 0 {
+		return prefetched{}, false
+	}
+
+	return prefetched{destIp: destIp, ref: ref}, true
+}
+
+// destination returns the prefetched destination of question, as long as the
+// service it was resolved from still holds it.
+func (p *prefetcher) destination(question request.Request) (string, bool) {
+	p.mu.RLock()
+	entry, ok := p.destinations[question.QType()][question.Name()]
+	p.mu.RUnlock()
+
+	if !ok {
+		return "", false
+	}
+
+	ips, ok := p.capsule.dnsController.active().clusterIPs(entry.ref)
+	if !ok || !slices.Contains(ips, entry.destIp) {
+		return "", false
+	}
+
+	prefetchHits.Inc()
+
+	return entry.destIp, true
+}
+
+// flush drops the prefetched destinations and returns how many were removed.
+func (p *prefetcher) flush() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, names := range p.destinations {
+		n += len(names)
+	}
+
+	p.destinations = map[uint16]map[string]prefetched{}
+
+	return n
+}
+
+// clusterIPs returns the cluster IPs of ref, when it is a service with some.
+func (c *dnsController) clusterIPs(ref serviceRef) ([]string, bool) {
+	svc, ok := c.service(ref)
+	if !ok || svc.Spec.Type == v1.ServiceTypeExternalName || svc.Spec.ClusterIP == v1.ClusterIPNone ||
+		len(svc.Spec.ClusterIPs) == 0 {
+		return nil, false
+	}
+
+	return svc.Spec.ClusterIPs, true
+}
+
+// prefetchedLookup is lookup, served from the prefetched destinations when
+// question is among them.
+func (h *Capsule) prefetchedLookup(ctx context.Context, question request.Request, zone, src string) (string, []serviceRef, error) {
+	if h.prefetch != nil {
+		if destIp, ok := h.prefetch.destination(question); ok {
+			return destIp, nil, nil
+		}
+	}
+
+	return h.lookup(ctx, question, zone, src)
+}
+
+// recordPrefetch counts the question for the source tenant of d, with
+// prefetch, when it was allowed to a destination of that tenant.
+func (h *Capsule) recordPrefetch(question request.Request, d decision) {
+	if h.prefetch == nil || !prefetchTypes[question.QType()] || !d.allowed || d.srcTenant == "" ||
+		!h.sameTenant(d.srcTenant, d.dstTenant) {
+		return
+	}
+
+	h.prefetch.record(d.srcTenant, question)
+}
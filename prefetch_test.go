@@ -0,0 +1,164 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParsePrefetch(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		wantK        int
+		wantInterval time.Duration
+		wantErr      bool
+	}{
+		{name: "default interval", input: "capsule {\nprefetch 20\n}", wantK: 20, wantInterval: defaultPrefetchInterval},
+		{name: "interval", input: "capsule {\nprefetch 20 10s\n}", wantK: 20, wantInterval: 10 * time.Second},
+		{name: "missing value", input: "capsule {\nprefetch\n}", wantErr: true},
+		{name: "invalid value", input: "capsule {\nprefetch 0\n}", wantErr: true},
+		{name: "invalid interval", input: "capsule {\nprefetch 20 soon\n}", wantErr: true},
+		{name: "too many args", input: "capsule {\nprefetch 20 10s 1m\n}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if h.prefetchK != tt.wantK || h.prefetchInterval != tt.wantInterval {
+				t.Errorf("got %d every %s, want %d every %s", h.prefetchK, h.prefetchInterval, tt.wantK, tt.wantInterval)
+			}
+		})
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	clientset := fake.NewClientset(cl.objects()...)
+	h := newTestCapsuleForClient(t, cl, clientset, dnsControllerOptions{})
+	h.prefetch = newPrefetcher(h, 10, time.Minute)
+
+	own := cl.services[0]
+	other := cl.services[1]
+	name := func(svc string, ns string) string { return svc + "." + ns + ".svc." + testZone }
+
+	query := func(t *testing.T, src int, qname string) {
+		t.Helper()
+
+		m := new(dns.Msg)
+		m.SetQuestion(qname, dns.TypeA)
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: cl.pods[src].Status.PodIPs[0].IP})
+		if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatalf("ServeDNS failed: %v", err)
+		}
+	}
+
+	// Only the in-tenant question is prefetched, the cross-tenant one is
+	// denied.
+	query(t, 0, name(own.Name, own.Namespace))
+	query(t, 0, name(other.Name, other.Namespace))
+	h.prefetch.refresh(context.Background())
+
+	if got := h.prefetch.flush(); got != 1 {
+		t.Fatalf("got %d prefetched names, want 1", got)
+	}
+
+	query(t, 0, name(own.Name, own.Namespace))
+	h.prefetch.refresh(context.Background())
+
+	hits := testutil.ToFloat64(prefetchHits)
+
+	query(t, 0, name(own.Name, own.Namespace))
+
+	if got := testutil.ToFloat64(prefetchHits) - hits; got != 1 {
+		t.Fatalf("got %v prefetch hits, want 1", got)
+	}
+
+	// A service no longer holding the prefetched address is looked up again.
+	updated := own.DeepCopy()
+	updated.Spec.ClusterIP = "10.96.255.1"
+	updated.Spec.ClusterIPs = []string{updated.Spec.ClusterIP}
+
+	if _, err := clientset.CoreV1().Services(own.Namespace).Update(context.Background(), updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update the service: %v", err)
+	}
+
+	waitFor(t, "service updated", func() bool {
+		ips, _ := h.dnsController.clusterIPs(serviceRef{namespace: own.Namespace, name: own.Name})
+
+		return len(ips) == 1 && ips[0] == updated.Spec.ClusterIP
+	})
+
+	hits = testutil.ToFloat64(prefetchHits)
+
+	query(t, 0, name(own.Name, own.Namespace))
+
+	if got := testutil.ToFloat64(prefetchHits) - hits; got != 0 {
+		t.Errorf("got %v prefetch hits for a stale address, want 0", got)
+	}
+}
+
+func TestPrefetchLiveConfig(t *testing.T) {
+	cl := newCluster(1, 1, 1)
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.prefetch = newPrefetcher(h, 10, time.Minute)
+	h.live = &atomic.Pointer[Capsule]{}
+
+	// The policy of the config in force fails every lookup.
+	p := *h
+	p.breaker = &lookupBreaker{openUntil: time.Now().Add(time.Hour)}
+	h.live.Store(&p)
+
+	svc := cl.services[0]
+
+	m := new(dns.Msg)
+	m.SetQuestion(svc.Name+"."+svc.Namespace+".svc."+testZone, dns.TypeA)
+
+	h.prefetch.record(svc.Namespace, request.Request{Req: m})
+	h.prefetch.refresh(context.Background())
+
+	if got := h.prefetch.flush(); got != 0 {
+		t.Errorf("got %d names prefetched with the Corefile policy, want none", got)
+	}
+
+	h.live.Store(nil)
+	h.prefetch.record(svc.Namespace, request.Request{Req: m})
+	h.prefetch.refresh(context.Background())
+
+	if got := h.prefetch.flush(); got != 1 {
+		t.Errorf("got %d names prefetched once back to the Corefile policy, want 1", got)
+	}
+}
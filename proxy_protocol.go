@@ -0,0 +1,280 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyHeaderTimeout bounds the time a trusted frontend takes to send the
+// PROXY protocol header of a connection.
+const proxyHeaderTimeout = 5 * time.Second
+
+// proxyV1MaxLength is the longest PROXY protocol v1 header, CRLF included.
+const proxyV1MaxLength = 107
+
+// proxyV2Signature starts every PROXY protocol v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var errProxyHeader = errors.New("invalid PROXY protocol header")
+
+// proxyAddr is the remote address of a connection or datagram received from a
+// trusted frontend. It stands for the frontend, the socket peer, and carries
+// the address of the client the PROXY protocol header names, if any.
+type proxyAddr struct {
+	frontend net.Addr
+	client   netip.AddrPort
+}
+
+func (a *proxyAddr) Network() string { return a.frontend.Network() }
+func (a *proxyAddr) String() string  { return a.frontend.String() }
+
+// proxyListener parses the PROXY protocol header of the connections accepted
+// from trusted frontends.
+type proxyListener struct {
+	net.Listener
+	trusted []netip.Prefix
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	peer, ok := addrOf(conn.RemoteAddr().String())
+	if !ok || !containsAddr(l.trusted, peer) {
+		return conn, nil
+	}
+
+	return &proxyConn{Conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// proxyConn is a connection from a trusted frontend. Its header is read on the
+// first read or lookup of the remote address, off the accepting goroutine, and
+// the connection fails without one.
+type proxyConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	once   sync.Once
+	client netip.AddrPort
+	err    error
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (c *proxyConn) header() error {
+	c.once.Do(func() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+
+		c.client, c.err = readProxyHeader(c.r)
+
+		c.mu.Lock()
+		_ = c.Conn.SetReadDeadline(c.deadline)
+		c.mu.Unlock()
+	})
+
+	return c.err
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	if err := c.header(); err != nil {
+		return 0, err
+	}
+
+	return c.r.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.header() != nil || !c.client.IsValid() {
+		return c.Conn.RemoteAddr()
+	}
+
+	return &proxyAddr{frontend: c.Conn.RemoteAddr(), client: c.client}
+}
+
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+
+	return c.Conn.SetReadDeadline(t)
+}
+
+// proxyPacketConn strips the PROXY protocol v2 header of the datagrams received
+// from trusted frontends, and answers the frontend rather than the client.
+type proxyPacketConn struct {
+	net.PacketConn
+	trusted []netip.Prefix
+}
+
+func (c *proxyPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(b)
+		if err != nil {
+			return n, addr, err
+		}
+
+		peer, ok := addrOf(addr.String())
+		if !ok || !containsAddr(c.trusted, peer) {
+			return n, addr, nil
+		}
+
+		client, length, err := parseProxyV2(b[:n])
+		if err != nil {
+			// The datagram of a trusted frontend without a header can't be
+			// attributed, drop it.
+			continue
+		}
+
+		n = copy(b, b[length:n])
+		if !client.IsValid() {
+			return n, addr, nil
+		}
+
+		return n, &proxyAddr{frontend: addr, client: client}, nil
+	}
+}
+
+func (c *proxyPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if a, ok := addr.(*proxyAddr); ok {
+		addr = a.frontend
+	}
+
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+// readProxyHeader reads the v1 or v2 PROXY protocol header from r, returning
+// the address of the client it names. A header not naming one, sent by the
+// frontend for its own connections, returns the zero AddrPort.
+func readProxyHeader(r *bufio.Reader) (netip.AddrPort, error) {
+	start, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+
+	if !bytes.Equal(start, proxyV2Signature) {
+		if !bytes.HasPrefix(start, []byte("PROXY ")) {
+			return netip.AddrPort{}, errProxyHeader
+		}
+
+		line, err := r.ReadSlice('\n')
+		if err != nil || len(line) > proxyV1MaxLength {
+			return netip.AddrPort{}, errProxyHeader
+		}
+
+		return parseProxyV1(string(line))
+	}
+
+	fixed, err := r.Peek(16)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+
+	b, err := r.Peek(16 + int(binary.BigEndian.Uint16(fixed[14:])))
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+
+	client, length, err := parseProxyV2(b)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+
+	_, err = r.Discard(length)
+
+	return client, err
+}
+
+// parseProxyV1 parses a v1 header, "PROXY TCP4 <src> <dst> <sport> <dport>".
+func parseProxyV1(line string) (netip.AddrPort, error) {
+	line, ok := strings.CutSuffix(line, "\r\n")
+	if !ok {
+		return netip.AddrPort{}, errProxyHeader
+	}
+
+	fields := strings.Split(line, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return netip.AddrPort{}, nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return netip.AddrPort{}, errProxyHeader
+	}
+
+	addr, err := netip.ParseAddr(fields[2])
+	if err != nil || addr.Is4() != (fields[1] == "TCP4") {
+		return netip.AddrPort{}, errProxyHeader
+	}
+
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, errProxyHeader
+	}
+
+	return netip.AddrPortFrom(addr, uint16(port)), nil
+}
+
+// parseProxyV2 parses the v2 header starting b, returning the address of the
+// client it names and its length.
+func parseProxyV2(b []byte) (netip.AddrPort, int, error) {
+	if len(b) < 16 || !bytes.Equal(b[:len(proxyV2Signature)], proxyV2Signature) || b[12]>>4 != 2 {
+		return netip.AddrPort{}, 0, errProxyHeader
+	}
+
+	length := 16 + int(binary.BigEndian.Uint16(b[14:16]))
+	if len(b) < length {
+		return netip.AddrPort{}, 0, errProxyHeader
+	}
+
+	addrs := b[16:length]
+
+	switch b[12] & 0x0f {
+	case 0x0: // LOCAL, a connection of the frontend itself.
+		return netip.AddrPort{}, length, nil
+	case 0x1: // PROXY
+	default:
+		return netip.AddrPort{}, 0, errProxyHeader
+	}
+
+	var size int
+
+	switch b[13] >> 4 {
+	case 0x1: // AF_INET
+		size = 4
+	case 0x2: // AF_INET6
+		size = 16
+	default:
+		// UNSPEC or AF_UNIX, nothing to attribute the connection to.
+		return netip.AddrPort{}, length, nil
+	}
+
+	if len(addrs) < 2*size+4 {
+		return netip.AddrPort{}, 0, errProxyHeader
+	}
+
+	addr, _ := netip.AddrFromSlice(addrs[:size])
+	port := binary.BigEndian.Uint16(addrs[2*size:])
+
+	return netip.AddrPortFrom(addr, port), length, nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// proxyV2Header returns a v2 header naming client, or a LOCAL one without it.
+func proxyV2Header(client netip.AddrPort) []byte {
+	b := append([]byte{}, proxyV2Signature...)
+
+	if !client.IsValid() {
+		return append(b, 0x20, 0x00, 0x00, 0x00)
+	}
+
+	family, size := byte(0x11), 4
+	if client.Addr().Is6() {
+		family, size = 0x21, 16
+	}
+
+	b = append(b, 0x21, family)
+	b = binary.BigEndian.AppendUint16(b, uint16(2*size+4))
+	b = append(b, client.Addr().AsSlice()...)
+	b = append(b, make([]byte, size)...)
+	b = binary.BigEndian.AppendUint16(b, client.Port())
+
+	return binary.BigEndian.AppendUint16(b, 53)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{name: "v1 tcp4", header: "PROXY TCP4 10.244.1.5 10.96.0.10 40000 53\r\n", want: "10.244.1.5:40000"},
+		{name: "v1 tcp6", header: "PROXY TCP6 fd00::5 fd00::10 40000 53\r\n", want: "[fd00::5]:40000"},
+		{name: "v1 unknown", header: "PROXY UNKNOWN\r\n"},
+		{name: "v1 mismatched family", header: "PROXY TCP4 fd00::5 fd00::10 40000 53\r\n", wantErr: true},
+		{name: "v1 too long", header: "PROXY TCP4 " + strings.Repeat("1", proxyV1MaxLength) + "\r\n", wantErr: true},
+		{name: "v2 tcp4", header: string(proxyV2Header(netip.MustParseAddrPort("10.244.1.5:40000"))), want: "10.244.1.5:40000"},
+		{name: "v2 tcp6", header: string(proxyV2Header(netip.MustParseAddrPort("[fd00::5]:40000"))), want: "[fd00::5]:40000"},
+		{name: "v2 local", header: string(proxyV2Header(netip.AddrPort{}))},
+		{name: "missing header", header: "\x00\x1d", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.header + "query follows"))
+
+			client, err := readProxyHeader(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got := client.String(); client.IsValid() && got != tt.want || !client.IsValid() && tt.want != "" {
+				t.Errorf("got client %s, want %q", client, tt.want)
+			}
+
+			if rest, _ := r.ReadString(0); rest != "query follows" {
+				t.Errorf("got %q after the header, want the query", rest)
+			}
+		})
+	}
+}
+
+// serveSource serves, on ln or pc wrapped by mw, the source derived for each
+// query as the target of a CNAME record.
+func serveSource(t *testing.T, mw *Middleware, ln net.Listener, pc net.PacketConn) {
+	t.Helper()
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		state := request.Request{W: mw.capsule.identify(w, r), Req: r}
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, &dns.CNAME{
+			Hdr:    dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+			Target: state.Proto() + "." + state.IP() + ".",
+		})
+
+		_ = w.WriteMsg(m)
+	})
+
+	server := &dns.Server{Handler: handler}
+	if ln != nil {
+		server.Listener = mw.Listener(ln)
+	} else {
+		server.PacketConn = mw.PacketConn(pc)
+	}
+
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+}
+
+func sourceOf(t *testing.T, conn *dns.Conn) string {
+	t.Helper()
+
+	r := new(dns.Msg)
+	r.SetQuestion("svc-0.tenant-0.svc.cluster.local.", dns.TypeA)
+
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := conn.WriteMsg(r); err != nil {
+		t.Fatalf("failed to write the query: %v", err)
+	}
+
+	m, err := conn.ReadMsg()
+	if err != nil {
+		t.Fatalf("failed to read the answer: %v", err)
+	}
+
+	//nolint:forcetypeassert
+	return m.Answer[0].(*dns.CNAME).Target
+}
+
+func TestProxyListener(t *testing.T) {
+	v1 := "PROXY TCP4 10.244.1.5 127.0.0.1 40000 53\r\n"
+
+	tests := []struct {
+		name   string
+		config string
+		header string
+		want   string
+	}{
+		{name: "v1", config: "trusted_frontends 127.0.0.1", header: v1, want: "tcp.10.244.1.5."},
+		{name: "v2", config: "trusted_frontends 127.0.0.0/8", header: string(proxyV2Header(netip.MustParseAddrPort("10.244.1.5:40000"))), want: "tcp.10.244.1.5."},
+		{name: "v2 local", config: "trusted_frontends 127.0.0.1", header: string(proxyV2Header(netip.AddrPort{})), want: "tcp.127.0.0.1."},
+		{name: "untrusted peer", config: "trusted_frontends 10.0.0.0/8", want: "tcp.127.0.0.1."},
+		{name: "proxy_proto", config: "source_identity proxy_proto 127.0.0.1", header: v1, want: "tcp.10.244.1.5."},
+		{name: "socket first", config: "trusted_frontends 127.0.0.1\nsource_identity socket", header: v1, want: "tcp.127.0.0.1."},
+		{
+			name:   "proxy_proto untrusted",
+			config: "trusted_frontends 127.0.0.1\nsource_identity proxy_proto 10.0.0.0/8",
+			header: v1,
+			want:   "tcp.127.0.0.1.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw, err := NewMiddleware(tt.config, dns.HandlerFunc(func(dns.ResponseWriter, *dns.Msg) {}))
+			if err != nil {
+				t.Fatalf("failed to create middleware: %v", err)
+			}
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+
+			serveSource(t, mw, ln, nil)
+
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+
+			if _, err := conn.Write([]byte(tt.header)); err != nil {
+				t.Fatalf("failed to write the header: %v", err)
+			}
+
+			dnsConn := &dns.Conn{Conn: conn}
+
+			if got := sourceOf(t, dnsConn); got != tt.want {
+				t.Errorf("got source %s, want %s", got, tt.want)
+			}
+
+			// The header starts the connection only.
+			if got := sourceOf(t, dnsConn); got != tt.want {
+				t.Errorf("got source %s for the second query, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyPacketConn(t *testing.T) {
+	mw, err := NewMiddleware("trusted_frontends 127.0.0.1", dns.HandlerFunc(func(dns.ResponseWriter, *dns.Msg) {}))
+	if err != nil {
+		t.Fatalf("failed to create middleware: %v", err)
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	serveSource(t, mw, nil, pc)
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	r := new(dns.Msg)
+	r.SetQuestion("svc-0.tenant-0.svc.cluster.local.", dns.TypeA)
+
+	query, err := r.Pack()
+	if err != nil {
+		t.Fatalf("failed to pack the query: %v", err)
+	}
+
+	// A datagram of the trusted frontend without a header is dropped, the
+	// answer is that of the next one.
+	_, _ = conn.Write(query)
+	_, _ = conn.Write(append(proxyV2Header(netip.MustParseAddrPort("10.244.1.5:40000")), query...))
+
+	// The answer is sent back to the frontend.
+	dnsConn := &dns.Conn{Conn: conn}
+	_ = dnsConn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	m, err := dnsConn.ReadMsg()
+	if err != nil {
+		t.Fatalf("failed to read the answer: %v", err)
+	}
+
+	//nolint:forcetypeassert
+	if got := m.Answer[0].(*dns.CNAME).Target; got != "udp.10.244.1.5." {
+		t.Errorf("got source %s, want udp.10.244.1.5.", got)
+	}
+}
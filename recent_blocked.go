@@ -0,0 +1,121 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/request"
+)
+
+// blockedQuery is a query of a tenant that was blocked.
+type blockedQuery struct {
+	Time                 time.Time `json:"time"`
+	Name                 string    `json:"name"`
+	Type                 string    `json:"type"`
+	Source               string    `json:"source"`
+	Pod                  string    `json:"pod,omitempty"`
+	Namespace            string    `json:"namespace"`
+	DestinationNamespace string    `json:"destinationNamespace,omitempty"`
+	Reason               string    `json:"reason"`
+}
+
+// blockedRing holds the last queries of a tenant that were blocked, next
+// being where the following one goes once the ring is full.
+type blockedRing struct {
+	mu      sync.Mutex
+	queries []blockedQuery
+	next    int
+}
+
+// recentBlocked keeps the last n blocked queries of each tenant since the
+// plugin started.
+type recentBlocked struct {
+	n int
+
+	mu    sync.RWMutex
+	rings map[string]*blockedRing
+}
+
+func newRecentBlocked(n int) *recentBlocked {
+	return &recentBlocked{
+		n:     n,
+		rings: make(map[string]*blockedRing),
+	}
+}
+
+func (b *recentBlocked) record(tenant string, q blockedQuery) {
+	b.mu.RLock()
+	ring, ok := b.rings[tenant]
+	b.mu.RUnlock()
+
+	if !ok {
+		b.mu.Lock()
+		if ring, ok = b.rings[tenant]; !ok {
+			ring = &blockedRing{queries: make([]blockedQuery, 0, b.n)}
+			b.rings[tenant] = ring
+		}
+		b.mu.Unlock()
+	}
+
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+
+	if len(ring.queries) < b.n {
+		ring.queries = append(ring.queries, q)
+
+		return
+	}
+
+	ring.queries[ring.next] = q
+	ring.next = (ring.next + 1) % b.n
+}
+
+// since returns, oldest first, the blocked queries of each tenant made after
+// t, or those of tenant only when not empty.
+func (b *recentBlocked) since(tenant string, t time.Time) map[string][]blockedQuery {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	recent := map[string][]blockedQuery{}
+
+	for name, ring := range b.rings {
+		if tenant != "" && name != tenant {
+			continue
+		}
+
+		ring.mu.Lock()
+		queries := make([]blockedQuery, 0, len(ring.queries))
+		for i := range ring.queries {
+			if q := ring.queries[(ring.next+i)%len(ring.queries)]; q.Time.After(t) {
+				queries = append(queries, q)
+			}
+		}
+		ring.mu.Unlock()
+
+		recent[name] = queries
+	}
+
+	return recent
+}
+
+// recordBlocked keeps question for the tenant of the source of d, with
+// recent_blocked, when it was denied.
+func (h *Capsule) recordBlocked(question request.Request, d decision) {
+	if h.recentBlocked == nil || d.allowed || d.srcTenant == "" {
+		return
+	}
+
+	h.recentBlocked.record(d.srcTenant, blockedQuery{
+		Time:                 time.Now(),
+		Name:                 h.reportedQName(question.Name()),
+		Type:                 question.Type(),
+		Source:               question.IP(),
+		Pod:                  d.srcPod,
+		Namespace:            d.srcNamespace,
+		DestinationNamespace: d.dstNamespace,
+		Reason:               d.reason,
+	})
+}
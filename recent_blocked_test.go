@@ -0,0 +1,71 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestRecentBlocked(t *testing.T) {
+	recent := newRecentBlocked(3)
+	start := time.Now()
+
+	for i := range 5 {
+		recent.record("team-a", blockedQuery{Time: start.Add(time.Duration(i) * time.Minute), Name: fmt.Sprintf("db-%d.team-b.svc.cluster.local.", i)})
+	}
+
+	recent.record("team-b", blockedQuery{Time: start, Name: "api.team-a.svc.cluster.local."})
+
+	got := recent.since("team-a", time.Time{})["team-a"]
+	if len(got) != 3 {
+		t.Fatalf("got %d queries, want the last 3: %+v", len(got), got)
+	}
+
+	for i, q := range got {
+		if want := fmt.Sprintf("db-%d.team-b.svc.cluster.local.", i+2); q.Name != want {
+			t.Errorf("got query %d %s, want %s", i, q.Name, want)
+		}
+	}
+
+	if got := recent.since("team-a", start.Add(3*time.Minute))["team-a"]; len(got) != 1 || got[0].Name != "db-4.team-b.svc.cluster.local." {
+		t.Errorf("got %+v since the 4th minute, want the last query", got)
+	}
+
+	if all := recent.since("", time.Time{}); len(all) != 2 || len(all["team-b"]) != 1 {
+		t.Errorf("got %+v, want both tenants", all)
+	}
+}
+
+func TestServeDNSRecentBlocked(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.recentBlocked = newRecentBlocked(10)
+
+	for _, svc := range cl.services {
+		m := new(dns.Msg)
+		m.SetQuestion(svc.Name+"."+svc.Namespace+".svc."+testZone, dns.TypeA)
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: cl.pods[0].Status.PodIPs[0].IP})
+		if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatalf("ServeDNS failed: %v", err)
+		}
+	}
+
+	got := h.recentBlocked.since("", time.Time{})
+	if len(got) != 1 || len(got["tenant-0"]) != 1 {
+		t.Fatalf("got %+v, want the cross-tenant query of tenant-0", got)
+	}
+
+	q := got["tenant-0"][0]
+	if q.Namespace != "tenant-0" || q.DestinationNamespace != "tenant-1" || q.Reason != reasonCrossTenant || q.Pod != cl.pods[0].Name {
+		t.Errorf("got %+v, want the query of %s to tenant-1", q, cl.pods[0].Name)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	qnameRedactionHash     = "hash"
+	qnameRedactionTruncate = "truncate"
+)
+
+// reportedQName returns name as it may appear in decision logs and audit
+// events under qname_redaction:
+//
+//   - hash replaces it with a digest, identical for every query of the name
+//   - truncate replaces its first label, the service or pod, with "*"
+func (h *Capsule) reportedQName(name string) string {
+	switch h.qnameRedaction {
+	case qnameRedactionHash:
+		sum := sha256.Sum256([]byte(strings.ToLower(name)))
+
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	case qnameRedactionTruncate:
+		if i, end := dns.NextLabel(name, 0); !end {
+			return "*." + name[i:]
+		}
+
+		return "*."
+	}
+
+	return name
+}
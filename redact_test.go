@@ -0,0 +1,27 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import "testing"
+
+func TestReportedQName(t *testing.T) {
+	tests := []struct {
+		mode  string
+		qname string
+		want  string
+	}{
+		{mode: "", qname: "api.team-b.svc.cluster.local.", want: "api.team-b.svc.cluster.local."},
+		{mode: qnameRedactionTruncate, qname: "api.team-b.svc.cluster.local.", want: "*.team-b.svc.cluster.local."},
+		{mode: qnameRedactionTruncate, qname: "local.", want: "*."},
+		{mode: qnameRedactionHash, qname: "api.team-b.svc.cluster.local.", want: "sha256:df7338b4b9848fbf"},
+		{mode: qnameRedactionHash, qname: "API.team-b.svc.cluster.local.", want: "sha256:df7338b4b9848fbf"},
+	}
+
+	for _, tt := range tests {
+		h := &Capsule{qnameRedaction: tt.mode}
+		if got := h.reportedQName(tt.qname); got != tt.want {
+			t.Errorf("reportedQName(%q) with %q = %q, want %q", tt.qname, tt.mode, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"regexp"
+	"time"
+
+	tap "github.com/dnstap/golang-dnstap"
+	framestream "github.com/farsightsec/golang-framestream"
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ReplayQuery is a query of a capture, as read by ReadDnstap or ReadQueryLog.
+type ReplayQuery struct {
+	// Time is when the query was made, zero when the capture doesn't tell.
+	Time   time.Time
+	Source netip.Addr
+	Name   string
+	Type   uint16
+}
+
+// ReadDnstap decodes the client queries of a dnstap capture, such as the file
+// dnstap -u <socket> -w <file> writes from the dnstap plugin of CoreDNS.
+// Responses and queries without a source address are skipped.
+func ReadDnstap(r io.Reader) ([]ReplayQuery, error) {
+	dec, err := framestream.NewDecoder(r, &framestream.DecoderOptions{ContentType: []byte("protobuf:dnstap.Dnstap")})
+	if err != nil {
+		return nil, err
+	}
+
+	var queries []ReplayQuery
+
+	for {
+		frame, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			return queries, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		var event tap.Dnstap
+		if err := proto.Unmarshal(frame, &event); err != nil {
+			return nil, err
+		}
+
+		msg := event.GetMessage()
+		if msg.GetType() != tap.Message_CLIENT_QUERY {
+			continue
+		}
+
+		source, ok := netip.AddrFromSlice(msg.GetQueryAddress())
+		if !ok {
+			continue
+		}
+
+		m := new(dns.Msg)
+		if err := m.Unpack(msg.GetQueryMessage()); err != nil || len(m.Question) == 0 {
+			continue
+		}
+
+		queries = append(queries, ReplayQuery{
+			Time:   time.Unix(int64(msg.GetQueryTimeSec()), int64(msg.GetQueryTimeNsec())).UTC(),
+			Source: source.Unmap(),
+			Name:   m.Question[0].Name,
+			Type:   m.Question[0].Qtype,
+		})
+	}
+}
+
+// queryLogLine matches the queries the log plugin of CoreDNS logs in its
+// default format, optionally after the timestamp kubectl logs --timestamps
+// prefixes lines with:
+//
+//	[INFO] 10.244.0.5:52634 - 4017 "A IN api.team-b.svc.cluster.local. udp 57 false 512" NOERROR ...
+var queryLogLine = regexp.MustCompile(`^(?:(\S+) )?\[INFO\] \[?([0-9A-Fa-f:.]+?)\]?:\d+ - \d+ "(\S+) \S+ (\S+) `)
+
+// ReadQueryLog decodes the queries logged by the log plugin of CoreDNS in its
+// default format. Other lines are skipped.
+func ReadQueryLog(r io.Reader) ([]ReplayQuery, error) {
+	var queries []ReplayQuery
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		match := queryLogLine.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+
+		source, err := netip.ParseAddr(match[2])
+		if err != nil {
+			continue
+		}
+
+		qtype, ok := dns.StringToType[match[3]]
+		if !ok {
+			continue
+		}
+
+		q := ReplayQuery{Source: source.Unmap(), Name: dns.Fqdn(match[4]), Type: qtype}
+		if t, err := time.Parse(time.RFC3339Nano, match[1]); err == nil {
+			q.Time = t
+		}
+
+		queries = append(queries, q)
+	}
+
+	return queries, scanner.Err()
+}
+
+// Replay evaluates captured queries offline against a cluster described by
+// fixtures, such as a cache snapshot, to tell which queries a proposed
+// configuration would block before enabling it. The audit sinks, status
+// reporter, tenant stats, prefetching, alerts and admin server of the
+// configuration are left out.
+type Replay struct {
+	sim  *Simulation
+	sink *replaySink
+}
+
+// NewReplay returns a Replay of objects, as read by ReadFixtures or
+// ReadCacheSnapshot, serving zone with the policy configured by config, the
+// content of a capsule block in the Corefile syntax. Start must be called
+// before Evaluate.
+func NewReplay(config, zone string, objects []runtime.Object) (*Replay, error) {
+	sim, err := NewSimulation(config, zone, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	sink := &replaySink{}
+
+	h := sim.capsule
+	h.auditSinks = []auditSink{sink}
+	h.audit.all = true
+	h.status, h.tenantStats, h.prefetch, h.alerter, h.admin = nil, nil, nil, nil, nil
+
+	return &Replay{sim: sim, sink: sink}, nil
+}
+
+// Start loads the fixtures in the caches.
+func (r *Replay) Start() error {
+	return r.sim.load()
+}
+
+// Stop releases what Start acquired.
+func (r *Replay) Stop() error {
+	return r.sim.Stop()
+}
+
+// Evaluate replays q and returns the decisions made for it, one for each
+// address of the answer. The queries the policy doesn't evaluate, such as
+// those for names outside of the cluster, have none. Evaluate is not safe for
+// concurrent use.
+func (r *Replay) Evaluate(q ReplayQuery) []Decision {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(q.Name), q.Type)
+
+	r.sink.decisions = nil
+
+	w := &replayWriter{remote: &net.UDPAddr{IP: q.Source.AsSlice()}}
+	if _, err := r.sim.capsule.ServeDNS(context.Background(), w, m); err != nil {
+		log.Debugf("replayed query %s %s failed: %v", dns.TypeToString[q.Type], q.Name, err)
+	}
+
+	return r.sink.decisions
+}
+
+// replaySink keeps the decisions of the query being replayed.
+type replaySink struct {
+	decisions []Decision
+}
+
+func (s *replaySink) Name() string { return "replay" }
+func (s *replaySink) Start()       {}
+func (s *replaySink) Stop()        {}
+
+func (s *replaySink) Emit(ev auditEvent) {
+	action := ActionBlock
+	if ev.Allowed {
+		action = ActionAllow
+	}
+
+	s.decisions = append(s.decisions, Decision{
+		Action: action,
+		Reason: ev.Reason,
+		Rule:   ev.Rule,
+		QName:  ev.QName,
+		QType:  dns.StringToType[ev.QType],
+		Source: Identity{
+			IP:        ev.SrcIP,
+			Namespace: ev.SrcNamespace,
+			Tenant:    ev.SrcTenant,
+		},
+		Destination: Identity{
+			IP:        ev.DstIP,
+			Namespace: ev.DstNamespace,
+			Tenant:    ev.DstTenant,
+		},
+	})
+}
+
+// replayWriter discards the answers of the replayed queries, reporting their
+// source as the remote address.
+type replayWriter struct {
+	remote net.Addr
+}
+
+func (w *replayWriter) WriteMsg(*dns.Msg) error     { return nil }
+func (w *replayWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *replayWriter) LocalAddr() net.Addr         { return &net.UDPAddr{} }
+func (w *replayWriter) RemoteAddr() net.Addr        { return w.remote }
+func (w *replayWriter) Close() error                { return nil }
+func (w *replayWriter) TsigStatus() error           { return nil }
+func (w *replayWriter) TsigTimersOnly(bool)         {}
+func (w *replayWriter) Hijack()                     {}
@@ -0,0 +1,189 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	tap "github.com/dnstap/golang-dnstap"
+	framestream "github.com/farsightsec/golang-framestream"
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestReadQueryLog(t *testing.T) {
+	capture := strings.Join([]string{
+		`[INFO] 10.244.0.5:52634 - 4017 "A IN api.team-b.svc.cluster.local. udp 57 false 512" NOERROR qr,aa,rd 106 0.000134s`,
+		`2026-01-02T03:04:05.123456789Z [INFO] [fd00::5]:41000 - 12 "AAAA IN web.team-a.svc.cluster.local. udp 57 false 512" NOERROR qr,aa,rd 106 0.0001s`,
+		`[INFO] plugin/reload: Running configuration SHA512 = 1c648f07`,
+		`[INFO] 10.244.0.5:52634 - 4018 "TYPE65534 IN odd.example. udp 57 false 512" NOERROR qr,rd 57 0.0001s`,
+	}, "\n")
+
+	got, err := ReadQueryLog(strings.NewReader(capture))
+	if err != nil {
+		t.Fatalf("failed to read the query log: %v", err)
+	}
+
+	want := []ReplayQuery{
+		{Source: netip.MustParseAddr("10.244.0.5"), Name: "api.team-b.svc.cluster.local.", Type: dns.TypeA},
+		{Time: time.Date(2026, 1, 2, 3, 4, 5, 123456789, time.UTC), Source: netip.MustParseAddr("fd00::5"), Name: "web.team-a.svc.cluster.local.", Type: dns.TypeAAAA},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Source != want[i].Source || got[i].Name != want[i].Name || got[i].Type != want[i].Type {
+			t.Errorf("got query %d %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadDnstap(t *testing.T) {
+	var buf bytes.Buffer
+
+	enc, err := framestream.NewEncoder(&buf, &framestream.EncoderOptions{ContentType: []byte("protobuf:dnstap.Dnstap")})
+	if err != nil {
+		t.Fatalf("failed to create encoder: %v", err)
+	}
+
+	write := func(typ tap.Message_Type, name string) {
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+
+		packed, err := m.Pack()
+		if err != nil {
+			t.Fatalf("failed to pack the query: %v", err)
+		}
+
+		frame, err := proto.Marshal(&tap.Dnstap{
+			Type: tap.Dnstap_MESSAGE.Enum(),
+			Message: &tap.Message{
+				Type:          typ.Enum(),
+				QueryAddress:  netip.MustParseAddr("10.244.0.5").AsSlice(),
+				QueryTimeSec:  proto.Uint64(1767323045),
+				QueryTimeNsec: proto.Uint32(0),
+				QueryMessage:  packed,
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to marshal the event: %v", err)
+		}
+
+		if _, err := enc.Write(frame); err != nil {
+			t.Fatalf("failed to write the frame: %v", err)
+		}
+	}
+
+	write(tap.Message_CLIENT_QUERY, "api.team-b.svc.cluster.local.")
+	write(tap.Message_CLIENT_RESPONSE, "api.team-b.svc.cluster.local.")
+	write(tap.Message_FORWARDER_QUERY, "www.example.")
+
+	if err := enc.Close(); err != nil {
+		t.Fatalf("failed to close encoder: %v", err)
+	}
+
+	got, err := ReadDnstap(&buf)
+	if err != nil {
+		t.Fatalf("failed to read the capture: %v", err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("got %+v, want the client query only", got)
+	}
+
+	if q := got[0]; q.Source != netip.MustParseAddr("10.244.0.5") || q.Name != "api.team-b.svc.cluster.local." || q.Type != dns.TypeA || q.Time.Unix() != 1767323045 {
+		t.Errorf("got %+v, want the A query of 10.244.0.5", q)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	cl := newCluster(2, 1, 2)
+	cl.services[3].Labels = map[string]string{"expose": "true"}
+
+	snapshot := cacheSnapshotFile{Version: cacheSnapshotVersion, Namespaces: cl.namespaces, Pods: cl.pods, Services: cl.services}
+
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatalf("failed to marshal the snapshot: %v", err)
+	}
+
+	objects, err := ReadCacheSnapshot(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to read the snapshot: %v", err)
+	}
+
+	replay, err := NewReplay("labels expose=true", testZone, objects)
+	if err != nil {
+		t.Fatalf("failed to create replay: %v", err)
+	}
+
+	if err := replay.Start(); err != nil {
+		t.Fatalf("failed to start replay: %v", err)
+	}
+	t.Cleanup(func() { _ = replay.Stop() })
+
+	src := netip.MustParseAddr(cl.pods[0].Status.PodIPs[0].IP)
+
+	tests := []struct {
+		name   string
+		qname  string
+		action Action
+		reason string
+	}{
+		{name: "same tenant", qname: "svc-0.tenant-0.svc." + testZone, action: ActionAllow, reason: reasonSameTenant},
+		{name: "other tenant", qname: "svc-0.tenant-1.svc." + testZone, action: ActionBlock, reason: reasonCrossTenant},
+		{name: "exposed service", qname: "svc-1.tenant-1.svc." + testZone, action: ActionAllow, reason: reasonExposedService},
+		{name: "outside of the cluster", qname: "www.example."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decisions := replay.Evaluate(ReplayQuery{Source: src, Name: tt.qname, Type: dns.TypeA})
+
+			if tt.action == "" {
+				if len(decisions) != 0 {
+					t.Errorf("got %+v, want no decision", decisions)
+				}
+
+				return
+			}
+
+			if len(decisions) != 1 {
+				t.Fatalf("got %+v, want one decision", decisions)
+			}
+
+			if d := decisions[0]; d.Action != tt.action || d.Reason != tt.reason || d.Source.Namespace != "tenant-0" {
+				t.Errorf("got %+v, want %s for %s", d, tt.action, tt.reason)
+			}
+		})
+	}
+}
+
+func TestReadCacheSnapshot(t *testing.T) {
+	_, err := ReadCacheSnapshot(strings.NewReader(`{"version": 0}`))
+	if err == nil {
+		t.Error("got no error for an unsupported version")
+	}
+
+	objects, err := ReadCacheSnapshot(strings.NewReader(`{"version": 1, "namespaces": [{"metadata": {"name": "team-a"}}]}`))
+	if err != nil {
+		t.Fatalf("failed to read the snapshot: %v", err)
+	}
+
+	if len(objects) != 1 {
+		t.Fatalf("got %d objects, want the namespace", len(objects))
+	}
+
+	if ns, ok := objects[0].(*v1.Namespace); !ok || ns.Name != "team-a" {
+		t.Errorf("got %+v, want the namespace team-a", objects)
+	}
+}
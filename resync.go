@@ -0,0 +1,250 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/pager"
+)
+
+// resyncJitter spreads the relists of replicas started together, each waits
+// between one and one and a half period.
+const resyncJitter = 0.5
+
+// Kinds of discrepancies between the caches and the API server.
+const (
+	discrepancyMissing  = "missing"
+	discrepancyOutdated = "outdated"
+	discrepancyDeleted  = "deleted"
+)
+
+// resyncDiscrepancies counts the cache entries periodic resyncs corrected.
+var resyncDiscrepancies = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "resync_discrepancies_total",
+		Help:      "Number of cache entries corrected by a periodic resync, by informer and kind (missing, outdated or deleted).",
+	},
+	[]string{"informer", "kind"},
+)
+
+// resyncTarget is an informer the periodic resync relists.
+type resyncTarget struct {
+	name     string
+	informer cache.SharedIndexInformer
+	list     pager.ListPageFunc
+	// transform is the transform of the informer, applied to the listed
+	// objects.
+	transform cache.TransformFunc
+	// ips returns the IPs of an object for the IP table, nil for objects
+	// not in it.
+	ips cache.IndexFunc
+}
+
+// resyncs relists the namespaces, pods and services every period, jittered,
+// until s stops.
+func (s *informerSet) resyncs(period time.Duration) {
+	timer := time.NewTimer(wait.Jitter(period, resyncJitter))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-timer.C:
+		}
+
+		if s.synced() {
+			s.resync()
+		}
+
+		timer.Reset(wait.Jitter(period, resyncJitter))
+	}
+}
+
+// resync corrects the caches of s from a fresh list of the API server, and
+// returns the number of entries corrected. It makes up for events the
+// watches missed, which informers otherwise only recover from when they
+// happen to relist.
+func (s *informerSet) resync() int {
+	ctx := wait.ContextForChannel(s.stopCh)
+	corrected := 0
+
+	for _, t := range s.resyncTargets() {
+		n, err := s.resyncInformer(ctx, t)
+		if err != nil {
+			log.Warningf("failed to resync %s: %v", t.name, err)
+		}
+
+		if n > 0 {
+			log.Warningf("resync corrected %d %s cache entries", n, t.name)
+		}
+
+		corrected += n
+	}
+
+	return corrected
+}
+
+func (s *informerSet) resyncTargets() []resyncTarget {
+	core := s.client.CoreV1()
+
+	targets := []resyncTarget{{
+		name:     "namespaces",
+		informer: s.namespaces,
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return core.Namespaces().List(ctx, opts)
+		},
+	}}
+
+	if s.pods != nil {
+		targets = append(targets, resyncTarget{
+			name:     "pods",
+			informer: s.pods,
+			list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+				return core.Pods(metav1.NamespaceAll).List(ctx, opts)
+			},
+			transform: slimPod,
+			ips:       podIPs,
+		})
+	}
+
+	if s.services != nil {
+		targets = append(targets, resyncTarget{
+			name:     "services",
+			informer: s.services,
+			list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+				return core.Services(metav1.NamespaceAll).List(ctx, opts)
+			},
+			ips: serviceIPs,
+		})
+	}
+
+	return targets
+}
+
+// resyncInformer lists the objects of t and corrects the cache entries that
+// differ, returning their number. The list is a consistent read: an entry
+// left untouched by the watch while listing can only be as recent as the
+// listed object, entries updated meanwhile are left to the next resync.
+func (s *informerSet) resyncInformer(ctx context.Context, t resyncTarget) (int, error) {
+	store := t.informer.GetIndexer()
+
+	before := map[string]string{}
+	for _, obj := range store.List() {
+		if key, version, ok := keyAndVersion(obj); ok {
+			before[key] = version
+		}
+	}
+
+	listed := map[string]any{}
+
+	p := pager.New(t.list)
+	if s.pageSize > 0 {
+		p.PageSize = s.pageSize
+	}
+
+	err := p.EachListItem(ctx, metav1.ListOptions{}, func(obj runtime.Object) error {
+		var item any = obj
+
+		if t.transform != nil {
+			var err error
+			if item, err = t.transform(obj); err != nil {
+				return err
+			}
+		}
+
+		if key, _, ok := keyAndVersion(item); ok {
+			listed[key] = item
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	corrected := 0
+
+	correct := func(key string) {
+		current, exists, _ := store.GetByKey(key)
+
+		var version string
+		if exists {
+			_, version, _ = keyAndVersion(current)
+		}
+
+		if version != before[key] {
+			return
+		}
+
+		obj, ok := listed[key]
+
+		var kind string
+
+		switch {
+		case ok && !exists:
+			kind = discrepancyMissing
+			_ = store.Add(obj)
+		case ok:
+			if _, listedVersion, _ := keyAndVersion(obj); listedVersion == version {
+				return
+			}
+
+			kind = discrepancyOutdated
+			_ = store.Update(obj)
+		case exists:
+			kind = discrepancyDeleted
+			obj = nil
+			_ = store.Delete(current)
+		default:
+			return
+		}
+
+		if t.ips != nil {
+			s.ips.update(current, obj, t.ips)
+		}
+
+		resyncDiscrepancies.WithLabelValues(t.name, kind).Inc()
+		corrected++
+	}
+
+	for key := range listed {
+		correct(key)
+	}
+
+	for key := range before {
+		if _, ok := listed[key]; !ok {
+			correct(key)
+		}
+	}
+
+	return corrected, nil
+}
+
+// keyAndVersion returns the cache key and resource version of obj.
+func keyAndVersion(obj any) (string, string, bool) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return "", "", false
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return "", "", false
+	}
+
+	return key, accessor.GetResourceVersion(), true
+}
@@ -0,0 +1,91 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestResync(t *testing.T) {
+	cl := newCluster(2, 2, 1)
+
+	ctrl, err := newDNSControllerForClient(fake.NewClientset(cl.objects()...), dnsControllerOptions{})
+	if err != nil {
+		t.Fatalf("failed to create DNS controller: %v", err)
+	}
+
+	go ctrl.Start()
+	t.Cleanup(ctrl.Stop)
+
+	waitForSync(t, ctrl)
+
+	s := ctrl.informers
+
+	if n := s.resync(); n != 0 {
+		t.Fatalf("got %d entries corrected in synced caches, want 0", n)
+	}
+
+	// A missed deletion.
+	missed := cl.pods[0]
+	if err := s.pods.GetIndexer().Delete(missed); err != nil {
+		t.Fatalf("failed to delete pod: %v", err)
+	}
+
+	s.ips.update(missed, nil, podIPs)
+
+	// A missed creation.
+	ghost := cl.pods[1].DeepCopy()
+	ghost.Name = "ghost"
+	ghost.Status.PodIPs = []v1.PodIP{{IP: "10.99.0.1"}}
+
+	if err := s.pods.GetIndexer().Add(ghost); err != nil {
+		t.Fatalf("failed to add pod: %v", err)
+	}
+
+	s.ips.update(nil, ghost, podIPs)
+
+	// A missed update, the service had another IP.
+	svc := cl.services[0]
+	stale := svc.DeepCopy()
+	stale.ResourceVersion = "stale"
+	stale.Spec.ClusterIPs = []string{"10.98.0.1"}
+
+	if err := s.services.GetIndexer().Update(stale); err != nil {
+		t.Fatalf("failed to update service: %v", err)
+	}
+
+	s.ips.update(svc, stale, serviceIPs)
+
+	if n := s.resync(); n != 3 {
+		t.Errorf("got %d entries corrected, want 3", n)
+	}
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: missed.Status.PodIPs[0].IP, want: missed.Namespace + "/" + missed.Name},
+		{ip: "10.99.0.1"},
+		{ip: svc.Spec.ClusterIP, want: svc.Namespace + "/" + svc.Name},
+		{ip: "10.98.0.1"},
+	}
+
+	for _, tt := range tests {
+		var got string
+		if objs := s.ips.lookup(tt.ip); len(objs) > 0 {
+			got, _, _ = keyAndVersion(objs[0])
+		}
+
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+
+	if n := s.resync(); n != 0 {
+		t.Errorf("got %d entries corrected after the resync, want 0", n)
+	}
+}
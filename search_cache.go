@@ -0,0 +1,161 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultSearchCacheSize = 10000
+
+type searchKey struct {
+	src   string
+	qtype uint16
+	qname string
+}
+
+// searchCache remembers per source IP, for a short time, what a search path
+// expansion keeps asking again: the questions that named nothing in the
+// cluster, and the decisions that hold whatever the destination because the
+// source is outside of the policy.
+type searchCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	size     int
+	negative map[searchKey]time.Time
+	sources  map[string]cachedDecision
+}
+
+func newSearchCache(ttl time.Duration, size int) *searchCache {
+	return &searchCache{
+		ttl:      ttl,
+		size:     size,
+		negative: make(map[searchKey]time.Time),
+		sources:  make(map[string]cachedDecision),
+	}
+}
+
+// sourceLevel reports whether d was reached before looking at the
+// destination, and so holds for every question of the source.
+func sourceLevel(d decision) bool {
+	switch d.reason {
+	case reasonUnknownSource, reasonNonTenantSource, reasonOutOfShard:
+		return true
+	default:
+		return false
+	}
+}
+
+// source returns the cached source-level decision for src.
+func (c *searchCache) source(src string) (decision, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.sources[src]
+	if !ok || time.Now().After(entry.expires) {
+		return decision{}, false
+	}
+
+	searchCacheHits.WithLabelValues("source").Inc()
+
+	return entry.decision, true
+}
+
+func (c *searchCache) setSource(src string, d decision) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.makeRoom()
+	c.sources[src] = cachedDecision{decision: d, expires: time.Now().Add(c.ttl)}
+}
+
+// unnamed reports whether the question of src recently named nothing in the
+// cluster.
+func (c *searchCache) unnamed(src string, qtype uint16, qname string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires, ok := c.negative[searchKey{src: src, qtype: qtype, qname: qname}]
+	if !ok || time.Now().After(expires) {
+		return false
+	}
+
+	searchCacheHits.WithLabelValues("negative").Inc()
+
+	return true
+}
+
+func (c *searchCache) setNegative(src string, qtype uint16, qname string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.makeRoom()
+	c.negative[searchKey{src: src, qtype: qtype, qname: qname}] = time.Now().Add(c.ttl)
+}
+
+// makeRoom drops the expired entries once the cache is full, and arbitrary
+// ones if that is not enough. The caller holds c.mu.
+func (c *searchCache) makeRoom() {
+	if len(c.negative)+len(c.sources) < c.size {
+		return
+	}
+
+	now := time.Now()
+
+	for key, expires := range c.negative {
+		if now.After(expires) {
+			delete(c.negative, key)
+		}
+	}
+
+	for src, entry := range c.sources {
+		if now.After(entry.expires) {
+			delete(c.sources, src)
+		}
+	}
+
+	for key := range c.negative {
+		if len(c.negative)+len(c.sources) < c.size {
+			return
+		}
+
+		delete(c.negative, key)
+	}
+
+	for src := range c.sources {
+		if len(c.sources) < c.size {
+			return
+		}
+
+		delete(c.sources, src)
+	}
+}
+
+// flush drops every entry, or with negativeOnly the names that didn't resolve
+// and the sources that could not be attributed, and returns how many were
+// removed.
+func (c *searchCache) flush(negativeOnly bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.negative)
+	c.negative = make(map[searchKey]time.Time)
+
+	if !negativeOnly {
+		n += len(c.sources)
+		c.sources = make(map[string]cachedDecision)
+
+		return n
+	}
+
+	for src, entry := range c.sources {
+		if entry.negative() {
+			delete(c.sources, src)
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,27 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestSearchCacheSize(t *testing.T) {
+	c := newSearchCache(time.Minute, 2)
+
+	c.setNegative("10.0.0.1", dns.TypeA, "a.cluster.local.")
+	c.setNegative("10.0.0.1", dns.TypeA, "b.cluster.local.")
+	c.setSource("10.0.0.2", decision{allowed: true, reason: reasonUnknownSource})
+
+	if n := len(c.negative) + len(c.sources); n != 2 {
+		t.Errorf("got %d entries, want 2", n)
+	}
+
+	if _, ok := c.source("10.0.0.2"); !ok {
+		t.Error("latest entry evicted")
+	}
+}
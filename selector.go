@@ -0,0 +1,153 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/coredns/caddy"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// selector is a label selector compiled once, so matching it on the query path
+// doesn't allocate. It marshals as the selector it was compiled from.
+type selector struct {
+	source   *meta.LabelSelector
+	compiled labels.Selector
+}
+
+func newSelector(ls *meta.LabelSelector) (*selector, error) {
+	compiled, err := meta.LabelSelectorAsSelector(ls)
+	if err != nil {
+		return nil, err
+	}
+
+	return &selector{source: ls, compiled: compiled}, nil
+}
+
+// matches reports whether s is set and matches set.
+func (s *selector) matches(set map[string]string) bool {
+	return s != nil && s.compiled.Matches(labels.Set(set))
+}
+
+func (s *selector) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.source)
+}
+
+// compileSelector is parseSelector for the selectors matched on every query.
+func compileSelector(c *caddy.Controller) (*selector, error) {
+	directive := c.Val()
+
+	ls, err := parseSelector(c)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newSelector(ls)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s selector: %w", directive, err)
+	}
+
+	return s, nil
+}
+
+// parseSelector parses the selector of the current directive, given either
+// inline as a label selector string:
+//
+//	labels capsule.io/expose-dns=true
+//
+// or as a block of matchLabels and matchExpressions:
+//
+//	labels {
+//	    match_labels capsule.io/expose-dns=true
+//	    match_expressions environment In shared platform
+//	    match_expressions capsule.io/internal DoesNotExist
+//	}
+func parseSelector(c *caddy.Controller) (*meta.LabelSelector, error) {
+	directive := c.Val()
+
+	args := c.RemainingArgs()
+	if len(args) > 0 {
+		selector := strings.Join(args, " ")
+
+		ls, err := meta.ParseToLabelSelector(selector)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s selector value: '%v': %w", directive, selector, err)
+		}
+
+		return ls, nil
+	}
+
+	if !c.NextArg() || c.Val() != "{" {
+		return nil, c.ArgErr()
+	}
+
+	ls := &meta.LabelSelector{}
+
+	for c.Next() {
+		switch c.Val() {
+		case "}":
+			if len(ls.MatchLabels) == 0 && len(ls.MatchExpressions) == 0 {
+				return nil, c.Errf("empty %s selector block", directive)
+			}
+
+			if _, err := meta.LabelSelectorAsSelector(ls); err != nil {
+				return nil, c.Errf("invalid %s selector: %v", directive, err)
+			}
+
+			return ls, nil
+		case "match_labels":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+
+			for _, arg := range args {
+				key, value, ok := strings.Cut(arg, "=")
+				if !ok {
+					return nil, c.Errf("invalid match_labels entry '%s', expected key=value", arg)
+				}
+
+				if ls.MatchLabels == nil {
+					ls.MatchLabels = map[string]string{}
+				}
+
+				ls.MatchLabels[key] = value
+			}
+		case "match_expressions":
+			args := c.RemainingArgs()
+			if len(args) < 2 {
+				return nil, c.ArgErr()
+			}
+
+			req := meta.LabelSelectorRequirement{
+				Key:      args[0],
+				Operator: meta.LabelSelectorOperator(args[1]),
+				Values:   args[2:],
+			}
+
+			switch req.Operator {
+			case meta.LabelSelectorOpIn, meta.LabelSelectorOpNotIn:
+				if len(req.Values) == 0 {
+					return nil, c.Errf("match_expressions operator %s requires values", req.Operator)
+				}
+			case meta.LabelSelectorOpExists, meta.LabelSelectorOpDoesNotExist:
+				if len(req.Values) != 0 {
+					return nil, c.Errf("match_expressions operator %s takes no values", req.Operator)
+				}
+			default:
+				return nil, c.Errf("unknown match_expressions operator '%s'", args[1])
+			}
+
+			ls.MatchExpressions = append(ls.MatchExpressions, req)
+		default:
+			return nil, c.Errf("unknown %s property '%s'", directive, c.Val())
+		}
+	}
+
+	return nil, c.EOFErr()
+}
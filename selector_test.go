@@ -0,0 +1,129 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+
+	"github.com/coredns/caddy"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		matches map[string]string
+		misses  map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "inline",
+			input:   "capsule {\nlabels capsule.io/expose-dns=true\n}",
+			matches: map[string]string{"capsule.io/expose-dns": "true"},
+			misses:  map[string]string{"capsule.io/expose-dns": "false"},
+		},
+		{
+			name:    "inline set-based",
+			input:   "capsule {\nlabels environment in (shared, platform)\n}",
+			matches: map[string]string{"environment": "platform"},
+			misses:  map[string]string{"environment": "dev"},
+		},
+		{
+			name: "block",
+			input: `capsule {
+				labels {
+					match_labels team=platform
+					match_expressions environment In shared platform
+					match_expressions internal DoesNotExist
+				}
+				networkpolicies
+			}`,
+			matches: map[string]string{"team": "platform", "environment": "shared"},
+			misses:  map[string]string{"team": "platform", "environment": "shared", "internal": "true"},
+		},
+		{
+			name: "block not in",
+			input: `capsule {
+				labels {
+					match_expressions environment NotIn dev
+					match_expressions environment Exists
+				}
+			}`,
+			matches: map[string]string{"environment": "prod"},
+			misses:  map[string]string{"team": "platform"},
+		},
+		{
+			name:    "missing selector",
+			input:   "capsule {\nlabels\n}",
+			wantErr: true,
+		},
+		{
+			name:    "empty block",
+			input:   "capsule {\nlabels {\n}\n}",
+			wantErr: true,
+		},
+		{
+			name:    "unknown operator",
+			input:   "capsule {\nlabels {\nmatch_expressions environment Gt 1\n}\n}",
+			wantErr: true,
+		},
+		{
+			name:    "in without values",
+			input:   "capsule {\nlabels {\nmatch_expressions environment In\n}\n}",
+			wantErr: true,
+		},
+		{
+			name:    "exists with values",
+			input:   "capsule {\nlabels {\nmatch_expressions environment Exists prod\n}\n}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid match_labels",
+			input:   "capsule {\nlabels {\nmatch_labels environment\n}\n}",
+			wantErr: true,
+		},
+		{
+			name:    "unknown property",
+			input:   "capsule {\nlabels {\nmatch_fields environment=prod\n}\n}",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated block",
+			input:   "capsule {\nlabels {\nmatch_labels environment=prod\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !h.labelSelector.matches(tt.matches) {
+				t.Errorf("expected %v to match %s", tt.matches, h.labelSelector.compiled)
+			}
+
+			if h.labelSelector.matches(tt.misses) {
+				t.Errorf("expected %v not to match %s", tt.misses, h.labelSelector.compiled)
+			}
+		})
+	}
+}
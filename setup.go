@@ -4,12 +4,16 @@
 package capsule_coredns
 
 import (
-	"errors"
+	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/cache"
 	"github.com/coredns/coredns/plugin/kubernetes"
+	"github.com/coredns/coredns/plugin/transfer"
 )
 
 const pluginName = "capsule"
@@ -19,41 +23,275 @@ func init() { plugin.Register(pluginName, setup) }
 func setup(c *caddy.Controller) error {
 	handler := &Capsule{}
 
+	for c.Next() {
+		err := handler.Parse(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	// CoreDNS listeners don't speak the PROXY protocol, only the listeners
+	// wrapped by the middleware do.
+	if len(handler.frontends()) > 0 {
+		return plugin.Error(pluginName, c.Err("trusted_frontends and source_identity proxy_proto require a listener wrapped by the middleware"))
+	}
+
 	err := handler.Setup()
 	if err != nil {
 		return err
 	}
 
-	for c.Next() {
-		err = handler.Parse(c)
-		if err != nil {
-			return err
-		}
+	config := dnsserver.GetConfig(c)
+	if handler.cacheGuard == "" || handler.cacheGuard == cacheGuardEvaluate {
+		guardCache(config, handler)
 	}
 
-	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+	config.AddPlugin(func(next plugin.Handler) plugin.Handler {
 		handler.Next = next
 
 		return handler
 	})
-	//nolint:forcetypeassert
+
+	// Every server block declaring capsule is recorded so that one without a
+	// kubernetes plugin of its own can rely on another's.
+	configs, _ := c.Get(capsuleConfigsKey{}).([]*dnsserver.Config)
+	c.Set(capsuleConfigsKey{}, append(configs, config))
+
 	c.OnStartup(func() error {
-		kubernetesHandler := dnsserver.GetConfig(c).Handler("kubernetes")
-		if kubernetesHandler == nil {
-			return plugin.Error(pluginName, errors.New("kubernetes plugin not loaded"))
+		configs, _ := c.Get(capsuleConfigsKey{}).([]*dnsserver.Config)
+
+		k, local, err := findKubernetes(config, configs)
+		if err != nil {
+			return plugin.Error(pluginName, err)
+		}
+
+		handler.kubernetesHandler = k
+		handler.kubernetesBorrowed = !local
+
+		if handler.clusterZones, err = clusterZones(handler.clusterDomains, k); err != nil {
+			return plugin.Error(pluginName, err)
+		}
+
+		if local {
+			log.Info("kubernetes handler assigned to capsule plugin")
+		} else {
+			log.Infof("kubernetes handler for zones %v from another server block assigned to capsule plugin", k.Zones)
 		}
 
-		capsuleHandler := dnsserver.GetConfig(c).Handler("capsule")
+		// The transfer plugin would hand out the whole cluster zone, whatever
+		// the policy. Without the kubernetes plugin as a source, transfers of
+		// the cluster zone reach the capsule handler, which refuses them.
+		if t, ok := config.Handler("transfer").(*transfer.Transfer); ok && withholdTransfers(t, k) {
+			log.Warningf("zone transfers of %v refused, they would bypass the tenant policy", k.Zones)
+		}
+
+		// A cache in front of capsule would serve the answers allowed for
+		// one source to every other.
+		if ca, ok := config.Handler("cache").(*cache.Cache); ok && handler.cacheGuard == cacheGuardRefuse {
+			if zones := cachedZones(ca, handler.clusterZones); len(zones) > 0 {
+				return plugin.Error(pluginName, fmt.Errorf("the cache plugin serves %v to every client whatever the tenant policy, "+
+					"disable its success and denial caches for them or use cache_guard evaluate", zones))
+			}
+		}
 
-		m := capsuleHandler.(*Capsule)
-		m.kubernetesHandler = kubernetesHandler.(*kubernetes.Kubernetes)
+		// The controller is acquired here rather than at setup so a reload
+		// that fails before startup does not hold on to it.
+		if err := handler.startup(serverBlockKey(config)); err != nil {
+			return plugin.Error(pluginName, err)
+		}
 
-		log.Info("kubernetes handler assigned to capsule plugin")
+		return nil
+	})
+	// The admin listener is released before a reload so the new instance can
+	// bind the same address, and restored if the reload fails.
+	c.OnRestart(func() error {
+		if handler.admin != nil {
+			return handler.admin.Stop()
+		}
 
-		go m.dnsController.Start()
+		return nil
+	})
+	c.OnRestartFailed(func() error {
+		if handler.admin != nil {
+			return handler.admin.Start()
+		}
 
 		return nil
 	})
+	c.OnShutdown(handler.shutdown)
+
+	return nil
+}
+
+// startup acquires the controller of h, the handler of the server block
+// identified by block, and starts its audit sinks, status and tenant stats
+// reporters and admin server.
+func (h *Capsule) startup(block string) error {
+	log.configure(h, h.logLevel)
+
+	if err := h.startController(block); err != nil {
+		return err
+	}
+
+	return h.startReporters()
+}
+
+// startReporters starts the audit sinks, status and tenant stats reporters,
+// prefetcher, alerter and admin server of h.
+func (h *Capsule) startReporters() error {
+	for _, sink := range h.auditSinks {
+		sink.Start()
+	}
+
+	if h.status != nil {
+		h.status.Start()
+	}
+
+	if h.tenantStats != nil {
+		h.tenantStats.Start()
+	}
+
+	if h.prefetch != nil {
+		h.prefetch.Start()
+	}
+
+	if h.alerter != nil {
+		h.alerter.Start()
+	}
+
+	if h.admin != nil {
+		return h.admin.Start()
+	}
 
 	return nil
 }
+
+// startController acquires the controller backing h, the handler of the
+// server block identified by block, and starts it, unless it is shared with a
+// handler that already did.
+func (h *Capsule) startController(block string) error {
+	ctrl, err := acquireDNSController(h.controllerOptions(), block, newDNSController)
+	if err != nil {
+		return err
+	}
+
+	h.dnsController = ctrl
+
+	go h.dnsController.Start()
+
+	if h.configName != "" {
+		return h.watchConfig()
+	}
+
+	return nil
+}
+
+// serverBlockKey identifies the server block of config across reloads, by its
+// transport, zone, view and listen addresses.
+func serverBlockKey(config *dnsserver.Config) string {
+	return config.Transport + "://" + config.Zone + ":" + config.Port + "/" + config.ViewName + "/" + strings.Join(config.ListenHosts, ",")
+}
+
+// shutdown releases what startup acquired.
+func (h *Capsule) shutdown() error {
+	log.release(h)
+
+	if h.dnsController != nil {
+		h.unwatchConfig()
+		h.dnsController.release()
+	}
+
+	for _, sink := range h.auditSinks {
+		sink.Stop()
+	}
+
+	if h.status != nil {
+		h.status.Stop()
+	}
+
+	if h.tenantStats != nil {
+		h.tenantStats.Stop()
+	}
+
+	if h.prefetch != nil {
+		h.prefetch.Stop()
+	}
+
+	if h.alerter != nil {
+		h.alerter.Stop()
+	}
+
+	if h.admin != nil {
+		return h.admin.Stop()
+	}
+
+	return nil
+}
+
+// capsuleConfigsKey indexes, in the instance storage, the configs of the server
+// blocks declaring capsule.
+type capsuleConfigsKey struct{}
+
+// findKubernetes returns the kubernetes plugin capsule relies on and whether it
+// is declared in the server block of own. Without one there, it falls back to
+// the kubernetes plugin of another server block declaring capsule, preferring
+// one serving the zone of own.
+func findKubernetes(own *dnsserver.Config, configs []*dnsserver.Config) (*kubernetes.Kubernetes, bool, error) {
+	k, err := kubernetesPlugin(own)
+	if err != nil || k != nil {
+		return k, true, err
+	}
+
+	var candidates []*kubernetes.Kubernetes
+
+	for _, config := range configs {
+		if config == own {
+			continue
+		}
+
+		k, err := kubernetesPlugin(config)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if k != nil {
+			candidates = append(candidates, k)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, false, fmt.Errorf("kubernetes plugin not found in server block %s nor in any other server block declaring capsule", own.Zone)
+	}
+
+	for _, k := range candidates {
+		if plugin.Zones(k.Zones).Matches(own.Zone) != "" {
+			return k, false, nil
+		}
+	}
+
+	return candidates[0], false, nil
+}
+
+// kubernetesPlugin returns the kubernetes plugin of config, if any.
+func kubernetesPlugin(config *dnsserver.Config) (*kubernetes.Kubernetes, error) {
+	h := config.Handler("kubernetes")
+	if h == nil {
+		return nil, nil
+	}
+
+	k, ok := h.(*kubernetes.Kubernetes)
+	if !ok {
+		return nil, fmt.Errorf("handler registered as kubernetes in server block %s is a %T", config.Zone, h)
+	}
+
+	return k, nil
+}
+
+// withholdTransfers removes k from the sources of t and reports whether it was
+// one.
+func withholdTransfers(t *transfer.Transfer, k *kubernetes.Kubernetes) bool {
+	n := len(t.Transferers)
+	t.Transferers = slices.DeleteFunc(t.Transferers, func(tr transfer.Transferer) bool { return tr == k })
+
+	return len(t.Transferers) != n
+}
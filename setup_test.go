@@ -0,0 +1,113 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	kubedns "github.com/coredns/coredns/plugin/kubernetes"
+	"github.com/coredns/coredns/plugin/transfer"
+	"github.com/miekg/dns"
+)
+
+// impostorHandler is registered as kubernetes without being the plugin.
+type impostorHandler struct{}
+
+func (impostorHandler) ServeDNS(context.Context, dns.ResponseWriter, *dns.Msg) (int, error) {
+	return dns.RcodeSuccess, nil
+}
+
+func (impostorHandler) Name() string { return "kubernetes" }
+
+// serverBlock builds the config of a server block for zone running handlers.
+func serverBlock(t *testing.T, zone string, handlers ...plugin.Handler) *dnsserver.Config {
+	t.Helper()
+
+	config := &dnsserver.Config{Zone: zone, ListenHosts: []string{""}, Port: "53"}
+	for _, h := range handlers {
+		config.AddPlugin(func(plugin.Handler) plugin.Handler { return h })
+	}
+
+	if _, err := dnsserver.NewServer("dns://:53", []*dnsserver.Config{config}); err != nil {
+		t.Fatalf("failed to build server block %s: %v", zone, err)
+	}
+
+	return config
+}
+
+func TestFindKubernetes(t *testing.T) {
+	cluster := kubedns.New([]string{"cluster.local."})
+	reverse := kubedns.New([]string{"in-addr.arpa."})
+
+	own := serverBlock(t, "cluster.local.", &Capsule{}, cluster)
+	ptr := serverBlock(t, "in-addr.arpa.", &Capsule{}, reverse)
+	bare := serverBlock(t, "ip6.arpa.", &Capsule{})
+	other := serverBlock(t, "example.org.", &Capsule{})
+	impostor := serverBlock(t, "cluster.local.", &Capsule{}, impostorHandler{})
+
+	tests := []struct {
+		name    string
+		own     *dnsserver.Config
+		configs []*dnsserver.Config
+		want    *kubedns.Kubernetes
+		local   bool
+		wantErr bool
+	}{
+		{name: "own block", own: own, configs: []*dnsserver.Config{ptr, own}, want: cluster, local: true},
+		{name: "own block among others", own: ptr, configs: []*dnsserver.Config{own, ptr}, want: reverse, local: true},
+		{name: "borrowed", own: bare, configs: []*dnsserver.Config{bare, own}, want: cluster},
+		{name: "borrowed by zone", own: serverBlock(t, "10.in-addr.arpa.", &Capsule{}), configs: []*dnsserver.Config{own, ptr}, want: reverse},
+		{name: "missing", own: bare, configs: []*dnsserver.Config{bare, other}, wantErr: true},
+		{name: "wrong type", own: impostor, configs: []*dnsserver.Config{impostor}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, local, err := findKubernetes(tt.own, tt.configs)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if k != tt.want || local != tt.local {
+				t.Errorf("got %v (local %t), want %v (local %t)", k.Zones, local, tt.want.Zones, tt.local)
+			}
+		})
+	}
+}
+
+func TestWithholdTransfers(t *testing.T) {
+	cluster := kubedns.New([]string{"cluster.local."})
+	other := kubedns.New([]string{"example.org."})
+
+	xfr := &transfer.Transfer{Transferers: []transfer.Transferer{other, cluster}}
+	config := serverBlock(t, "cluster.local.", xfr, &Capsule{}, cluster)
+
+	found, ok := config.Handler("transfer").(*transfer.Transfer)
+	if !ok {
+		t.Fatal("transfer handler not registered")
+	}
+
+	if !withholdTransfers(found, cluster) {
+		t.Error("got kubernetes not withheld, want it removed from the transfer sources")
+	}
+
+	if len(xfr.Transferers) != 1 || xfr.Transferers[0] != other {
+		t.Errorf("got %d transfer sources, want only the other zone", len(xfr.Transferers))
+	}
+
+	if withholdTransfers(xfr, cluster) {
+		t.Error("got kubernetes withheld twice")
+	}
+}
@@ -0,0 +1,421 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	kubedns "github.com/coredns/coredns/plugin/kubernetes"
+	"github.com/coredns/coredns/plugin/kubernetes/object"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// simulationSyncTimeout bounds the load of the fixtures in the caches.
+const simulationSyncTimeout = 10 * time.Second
+
+// fixtureResources are the custom resources a fixture may hold, by kind.
+var fixtureResources = map[string]schema.GroupVersionResource{
+	"Tenant":               tenantsResource,
+	"DNSAccessRequest":     accessRequestResource,
+	"ExternalWorkload":     externalWorkloadResource,
+	"TenantResource":       tenantResourceResource,
+	"GlobalTenantResource": globalTenantResourceResource,
+	"CapsuleCoreDNSConfig": configResource,
+}
+
+// ReadFixtures decodes the YAML, or JSON, documents of r: namespaces, pods,
+// services and network policies, and the Capsule Tenants, TenantResources,
+// GlobalTenantResources, DNSAccessRequests, ExternalWorkloads and
+// CapsuleCoreDNSConfigs, alone or in a List.
+//
+// Fixtures describe what the caches would hold, a pod without a phase is
+// running and the single address of a pod or service is its only one.
+func ReadFixtures(r io.Reader) ([]runtime.Object, error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+
+	var objects []runtime.Object
+
+	for {
+		u := &unstructured.Unstructured{}
+
+		err := decoder.Decode(&u.Object)
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(u.Object) == 0 {
+			continue
+		}
+
+		// Lists, such as kubectl get -o yaml prints, hold the fixtures.
+		items := []*unstructured.Unstructured{u}
+		if u.IsList() {
+			list, err := u.ToList()
+			if err != nil {
+				return nil, err
+			}
+
+			items = items[:0]
+			for i := range list.Items {
+				items = append(items, &list.Items[i])
+			}
+		}
+
+		for _, item := range items {
+			obj, err := fixtureObject(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s %q: %w", item.GetKind(), item.GetName(), err)
+			}
+
+			objects = append(objects, obj)
+		}
+	}
+}
+
+// fixtureObject converts u to the type the fake clients serve it as.
+func fixtureObject(u *unstructured.Unstructured) (runtime.Object, error) {
+	var obj runtime.Object
+
+	switch gvk := u.GroupVersionKind(); gvk {
+	case v1.SchemeGroupVersion.WithKind("Namespace"):
+		obj = &v1.Namespace{}
+	case v1.SchemeGroupVersion.WithKind("Pod"):
+		obj = &v1.Pod{}
+	case v1.SchemeGroupVersion.WithKind("Service"):
+		obj = &v1.Service{}
+	case networkingv1.SchemeGroupVersion.WithKind("NetworkPolicy"):
+		obj = &networkingv1.NetworkPolicy{}
+	default:
+		if gvr, ok := fixtureResources[gvk.Kind]; ok && gvr.GroupVersion() == gvk.GroupVersion() {
+			return u, nil
+		}
+
+		return nil, fmt.Errorf("unsupported fixture %s", gvk)
+	}
+
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj); err != nil {
+		return nil, err
+	}
+
+	switch obj := obj.(type) {
+	case *v1.Pod:
+		if obj.Status.Phase == "" {
+			obj.Status.Phase = v1.PodRunning
+		}
+
+		if len(obj.Status.PodIPs) == 0 && obj.Status.PodIP != "" {
+			obj.Status.PodIPs = []v1.PodIP{{IP: obj.Status.PodIP}}
+		}
+	case *v1.Service:
+		if len(obj.Spec.ClusterIPs) == 0 && obj.Spec.ClusterIP != "" {
+			obj.Spec.ClusterIPs = []string{obj.Spec.ClusterIP}
+		}
+
+		if obj.Spec.Type == "" {
+			obj.Spec.Type = v1.ServiceTypeClusterIP
+		}
+	}
+
+	return obj, nil
+}
+
+// Simulation answers queries for a cluster described by fixtures, with the
+// policy configured in front of the kubernetes plugin as in CoreDNS, so that
+// selectors and custom resources can be tried without a cluster.
+//
+// The source of a query is the address of its EDNS0 client subnet option, such
+// as the one dig +subnet=10.0.0.7/32 sends, or the address it comes from.
+// Endpoints are not simulated: headless services, like services without
+// ports, have no records.
+type Simulation struct {
+	capsule *Capsule
+	ctrl    *dnsController
+}
+
+// NewSimulation returns a Simulation of objects, as read by ReadFixtures,
+// serving zone, and the cluster_domains of config, with the policy configured
+// by config, the content of a capsule block in the Corefile syntax. Start must
+// be called before serving queries.
+func NewSimulation(config, zone string, objects []runtime.Object) (*Simulation, error) {
+	h, err := parseConfig("simulation", config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.Setup(); err != nil {
+		return nil, err
+	}
+
+	var (
+		typed   []runtime.Object
+		custom  []runtime.Object
+		fixture fixtureCluster
+	)
+
+	for _, obj := range objects {
+		switch obj := obj.(type) {
+		case *unstructured.Unstructured:
+			custom = append(custom, obj)
+
+			continue
+		case *v1.Namespace:
+			fixture.namespaces = append(fixture.namespaces, obj)
+		case *v1.Pod:
+			fixture.pods = append(fixture.pods, obj)
+		case *v1.Service:
+			fixture.services = append(fixture.services, obj)
+		}
+
+		typed = append(typed, obj)
+	}
+
+	set, err := newInformerSet(fake.NewClientset(typed...), h.api)
+	if err != nil {
+		return nil, err
+	}
+
+	listKinds := make(map[schema.GroupVersionResource]string, len(fixtureResources))
+	for kind, gvr := range fixtureResources {
+		listKinds[gvr] = kind + "List"
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, custom...)
+	set.dynamic = dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
+
+	ctrl, err := newDNSControllerForSet(set, h.controllerOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	zones := []string{dns.Fqdn(zone)}
+	for _, domain := range h.clusterDomains {
+		if !slices.Contains(zones, domain) {
+			zones = append(zones, domain)
+		}
+	}
+
+	k := kubedns.New(zones)
+	k.APIConn = newFixtureAPIConn(fixture)
+	k.Upstream = emptyUpstream{}
+
+	if h.clusterZones, err = clusterZones(h.clusterDomains, k); err != nil {
+		return nil, err
+	}
+
+	h.Next = k
+	h.kubernetesHandler = k
+
+	return &Simulation{capsule: h, ctrl: ctrl}, nil
+}
+
+// Start loads the fixtures in the caches and starts the audit sinks, status
+// reporter and admin server.
+func (s *Simulation) Start() error {
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	return s.capsule.startReporters()
+}
+
+// load starts the controller and waits until the fixtures are in its caches.
+func (s *Simulation) load() error {
+	h := s.capsule
+	h.dnsController = s.ctrl
+
+	go s.ctrl.Start()
+
+	if h.configName != "" {
+		if err := h.watchConfig(); err != nil {
+			return err
+		}
+	}
+
+	deadline := time.Now().Add(simulationSyncTimeout)
+	for !s.ctrl.HasSynced() {
+		if time.Now().After(deadline) {
+			return errors.New("fixtures not loaded in time")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// Stop releases what Start acquired.
+func (s *Simulation) Stop() error {
+	return s.capsule.shutdown()
+}
+
+// Controller returns the decision API backed by the fixtures, valid once s
+// started.
+func (s *Simulation) Controller() *Controller {
+	return &Controller{capsule: s.capsule}
+}
+
+// ServeDNS implements dns.Handler.
+func (s *Simulation) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if client := clientSubnet(r); client != nil {
+		w = &simulatedWriter{ResponseWriter: w, client: client}
+	}
+
+	rcode, err := s.capsule.ServeDNS(context.Background(), w, r)
+	if err != nil {
+		log.Errorf("simulated query failed: %v", err)
+	}
+
+	if !plugin.ClientWrite(rcode) {
+		msg := new(dns.Msg)
+		msg.SetRcode(r, rcode)
+		_ = w.WriteMsg(msg)
+	}
+}
+
+// clientSubnet returns the address of the EDNS0 client subnet option of r,
+// nil without one.
+func clientSubnet(r *dns.Msg) net.IP {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+
+	for _, o := range opt.Option {
+		if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return subnet.Address
+		}
+	}
+
+	return nil
+}
+
+// simulatedWriter reports the client subnet of the query as the remote
+// address.
+type simulatedWriter struct {
+	dns.ResponseWriter
+	client net.IP
+}
+
+func (w *simulatedWriter) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: w.client}
+}
+
+// emptyUpstream answers the lookups of targets outside of the cluster, such as
+// ExternalName services, with an empty answer.
+type emptyUpstream struct{}
+
+func (emptyUpstream) Lookup(_ context.Context, _ request.Request, name string, typ uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, typ)
+	m.Response = true
+
+	return m, nil
+}
+
+// fixtureCluster is the part of the fixtures the kubernetes plugin answers
+// from.
+type fixtureCluster struct {
+	namespaces []*v1.Namespace
+	pods       []*v1.Pod
+	services   []*v1.Service
+}
+
+// fixtureAPIConn serves the kubernetes plugin lookups from fixtures.
+type fixtureAPIConn struct {
+	namespaces map[string]*object.Namespace
+	services   map[string][]*object.Service
+	pods       map[string][]*object.Pod
+}
+
+func newFixtureAPIConn(cl fixtureCluster) *fixtureAPIConn {
+	f := &fixtureAPIConn{
+		namespaces: map[string]*object.Namespace{},
+		services:   map[string][]*object.Service{},
+		pods:       map[string][]*object.Pod{},
+	}
+
+	for _, ns := range cl.namespaces {
+		f.namespaces[ns.Name] = &object.Namespace{Name: ns.Name}
+	}
+
+	for _, svc := range cl.services {
+		key := object.ServiceKey(svc.Name, svc.Namespace)
+		f.services[key] = append(f.services[key], &object.Service{
+			Name:         svc.Name,
+			Namespace:    svc.Namespace,
+			Index:        key,
+			ClusterIPs:   svc.Spec.ClusterIPs,
+			Type:         svc.Spec.Type,
+			ExternalName: svc.Spec.ExternalName,
+			Ports:        svc.Spec.Ports,
+		})
+	}
+
+	for _, pod := range cl.pods {
+		for _, ip := range pod.Status.PodIPs {
+			f.pods[ip.IP] = append(f.pods[ip.IP], &object.Pod{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+				PodIP:     ip.IP,
+			})
+		}
+	}
+
+	return f
+}
+
+func (f *fixtureAPIConn) ServiceList() []*object.Service {
+	var svcs []*object.Service
+	for _, s := range f.services {
+		svcs = append(svcs, s...)
+	}
+
+	return svcs
+}
+
+func (f *fixtureAPIConn) SvcIndex(key string) []*object.Service { return f.services[key] }
+func (f *fixtureAPIConn) PodIndex(ip string) []*object.Pod      { return f.pods[ip] }
+
+func (f *fixtureAPIConn) GetNamespaceByName(name string) (*object.Namespace, error) {
+	if ns, ok := f.namespaces[name]; ok {
+		return ns, nil
+	}
+
+	return nil, fmt.Errorf("namespace not found: %s", name)
+}
+
+func (f *fixtureAPIConn) EndpointsList() []*object.Endpoints                      { return nil }
+func (f *fixtureAPIConn) ServiceImportList() []*object.ServiceImport              { return nil }
+func (f *fixtureAPIConn) SvcIndexReverse(string) []*object.Service                { return nil }
+func (f *fixtureAPIConn) SvcExtIndexReverse(string) []*object.Service             { return nil }
+func (f *fixtureAPIConn) SvcImportIndex(string) []*object.ServiceImport           { return nil }
+func (f *fixtureAPIConn) EpIndex(string) []*object.Endpoints                      { return nil }
+func (f *fixtureAPIConn) EpIndexReverse(string) []*object.Endpoints               { return nil }
+func (f *fixtureAPIConn) McEpIndex(string) []*object.MultiClusterEndpoints        { return nil }
+func (f *fixtureAPIConn) GetNodeByName(context.Context, string) (*v1.Node, error) { return nil, nil }
+func (f *fixtureAPIConn) Run()                                                    {}
+func (f *fixtureAPIConn) HasSynced() bool                                         { return true }
+func (f *fixtureAPIConn) Stop() error                                             { return nil }
+func (f *fixtureAPIConn) Modified(kubedns.ModifiedMode) int64                     { return 0 }
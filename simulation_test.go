@@ -0,0 +1,191 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const simulationFixtures = `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: team-a
+  labels:
+    capsule.clastix.io/tenant: a
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: team-b
+  labels:
+    capsule.clastix.io/tenant: b
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: client
+  namespace: team-a
+status:
+  podIP: 10.0.0.7
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: team-a
+spec:
+  clusterIP: 172.16.0.1
+  ports:
+  - name: http
+    port: 80
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: api
+  namespace: team-b
+  labels:
+    expose: "true"
+spec:
+  clusterIP: 172.16.0.2
+  ports:
+  - name: http
+    port: 80
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: db
+  namespace: team-b
+spec:
+  clusterIP: 172.16.0.3
+  ports:
+  - name: http
+    port: 80
+---
+apiVersion: capsule.clastix.io/v1beta2
+kind: Tenant
+metadata:
+  name: a
+`
+
+func TestReadFixtures(t *testing.T) {
+	objects, err := ReadFixtures(strings.NewReader(simulationFixtures))
+	if err != nil {
+		t.Fatalf("failed to read fixtures: %v", err)
+	}
+
+	if len(objects) != 7 {
+		t.Fatalf("got %d objects, want 7", len(objects))
+	}
+
+	pod, ok := objects[2].(*v1.Pod)
+	if !ok {
+		t.Fatalf("got %T, want a pod", objects[2])
+	}
+
+	if pod.Status.Phase != v1.PodRunning || len(pod.Status.PodIPs) != 1 {
+		t.Errorf("got pod phase %q and IPs %v, want a running pod with its single IP", pod.Status.Phase, pod.Status.PodIPs)
+	}
+
+	if _, ok := objects[6].(*unstructured.Unstructured); !ok {
+		t.Errorf("got %T, want the tenant as unstructured", objects[6])
+	}
+
+	// kubectl get -o yaml prints a List.
+	list := "apiVersion: v1\nkind: List\nitems:\n- apiVersion: v1\n  kind: Namespace\n  metadata:\n    name: team-a\n" +
+		"- apiVersion: v1\n  kind: Namespace\n  metadata:\n    name: team-b\n"
+
+	objects, err = ReadFixtures(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("failed to read the list: %v", err)
+	}
+
+	if len(objects) != 2 {
+		t.Errorf("got %d objects, want the 2 items of the list", len(objects))
+	}
+
+	_, err = ReadFixtures(strings.NewReader("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: unsupported\n"))
+	if err == nil {
+		t.Error("got no error for an unsupported kind")
+	}
+}
+
+func TestSimulation(t *testing.T) {
+	objects, err := ReadFixtures(strings.NewReader(simulationFixtures))
+	if err != nil {
+		t.Fatalf("failed to read fixtures: %v", err)
+	}
+
+	sim, err := NewSimulation("labels expose=true", "cluster.local", objects)
+	if err != nil {
+		t.Fatalf("failed to create simulation: %v", err)
+	}
+
+	if err := sim.Start(); err != nil {
+		t.Fatalf("failed to start simulation: %v", err)
+	}
+	t.Cleanup(func() { _ = sim.Stop() })
+
+	tests := []struct {
+		name   string
+		qname  string
+		subnet string
+		answer string
+	}{
+		{name: "same tenant", qname: "web.team-a.svc.cluster.local.", subnet: "10.0.0.7", answer: "172.16.0.1"},
+		{name: "exposed service", qname: "api.team-b.svc.cluster.local.", subnet: "10.0.0.7", answer: "172.16.0.2"},
+		{name: "other tenant", qname: "db.team-b.svc.cluster.local.", subnet: "10.0.0.7"},
+		{name: "outside of the tenants", qname: "db.team-b.svc.cluster.local.", answer: "172.16.0.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := new(dns.Msg)
+			m.SetQuestion(tt.qname, dns.TypeA)
+
+			if tt.subnet != "" {
+				m.SetEdns0(4096, false)
+				opt := m.IsEdns0()
+				opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+					Code:          dns.EDNS0SUBNET,
+					Family:        1,
+					SourceNetmask: 32,
+					Address:       net.ParseIP(tt.subnet),
+				})
+			}
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			sim.ServeDNS(rec, m)
+
+			if rec.Msg == nil {
+				t.Fatal("no answer written")
+			}
+
+			if rec.Msg.Rcode != dns.RcodeSuccess {
+				t.Errorf("got rcode %s, want NOERROR", dns.RcodeToString[rec.Msg.Rcode])
+			}
+
+			var answer string
+			if len(rec.Msg.Answer) > 0 {
+				if a, ok := rec.Msg.Answer[0].(*dns.A); ok {
+					answer = a.A.String()
+				}
+			}
+
+			if answer != tt.answer {
+				t.Errorf("got answer %q, want %q", answer, tt.answer)
+			}
+		})
+	}
+}
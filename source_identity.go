@@ -0,0 +1,178 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// Mechanisms deriving the source address of a query, for source_identity.
+const (
+	sourceEDNS   = "edns"
+	sourceProxy  = "proxy_proto"
+	sourceXFF    = "xff"
+	sourceSocket = "socket"
+)
+
+// defaultSourceIdentity applies without source_identity, the mechanisms
+// trusting the peers of trusted_frontends and trusted_proxies.
+var defaultSourceIdentity = []sourceMechanism{{name: sourceProxy}, {name: sourceXFF}}
+
+// sourceMechanism is a way of deriving the source address of a query, believed
+// for queries received from trusted peers.
+type sourceMechanism struct {
+	name    string
+	trusted []netip.Prefix
+}
+
+func (m sourceMechanism) String() string {
+	s := m.name
+	for _, prefix := range m.trusted {
+		s += " " + prefix.String()
+	}
+
+	return s
+}
+
+// sourceIdentityStrings returns the mechanisms as configured.
+func sourceIdentityStrings(mechanisms []sourceMechanism) []string {
+	s := make([]string, 0, len(mechanisms))
+	for _, m := range mechanisms {
+		s = append(s, m.String())
+	}
+
+	return s
+}
+
+// sourceWriter reports the source address derived for the query as the remote
+// address.
+type sourceWriter struct {
+	dns.ResponseWriter
+	client netip.Addr
+}
+
+func (w *sourceWriter) RemoteAddr() net.Addr {
+	// The transport tells how large an answer may be, keep it.
+	if w.ResponseWriter.RemoteAddr().Network() == "udp" {
+		return &net.UDPAddr{IP: w.client.AsSlice()}
+	}
+
+	return &net.TCPAddr{IP: w.client.AsSlice()}
+}
+
+// identify returns w reporting the source address of r as derived by the
+// source_identity mechanisms, in order, the first one applying winning. The
+// address r comes from is used when none applies. Without source_identity,
+// the PROXY protocol header is believed from trusted_frontends, then
+// X-Forwarded-For from trusted_proxies.
+func (h *Capsule) identify(w dns.ResponseWriter, r *dns.Msg) dns.ResponseWriter {
+	peer, ok := addrOf(w.RemoteAddr().String())
+	if !ok {
+		return w
+	}
+
+	proxied, _ := w.RemoteAddr().(*proxyAddr)
+
+	mechanisms := h.sourceIdentity
+	if mechanisms == nil {
+		if proxied == nil && len(h.trustedProxies) == 0 {
+			return w
+		}
+
+		mechanisms = defaultSourceIdentity
+	}
+
+	for _, m := range mechanisms {
+		var client netip.Addr
+
+		switch m.name {
+		case sourceSocket:
+			return socketWriter(w, proxied, peer)
+		case sourceProxy:
+			trusted := m.trusted
+			if trusted == nil {
+				trusted = h.trustedFrontends
+			}
+
+			if proxied != nil && containsAddr(trusted, peer) {
+				client = proxied.client.Addr().Unmap()
+			}
+		case sourceXFF:
+			trusted := m.trusted
+			if trusted == nil {
+				trusted = h.trustedProxies
+			}
+
+			client = forwardedFor(w, peer, trusted)
+		case sourceEDNS:
+			if containsAddr(m.trusted, peer) {
+				client = clientSubnetAddr(r)
+			}
+		}
+
+		if client.IsValid() {
+			return &sourceWriter{ResponseWriter: w, client: client}
+		}
+	}
+
+	return socketWriter(w, proxied, peer)
+}
+
+// frontends returns the peers whose PROXY protocol header is parsed, those of
+// trusted_frontends and those proxy_proto trusts.
+func (h *Capsule) frontends() []netip.Prefix {
+	frontends := h.trustedFrontends
+
+	for _, m := range h.sourceIdentity {
+		if m.name == sourceProxy {
+			frontends = append(slices.Clip(frontends), m.trusted...)
+		}
+	}
+
+	return frontends
+}
+
+// socketWriter returns w reporting peer, the address the query comes from,
+// rather than the client named by the PROXY protocol header of proxied.
+func socketWriter(w dns.ResponseWriter, proxied *proxyAddr, peer netip.Addr) dns.ResponseWriter {
+	if proxied == nil {
+		return w
+	}
+
+	return &sourceWriter{ResponseWriter: w, client: peer}
+}
+
+// clientSubnetAddr returns the address of the EDNS0 client subnet option of r
+// when it names a single address: a wider subnet doesn't tell pods apart.
+func clientSubnetAddr(r *dns.Msg) netip.Addr {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return netip.Addr{}
+	}
+
+	for _, o := range opt.Option {
+		subnet, ok := o.(*dns.EDNS0_SUBNET)
+		if !ok {
+			continue
+		}
+
+		addr, ok := netip.AddrFromSlice(subnet.Address)
+		if !ok {
+			return netip.Addr{}
+		}
+
+		addr = addr.Unmap()
+		if int(subnet.SourceNetmask) != addr.BitLen() {
+			return netip.Addr{}
+		}
+
+		return addr
+	}
+
+	return netip.Addr{}
+}
@@ -0,0 +1,139 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+func TestParseSourceIdentity(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "ordering",
+			input: "source_identity edns 10.96.0.10 10.97.0.0/16\nsource_identity xff 10.244.0.0/16\nsource_identity socket",
+			want:  []string{"edns 10.96.0.10/32 10.97.0.0/16", "xff 10.244.0.0/16", "socket"},
+		},
+		{name: "xff from trusted_proxies", input: "trusted_proxies 10.244.0.0/16\nsource_identity xff", want: []string{"xff"}},
+		{
+			name:  "proxy_proto",
+			input: "trusted_frontends 10.0.0.0/24\nsource_identity proxy_proto\nsource_identity edns 10.96.0.10",
+			want:  []string{"proxy_proto", "edns 10.96.0.10/32"},
+		},
+		{name: "proxy_proto trusting its own", input: "source_identity proxy_proto 10.0.0.0/24", want: []string{"proxy_proto 10.0.0.0/24"}},
+		{name: "unknown mechanism", input: "source_identity ecs 10.96.0.10", wantErr: true},
+		{name: "proxy_proto trusting no one", input: "source_identity proxy_proto", wantErr: true},
+		{name: "edns trusting no one", input: "source_identity edns", wantErr: true},
+		{name: "xff trusting no one", input: "source_identity xff", wantErr: true},
+		{name: "invalid address", input: "source_identity edns 10.96.0", wantErr: true},
+		{name: "listed twice", input: "source_identity edns 10.96.0.10\nsource_identity edns 10.97.0.10", wantErr: true},
+		{name: "after socket", input: "source_identity socket\nsource_identity edns 10.96.0.10", wantErr: true},
+		{name: "socket with addresses", input: "source_identity socket 10.96.0.10", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", "capsule {\n"+tt.input+"\n}")
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			got := sourceIdentityStrings(h.sourceIdentity)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	h, err := parseConfig("test", "source_identity edns 10.96.0.10\nsource_identity xff 10.96.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		remote string
+		subnet string
+		mask   uint8
+		xff    string
+		want   string
+	}{
+		{name: "socket", remote: "10.244.1.5", want: "10.244.1.5"},
+		{name: "client subnet", remote: "10.96.0.10", subnet: "10.244.1.5", mask: 32, want: "10.244.1.5"},
+		{name: "client subnet over xff", remote: "10.96.0.10", subnet: "10.244.1.5", mask: 32, xff: "10.244.2.7", want: "10.244.1.5"},
+		{name: "untrusted client subnet", remote: "10.96.0.11", subnet: "10.244.1.5", mask: 32, want: "10.96.0.11"},
+		{name: "client subnet of a network", remote: "10.96.0.10", subnet: "10.244.1.0", mask: 24, want: "10.96.0.10"},
+		{name: "xff without client subnet", remote: "10.96.0.10", xff: "10.244.2.7", want: "10.244.2.7"},
+		{name: "ipv6 client subnet", remote: "10.96.0.10", subnet: "fd00::5", mask: 128, want: "fd00::5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := new(dns.Msg)
+			r.SetQuestion("svc-0.tenant-0.svc.cluster.local.", dns.TypeA)
+
+			if tt.subnet != "" {
+				family := uint16(1)
+				if ip := net.ParseIP(tt.subnet); ip.To4() == nil {
+					family = 2
+				}
+
+				r.SetEdns0(dns.DefaultMsgSize, false)
+				opt := r.IsEdns0()
+				opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+					Code:          dns.EDNS0SUBNET,
+					Family:        family,
+					SourceNetmask: tt.mask,
+					Address:       net.ParseIP(tt.subnet),
+				})
+			}
+
+			var w dns.ResponseWriter = &test.ResponseWriter{RemoteIP: tt.remote}
+
+			if tt.xff != "" {
+				req := &http.Request{Header: http.Header{"X-Forwarded-For": {tt.xff}}}
+				w = &dohWriter{ResponseWriter: test.ResponseWriter{RemoteIP: tt.remote}, request: req}
+			}
+
+			state := request.Request{W: h.identify(w, r), Req: r}
+			if got := state.IP(); got != tt.want {
+				t.Errorf("got source %s, want %s", got, tt.want)
+			}
+
+			if state.Proto() != "udp" {
+				t.Errorf("got transport %s, want udp", state.Proto())
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// StatusLabel marks the ConfigMaps published by the status reporter.
+	StatusLabel = "capsule.clastix.io/dns-status"
+
+	defaultStatusInterval = 30 * time.Second
+	statusTimeout         = 10 * time.Second
+	serviceAccountNsFile  = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// Version of the plugin, set at build time with
+// -ldflags "-X github.com/CorentinPtrl/capsule_coredns.Version=<version>".
+var Version = "dev"
+
+// decisionCounters counts decisions since the plugin started.
+type decisionCounters struct {
+	allowed atomic.Uint64
+	denied  atomic.Uint64
+	// failed counts the questions whose evaluation failed, answered with a
+	// fallback.
+	failed atomic.Uint64
+	// perNamespace enables the counts of namespaces, by source namespace,
+	// for tenant_stats.
+	perNamespace bool
+	namespaces   sync.Map
+}
+
+func (c *decisionCounters) record(d decision) {
+	if d.allowed {
+		c.allowed.Add(1)
+	} else {
+		c.denied.Add(1)
+	}
+
+	if c.perNamespace {
+		c.recordNamespace(d)
+	}
+}
+
+// statusReporter periodically publishes the state of this replica in a
+// ConfigMap named after the pod, owned by the pod so that it is garbage
+// collected along with it.
+type statusReporter struct {
+	capsule   *Capsule
+	interval  time.Duration
+	namespace string
+	name      string
+	done      chan struct{}
+}
+
+func newStatusReporter(h *Capsule, interval time.Duration) *statusReporter {
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		if b, err := os.ReadFile(serviceAccountNsFile); err == nil {
+			namespace = strings.TrimSpace(string(b))
+		}
+	}
+
+	return &statusReporter{
+		capsule:   h,
+		interval:  interval,
+		namespace: namespace,
+		name:      podName(),
+		done:      make(chan struct{}),
+	}
+}
+
+func podName() string {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name
+	}
+
+	name, _ := os.Hostname()
+
+	return name
+}
+
+func (r *statusReporter) Start() {
+	if r.namespace == "" || r.name == "" {
+		log.Warning("unable to determine pod name and namespace, status reporting disabled")
+
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			r.publish()
+
+			select {
+			case <-ticker.C:
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+func (r *statusReporter) Stop() {
+	close(r.done)
+}
+
+func (r *statusReporter) publish() {
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	h := r.capsule
+	client := h.dnsController.client.CoreV1().ConfigMaps(r.namespace)
+
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "capsule-coredns-status-" + r.name,
+			Namespace: r.namespace,
+			Labels: map[string]string{
+				StatusLabel: "true",
+			},
+		},
+		Data: map[string]string{
+			"pod":        r.name,
+			"version":    Version,
+			"policyHash": h.policy().policyHash(),
+			"synced":     strconv.FormatBool(h.dnsController.HasSynced()),
+			"degraded":   strconv.FormatBool(h.dnsController.Degraded()),
+			"allowed":    strconv.FormatUint(h.counters.allowed.Load(), 10),
+			"denied":     strconv.FormatUint(h.counters.denied.Load(), 10),
+			"updated":    time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	if pod := h.dnsController.getPod(r.namespace, r.name); pod != nil {
+		cm.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Name:       pod.Name,
+			UID:        pod.UID,
+		}}
+	}
+
+	current, err := client.Get(ctx, cm.Name, metav1.GetOptions{})
+
+	switch {
+	case apierrors.IsNotFound(err):
+		_, err = client.Create(ctx, cm, metav1.CreateOptions{})
+	case err == nil:
+		current.Labels = cm.Labels
+		current.Data = cm.Data
+
+		if len(cm.OwnerReferences) > 0 {
+			current.OwnerReferences = cm.OwnerReferences
+		}
+
+		_, err = client.Update(ctx, current, metav1.UpdateOptions{})
+	}
+
+	if err != nil {
+		log.Warningf("failed to publish status to %s/%s: %v", cm.Namespace, cm.Name, err)
+	}
+}
+
+// policyHash fingerprints the configuration that drives decisions, so replicas
+// running a different policy stand out.
+func (h *Capsule) policyHash() string {
+	b, _ := json.Marshal(struct {
+		Labels               *selector             `json:"labels,omitempty"`
+		ExposureLabel        string                `json:"exposureLabel,omitempty"`
+		PodExposureLabel     string                `json:"podExposureLabel,omitempty"`
+		NamespaceLabels      *selector             `json:"namespaceLabels,omitempty"`
+		NamespaceAnnotations *selector             `json:"namespaceAnnotations,omitempty"`
+		SelectorMode         string                `json:"selectorMode,omitempty"`
+		NamespaceScope       string                `json:"namespaceScope,omitempty"`
+		Tenants              *metav1.LabelSelector `json:"tenants,omitempty"`
+		StrictTenants        []string              `json:"strictTenants,omitempty"`
+		TenantAliases        map[string]string     `json:"tenantAliases,omitempty"`
+		TenantLabels         []string              `json:"tenantLabels,omitempty"`
+		TenantOwners         bool                  `json:"tenantOwners,omitempty"`
+		Apex                 string                `json:"apex,omitempty"`
+		NamespaceGrace       string                `json:"namespaceGrace,omitempty"`
+		SinkholeV4           string                `json:"sinkholeV4,omitempty"`
+		SinkholeV6           string                `json:"sinkholeV6,omitempty"`
+		BlockedCNAME         string                `json:"blockedCNAME,omitempty"`
+		NetworkPolicies      bool                  `json:"networkPolicies,omitempty"`
+		Ingresses            bool                  `json:"ingresses,omitempty"`
+		AccessRequests       bool                  `json:"accessRequests,omitempty"`
+		ExternalWorkloads    bool                  `json:"externalWorkloads,omitempty"`
+		TenantResources      bool                  `json:"tenantResources,omitempty"`
+		WithholdNamespaces   bool                  `json:"withholdNamespaces,omitempty"`
+		Visibility           bool                  `json:"visibility,omitempty"`
+		CacheTTL             string                `json:"cacheTTL,omitempty"`
+		EnforcedQtypes       []uint16              `json:"enforcedQtypes,omitempty"`
+		TrustedProxies       []netip.Prefix        `json:"trustedProxies,omitempty"`
+		TrustedFrontends     []netip.Prefix        `json:"trustedFrontends,omitempty"`
+		SourceIdentity       []string              `json:"sourceIdentity,omitempty"`
+		WithoutPods          bool                  `json:"withoutPods,omitempty"`
+		WithoutServices      bool                  `json:"withoutServices,omitempty"`
+		ClusterDomains       []string              `json:"clusterDomains,omitempty"`
+		CacheGuard           string                `json:"cacheGuard,omitempty"`
+		ReuseGrace           string                `json:"reuseGrace,omitempty"`
+		DenyReassigned       bool                  `json:"denyReassigned,omitempty"`
+	}{
+		Labels:               h.labelSelector,
+		ExposureLabel:        h.exposureLabel,
+		PodExposureLabel:     h.podExposureLabel,
+		NamespaceLabels:      h.namespaceLabelSelector,
+		NamespaceAnnotations: h.namespaceAnnotations,
+		SelectorMode:         h.selectorMode,
+		NamespaceScope:       h.namespaceScope,
+		Tenants:              h.tenantSelector,
+		StrictTenants:        slices.Sorted(maps.Keys(h.strictTenants)),
+		TenantAliases:        h.tenantAliases,
+		TenantLabels:         h.tenantLabels,
+		TenantOwners:         h.tenantOwners,
+		Apex:                 h.apex,
+		NamespaceGrace:       h.namespaceGrace.String(),
+		SinkholeV4:           ipString(h.sinkholeV4),
+		SinkholeV6:           ipString(h.sinkholeV6),
+		BlockedCNAME:         h.blockedCNAME,
+		NetworkPolicies:      h.networkPolicies,
+		Ingresses:            h.ingresses,
+		AccessRequests:       h.accessRequests,
+		ExternalWorkloads:    h.externalWorkloads,
+		TenantResources:      h.tenantResources,
+		WithholdNamespaces:   h.withholdNamespaces,
+		Visibility:           h.visibility,
+		CacheTTL:             h.cacheTTL.String(),
+		EnforcedQtypes:       slices.Sorted(maps.Keys(h.enforcedQtypes)),
+		TrustedProxies:       h.trustedProxies,
+		TrustedFrontends:     h.trustedFrontends,
+		SourceIdentity:       sourceIdentityStrings(h.sourceIdentity),
+		WithoutPods:          h.api.withoutPods,
+		WithoutServices:      h.api.withoutServices,
+		ClusterDomains:       h.clusterDomains,
+		CacheGuard:           cmp.Or(h.cacheGuard, cacheGuardEvaluate),
+		ReuseGrace:           h.reuseGrace.String(),
+		DenyReassigned:       h.denyReassigned,
+	})
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,33 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyHash(t *testing.T) {
+	base := (&Capsule{}).policyHash()
+
+	if got := (&Capsule{cacheGuard: cacheGuardEvaluate}).policyHash(); got != base {
+		t.Errorf("got hash %s for the default cache_guard spelled out, want %s", got, base)
+	}
+
+	for name, h := range map[string]*Capsule{
+		"cluster_domains":      {clusterDomains: []string{"cluster.local", "edge.local"}},
+		"cache_guard":          {cacheGuard: cacheGuardOff},
+		"ip_reuse_grace":       {reuseGrace: 30 * time.Second},
+		"ip_reuse_grace deny":  {reuseGrace: 30 * time.Second, denyReassigned: true},
+		"evaluation directive": {networkPolicies: true},
+	} {
+		if got := h.policyHash(); got == base {
+			t.Errorf("got the same hash %s with %s set", got, name)
+		}
+	}
+
+	if a, b := (&Capsule{reuseGrace: 30 * time.Second}).policyHash(), (&Capsule{reuseGrace: 30 * time.Second, denyReassigned: true}).policyHash(); a == b {
+		t.Errorf("got the same hash %s whether reassigned IPs are denied or not", a)
+	}
+}
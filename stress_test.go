@@ -0,0 +1,187 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build race
+
+package capsule_coredns
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	stressQueriers = 200
+	stressDuration = 5 * time.Second
+)
+
+// TestStress hammers ServeDNS from hundreds of goroutines while pods,
+// services and namespace labels churn through the informers and the policy in
+// force is swapped, for the race detector to catch unsynchronized accesses to
+// the caches and policy state. It only builds with -race, see make test-stress.
+func TestStress(t *testing.T) {
+	duration := stressDuration
+	if testing.Short() {
+		duration = time.Second
+	}
+
+	cl := newCluster(8, 20, 5)
+	clientset := fake.NewClientset(cl.objects()...)
+
+	h := newTestCapsuleForClient(t, cl, clientset, dnsControllerOptions{reuseGrace: time.Second})
+	h.labelSelector = matchLabels(map[string]string{"expose": "true"})
+	h.cache = newDecisionCache(100*time.Millisecond, defaultDecisionCacheSize)
+	h.search = newSearchCache(100*time.Millisecond, defaultSearchCacheSize)
+	h.live = &atomic.Pointer[Capsule]{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		queries atomic.Int64
+	)
+
+	for range stressQueriers {
+		wg.Go(func() {
+			for ctx.Err() == nil {
+				src := cl.pods[rand.IntN(len(cl.pods))].Status.PodIPs[0].IP
+				svc := cl.services[rand.IntN(len(cl.services))]
+
+				m := new(dns.Msg)
+				if rand.IntN(4) == 0 {
+					m.SetQuestion("_http._tcp."+svc.Name+"."+svc.Namespace+".svc."+testZone, dns.TypeSRV)
+				} else {
+					m.SetQuestion(svc.Name+"."+svc.Namespace+".svc."+testZone, dns.TypeA)
+				}
+
+				rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: src})
+
+				if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+					t.Errorf("ServeDNS failed: %v", err)
+
+					return
+				}
+
+				queries.Add(1)
+			}
+		})
+	}
+
+	churn := func(name string, step func(i int) error) {
+		wg.Go(func() {
+			for i := 0; ctx.Err() == nil; i++ {
+				if err := step(i); err != nil {
+					t.Errorf("%s: %v", name, err)
+
+					return
+				}
+
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+
+	core := clientset.CoreV1()
+
+	// Pods swap their IPs, as reassigned addresses do.
+	churn("pods", func(i int) error {
+		a, b := cl.pods[rand.IntN(len(cl.pods))], cl.pods[rand.IntN(len(cl.pods))]
+
+		podA, err := core.Pods(a.Namespace).Get(ctx, a.Name, metav1.GetOptions{})
+		if err != nil {
+			return ignoreDone(ctx, err)
+		}
+
+		podB, err := core.Pods(b.Namespace).Get(ctx, b.Name, metav1.GetOptions{})
+		if err != nil {
+			return ignoreDone(ctx, err)
+		}
+
+		podA.Status.PodIPs, podB.Status.PodIPs = podB.Status.PodIPs, podA.Status.PodIPs
+
+		for _, pod := range []*v1.Pod{podA, podB} {
+			if _, err := core.Pods(pod.Namespace).UpdateStatus(ctx, pod, metav1.UpdateOptions{}); err != nil {
+				return ignoreDone(ctx, err)
+			}
+		}
+
+		return nil
+	})
+
+	// Services are exposed and hidden, deleted and created again.
+	churn("services", func(i int) error {
+		svc := cl.services[rand.IntN(len(cl.services))].DeepCopy()
+
+		if i%10 == 0 {
+			if err := core.Services(svc.Namespace).Delete(ctx, svc.Name, metav1.DeleteOptions{}); err != nil {
+				return ignoreDone(ctx, err)
+			}
+
+			_, err := core.Services(svc.Namespace).Create(ctx, svc, metav1.CreateOptions{})
+
+			return ignoreDone(ctx, err)
+		}
+
+		svc.Labels = map[string]string{"expose": []string{"true", "false"}[i%2]}
+		_, err := core.Services(svc.Namespace).Update(ctx, svc, metav1.UpdateOptions{})
+
+		return ignoreDone(ctx, err)
+	})
+
+	// Namespaces move between tenants.
+	churn("namespaces", func(i int) error {
+		ns := cl.namespaces[rand.IntN(len(cl.namespaces))].DeepCopy()
+		ns.Labels = map[string]string{CapsuleTenantLabel: cl.namespaces[rand.IntN(len(cl.namespaces))].Name}
+
+		_, err := core.Namespaces().Update(ctx, ns, metav1.UpdateOptions{})
+
+		return ignoreDone(ctx, err)
+	})
+
+	// The policy in force changes, as with config_resource.
+	churn("policy", func(i int) error {
+		if i%2 == 0 {
+			h.live.Store(nil)
+
+			return nil
+		}
+
+		p, err := h.withConfig(newConfigResource("default", map[string]any{"selectorMode": "all", "visibility": true}))
+		if err != nil {
+			return err
+		}
+
+		h.live.Store(p)
+
+		return nil
+	})
+
+	wg.Wait()
+
+	if queries.Load() == 0 {
+		t.Fatal("no query served")
+	}
+
+	t.Logf("served %d queries", queries.Load())
+}
+
+// ignoreDone drops the errors of requests interrupted by the end of the test.
+func ignoreDone(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,52 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// addTenantAliases records names as aliases of tenant in aliases, which maps
+// each alias to the tenant it stands for. Aliases don't chain: a tenant with
+// aliases can't be an alias itself.
+func addTenantAliases(aliases map[string]string, tenant string, names []string) error {
+	if other, ok := aliases[tenant]; ok {
+		return fmt.Errorf("'%s' is already an alias of '%s'", tenant, other)
+	}
+
+	for _, name := range names {
+		if name == tenant {
+			return fmt.Errorf("'%s' is aliased to itself", tenant)
+		}
+
+		if other, ok := aliases[name]; ok && other != tenant {
+			return fmt.Errorf("'%s' is already an alias of '%s'", name, other)
+		}
+
+		if slices.Contains(slices.Collect(maps.Values(aliases)), name) {
+			return fmt.Errorf("'%s' already has aliases", name)
+		}
+
+		aliases[name] = tenant
+	}
+
+	return nil
+}
+
+// tenantOf returns the tenant that the tenant label value tenant stands for.
+func (h *Capsule) tenantOf(tenant string) string {
+	if t, ok := h.tenantAliases[tenant]; ok {
+		return t
+	}
+
+	return tenant
+}
+
+// sameTenant reports whether the tenant label values a and b stand for the
+// same tenant, aliases included.
+func (h *Capsule) sameTenant(a, b string) bool {
+	return a == b || h.tenantOf(a) == h.tenantOf(b)
+}
@@ -0,0 +1,91 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/coredns/caddy"
+)
+
+func TestParseTenantAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "none", input: "capsule {\nnetworkpolicies\n}"},
+		{
+			name:  "split tenant",
+			input: "capsule {\ntenant_alias team-a team-a-prod team-a-dev\ntenant_alias team-b team-b-old\n}",
+			want:  map[string]string{"team-a-prod": "team-a", "team-a-dev": "team-a", "team-b-old": "team-b"},
+		},
+		{name: "missing alias", input: "capsule {\ntenant_alias team-a\n}", wantErr: true},
+		{name: "self alias", input: "capsule {\ntenant_alias team-a team-a\n}", wantErr: true},
+		{name: "two tenants", input: "capsule {\ntenant_alias team-a shared\ntenant_alias team-b shared\n}", wantErr: true},
+		{name: "alias with aliases", input: "capsule {\ntenant_alias team-a team-b\ntenant_alias team-c team-a\n}", wantErr: true},
+		{name: "tenant already an alias", input: "capsule {\ntenant_alias team-a team-b\ntenant_alias team-b team-c\n}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !maps.Equal(h.tenantAliases, tt.want) {
+				t.Errorf("got %v, want %v", h.tenantAliases, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateTenantAlias(t *testing.T) {
+	cl := newCluster(3, 1, 1)
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.tenantAliases = map[string]string{"tenant-1": "tenant-0"}
+
+	tests := []struct {
+		name   string
+		from   int
+		to     int
+		reason string
+	}{
+		{name: "alias to tenant", from: 0, to: 1, reason: reasonSameTenant},
+		{name: "tenant to alias", from: 1, to: 0, reason: reasonSameTenant},
+		{name: "other tenant", from: 1, to: 2, reason: reasonCrossTenant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := h.dnsController.Evaluate(t.Context(), cl.pods[tt.from].Status.PodIPs[0].IP, cl.services[tt.to].Spec.ClusterIP, *h)
+			if d.reason != tt.reason {
+				t.Errorf("got reason %s, want %s", d.reason, tt.reason)
+			}
+
+			// Decisions report the tenant labels as they are.
+			if d.srcTenant != cl.namespaces[tt.from].Name || d.dstTenant != cl.namespaces[tt.to].Name {
+				t.Errorf("got tenants %s and %s", d.srcTenant, d.dstTenant)
+			}
+		})
+	}
+}
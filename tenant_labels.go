@@ -0,0 +1,23 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+// tenantOfNamespace returns the tenant of a namespace labelled with labels,
+// read from the first of the tenant_labels keys it carries, and whether it
+// belongs to a tenant.
+func (h *Capsule) tenantOfNamespace(labels map[string]string) (string, bool) {
+	if len(h.tenantLabels) == 0 {
+		tenant, ok := labels[CapsuleTenantLabel]
+
+		return tenant, ok
+	}
+
+	for _, key := range h.tenantLabels {
+		if tenant, ok := labels[key]; ok {
+			return tenant, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,139 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/coredns/caddy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseTenantLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "default", input: "capsule {\nnetworkpolicies\n}"},
+		{name: "ordered keys", input: "capsule {\ntenant_labels example.com/tenant capsule.clastix.io/tenant\n}", want: []string{"example.com/tenant", "capsule.clastix.io/tenant"}},
+		{name: "missing key", input: "capsule {\ntenant_labels\n}", wantErr: true},
+		{name: "invalid key", input: "capsule {\ntenant_labels example.com/tenant/v2\n}", wantErr: true},
+		{name: "duplicate key", input: "capsule {\ntenant_labels tenant tenant\n}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			h := &Capsule{}
+
+			var err error
+			for c.Next() && err == nil {
+				err = h.Parse(c)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(h.tenantLabels, tt.want) {
+				t.Errorf("got %v, want %v", h.tenantLabels, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateTenantLabels(t *testing.T) {
+	const newLabel = "example.com/tenant"
+
+	cl := newCluster(3, 1, 1)
+
+	// tenant-1 migrated to the new key, tenant-2 carries both keys with
+	// different values, the first key listed taking precedence.
+	cl.namespaces[1].Labels = map[string]string{newLabel: "tenant-0"}
+	cl.namespaces[2].Labels[newLabel] = "tenant-0"
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+
+	evaluate := func(from, to int) decision {
+		return h.dnsController.Evaluate(t.Context(), cl.pods[from].Status.PodIPs[0].IP, cl.services[to].Spec.ClusterIP, *h)
+	}
+
+	if d := evaluate(0, 1); d.reason != reasonNonTenantDestination {
+		t.Errorf("without tenant_labels: got reason %s, want %s", d.reason, reasonNonTenantDestination)
+	}
+
+	h.tenantLabels = []string{newLabel, CapsuleTenantLabel}
+
+	tests := []struct {
+		from, to int
+		reason   string
+	}{
+		{from: 0, to: 1, reason: reasonSameTenant},
+		{from: 1, to: 0, reason: reasonSameTenant},
+		{from: 2, to: 0, reason: reasonSameTenant},
+	}
+
+	for _, tt := range tests {
+		if d := evaluate(tt.from, tt.to); d.reason != tt.reason {
+			t.Errorf("tenant-%d to tenant-%d: got reason %s, want %s", tt.from, tt.to, d.reason, tt.reason)
+		}
+	}
+
+	for _, a := range h.dnsController.snapshot(h) {
+		if a.Tenant != "tenant-0" {
+			t.Errorf("got tenant %q for %s/%s in the snapshot, want tenant-0", a.Tenant, a.Namespace, a.Name)
+		}
+	}
+}
+
+func TestEvaluateTenantLabelsShard(t *testing.T) {
+	const newLabel = "example.com/tenant"
+
+	cl := newCluster(2, 1, 1)
+
+	// tenant-1 only carries the new key.
+	cl.namespaces[1].Labels = map[string]string{newLabel: "tenant-1"}
+
+	tests := []struct {
+		name   string
+		shard  *metav1.LabelSelector
+		reason string
+	}{
+		{
+			name:   "in shard",
+			shard:  &metav1.LabelSelector{MatchLabels: map[string]string{CapsuleTenantLabel: "tenant-1"}},
+			reason: reasonCrossTenant,
+		},
+		{
+			name: "out of shard",
+			shard: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: CapsuleTenantLabel, Operator: metav1.LabelSelectorOpNotIn, Values: []string{"tenant-1"}},
+			}},
+			reason: reasonOutOfShard,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestCapsule(t, cl, dnsControllerOptions{tenantSelector: tt.shard})
+			h.tenantLabels = []string{newLabel, CapsuleTenantLabel}
+
+			d := h.dnsController.Evaluate(t.Context(), cl.pods[1].Status.PodIPs[0].IP, cl.services[0].Spec.ClusterIP, *h)
+			if d.reason != tt.reason {
+				t.Errorf("got reason %s, want %s", d.reason, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// TenantNamespaceIndex indexes Tenants by the namespaces their status lists.
+const TenantNamespaceIndex = "statusNamespaces"
+
+// tenantNamespaces indexes a Tenant by the namespaces Capsule lists in its
+// status.
+func tenantNamespaces(obj any) ([]string, error) {
+	t, ok := obj.(*tenant)
+	if !ok {
+		return []string{}, nil
+	}
+
+	return t.namespaces, nil
+}
+
+// namespaceTenant returns the tenant of ns, read from its labels as h
+// configures, or with tenant_owners from the Tenant that owns it, and whether
+// it belongs to a tenant.
+func (c *dnsController) namespaceTenant(h *Capsule, ns *v1.Namespace) (string, bool) {
+	if tenant, ok := h.tenantOfNamespace(ns.Labels); ok {
+		return tenant, true
+	}
+
+	if c.tenantOwners {
+		return c.ownerTenant(ns)
+	}
+
+	return "", false
+}
+
+// ownerTenant returns the cached Tenant that owns ns, for namespaces whose
+// tenant label is not set yet or was removed. Capsule makes a Tenant the
+// controller of its namespaces and lists them in its status, either tells.
+func (c *dnsController) ownerTenant(ns *v1.Namespace) (string, bool) {
+	store := c.tenantInformer.GetIndexer()
+
+	for _, ref := range ns.OwnerReferences {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil || gv.Group != tenantsResource.Group || ref.Kind != "Tenant" {
+			continue
+		}
+
+		obj, exists, err := store.GetByKey(ref.Name)
+		if err != nil || !exists {
+			continue
+		}
+
+		if t, ok := obj.(*tenant); ok && t.UID == ref.UID {
+			return t.Name, true
+		}
+	}
+
+	tenants, err := store.ByIndex(TenantNamespaceIndex, ns.Name)
+	if err != nil || len(tenants) != 1 {
+		return "", false
+	}
+
+	t, ok := tenants[0].(*tenant)
+	if !ok {
+		return "", false
+	}
+
+	return t.Name, true
+}
@@ -0,0 +1,97 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+func newTenant(name string, uid types.UID, namespaces ...any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "capsule.clastix.io/v1beta2",
+		"kind":       "Tenant",
+		"metadata":   map[string]any{"name": name, "uid": string(uid)},
+		"status":     map[string]any{"namespaces": namespaces},
+	}}
+}
+
+func TestEvaluateTenantOwners(t *testing.T) {
+	cl := newCluster(4, 1, 1)
+
+	// tenant-1 lost its label but is owned by the Tenant, tenant-2 is only
+	// listed in its status, tenant-3 is owned by a Tenant of the same name
+	// that was deleted and recreated.
+	owner := func(name string, uid types.UID) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{
+			APIVersion: "capsule.clastix.io/v1beta2",
+			Kind:       "Tenant",
+			Name:       name,
+			UID:        uid,
+			Controller: ptr.To(true),
+		}}
+	}
+
+	for _, ns := range cl.namespaces[1:] {
+		ns.Labels = nil
+	}
+
+	cl.namespaces[1].OwnerReferences = owner("tenant-0", "uid-0")
+	cl.namespaces[3].OwnerReferences = owner("tenant-3", "uid-old")
+
+	set, err := newInformerSet(fake.NewClientset(cl.objects()...), apiConfig{})
+	if err != nil {
+		t.Fatalf("failed to create informers: %v", err)
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{tenantsResource: "TenantList"},
+		newTenant("tenant-0", "uid-0", "tenant-0", "tenant-1", "tenant-2"),
+		newTenant("tenant-3", "uid-3"))
+	set.dynamic = dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
+
+	ctrl, err := newDNSControllerForSet(set, dnsControllerOptions{tenantOwners: true})
+	if err != nil {
+		t.Fatalf("failed to create DNS controller: %v", err)
+	}
+
+	go ctrl.Start()
+	t.Cleanup(ctrl.Stop)
+
+	waitForSync(t, ctrl)
+
+	tests := []struct {
+		name   string
+		owners bool
+		src    int
+		dst    int
+		reason string
+	}{
+		{name: "owner reference", owners: true, src: 0, dst: 1, reason: reasonSameTenant},
+		{name: "owned source", owners: true, src: 1, dst: 0, reason: reasonSameTenant},
+		{name: "tenant status", owners: true, src: 2, dst: 0, reason: reasonSameTenant},
+		{name: "stale owner", owners: true, src: 0, dst: 3, reason: reasonNonTenantDestination},
+		{name: "disabled", src: 0, dst: 1, reason: reasonNonTenantDestination},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl.tenantOwners = tt.owners
+
+			d := ctrl.Evaluate(t.Context(), cl.pods[tt.src].Status.PodIPs[0].IP, cl.services[tt.dst].Spec.ClusterIP, Capsule{})
+			if d.reason != tt.reason {
+				t.Errorf("got reason %s, want %s", d.reason, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The Capsule resources replicating objects into tenant namespaces.
+var (
+	globalTenantResourceResource = schema.GroupVersionResource{
+		Group:    "capsule.clastix.io",
+		Version:  "v1beta2",
+		Resource: "globaltenantresources",
+	}
+	tenantResourceResource = schema.GroupVersionResource{
+		Group:    "capsule.clastix.io",
+		Version:  "v1beta2",
+		Resource: "tenantresources",
+	}
+)
+
+// TenantResourceSourceIndex indexes (Global)TenantResources by the namespaces
+// they replicate services from.
+const TenantResourceSourceIndex = "sourceNamespace"
+
+// tenantResource is the part of a (Global)TenantResource the controller keeps:
+// the services it selects for replication and the replicas it reports.
+type tenantResource struct {
+	metav1.ObjectMeta
+
+	sources []serviceSource
+	// replicas holds the namespace/name of the replicated services.
+	replicas map[string]bool
+}
+
+// serviceSource selects the services of a namespace to replicate.
+type serviceSource struct {
+	namespace string
+	selector  labels.Selector
+}
+
+// slimTenantResource converts the unstructured (Global)TenantResources of the
+// dynamic informers. Both share the spec.resources and status.processedItems
+// layout.
+func slimTenantResource(obj any) (any, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return obj, nil
+	}
+
+	var parsed struct {
+		Spec   capsulev1beta2.TenantResourceSpec `json:"spec"`
+		Status struct {
+			ProcessedItems capsulev1beta2.ProcessedItems `json:"processedItems"`
+		} `json:"status"`
+	}
+
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &parsed); err != nil {
+		log.Warningf("ignoring malformed %s %s: %v", u.GetKind(), u.GetName(), err)
+	}
+
+	r := &tenantResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            u.GetName(),
+			Namespace:       u.GetNamespace(),
+			UID:             u.GetUID(),
+			ResourceVersion: u.GetResourceVersion(),
+		},
+		replicas: map[string]bool{},
+	}
+
+	for _, resource := range parsed.Spec.Resources {
+		for _, item := range resource.NamespacedItems {
+			if !isService(item.Kind, item.APIVersion) {
+				continue
+			}
+
+			selector, err := metav1.LabelSelectorAsSelector(&item.Selector)
+			if err != nil {
+				continue
+			}
+
+			r.sources = append(r.sources, serviceSource{namespace: item.Namespace, selector: selector})
+		}
+	}
+
+	for _, item := range parsed.Status.ProcessedItems {
+		if isService(item.Kind, item.APIVersion) {
+			r.replicas[item.Namespace+"/"+item.Name] = true
+		}
+	}
+
+	return r, nil
+}
+
+// isService reports whether kind and apiVersion, as recorded by Capsule, name
+// core services. processedItems only carry the version.
+func isService(kind, apiVersion string) bool {
+	return kind == "Service" && (apiVersion == "v1" || apiVersion == "")
+}
+
+// tenantResourceSources indexes a (Global)TenantResource by the namespaces it
+// replicates services from.
+func tenantResourceSources(obj any) ([]string, error) {
+	r, ok := obj.(*tenantResource)
+	if !ok {
+		return []string{}, nil
+	}
+
+	namespaces := make([]string, 0, len(r.sources))
+	for _, source := range r.sources {
+		namespaces = append(namespaces, source.namespace)
+	}
+
+	return namespaces, nil
+}
+
+// replicatedTo reports whether obj is a service a (Global)TenantResource
+// replicated into nsFrom. The replica labels are not trusted, tenants can set
+// them on services of their own; the status of the replicating resource is.
+// processedItems don't record the source of a replica, any selected service of
+// the same name counts, as Capsule could not replicate both into nsFrom anyway.
+func (c *dnsController) replicatedTo(nsFrom *v1.Namespace, obj any) bool {
+	svc, ok := obj.(*v1.Service)
+	if !ok {
+		return false
+	}
+
+	for _, informer := range c.replicaInformers {
+		resources, err := informer.GetIndexer().ByIndex(TenantResourceSourceIndex, svc.Namespace)
+		if err != nil {
+			continue
+		}
+
+		for _, obj := range resources {
+			r, ok := obj.(*tenantResource)
+			if !ok || !r.replicas[nsFrom.Name+"/"+svc.Name] {
+				continue
+			}
+
+			for _, source := range r.sources {
+				if source.namespace == svc.Namespace && source.selector.Matches(labels.Set(svc.Labels)) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,96 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEvaluateReplicatedService(t *testing.T) {
+	cl := newCluster(4, 1, 1)
+	cl.services[1].Labels = map[string]string{"shared": "true"}
+
+	// tenant-1 shares svc-0 with tenant-0, nothing of tenant-2 is selected.
+	replicator := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "capsule.clastix.io/v1beta2",
+		"kind":       "GlobalTenantResource",
+		"metadata":   map[string]any{"name": "shared-services"},
+		"spec": map[string]any{
+			"resyncPeriod": "60s",
+			"resources": []any{map[string]any{
+				"namespacedItems": []any{
+					map[string]any{
+						"kind":       "Service",
+						"apiVersion": "v1",
+						"namespace":  "tenant-1",
+						"selector":   map[string]any{"matchLabels": map[string]any{"shared": "true"}},
+					},
+					map[string]any{
+						"kind":       "Service",
+						"apiVersion": "v1",
+						"namespace":  "tenant-2",
+						"selector":   map[string]any{"matchLabels": map[string]any{"shared": "true"}},
+					},
+				},
+			}},
+		},
+		"status": map[string]any{
+			"selectedTenants": []any{"tenant-0"},
+			"processedItems": []any{
+				map[string]any{"kind": "Service", "apiVersion": "v1", "namespace": "tenant-0", "name": "svc-0"},
+			},
+		},
+	}}
+
+	set, err := newInformerSet(fake.NewClientset(cl.objects()...), apiConfig{})
+	if err != nil {
+		t.Fatalf("failed to create informers: %v", err)
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			globalTenantResourceResource: "GlobalTenantResourceList",
+			tenantResourceResource:       "TenantResourceList",
+		}, replicator)
+	set.dynamic = dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
+
+	ctrl, err := newDNSControllerForSet(set, dnsControllerOptions{tenantResources: true})
+	if err != nil {
+		t.Fatalf("failed to create DNS controller: %v", err)
+	}
+
+	go ctrl.Start()
+	t.Cleanup(ctrl.Stop)
+
+	waitForSync(t, ctrl)
+
+	tests := []struct {
+		name    string
+		src     int
+		dst     int
+		allowed bool
+		reason  string
+	}{
+		{name: "replicated", src: 0, dst: 1, allowed: true, reason: reasonReplicatedService},
+		{name: "not replicated to the source", src: 3, dst: 1, reason: reasonCrossTenant},
+		{name: "not selected", src: 0, dst: 2, reason: reasonCrossTenant},
+		{name: "not a source", src: 1, dst: 3, reason: reasonCrossTenant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := ctrl.Evaluate(t.Context(), cl.pods[tt.src].Status.PodIPs[0].IP, cl.services[tt.dst].Spec.ClusterIP, Capsule{})
+			if d.allowed != tt.allowed || d.reason != tt.reason {
+				t.Errorf("got allowed=%t reason=%s, want allowed=%t reason=%s", d.allowed, d.reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// TenantStatsLabel marks the ConfigMaps published by the tenant stats
+	// reporter.
+	TenantStatsLabel = "capsule.clastix.io/dns-stats"
+
+	tenantStatsName            = "capsule-coredns-dns-stats"
+	defaultTenantStatsInterval = time.Minute
+)
+
+// namespaceCounters counts the decisions for the queries of a tenant
+// namespace since the plugin started.
+type namespaceCounters struct {
+	tenant  string
+	allowed atomic.Uint64
+	denied  atomic.Uint64
+}
+
+// recordNamespace counts d for its source namespace, when it belongs to a
+// tenant.
+func (c *decisionCounters) recordNamespace(d decision) {
+	if d.srcTenant == "" || d.srcNamespace == "" {
+		return
+	}
+
+	counters, ok := c.namespaces.Load(d.srcNamespace)
+	if !ok {
+		counters, _ = c.namespaces.LoadOrStore(d.srcNamespace, &namespaceCounters{tenant: d.srcTenant})
+	}
+
+	if d.allowed {
+		counters.(*namespaceCounters).allowed.Add(1)
+	} else {
+		counters.(*namespaceCounters).denied.Add(1)
+	}
+}
+
+// tenantStats is what a replica publishes in a tenant namespace, under its
+// own key.
+type tenantStats struct {
+	Tenant        string `json:"tenant"`
+	Allowed       uint64 `json:"allowed"`
+	Denied        uint64 `json:"denied"`
+	TenantAllowed uint64 `json:"tenantAllowed"`
+	TenantDenied  uint64 `json:"tenantDenied"`
+	Updated       string `json:"updated"`
+}
+
+// tenantStatsReporter periodically publishes the decision counts of each
+// tenant namespace in a ConfigMap of that namespace, readable by the tenant
+// owners. Each replica patches its own key, named after the pod, so that
+// replicas don't overwrite each other.
+type tenantStatsReporter struct {
+	capsule  *Capsule
+	interval time.Duration
+	name     string
+	done     chan struct{}
+	// published holds the tenant totals last published, only the namespaces
+	// of the tenants whose totals changed are written again.
+	published map[string][2]uint64
+}
+
+func newTenantStatsReporter(h *Capsule, interval time.Duration) *tenantStatsReporter {
+	return &tenantStatsReporter{
+		capsule:   h,
+		interval:  interval,
+		name:      podName(),
+		done:      make(chan struct{}),
+		published: make(map[string][2]uint64),
+	}
+}
+
+func (r *tenantStatsReporter) Start() {
+	if r.name == "" {
+		log.Warning("unable to determine pod name, tenant stats disabled")
+
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.publish()
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+func (r *tenantStatsReporter) Stop() {
+	close(r.done)
+}
+
+func (r *tenantStatsReporter) publish() {
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	stats := map[string]*tenantStats{}
+	totals := map[string][2]uint64{}
+
+	r.capsule.counters.namespaces.Range(func(key, value any) bool {
+		counters := value.(*namespaceCounters)
+		allowed, denied := counters.allowed.Load(), counters.denied.Load()
+
+		stats[key.(string)] = &tenantStats{Tenant: counters.tenant, Allowed: allowed, Denied: denied}
+
+		total := totals[counters.tenant]
+		totals[counters.tenant] = [2]uint64{total[0] + allowed, total[1] + denied}
+
+		return true
+	})
+
+	updated := time.Now().UTC().Format(time.RFC3339)
+
+	for namespace, s := range stats {
+		total := totals[s.Tenant]
+		if r.published[s.Tenant] == total {
+			continue
+		}
+
+		s.TenantAllowed, s.TenantDenied, s.Updated = total[0], total[1], updated
+
+		if err := r.write(ctx, namespace, s); err != nil {
+			log.Warningf("failed to publish DNS stats to %s/%s: %v", namespace, tenantStatsName, err)
+
+			// Retried on the next tick.
+			totals[s.Tenant] = r.published[s.Tenant]
+		}
+	}
+
+	for tenant, total := range totals {
+		r.published[tenant] = total
+	}
+}
+
+// write sets the key of this replica in the stats ConfigMap of namespace,
+// creating it when missing.
+func (r *tenantStatsReporter) write(ctx context.Context, namespace string, s *tenantStats) error {
+	value, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	client := r.capsule.dnsController.client.CoreV1().ConfigMaps(namespace)
+
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"labels": map[string]string{TenantStatsLabel: "true"}},
+		"data":     map[string]string{r.name: string(value)},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Patch(ctx, tenantStatsName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	_, err = client.Create(ctx, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tenantStatsName,
+			Namespace: namespace,
+			Labels:    map[string]string{TenantStatsLabel: "true"},
+		},
+		Data: map[string]string{r.name: string(value)},
+	}, metav1.CreateOptions{})
+
+	return err
+}
@@ -0,0 +1,77 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTenantStats(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.counters.perNamespace = true
+
+	t.Setenv("POD_NAME", "coredns-0")
+
+	r := newTenantStatsReporter(h, defaultTenantStatsInterval)
+
+	record := func(src, dst int) {
+		h.counters.record(h.dnsController.Evaluate(t.Context(), cl.pods[src].Status.PodIPs[0].IP, cl.services[dst].Spec.ClusterIP, *h))
+	}
+
+	record(0, 0)
+	record(0, 1)
+	record(0, 1)
+	record(1, 1)
+
+	r.publish()
+
+	stats := func(namespace, replica string) tenantStats {
+		t.Helper()
+
+		cm, err := h.dnsController.client.CoreV1().ConfigMaps(namespace).Get(context.Background(), tenantStatsName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get stats of %s: %v", namespace, err)
+		}
+
+		if cm.Labels[TenantStatsLabel] != "true" {
+			t.Errorf("got labels %v, want %s", cm.Labels, TenantStatsLabel)
+		}
+
+		var s tenantStats
+		if err := json.Unmarshal([]byte(cm.Data[replica]), &s); err != nil {
+			t.Fatalf("failed to decode stats of %s: %v", replica, err)
+		}
+
+		return s
+	}
+
+	got := stats("tenant-0", "coredns-0")
+	if got.Tenant != "tenant-0" || got.Allowed != 1 || got.Denied != 2 || got.TenantAllowed != 1 || got.TenantDenied != 2 {
+		t.Errorf("got tenant-0 stats %+v, want allowed=1 denied=2", got)
+	}
+
+	got = stats("tenant-1", "coredns-0")
+	if got.Allowed != 1 || got.Denied != 0 {
+		t.Errorf("got tenant-1 stats %+v, want allowed=1 denied=0", got)
+	}
+
+	// Another replica adds its own key, without overwriting the first one.
+	r.name = "coredns-1"
+	r.published = map[string][2]uint64{}
+	r.publish()
+
+	if got := stats("tenant-0", "coredns-0"); got.Denied != 2 {
+		t.Errorf("got stats of coredns-0 %+v after coredns-1 published, want them kept", got)
+	}
+
+	if got := stats("tenant-0", "coredns-1"); got.Denied != 2 {
+		t.Errorf("got stats of coredns-1 %+v, want denied=2", got)
+	}
+}
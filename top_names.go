@@ -0,0 +1,134 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/coredns/coredns/request"
+)
+
+// topNamesSlack is how many more names than reported a sketch tracks, the
+// names ranked last are the least accurate.
+const topNamesSlack = 10
+
+// nameCount is how often a tenant queried a name. Count overestimates the true
+// count by at most Error.
+type nameCount struct {
+	Name   string `json:"name"`
+	Count  uint64 `json:"count"`
+	Denied uint64 `json:"denied"`
+	Error  uint64 `json:"error,omitempty"`
+}
+
+// nameSketch finds the names queried most with the Space-Saving algorithm: it
+// tracks a fixed number of names, a new name replacing the least counted one
+// and inheriting its count as error.
+type nameSketch struct {
+	mu     sync.Mutex
+	counts map[string]*nameCount
+}
+
+// topNames tracks the names each tenant queries most since the plugin started.
+type topNames struct {
+	k        int
+	capacity int
+
+	mu       sync.RWMutex
+	sketches map[string]*nameSketch
+}
+
+func newTopNames(k int) *topNames {
+	return &topNames{
+		k:        k,
+		capacity: k * topNamesSlack,
+		sketches: make(map[string]*nameSketch),
+	}
+}
+
+func (t *topNames) record(tenant, name string, denied bool) {
+	t.mu.RLock()
+	s, ok := t.sketches[tenant]
+	t.mu.RUnlock()
+
+	if !ok {
+		t.mu.Lock()
+		if s, ok = t.sketches[tenant]; !ok {
+			s = &nameSketch{counts: make(map[string]*nameCount, t.capacity)}
+			t.sketches[tenant] = s
+		}
+		t.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counts[name]
+	if !ok {
+		c = &nameCount{Name: name}
+
+		if len(s.counts) >= t.capacity {
+			var least *nameCount
+			for _, candidate := range s.counts {
+				if least == nil || candidate.Count < least.Count {
+					least = candidate
+				}
+			}
+
+			delete(s.counts, least.Name)
+
+			c.Count, c.Error = least.Count, least.Count
+		}
+
+		s.counts[name] = c
+	}
+
+	c.Count++
+	if denied {
+		c.Denied++
+	}
+}
+
+// top returns the k names queried most by each tenant, or by tenant only when
+// not empty.
+func (t *topNames) top(tenant string) map[string][]nameCount {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	top := map[string][]nameCount{}
+
+	for name, s := range t.sketches {
+		if tenant != "" && name != tenant {
+			continue
+		}
+
+		s.mu.Lock()
+		counts := make([]nameCount, 0, len(s.counts))
+		for _, c := range s.counts {
+			counts = append(counts, *c)
+		}
+		s.mu.Unlock()
+
+		slices.SortFunc(counts, func(a, b nameCount) int {
+			return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.Name, b.Name))
+		})
+
+		top[name] = counts[:min(len(counts), t.k)]
+	}
+
+	return top
+}
+
+// recordName counts the name of question for the tenant of the source of d,
+// with top_names.
+func (h *Capsule) recordName(question request.Request, d decision) {
+	if h.topNames == nil || d.srcTenant == "" {
+		return
+	}
+
+	h.topNames.record(d.srcTenant, h.reportedQName(strings.ToLower(question.Name())), !d.allowed)
+}
@@ -0,0 +1,50 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTopNames(t *testing.T) {
+	top := newTopNames(2)
+
+	for i := range 5 {
+		top.record("team-a", "api.team-a.svc.cluster.local.", false)
+
+		if i < 3 {
+			top.record("team-a", "db.team-b.svc.cluster.local.", true)
+		}
+	}
+
+	top.record("team-b", "api.team-a.svc.cluster.local.", true)
+
+	// Names queried once each overflow the sketch, without evicting the
+	// frequent ones.
+	for i := range 30 {
+		top.record("team-a", fmt.Sprintf("rare-%d.example.com.", i), false)
+	}
+
+	got := top.top("team-a")["team-a"]
+	if len(got) != 2 {
+		t.Fatalf("got %d names, want 2: %+v", len(got), got)
+	}
+
+	want := []nameCount{
+		{Name: "api.team-a.svc.cluster.local.", Count: 5},
+		{Name: "db.team-b.svc.cluster.local.", Count: 3, Denied: 3},
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got rank %d %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	all := top.top("")
+	if len(all) != 2 || len(all["team-b"]) != 1 || all["team-b"][0].Denied != 1 {
+		t.Errorf("got %+v, want both tenants", all)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// VisibilityLabel on a service or namespace picks who may resolve it, once
+// enabled with the visibility option. The label of a service takes precedence
+// over the one of its namespace.
+const VisibilityLabel = "capsule.clastix.io/dns-visibility"
+
+// Values of the VisibilityLabel.
+const (
+	// visibilityPrivate restricts resolution to the namespace itself.
+	visibilityPrivate = "private"
+	// visibilityTenant restricts resolution to the namespaces of the tenant.
+	visibilityTenant = "tenant"
+	// visibilityCluster opens resolution to every tenant.
+	visibilityCluster = "cluster"
+)
+
+// visibility returns the visibility class of obj in namespace ns, empty when
+// neither carries a valid VisibilityLabel.
+func visibility(ns *v1.Namespace, obj any) string {
+	if svc, ok := obj.(*v1.Service); ok {
+		if class := visibilityClass(svc.Labels); class != "" {
+			return class
+		}
+	}
+
+	return visibilityClass(ns.Labels)
+}
+
+func visibilityClass(set map[string]string) string {
+	switch class := set[VisibilityLabel]; class {
+	case visibilityPrivate, visibilityTenant, visibilityCluster:
+		return class
+	default:
+		return ""
+	}
+}
+
+// visibilityDecision applies the visibility class of the destination of d, and
+// reports whether it settled the decision.
+func (h *Capsule) visibilityDecision(d decision, nsTo *v1.Namespace, obj any) (decision, bool) {
+	switch visibility(nsTo, obj) {
+	case visibilityPrivate:
+		if d.srcNamespace != d.dstNamespace {
+			return d.deny(reasonPrivateVisibility).by(VisibilityLabel), true
+		}
+	case visibilityTenant:
+		if !h.sameTenant(d.srcTenant, d.dstTenant) {
+			return d.deny(reasonTenantVisibility).by(VisibilityLabel), true
+		}
+	case visibilityCluster:
+		return d.allow(reasonClusterVisibility).by(VisibilityLabel), true
+	}
+
+	return d, false
+}
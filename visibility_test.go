@@ -0,0 +1,53 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+)
+
+func TestEvaluateVisibility(t *testing.T) {
+	cl := newCluster(3, 1, 2)
+
+	// tenant-1 is shared through the namespace selector, tenant-2 is a
+	// private sibling namespace of tenant-0.
+	cl.namespaces[1].Labels["capsule.io/dns"] = "enabled"
+	cl.namespaces[2].Labels[CapsuleTenantLabel] = "tenant-0"
+	cl.namespaces[2].Labels[VisibilityLabel] = visibilityPrivate
+	cl.services[2].Labels = map[string]string{VisibilityLabel: visibilityTenant}
+	cl.services[3].Labels = map[string]string{VisibilityLabel: visibilityCluster}
+	cl.services[5].Labels = map[string]string{VisibilityLabel: visibilityTenant}
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.namespaceLabelSelector = matchLabels(map[string]string{"capsule.io/dns": "enabled"})
+
+	tests := []struct {
+		name       string
+		visibility bool
+		src        int
+		dst        int
+		allowed    bool
+		reason     string
+	}{
+		{name: "tenant service of a shared namespace", visibility: true, dst: 2, reason: reasonTenantVisibility},
+		{name: "cluster service", visibility: true, dst: 3, allowed: true, reason: reasonClusterVisibility},
+		{name: "private namespace", visibility: true, dst: 4, reason: reasonPrivateVisibility},
+		{name: "private namespace from itself", visibility: true, src: 2, dst: 4, allowed: true, reason: reasonSameTenant},
+		{name: "tenant service of a private namespace", visibility: true, dst: 5, allowed: true, reason: reasonSameTenant},
+		{name: "tenant service from another tenant", visibility: true, src: 1, dst: 5, reason: reasonTenantVisibility},
+		{name: "disabled", dst: 2, allowed: true, reason: reasonExposedNamespace},
+		{name: "disabled private namespace", dst: 4, allowed: true, reason: reasonSameTenant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.visibility = tt.visibility
+
+			d := h.dnsController.Evaluate(t.Context(), cl.pods[tt.src].Status.PodIPs[0].IP, cl.services[tt.dst].Spec.ClusterIP, *h)
+			if d.allowed != tt.allowed || d.reason != tt.reason {
+				t.Errorf("got allowed=%t reason=%s, want allowed=%t reason=%s", d.allowed, d.reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
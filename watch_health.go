@@ -0,0 +1,188 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// watchRetryWindow is how long after its last error a watch is still
+	// considered failing. Reflectors retry with a backoff capped at 30s, so
+	// a watch that keeps failing reports errors more often than that.
+	watchRetryWindow = time.Minute
+	// staleCheckInterval is how often a controller with stale_timeout checks
+	// its watches.
+	staleCheckInterval = 5 * time.Second
+)
+
+var (
+	// informerWatchErrors counts the failed lists and watches of informers.
+	informerWatchErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "informer_watch_errors_total",
+			Help:      "Number of failed lists and watches of the API server, by informer.",
+		},
+		[]string{"informer"},
+	)
+
+	// degradedMode is set while the stale_timeout fallback applies.
+	degradedMode = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: plugin.Namespace,
+			Subsystem: pluginName,
+			Name:      "degraded",
+			Help:      "Whether the stale_timeout fallback applies, the watches of the API server failing for too long.",
+		},
+	)
+)
+
+// watchState is the health of the watch of an informer.
+type watchState struct {
+	// resourceVersion returns the resource version the informer is at.
+	resourceVersion func() string
+	// failingSince is when the errors of the current outage started, zero
+	// before the first error.
+	failingSince time.Time
+	lastError    time.Time
+	// version is the resource version the informer was at on the last
+	// error, a newer one means the watch delivered since.
+	version string
+}
+
+// failing reports whether the watch has kept failing up to now.
+func (s *watchState) failing(now time.Time) bool {
+	return !s.failingSince.IsZero() && now.Sub(s.lastError) < watchRetryWindow &&
+		s.resourceVersion() == s.version
+}
+
+// watchHealth tracks the watches of an informer set. Reflectors retry failing
+// lists and watches forever while the caches keep what they last received, so
+// the controller stays synced while the caches go stale.
+type watchHealth struct {
+	mu      sync.Mutex
+	watches map[string]*watchState
+}
+
+func newWatchHealth() *watchHealth {
+	return &watchHealth{watches: map[string]*watchState{}}
+}
+
+// track records the watch errors of informer under name. It has to be called
+// before the informer starts.
+func (w *watchHealth) track(informer cache.SharedIndexInformer, name string) error {
+	failures := informerWatchErrors.WithLabelValues(name)
+
+	return informer.SetWatchErrorHandlerWithContext(func(ctx context.Context, r *cache.Reflector, err error) {
+		cache.DefaultWatchErrorHandler(ctx, r, err)
+
+		// Watches closed by the API server, or expired and resumed from a
+		// relist, are routine.
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+			apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+			return
+		}
+
+		failures.Inc()
+		w.failed(name, informer.LastSyncResourceVersion, time.Now())
+	})
+}
+
+func (w *watchHealth) failed(name string, resourceVersion func() string, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s, ok := w.watches[name]
+	if !ok {
+		s = &watchState{resourceVersion: resourceVersion}
+		w.watches[name] = s
+	}
+
+	if !s.failing(now) {
+		s.failingSince = now
+	}
+
+	s.lastError = now
+	s.version = resourceVersion()
+}
+
+// stale returns for how long the watch failing the longest has been failing,
+// and its name, or zero when every watch is healthy.
+func (w *watchHealth) stale(now time.Time) (time.Duration, string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var (
+		longest time.Duration
+		name    string
+	)
+
+	for n, s := range w.watches {
+		if !s.failing(now) {
+			continue
+		}
+
+		if d := now.Sub(s.failingSince); d > longest || name == "" {
+			longest, name = d, n
+		}
+	}
+
+	return longest, name
+}
+
+// watchStaleness switches the controller to degraded once a watch has been
+// failing for staleTimeout, and back once every watch recovered, until the
+// controller stops.
+func (d *dnsController) watchStaleness() {
+	ticker := time.NewTicker(staleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.checkStaleness(time.Now())
+		case <-d.stopCh:
+			if d.degraded.Swap(false) {
+				degradedMode.Set(0)
+			}
+
+			return
+		}
+	}
+}
+
+func (d *dnsController) checkStaleness(now time.Time) {
+	failing, name := d.informers.watches.stale(now)
+	degraded := name != "" && failing >= d.staleTimeout
+
+	if d.degraded.Swap(degraded) == degraded {
+		return
+	}
+
+	if degraded {
+		log.Warningf("%s watch failing for %s, applying the stale_timeout fallback", name, failing.Round(time.Second))
+		degradedMode.Set(1)
+	} else {
+		log.Infof("watches recovered, leaving the stale_timeout fallback")
+		degradedMode.Set(0)
+	}
+}
+
+// Degraded reports whether a watch of the API server has been failing for
+// longer than stale_timeout, the caches being stale.
+func (d *dnsController) Degraded() bool {
+	return d.degraded.Load()
+}
@@ -0,0 +1,127 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestWatchHealth(t *testing.T) {
+	start := time.Now()
+	version := "1"
+	resourceVersion := func() string { return version }
+
+	w := newWatchHealth()
+	d := &dnsController{informers: &informerSet{watches: w}, staleTimeout: time.Minute}
+
+	check := func(at time.Duration, wantFailing time.Duration, wantDegraded bool) {
+		t.Helper()
+
+		if failing, _ := w.stale(start.Add(at)); failing != wantFailing {
+			t.Errorf("at %s: got failing for %s, want %s", at, failing, wantFailing)
+		}
+
+		d.checkStaleness(start.Add(at))
+
+		if d.Degraded() != wantDegraded {
+			t.Errorf("at %s: got degraded %t, want %t", at, d.Degraded(), wantDegraded)
+		}
+	}
+
+	check(0, 0, false)
+
+	// The watch keeps failing, retried every 30s.
+	for at := time.Duration(0); at <= 90*time.Second; at += 30 * time.Second {
+		w.failed("pods", resourceVersion, start.Add(at))
+	}
+
+	check(45*time.Second, 45*time.Second, false)
+	check(100*time.Second, 100*time.Second, true)
+
+	// No error for longer than the retry window: the watch resumed.
+	check(90*time.Second+watchRetryWindow, 0, false)
+
+	// A new outage starts over.
+	w.failed("pods", resourceVersion, start.Add(200*time.Second))
+	w.failed("pods", resourceVersion, start.Add(230*time.Second))
+	w.failed("pods", resourceVersion, start.Add(260*time.Second))
+	check(265*time.Second, 65*time.Second, true)
+
+	// The informer received a newer version: the watch resumed.
+	version = "2"
+	check(270*time.Second, 0, false)
+}
+
+func TestServeDNSDegraded(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.dnsController.degraded.Store(true)
+
+	tests := []struct {
+		fallback string
+		answer   string
+	}{
+		{fallback: syncFallbackPassthrough, answer: cl.services[1].Spec.ClusterIP},
+		{fallback: syncFallbackDeny},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fallback, func(t *testing.T) {
+			h.staleFallback = tt.fallback
+
+			m := new(dns.Msg)
+			m.SetQuestion(cl.services[1].Name+"."+cl.services[1].Namespace+".svc."+testZone, dns.TypeA)
+
+			rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: cl.pods[0].Status.PodIPs[0].IP})
+
+			if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+				t.Fatalf("ServeDNS failed: %v", err)
+			}
+
+			var answer string
+			if len(rec.Msg.Answer) > 0 {
+				if a, ok := rec.Msg.Answer[0].(*dns.A); ok {
+					answer = a.A.String()
+				}
+			}
+
+			if answer != tt.answer {
+				t.Errorf("got answer %q, want %q", answer, tt.answer)
+			}
+		})
+	}
+}
+
+func TestServeDNSDegradedPredecessor(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+	h.staleFallback = syncFallbackDeny
+
+	// A reload onto a controller yet to sync keeps answering from the
+	// degraded one it replaces.
+	prev := h.dnsController
+	prev.degraded.Store(true)
+
+	h.dnsController = &dnsController{}
+	h.dnsController.predecessor.Store(prev)
+
+	m := new(dns.Msg)
+	m.SetQuestion(cl.services[0].Name+"."+cl.services[0].Namespace+".svc."+testZone, dns.TypeA)
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: cl.pods[0].Status.PodIPs[0].IP})
+
+	if _, err := h.ServeDNS(context.Background(), rec, m); err != nil {
+		t.Fatalf("ServeDNS failed: %v", err)
+	}
+
+	if len(rec.Msg.Answer) > 0 {
+		t.Errorf("got answer %v from the degraded predecessor, want it blocked", rec.Msg.Answer)
+	}
+}
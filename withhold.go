@@ -0,0 +1,76 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"strings"
+	"unicode"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// tenantsResource is the Capsule Tenant custom resource.
+var tenantsResource = schema.GroupVersionResource{
+	Group:    "capsule.clastix.io",
+	Version:  "v1beta2",
+	Resource: "tenants",
+}
+
+// WithholdNamespacesAnnotation on a Tenant lists, separated by commas, the
+// namespaces the exposure selectors must not open to that tenant.
+const WithholdNamespacesAnnotation = "capsule.clastix.io/dns-withhold-namespaces"
+
+// tenant is the part of a Tenant the controller keeps.
+type tenant struct {
+	metav1.ObjectMeta
+
+	withheld map[string]bool
+	// namespaces are the namespaces of the Tenant, as listed in its status.
+	namespaces []string
+}
+
+// slimTenant converts the unstructured Tenants of the dynamic informer.
+func slimTenant(obj any) (any, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return obj, nil
+	}
+
+	t := &tenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            u.GetName(),
+			UID:             u.GetUID(),
+			ResourceVersion: u.GetResourceVersion(),
+		},
+	}
+
+	value := u.GetAnnotations()[WithholdNamespacesAnnotation]
+	for _, ns := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	}) {
+		if t.withheld == nil {
+			t.withheld = map[string]bool{}
+		}
+
+		t.withheld[ns] = true
+	}
+
+	t.namespaces, _, _ = unstructured.NestedStringSlice(u.Object, "status", "namespaces")
+
+	return t, nil
+}
+
+// withheld reports whether the Tenant named srcTenant withholds namespace ns.
+func (c *dnsController) withheld(srcTenant, ns string) bool {
+	obj, exists, err := c.tenantInformer.GetStore().GetByKey(srcTenant)
+	if err != nil || !exists {
+		return false
+	}
+
+	t, ok := obj.(*tenant)
+
+	return ok && t.withheld[ns]
+}
@@ -0,0 +1,73 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEvaluateWithheldNamespace(t *testing.T) {
+	cl := newCluster(3, 1, 1)
+	cl.namespaces[2].Labels["capsule.io/dns"] = "enabled"
+
+	// tenant-0 withholds the shared namespace, its own one is ignored.
+	withholding := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "capsule.clastix.io/v1beta2",
+		"kind":       "Tenant",
+		"metadata": map[string]any{
+			"name":        "tenant-0",
+			"annotations": map[string]any{WithholdNamespacesAnnotation: "tenant-0, tenant-2"},
+		},
+	}}
+
+	set, err := newInformerSet(fake.NewClientset(cl.objects()...), apiConfig{})
+	if err != nil {
+		t.Fatalf("failed to create informers: %v", err)
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{tenantsResource: "TenantList"}, withholding)
+	set.dynamic = dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
+
+	ctrl, err := newDNSControllerForSet(set, dnsControllerOptions{withholdNamespaces: true})
+	if err != nil {
+		t.Fatalf("failed to create DNS controller: %v", err)
+	}
+
+	go ctrl.Start()
+	t.Cleanup(ctrl.Stop)
+
+	waitForSync(t, ctrl)
+
+	h := Capsule{namespaceLabelSelector: matchLabels(map[string]string{"capsule.io/dns": "enabled"})}
+
+	tests := []struct {
+		name    string
+		src     int
+		dst     int
+		allowed bool
+		reason  string
+	}{
+		{name: "withheld", src: 0, dst: 2, reason: reasonWithheldNamespace},
+		{name: "other tenant", src: 1, dst: 2, allowed: true, reason: reasonExposedNamespace},
+		{name: "own namespace", src: 0, dst: 0, allowed: true, reason: reasonSameTenant},
+		{name: "not withheld", src: 0, dst: 1, reason: reasonCrossTenant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := ctrl.Evaluate(t.Context(), cl.pods[tt.src].Status.PodIPs[0].IP, cl.services[tt.dst].Spec.ClusterIP, h)
+			if d.allowed != tt.allowed || d.reason != tt.reason {
+				t.Errorf("got allowed=%t reason=%s, want allowed=%t reason=%s", d.allowed, d.reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
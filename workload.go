@@ -0,0 +1,59 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// controllerRef returns the ownerReference of the controller among refs, the
+// only one slimPod keeps.
+func controllerRef(refs []metav1.OwnerReference) []metav1.OwnerReference {
+	for _, ref := range refs {
+		if ref.Controller != nil && *ref.Controller {
+			return []metav1.OwnerReference{{
+				APIVersion: ref.APIVersion,
+				Kind:       ref.Kind,
+				Name:       ref.Name,
+				UID:        ref.UID,
+				Controller: ref.Controller,
+			}}
+		}
+	}
+
+	return nil
+}
+
+// podWorkload returns the kind and name of the workload running pod, empty
+// for pods without a controller. ReplicaSets are traced back to their
+// Deployment from the pod-template-hash suffix the Deployment controller
+// names them with, without watching ReplicaSets.
+func podWorkload(pod *v1.Pod) (kind, name string) {
+	ref := metav1.GetControllerOfNoCopy(pod)
+	if ref == nil {
+		return "", ""
+	}
+
+	if ref.Kind == "ReplicaSet" {
+		hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		if prefix, ok := strings.CutSuffix(ref.Name, hash); ok && hash != "" && strings.HasSuffix(prefix, "-") {
+			return "Deployment", prefix[:len(prefix)-1]
+		}
+	}
+
+	return ref.Kind, ref.Name
+}
+
+// workload formats the workload of a decision source as kind/name.
+func (d decision) workload() string {
+	if d.srcWorkloadKind == "" {
+		return ""
+	}
+
+	return d.srcWorkloadKind + "/" + d.srcWorkloadName
+}
@@ -0,0 +1,87 @@
+// Copyright 2025-2026 PITREL Corentin
+// SPDX-License-Identifier: Apache-2.0
+
+package capsule_coredns
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func ownedPod(kind, name, hash string) *v1.Pod {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod"}}
+
+	if hash != "" {
+		pod.Labels = map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: hash}
+	}
+
+	if kind != "" {
+		pod.OwnerReferences = []metav1.OwnerReference{
+			{APIVersion: "v1", Kind: "Node", Name: "node-1"},
+			{APIVersion: "apps/v1", Kind: kind, Name: name, Controller: ptr.To(true)},
+		}
+	}
+
+	return pod
+}
+
+func TestPodWorkload(t *testing.T) {
+	tests := []struct {
+		name     string
+		pod      *v1.Pod
+		wantKind string
+		wantName string
+	}{
+		{name: "no controller", pod: ownedPod("", "", "")},
+		{name: "deployment", pod: ownedPod("ReplicaSet", "web-7d4b9c", "7d4b9c"), wantKind: "Deployment", wantName: "web"},
+		{name: "bare replicaset", pod: ownedPod("ReplicaSet", "web", ""), wantKind: "ReplicaSet", wantName: "web"},
+		{name: "foreign hash", pod: ownedPod("ReplicaSet", "web7d4b9c", "7d4b9c"), wantKind: "ReplicaSet", wantName: "web7d4b9c"},
+		{name: "statefulset", pod: ownedPod("StatefulSet", "db", ""), wantKind: "StatefulSet", wantName: "db"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The informer only holds pods as slimPod leaves them.
+			slim, err := slimPod(tt.pod)
+			if err != nil {
+				t.Fatalf("slimPod failed: %v", err)
+			}
+
+			//nolint:forcetypeassert
+			kind, name := podWorkload(slim.(*v1.Pod))
+			if kind != tt.wantKind || name != tt.wantName {
+				t.Errorf("got %s/%s, want %s/%s", kind, name, tt.wantKind, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestEvaluateSourceWorkload(t *testing.T) {
+	cl := newCluster(2, 1, 1)
+	cl.pods[0].Labels = map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "5f6c8"}
+	cl.pods[0].OwnerReferences = []metav1.OwnerReference{
+		{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-5f6c8", Controller: ptr.To(true)},
+	}
+
+	h := newTestCapsule(t, cl, dnsControllerOptions{})
+
+	d := h.dnsController.Evaluate(t.Context(), cl.pods[0].Status.PodIPs[0].IP, cl.services[1].Spec.ClusterIP, *h)
+	if d.srcPod != cl.pods[0].Name || d.workload() != "Deployment/web" {
+		t.Errorf("got source %s of %q, want %s of Deployment/web", d.srcPod, d.workload(), cl.pods[0].Name)
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(cl.services[1].Name+"."+cl.services[1].Namespace+".svc."+testZone, dns.TypeA)
+
+	question := request.Request{W: &test.ResponseWriter{RemoteIP: cl.pods[0].Status.PodIPs[0].IP}, Req: m}
+	if ev := newAuditEvent(question, cl.services[1].Spec.ClusterIP, d); ev.SrcWorkload != "Deployment/web" {
+		t.Errorf("got audit src_workload %q, want Deployment/web", ev.SrcWorkload)
+	}
+}